@@ -9,6 +9,7 @@ import (
 
 	"github.com/bitrise-io/go-utils/command"
 	"github.com/bitrise-io/go-utils/command/git"
+	"github.com/bitrise-io/stepman/internal/httpconfig"
 	"github.com/bitrise-io/stepman/stepid"
 	"github.com/bitrise-io/stepman/stepman"
 )
@@ -30,6 +31,7 @@ func ActivateGitRefStep(
 	} else {
 		cloneCmd = repo.CloneTagOrBranch(id.IDorURI, id.Version, "--depth=1")
 	}
+	httpconfig.ConfigureGit(cloneCmd, id.IDorURI)
 	if out, err := cloneCmd.RunAndReturnTrimmedCombinedOutput(); err != nil {
 		if strings.HasPrefix(id.IDorURI, "git@") {
 			log.Warnf(`Note: if the step's repository is an open source one,
@@ -0,0 +1,21 @@
+package activator
+
+import "github.com/bitrise-io/stepman/internal/httpfetch"
+
+// HTTPSummary sums up stepman's HTTP requests by kind (inventory fetches,
+// conditional revalidations, downloads), with their failures, retries, bytes
+// and durations, and the files served from the inventory cache instead.
+type HTTPSummary = httpfetch.Summary
+
+// HTTPOp is the kind of an HTTP request, the key of HTTPSummary.Ops.
+type HTTPOp = httpfetch.Op
+
+// HTTPOpSummary sums up the HTTP requests of an HTTPOp.
+type HTTPOpSummary = httpfetch.OpSummary
+
+// HTTPMetrics returns the HTTP request counters of the steps activated in
+// this process so far, e.g. for build metrics. Set STEPMAN_HTTP_TRACE to the
+// path of a file to get every request as a JSON line too.
+func HTTPMetrics() HTTPSummary {
+	return httpfetch.Totals()
+}
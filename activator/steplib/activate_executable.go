@@ -1,18 +1,17 @@
 package steplib
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
 	"errors"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/stepman/internal/httpfetch"
+	"github.com/bitrise-io/stepman/internal/integrity"
+	"github.com/bitrise-io/stepman/internal/stepstorage"
 	"github.com/bitrise-io/stepman/models"
-	"github.com/hashicorp/go-retryablehttp"
 )
 
 func activateStepExecutable(
@@ -20,40 +19,17 @@ func activateStepExecutable(
 	executable models.Executable,
 	destinationDir string,
 ) (string, error) {
-	body, err := downloadExecutable(executable)
-	if err != nil {
-		return "", err
-	}
-	defer func() {
-		if err := body.Close(); err != nil {
-			log.Warnf("Failed to close response body: %s\n", err)
-		}
-	}()
-
-	err = os.MkdirAll(destinationDir, 0755)
-	if err != nil {
-		return "", fmt.Errorf("create directory %s: %w", destinationDir, err)
-	}
-
 	path := filepath.Join(destinationDir, stepID)
-	file, err := os.Create(path)
-	if err != nil {
-		return "", fmt.Errorf("create file %s: %w", path, err)
-	}
-	defer func() {
-		err := file.Close()
-		if err != nil {
-			log.Warnf("Failed to close file %s: %s\n", path, err)
-		}
-	}()
-
-	_, err = io.Copy(file, body)
+	err := downloadExecutable(executable, path)
 	if err != nil {
-		return "", fmt.Errorf("download to %s: %w", path, err)
+		return "", err
 	}
 
 	err = validateHash(path, executable.Hash)
 	if err != nil {
+		if err := os.Remove(path); err != nil {
+			log.Warnf("Failed to remove file %s: %s\n", path, err)
+		}
 		return "", fmt.Errorf("validate hash: %s", err)
 	}
 
@@ -66,85 +42,55 @@ func activateStepExecutable(
 }
 
 func validateHash(filePath string, expectedHash string) error {
-	if expectedHash == "" {
-		return fmt.Errorf("hash is empty")
-	}
-
-	if !strings.HasPrefix(expectedHash, "sha256-") {
-		return fmt.Errorf("only SHA256 hashes supported at this time, make sure to prefix the hash with `sha256-`. Found hash value: %s", expectedHash)
-	}
-
-	expectedHash = strings.TrimPrefix(expectedHash, "sha256-")
-
-	reader, err := os.Open(filePath)
+	expected, err := integrity.Parse(expectedHash)
 	if err != nil {
 		return err
 	}
-
-	h := sha256.New()
-	_, err = io.Copy(h, reader)
-	if err != nil {
-		return fmt.Errorf("calculate hash: %w", err)
-	}
-	actualHash := hex.EncodeToString(h.Sum(nil))
-	if actualHash != expectedHash {
-		return fmt.Errorf("hash mismatch: expected sha256-%s, got sha256-%s", expectedHash, actualHash)
-	}
-	return nil
+	return integrity.VerifyFile(expected, filePath)
 }
 
-func buildDownloadURLs(bases []string, executable models.Executable) ([]string, error) {
-	uri := strings.TrimLeft(executable.StorageURI, "/")
-	var urls []string
-	for _, base := range bases {
-		base = strings.TrimRight(strings.TrimSpace(base), "/")
-		if base == "" {
-			continue
-		}
-		url := fmt.Sprintf("%s/%s", base, uri)
-		if strings.HasPrefix(url, "http://") {
-			return nil, fmt.Errorf("http URL is unsupported, please use https: %s", url)
-		}
-		urls = append(urls, url)
-	}
-
-	if len(urls) == 0 {
-		return nil, fmt.Errorf("no storage URLs configured")
+func downloadExecutable(executable models.Executable, destPath string) error {
+	urls, err := stepstorage.ExecutableURLs(stepstorage.BaseURLs(), executable)
+	if err != nil {
+		return err
 	}
-	return urls, nil
+	return downloadFromURLs(urls, destPath)
 }
 
-func downloadExecutable(executable models.Executable) (io.ReadCloser, error) {
-	bases := precompiledStepsDefaultStorageURLs
-	if override := os.Getenv(precompiledStepsStorageURLsEnv); override != "" {
-		bases = strings.Split(override, ",")
-	}
+// downloadFromURLs downloads the first of urls that succeeds to destPath, or
+// the first to respond when stepstorage.HedgeDelayEnv is set. An interrupted
+// download is kept alongside destPath and resumed by the next activation, if
+// the storage supports it (see httpfetch.Client.Download).
+func downloadFromURLs(urls []string, destPath string) error {
+	client := httpfetch.NewClient(log.NewDefaultLogger(false))
 
-	urls, err := buildDownloadURLs(bases, executable)
+	hedgeDelay, err := stepstorage.HedgeDelay()
 	if err != nil {
-		return nil, err
+		log.Warnf("%s, downloading from one storage URL at a time\n", err)
+	}
+	if hedgeDelay > 0 && len(urls) > 1 {
+		hedge := httpfetch.Hedge{Delay: hedgeDelay, Latencies: httpfetch.SessionLatencies()}
+		if err := client.DownloadHedged(context.Background(), destPath, urls, "", hedge); err != nil {
+			return fmt.Errorf("failed to download executable: %w", err)
+		}
+		return nil
 	}
-	return downloadFromURLs(urls)
-}
 
-func downloadFromURLs(urls []string) (io.ReadCloser, error) {
 	var errs []error
 	for _, url := range urls {
-		resp, err := retryablehttp.Get(url)
-		if err == nil && resp.StatusCode < 400 {
-			return resp.Body, nil
+		err := client.Download(context.Background(), destPath, url)
+		if err == nil {
+			return nil
 		}
 
-		if err != nil {
+		var statusErr *httpfetch.StatusError
+		if errors.As(err, &statusErr) {
+			log.Warnf("Storage returned status %d for %s\n", statusErr.Code, url)
+			errs = append(errs, fmt.Errorf("%s: status %d", url, statusErr.Code))
+		} else {
 			log.Warnf("Failed to download step from %s: %s\n", url, err)
 			errs = append(errs, fmt.Errorf("%s: %w", url, err))
-		} else {
-			if closeErr := resp.Body.Close(); closeErr != nil {
-				log.Warnf("Failed to close response body: %s\n", closeErr)
-			}
-			log.Warnf("Storage returned status %d for %s\n", resp.StatusCode, url)
-			errs = append(errs, fmt.Errorf("%s: status %d", url, resp.StatusCode))
 		}
 	}
-	return nil, fmt.Errorf("failed to download executable: %w", errors.Join(errs...))
+	return fmt.Errorf("failed to download executable: %w", errors.Join(errs...))
 }
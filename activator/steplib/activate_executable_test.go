@@ -2,12 +2,14 @@ package steplib
 
 import (
 	"fmt"
-	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
-	"github.com/bitrise-io/stepman/models"
+	"github.com/bitrise-io/stepman/internal/stepstorage"
 	"github.com/stretchr/testify/require"
 )
 
@@ -24,16 +26,34 @@ func TestValidateHash(t *testing.T) {
 			expectedHash: "sha256-f2040af3939f5033be8ca9b363055b3e53107c4688ba39b71d4529869a9cc9b2",
 			expectedErr:  nil,
 		},
+		{
+			name:         "Valid SRI hash",
+			filePath:     "testdata/file.txt",
+			expectedHash: "sha256-8gQK85OfUDO+jKmzYwVbPlMQfEaIujm3HUUphpqcybI=",
+			expectedErr:  nil,
+		},
+		{
+			name:         "Valid multiple digests",
+			filePath:     "testdata/file.txt",
+			expectedHash: "sha384-M7G5scHuhce5TDMHJLR6Z0Yn9QitKJKRa1Yvdan6WrvsEZ1SV6BT4mG2JZti7QNT sha512-iQXXdGz+nXnXl5tSobPeqkId04fM86x0BQBtIW7HJ/bvuqee84hw5Su48TTGxOXKzORfGPmL1VBuStoK+D12lQ==",
+			expectedErr:  nil,
+		},
 		{
 			name:         "Hash mismatch",
 			filePath:     "testdata/file.txt",
-			expectedHash: "sha256-1234567890abcdef",
-			expectedErr:  fmt.Errorf("hash mismatch: expected sha256-1234567890abcdef, got sha256-f2040af3939f5033be8ca9b363055b3e53107c4688ba39b71d4529869a9cc9b2"),
+			expectedHash: "sha256-0000000000000000000000000000000000000000000000000000000000000000",
+			expectedErr:  fmt.Errorf("hash mismatch: expected sha256-0000000000000000000000000000000000000000000000000000000000000000, got sha256-f2040af3939f5033be8ca9b363055b3e53107c4688ba39b71d4529869a9cc9b2"),
+		},
+		{
+			name:         "One of multiple digests mismatches",
+			filePath:     "testdata/file.txt",
+			expectedHash: "sha256-8gQK85OfUDO+jKmzYwVbPlMQfEaIujm3HUUphpqcybI= sha384-AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA",
+			expectedErr:  fmt.Errorf("hash mismatch: expected sha384-AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA, got sha384-M7G5scHuhce5TDMHJLR6Z0Yn9QitKJKRa1Yvdan6WrvsEZ1SV6BT4mG2JZti7QNT"),
 		},
 		{
 			name:         "Nonexistent file",
 			filePath:     "testdata/nonexistent.txt",
-			expectedHash: "sha256-3b6b4f1e2e8b8a9e4f7a4b5e6c7d8e9f",
+			expectedHash: "sha256-f2040af3939f5033be8ca9b363055b3e53107c4688ba39b71d4529869a9cc9b2",
 			expectedErr:  fmt.Errorf("open testdata/nonexistent.txt: no such file or directory"),
 		},
 		{
@@ -42,11 +62,17 @@ func TestValidateHash(t *testing.T) {
 			expectedHash: "",
 			expectedErr:  fmt.Errorf("hash is empty"),
 		},
+		{
+			name:         "Malformed hash",
+			filePath:     "testdata/file.txt",
+			expectedHash: "sha256-1234567890abcdef",
+			expectedErr:  fmt.Errorf(`invalid digest "sha256-1234567890abcdef": expected the 32-byte sha256 sum in hex or base64`),
+		},
 		{
 			name:         "Invalid hash type",
 			filePath:     "testdata/file.txt",
 			expectedHash: "md5-3b6b4f1e2e8b8a9e4f7a4b5e6c7d8e9f",
-			expectedErr:  fmt.Errorf("only SHA256 hashes supported at this time, make sure to prefix the hash with `sha256-`. Found hash value: md5-3b6b4f1e2e8b8a9e4f7a4b5e6c7d8e9f"),
+			expectedErr:  fmt.Errorf(`invalid digest "md5-3b6b4f1e2e8b8a9e4f7a4b5e6c7d8e9f": unsupported algorithm "md5", expected sha256, sha384 or sha512`),
 		},
 	}
 
@@ -63,90 +89,6 @@ func TestValidateHash(t *testing.T) {
 	}
 }
 
-func TestBuildDownloadURLs(t *testing.T) {
-	tests := []struct {
-		name         string
-		bases        []string
-		executable   models.Executable
-		expectedURLs []string
-		expectedErr  error
-	}{
-		{
-			name:  "Default list: steplib.bitrise.io first, GCS second",
-			bases: precompiledStepsDefaultStorageURLs,
-			executable: models.Executable{
-				StorageURI: "steps/step1.tar.gz",
-			},
-			expectedURLs: []string{
-				"https://steplib.bitrise.io/steps/step1.tar.gz",
-				"https://storage.googleapis.com/bitrise-steplib-storage/steps/step1.tar.gz",
-			},
-		},
-		{
-			name:  "Multiple bases",
-			bases: []string{"https://a.example.com", "https://b.example.com"},
-			executable: models.Executable{
-				StorageURI: "steps/step2.tar.gz",
-			},
-			expectedURLs: []string{
-				"https://a.example.com/steps/step2.tar.gz",
-				"https://b.example.com/steps/step2.tar.gz",
-			},
-		},
-		{
-			name:  "URL normalization: trailing slashes and leading StorageURI slash",
-			bases: []string{"https://a.example.com/// ", " https://b.example.com///"},
-			executable: models.Executable{
-				StorageURI: "/steps/step3.tar.gz",
-			},
-			expectedURLs: []string{
-				"https://a.example.com/steps/step3.tar.gz",
-				"https://b.example.com/steps/step3.tar.gz",
-			},
-		},
-		{
-			name:  "Input parsing: spaces and empty entries",
-			bases: []string{"", " https://a.example.com ", "", " https://b.example.com ", ""},
-			executable: models.Executable{
-				StorageURI: "steps/step4.tar.gz",
-			},
-			expectedURLs: []string{
-				"https://a.example.com/steps/step4.tar.gz",
-				"https://b.example.com/steps/step4.tar.gz",
-			},
-		},
-		{
-			name:  "http URL is rejected",
-			bases: []string{"http://a.example.com"},
-			executable: models.Executable{
-				StorageURI: "steps/step5.tar.gz",
-			},
-			expectedErr: fmt.Errorf("http URL is unsupported, please use https: http://a.example.com/steps/step5.tar.gz"),
-		},
-		{
-			name:  "All-empty list yields a configuration error",
-			bases: []string{"", "", ""},
-			executable: models.Executable{
-				StorageURI: "steps/step6.tar.gz",
-			},
-			expectedErr: fmt.Errorf("no storage URLs configured"),
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got, err := buildDownloadURLs(tt.bases, tt.executable)
-			if tt.expectedErr != nil {
-				require.EqualError(t, err, tt.expectedErr.Error())
-			} else {
-				require.NoError(t, err)
-				require.Equal(t, tt.expectedURLs, got)
-			}
-		})
-	}
-}
-
-
 func TestDownloadFromURLs(t *testing.T) {
 	t.Run("primary succeeds, secondary is not called", func(t *testing.T) {
 		secondaryHits := 0
@@ -159,11 +101,11 @@ func TestDownloadFromURLs(t *testing.T) {
 		}))
 		defer secondary.Close()
 
-		body, err := downloadFromURLs([]string{primary.URL, secondary.URL})
+		dest := filepath.Join(t.TempDir(), "step")
+		err := downloadFromURLs([]string{primary.URL, secondary.URL}, dest)
 		require.NoError(t, err)
-		defer func() { _ = body.Close() }()
 
-		b, err := io.ReadAll(body)
+		b, err := os.ReadFile(dest)
 		require.NoError(t, err)
 		require.Equal(t, "from primary", string(b))
 		require.Equal(t, 0, secondaryHits)
@@ -179,11 +121,11 @@ func TestDownloadFromURLs(t *testing.T) {
 		}))
 		defer secondary.Close()
 
-		body, err := downloadFromURLs([]string{primary.URL, secondary.URL})
+		dest := filepath.Join(t.TempDir(), "step")
+		err := downloadFromURLs([]string{primary.URL, secondary.URL}, dest)
 		require.NoError(t, err)
-		defer func() { _ = body.Close() }()
 
-		b, err := io.ReadAll(body)
+		b, err := os.ReadFile(dest)
 		require.NoError(t, err)
 		require.Equal(t, "from secondary", string(b))
 	})
@@ -198,12 +140,38 @@ func TestDownloadFromURLs(t *testing.T) {
 		}))
 		defer secondary.Close()
 
-		_, err := downloadFromURLs([]string{primary.URL, secondary.URL})
+		dest := filepath.Join(t.TempDir(), "step")
+		err := downloadFromURLs([]string{primary.URL, secondary.URL}, dest)
 		require.Error(t, err)
+		require.NoFileExists(t, dest)
 		require.Contains(t, err.Error(), "failed to download executable")
 		require.Contains(t, err.Error(), primary.URL)
 		require.Contains(t, err.Error(), "status 404")
 		require.Contains(t, err.Error(), secondary.URL)
 		require.Contains(t, err.Error(), "status 403")
 	})
+
+	t.Run("hedged: a slow primary loses to the secondary", func(t *testing.T) {
+		t.Setenv(stepstorage.HedgeDelayEnv, "20ms")
+		primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(time.Minute):
+				_, _ = w.Write([]byte("from primary"))
+			case <-r.Context().Done():
+			}
+		}))
+		defer primary.Close()
+		secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("from secondary"))
+		}))
+		defer secondary.Close()
+
+		dest := filepath.Join(t.TempDir(), "step")
+		err := downloadFromURLs([]string{primary.URL, secondary.URL}, dest)
+		require.NoError(t, err)
+
+		b, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		require.Equal(t, "from secondary", string(b))
+	})
 }
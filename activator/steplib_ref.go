@@ -3,14 +3,56 @@ package activator
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/bitrise-io/go-utils/pointers"
 	"github.com/bitrise-io/stepman/activator/steplib"
+	"github.com/bitrise-io/stepman/internal/steplock"
 	"github.com/bitrise-io/stepman/models"
 	"github.com/bitrise-io/stepman/stepid"
+	"github.com/bitrise-io/stepman/steplibrary"
 	"github.com/bitrise-io/stepman/stepman"
 )
 
+// libraryResolver resolves bare step IDs against the steplib search path. It
+// lives as long as the process, so each library of the path is read once.
+var libraryResolver = sync.OnceValue(func() *stepman.LibraryResolver {
+	return stepman.NewLibraryResolver(steplibrary.NewInventoryReader())
+})
+
+// ResolveCanonicalID is stepid.CreateCanonicalIDFromString which resolves a
+// step ID without a source against the steplib search path, if one is
+// configured (see stepman.SearchPathEnvKey): to the first library of the path
+// containing the step, with defaultStepLibSource as the last layer.
+//
+// It is the entry point of the search path: a CanonicalID carries no trace of
+// whether its source was written out or defaulted, so the step references of a
+// build must be parsed with it, not with stepid.CreateCanonicalIDFromString,
+// before they are passed to ActivateSteplibRefStep. stepman lock parses with it
+// too, so the libraries recorded in stepman.lock are the ones activation looks
+// up.
+func ResolveCanonicalID(log stepman.Logger, compositeVersionStr, defaultStepLibSource string) (stepid.CanonicalID, error) {
+	searchPath := stepman.SearchPath(defaultStepLibSource)
+	if len(searchPath) == 0 || stepid.HasSource(compositeVersionStr) {
+		return stepid.CreateCanonicalIDFromString(compositeVersionStr, defaultStepLibSource)
+	}
+
+	// Any library of the path will do as the default, it's replaced below.
+	id, err := stepid.CreateCanonicalIDFromString(compositeVersionStr, searchPath[0])
+	if err != nil {
+		return stepid.CanonicalID{}, err
+	}
+	library, err := libraryResolver().Resolve(searchPath, id.IDorURI, log)
+	if err != nil {
+		return stepid.CanonicalID{}, fmt.Errorf("resolve library of %s: %w", compositeVersionStr, err)
+	}
+	id.SteplibSource = library
+	return id, nil
+}
+
+// ActivateSteplibRefStep activates the steplib step id. A bare step ID must
+// have been resolved against the search path already (see ResolveCanonicalID).
 func ActivateSteplibRefStep(
 	log stepman.Logger,
 	id stepid.CanonicalID,
@@ -53,12 +95,23 @@ func prepareStepLibForActivation(
 	didStepLibUpdateInWorkflow bool,
 	isOfflineMode bool,
 ) (stepInfo models.StepInfoModel, didUpdate bool, err error) {
-	err = stepman.SetupLibrary(id.SteplibSource, log)
+	err = stepman.SetupLibraryWithReader(id.SteplibSource, steplibrary.NewInventoryReader(), log)
 	if err != nil {
 		return models.StepInfoModel{}, false, fmt.Errorf("setup %s: %s", id.SteplibSource, err)
 	}
 
-	versionConstraint, err := models.ParseRequiredVersion(id.Version)
+	lockfile, _, err := steplock.Load()
+	if err != nil {
+		return models.StepInfoModel{}, false, err
+	}
+	lock, isLocked := lockfile.Find(id)
+	version := id.Version
+	if isLocked {
+		log.Debugf("Step %s@%s is locked to %s in %s", id.IDorURI, id.Version, lock.ResolvedVersion, steplock.Path())
+		version = lock.ResolvedVersion
+	}
+
+	versionConstraint, err := models.ParseRequiredVersion(version)
 	if err != nil {
 		return models.StepInfoModel{}, false, err
 	}
@@ -68,7 +121,7 @@ func prepareStepLibForActivation(
 
 	if shouldUpdateStepLibForStep(versionConstraint, isOfflineMode, didStepLibUpdateInWorkflow) {
 		log.Infof("Step uses latest version, updating StepLib...")
-		_, err = stepman.UpdateLibrary(id.SteplibSource, log)
+		_, err = stepman.UpdateLibraryWithReader(id.SteplibSource, steplibrary.NewInventoryReader(), log)
 		if err != nil {
 			log.Warnf("Step version constraint is latest or version locked, but failed to update StepLib, err: %s", err)
 		} else {
@@ -76,21 +129,21 @@ func prepareStepLibForActivation(
 		}
 	}
 
-	stepInfo, err = stepman.QueryStepInfoFromLibrary(id.SteplibSource, id.IDorURI, id.Version, log)
+	stepInfo, err = stepman.QueryStepInfoFromLibrary(id.SteplibSource, id.IDorURI, version, log)
 	if err != nil {
 		if !canUpdateStepLib(isOfflineMode, didStepLibUpdateInWorkflow) {
 			return stepInfo, didUpdate, err
 		}
 
 		log.Infof("Step not found in local StepLib cache, trying to update StepLib...")
-		_, err = stepman.UpdateLibrary(id.SteplibSource, log)
+		_, err = stepman.UpdateLibraryWithReader(id.SteplibSource, steplibrary.NewInventoryReader(), log)
 		if err != nil {
 			return stepInfo, didUpdate, err
 		} else {
 			didUpdate = true
 		}
 
-		stepInfo, err = stepman.QueryStepInfoFromLibrary(id.SteplibSource, id.IDorURI, id.Version, log)
+		stepInfo, err = stepman.QueryStepInfoFromLibrary(id.SteplibSource, id.IDorURI, version, log)
 		if err != nil {
 			return stepInfo, didUpdate, err
 		}
@@ -99,6 +152,14 @@ func prepareStepLibForActivation(
 	if stepInfo.Step.Title == nil || *stepInfo.Step.Title == "" {
 		stepInfo.Step.Title = pointers.NewStringPtr(stepInfo.ID)
 	}
+	if isLocked {
+		if mismatches := lock.Mismatches(steplock.NewEntry(id, stepInfo.Version, stepInfo.Step)); len(mismatches) > 0 {
+			return stepInfo, didUpdate, fmt.Errorf("step %s@%s does not match %s: %s", id.IDorURI, stepInfo.Version, steplock.Path(), strings.Join(mismatches, "; "))
+		}
+	}
+	if reason, yanked := stepInfo.GroupInfo.YankedVersions[stepInfo.Version]; yanked {
+		log.Warnf("Step %s@%s is yanked: %s", id.IDorURI, stepInfo.Version, reason)
+	}
 	stepInfo.OriginalVersion = id.Version
 
 	return stepInfo, didUpdate, nil
@@ -111,7 +172,8 @@ func shouldUpdateStepLibForStep(constraint models.VersionConstraint, isOfflineMo
 
 	return (constraint.VersionLockType == models.Latest) ||
 		(constraint.VersionLockType == models.MinorLocked) ||
-		(constraint.VersionLockType == models.MajorLocked)
+		(constraint.VersionLockType == models.MajorLocked) ||
+		constraint.IsRange()
 }
 
 func canUpdateStepLib(isOfflineMode bool, didStepLibUpdateInWorkflow bool) bool {
@@ -2,11 +2,16 @@ package activator
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
 	"testing"
 
 	"github.com/bitrise-io/go-utils/pathutil"
+	"github.com/bitrise-io/stepman/internal/specfixtures"
+	"github.com/bitrise-io/stepman/internal/steplock"
 	"github.com/bitrise-io/stepman/stepid"
+	"github.com/bitrise-io/stepman/stepman"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -211,3 +216,88 @@ func BenchmarkActivateSteplibRefStep(b *testing.B) {
 		})
 	}
 }
+
+func TestResolveCanonicalID(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	library := initTestSteplibRepo(t)
+	t.Setenv(stepman.SearchPathEnvKey, library)
+
+	cases := map[string]struct {
+		composite string
+		want      stepid.CanonicalID
+		wantErr   string
+	}{
+		"resolved against the search path": {
+			composite: "hello-step@1",
+			want:      stepid.CanonicalID{SteplibSource: library, IDorURI: "hello-step", Version: "1"},
+		},
+		"a source skips the search path": {
+			composite: "git::https://github.com/bitrise-steplib/steps-script.git@master",
+			want:      stepid.CanonicalID{SteplibSource: "git", IDorURI: "https://github.com/bitrise-steplib/steps-script.git", Version: "master"},
+		},
+		"not on the search path": {
+			composite: "missing",
+			wantErr:   "resolve library of missing: none of the libraries of the search path (" + library + ") contain step missing",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			id, err := ResolveCanonicalID(TestLogger[*testing.T]{t}, tc.composite, "")
+			if tc.wantErr != "" {
+				require.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, id)
+		})
+	}
+}
+
+// initTestSteplibRepo creates a local git repo of the sample steplib, usable as
+// a clone source for library setup.
+func initTestSteplibRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.CopyFS(dir, specfixtures.SteplibClone()))
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "git %v: %s", args, out)
+	}
+	git("init")
+	git("add", ".")
+	git("commit", "-m", "initial")
+
+	return dir
+}
+
+func TestResolveCanonicalID_locked(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	library := initTestSteplibRepo(t)
+	t.Setenv(stepman.SearchPathEnvKey, library)
+	log := TestLogger[*testing.T]{t}
+
+	id, err := ResolveCanonicalID(log, "hello-step@1", "https://github.com/bitrise-io/bitrise-steplib.git")
+	require.NoError(t, err)
+	require.Equal(t, library, id.SteplibSource)
+
+	// Lock the reference, as stepman lock does, to an older version than the
+	// latest 1.x.
+	spec, err := stepman.ReadStepSpec(library)
+	require.NoError(t, err)
+	lockPath := filepath.Join(t.TempDir(), steplock.FileName)
+	entry := steplock.NewEntry(id, "1.0.0", spec.Steps["hello-step"].Versions["1.0.0"])
+	require.NoError(t, steplock.Write(lockPath, steplock.Lockfile{Steps: []steplock.Entry{entry}}))
+	t.Setenv(steplock.PathEnv, lockPath)
+
+	stepInfo, _, err := prepareStepLibForActivation(log, id, false, true)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", stepInfo.Version, "locked version")
+	assert.Equal(t, library, stepInfo.Library)
+}
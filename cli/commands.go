@@ -56,6 +56,11 @@ var (
 			},
 		},
 		stepInfoCommand,
+		searchCommand,
+		lockCommand,
+		stepDiffCommand,
+		inventoryCommand,
+		mirrorCommand,
 		{
 			Name:   "download",
 			Usage:  "Download the step with provided --id and --version, from specified --collection, into local step downloads cache. If no --version defined, the latest version of the step (latest found in the collection) will be downloaded into the cache.",
@@ -151,6 +156,11 @@ var (
 					Name:  "steplib",
 					Usage: "StepLib URI",
 				},
+				cli.StringFlag{
+					Name:  "from-inventory",
+					Usage: "Build the spec from a V2 inventory instead of a StepLib: its base URL, or a comma-separated list of mirrors. Defaults to $BITRISE_STEPLIB_INVENTORY_URLS.",
+				},
+				flInventoryPublicKey,
 				cli.StringFlag{
 					Name:  "output",
 					Usage: "Output path",
@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -9,7 +10,9 @@ import (
 	"github.com/bitrise-io/go-utils/fileutil"
 	"github.com/bitrise-io/go-utils/log"
 	"github.com/bitrise-io/go-utils/pathutil"
+	v2fileutil "github.com/bitrise-io/go-utils/v2/fileutil"
 	"github.com/bitrise-io/stepman/models"
+	"github.com/bitrise-io/stepman/steplibrary"
 	"github.com/bitrise-io/stepman/stepman"
 	"github.com/urfave/cli"
 )
@@ -75,11 +78,12 @@ func convertToLatestSpec(stepLib models.StepCollectionModel) models.StepCollecti
 func export(c *cli.Context) error {
 	// Input validation
 	steplibURI := c.String("steplib")
+	inventoryURLs := c.String("from-inventory")
 	outputPth := c.String("output")
 	exportTypeStr := c.String("export-type")
 
-	if steplibURI == "" {
-		return fmt.Errorf("missing required input: steplib")
+	if steplibURI == "" && inventoryURLs == "" {
+		return fmt.Errorf("missing required input: steplib or from-inventory")
 	}
 
 	if outputPth == "" {
@@ -95,22 +99,38 @@ func export(c *cli.Context) error {
 		}
 	}
 
-	log.Infof("Exporting StepLib (%s) spec, export-type: %s, output: %s", steplibURI, exportTypeStr, outputPth)
+	var stepLibSpec models.StepCollectionModel
+	if inventoryURLs != "" {
+		log.Infof("Exporting StepLib spec from inventory (%s), export-type: %s, output: %s", inventoryURLs, exportTypeStr, outputPth)
 
-	// Setup StepLib
-	if exist, err := stepman.RootExistForLibrary(steplibURI); err != nil {
-		return fmt.Errorf("failed to check if setup was done for StepLib, error: %s", err)
-	} else if !exist {
-		log.Infof("StepLib does not exist, setup...")
-		if err := stepman.SetupLibrary(steplibURI, log.NewDefaultLogger(false)); err != nil {
-			return fmt.Errorf("failed to setup StepLib, error: %s", err)
+		inventory, err := inventoryOptions(c, "from-inventory")
+		if err != nil {
+			return err
+		}
+		client := steplibrary.NewWithOptions(log.NewDefaultLogger(false), steplibURI, v2fileutil.NewFileManager(), inventory)
+		stepLibSpec, err = client.StepCollection(context.Background())
+		if err != nil {
+			return fmt.Errorf("failed to build StepLib spec from inventory, error: %s", err)
+		}
+	} else {
+		log.Infof("Exporting StepLib (%s) spec, export-type: %s, output: %s", steplibURI, exportTypeStr, outputPth)
+
+		// Setup StepLib
+		if exist, err := stepman.RootExistForLibrary(steplibURI); err != nil {
+			return fmt.Errorf("failed to check if setup was done for StepLib, error: %s", err)
+		} else if !exist {
+			log.Infof("StepLib does not exist, setup...")
+			if err := stepman.SetupLibraryWithReader(steplibURI, steplibrary.NewInventoryReader(), log.NewDefaultLogger(false)); err != nil {
+				return fmt.Errorf("failed to setup StepLib, error: %s", err)
+			}
 		}
-	}
 
-	// Prepare spec
-	stepLibSpec, err := stepman.ReadStepSpec(steplibURI)
-	if err != nil {
-		failf("Failed to read StepLib spec, error: %s", err)
+		// Prepare spec
+		var err error
+		stepLibSpec, err = stepman.ReadStepSpec(steplibURI)
+		if err != nil {
+			failf("Failed to read StepLib spec, error: %s", err)
+		}
 	}
 
 	switch exportType {
@@ -1,6 +1,9 @@
 package cli
 
-import "github.com/urfave/cli"
+import (
+	"github.com/bitrise-io/stepman/steplibrary"
+	"github.com/urfave/cli"
+)
 
 const (
 	// DebugEnvKey ...
@@ -80,6 +83,8 @@ const (
 	StepYMLKey = "step-yml"
 
 	StepYMLOverrideKey = "stepyml-override"
+
+	inventoryPublicKeyKey = "inventory-public-key"
 )
 
 //nolint:exhaustruct // CLI command definitions don't need all fields initialized
@@ -144,6 +149,11 @@ var (
 		Name:  StepYMLOverrideKey,
 		Usage: "Path to a step.yml file that will override the one from the git checkout.",
 	}
+	flInventoryPublicKey = cli.StringFlag{
+		Name:   inventoryPublicKeyKey,
+		Usage:  "Base64 ed25519 public key the V2 inventory must be signed with. Files not covered by its signed manifest are refused.",
+		EnvVar: steplibrary.PublicKeyEnv,
+	}
 )
 
 //nolint:exhaustruct // CLI command definitions don't need all fields initialized
@@ -0,0 +1,366 @@
+package cli
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-utils/colorstring"
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/stepman/internal/inventoryserver"
+	"github.com/bitrise-io/stepman/steplibrary"
+	"github.com/bitrise-io/stepman/steplibrary/indexgen"
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+	"github.com/urfave/cli"
+)
+
+const (
+	steplibKey    = "steplib"
+	outKey        = "out"
+	dirKey        = "dir"
+	addrKey       = "addr"
+	signingKeyKey = "signing-key"
+
+	// SigningKeyEnvKey ...
+	SigningKeyEnvKey = "BITRISE_STEPLIB_INVENTORY_SIGNING_KEY"
+
+	// OutputFormatJUnit ...
+	OutputFormatJUnit = "junit"
+)
+
+//nolint:exhaustruct // CLI command definitions don't need all fields initialized
+var inventoryCommand = cli.Command{
+	Name:  "inventory",
+	Usage: "Generates, validates, serves and compares V2 steplib inventories.",
+	Subcommands: []cli.Command{
+		{
+			Name:  "generate",
+			Usage: "Generates the V2 inventory of a StepLib and prints its stats as JSON.",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  steplibKey,
+					Usage: "StepLib URI to generate the inventory from.",
+				},
+				cli.StringFlag{
+					Name:  outKey,
+					Usage: "Output dir of the inventory.",
+				},
+				cli.StringFlag{
+					Name:   signingKeyKey,
+					Usage:  "Base64 ed25519 private key (seed or full key) to sign the inventory with. Prefer the env var, to keep the key out of the shell history.",
+					EnvVar: SigningKeyEnvKey,
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if err := inventoryGenerate(c); err != nil {
+					failf("Command failed: %s", err)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "validate",
+			Usage:     "Validates a V2 inventory, exits with a non-zero code on violations.",
+			ArgsUsage: "<inventory dir>",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  FormatKey + ", " + formatKeyShort,
+					Usage: "Output format (options: raw, json, junit).",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				violations, err := inventoryValidate(c)
+				if err != nil {
+					failf("Command failed: %s", err)
+				}
+				if violations > 0 {
+					os.Exit(1)
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "serve",
+			Usage: "Serves a V2 inventory over HTTP like the inventory host, for development and integration tests.",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  dirKey,
+					Usage: "Inventory dir to serve (the dir containing v2/).",
+				},
+				cli.StringFlag{
+					Name:  addrKey,
+					Value: ":8888",
+					Usage: "Address to listen on.",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if err := inventoryServe(c); err != nil {
+					failf("Command failed: %s", err)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "diff",
+			Usage:     "Lists the steps and versions added or removed between two V2 inventories, and the changed deprecations.",
+			ArgsUsage: "<old inventory dir> <new inventory dir>",
+			Flags: []cli.Flag{
+				flFormat,
+			},
+			Action: func(c *cli.Context) error {
+				if err := inventoryDiff(c); err != nil {
+					failf("Command failed: %s", err)
+				}
+				return nil
+			},
+		},
+	},
+}
+
+func inventoryGenerate(c *cli.Context) error {
+	steplibURI := c.String(steplibKey)
+	if steplibURI == "" {
+		return fmt.Errorf("missing required input: --%s", steplibKey)
+	}
+	outputDir := c.String(outKey)
+	if outputDir == "" {
+		return fmt.Errorf("missing required input: --%s", outKey)
+	}
+
+	opts := indexgen.Options{GeneratedAt: time.Time{}, SteplibCommitSHA: "", SigningKey: nil}
+	if signingKey := c.String(signingKeyKey); signingKey != "" {
+		key, err := steplibindex.ParsePrivateKey(signingKey)
+		if err != nil {
+			return fmt.Errorf("invalid --%s: %w", signingKeyKey, err)
+		}
+		opts.SigningKey = key
+	}
+
+	stats, err := indexgen.Generate(steplibURI, outputDir, opts, log.NewDefaultLogger(false))
+	if err != nil {
+		return err
+	}
+
+	bytes, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bytes))
+	return nil
+}
+
+// inventoryValidate prints the violations of the inventory and returns their
+// count.
+func inventoryValidate(c *cli.Context) (int, error) {
+	format := c.String(FormatKey)
+	if format == "" {
+		format = OutputFormatRaw
+	} else if format != OutputFormatRaw && format != OutputFormatJSON && format != OutputFormatJUnit {
+		return 0, fmt.Errorf("invalid format: %s", format)
+	}
+	if len(c.Args()) != 1 {
+		return 0, fmt.Errorf("expected an inventory dir, got %d arguments", len(c.Args()))
+	}
+	dir := c.Args()[0]
+	if _, err := os.Stat(dir); err != nil {
+		return 0, err
+	}
+
+	violations := indexgen.Validate(os.DirFS(dir))
+
+	switch format {
+	case OutputFormatJSON:
+		bytes, err := json.Marshal(validationOutput(violations))
+		if err != nil {
+			return 0, err
+		}
+		fmt.Println(string(bytes))
+	case OutputFormatJUnit:
+		bytes, err := xml.MarshalIndent(junitReport(violations), "", "  ")
+		if err != nil {
+			return 0, err
+		}
+		fmt.Println(xml.Header + string(bytes))
+	default:
+		for _, violation := range violations {
+			fmt.Printf("%s %s\n", colorstring.Red("x"), violation.Error())
+		}
+		if len(violations) == 0 {
+			fmt.Println(colorstring.Green("No violations"))
+		} else {
+			fmt.Println(colorstring.Redf("%d violations", len(violations)))
+		}
+	}
+	return len(violations), nil
+}
+
+// ValidationOutput is an entry of the JSON output of the inventory validate
+// command.
+type ValidationOutput struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func validationOutput(violations []indexgen.ValidationError) []ValidationOutput {
+	output := make([]ValidationOutput, 0, len(violations))
+	for _, violation := range violations {
+		output = append(output, ValidationOutput{Path: violation.Path, Message: violation.Msg})
+	}
+	return output
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+// junitReport reports every violation as a failed test case named after the
+// violating file, or a single passing test case if there are none.
+func junitReport(violations []indexgen.ValidationError) junitTestSuites {
+	suite := junitTestSuite{Name: "inventory", Tests: 1, Failures: len(violations), Cases: nil}
+	if len(violations) == 0 {
+		suite.Cases = []junitTestCase{{Name: "inventory", ClassName: "inventory", Failure: nil}}
+	} else {
+		suite.Tests = len(violations)
+		for _, violation := range violations {
+			name := violation.Path
+			if name == "" {
+				name = "inventory"
+			}
+			suite.Cases = append(suite.Cases, junitTestCase{Name: name, ClassName: "inventory", Failure: &junitFailure{Message: violation.Msg}})
+		}
+	}
+	return junitTestSuites{XMLName: xml.Name{Space: "", Local: "testsuites"}, Suites: []junitTestSuite{suite}}
+}
+
+func inventoryServe(c *cli.Context) error {
+	dir := c.String(dirKey)
+	if dir == "" {
+		return fmt.Errorf("missing required input: --%s", dirKey)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+
+	logger := log.NewDefaultLogger(false)
+	//nolint:exhaustruct // the rest of the server config is left at its defaults
+	server := &http.Server{
+		Addr:              c.String(addrKey),
+		Handler:           inventoryserver.NewHandler(os.DirFS(dir), logger),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	logger.Infof("Serving %s on %s", dir, server.Addr)
+	return server.ListenAndServe()
+}
+
+func inventoryDiff(c *cli.Context) error {
+	format := c.String(FormatKey)
+	if format == "" {
+		format = OutputFormatRaw
+	} else if format != OutputFormatRaw && format != OutputFormatJSON {
+		return fmt.Errorf("invalid format: %s", format)
+	}
+	if len(c.Args()) != 2 {
+		return fmt.Errorf("expected an old and a new inventory dir, got %d arguments", len(c.Args()))
+	}
+
+	diff, err := indexgen.Diff(os.DirFS(c.Args()[0]), os.DirFS(c.Args()[1]))
+	if err != nil {
+		return err
+	}
+
+	if format == OutputFormatJSON {
+		bytes, err := json.Marshal(diff)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(bytes))
+		return nil
+	}
+	printRawInventoryDiff(diff)
+	return nil
+}
+
+func printRawInventoryDiff(diff indexgen.InventoryDiff) {
+	if diff.IsEmpty() {
+		fmt.Println("No changes")
+		return
+	}
+
+	printList := func(title string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		fmt.Printf("%s (%d):\n", title, len(items))
+		for _, item := range items {
+			fmt.Printf(" * %s\n", item)
+		}
+		fmt.Println()
+	}
+	stepVersions := func(versions []indexgen.StepVersion) []string {
+		items := make([]string, 0, len(versions))
+		for _, version := range versions {
+			items = append(items, version.StepID+"@"+version.Version)
+		}
+		return items
+	}
+
+	printList(colorstring.Green("Added steps"), diff.AddedSteps)
+	printList(colorstring.Red("Removed steps"), diff.RemovedSteps)
+	printList(colorstring.Green("Added versions"), stepVersions(diff.AddedVersions))
+	printList(colorstring.Red("Removed versions"), stepVersions(diff.RemovedVersions))
+
+	deprecations := make([]string, 0, len(diff.DeprecationChanges))
+	for _, change := range diff.DeprecationChanges {
+		switch {
+		case change.New == nil:
+			deprecations = append(deprecations, change.StepID+": no longer deprecated")
+		case change.Old == nil:
+			deprecations = append(deprecations, fmt.Sprintf("%s: deprecated, removal date: %s", change.StepID, change.New.RemovalDate))
+		default:
+			deprecations = append(deprecations, fmt.Sprintf("%s: deprecation changed, removal date: %s", change.StepID, change.New.RemovalDate))
+		}
+	}
+	printList(colorstring.Yellow("Deprecation changes"), deprecations)
+}
+
+// inventoryOptions returns the client options of the V2 inventory a command
+// reads: the comma-separated mirrors of its urlsKey flag, or the
+// steplibrary.InventoryURLsEnv ones if the flag is not set, verified with the
+// --inventory-public-key key if set. No mirrors means the command doesn't read
+// an inventory.
+func inventoryOptions(c *cli.Context, urlsKey string) (steplibrary.Options, error) {
+	opts := steplibrary.Options{InventoryURLs: steplibrary.MirrorURLs(nil), PublicKey: nil}
+	if urls := c.String(urlsKey); urls != "" {
+		opts.InventoryURLs = strings.Split(urls, ",")
+	}
+	if publicKey := c.String(inventoryPublicKeyKey); publicKey != "" {
+		key, err := steplibindex.ParsePublicKey(publicKey)
+		if err != nil {
+			return steplibrary.Options{}, fmt.Errorf("invalid --%s: %w", inventoryPublicKeyKey, err)
+		}
+		opts.PublicKey = key
+	}
+	return opts, nil
+}
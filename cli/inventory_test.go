@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/bitrise-io/stepman/steplibrary/indexgen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJUnitReport(t *testing.T) {
+	cases := map[string]struct {
+		violations []indexgen.ValidationError
+		want       string
+	}{
+		"no violations": {
+			violations: nil,
+			want: `<testsuites><testsuite name="inventory" tests="1" failures="0">` +
+				`<testcase name="inventory" classname="inventory"></testcase>` +
+				`</testsuite></testsuites>`,
+		},
+		"violations": {
+			violations: []indexgen.ValidationError{
+				{Path: "", Msg: "missing meta.json"},
+				{Path: "v2/stale.json", Msg: "unexpected file under v2/"},
+			},
+			want: `<testsuites><testsuite name="inventory" tests="2" failures="2">` +
+				`<testcase name="inventory" classname="inventory"><failure message="missing meta.json"></failure></testcase>` +
+				`<testcase name="v2/stale.json" classname="inventory"><failure message="unexpected file under v2/"></failure></testcase>` +
+				`</testsuite></testsuites>`,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := xml.Marshal(junitReport(tc.violations))
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, string(got))
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/colorstring"
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/stepman/activator"
+	"github.com/bitrise-io/stepman/internal/steplock"
+	"github.com/bitrise-io/stepman/models"
+	"github.com/bitrise-io/stepman/stepid"
+	"github.com/bitrise-io/stepman/steplibrary"
+	"github.com/bitrise-io/stepman/stepman"
+	"github.com/urfave/cli"
+)
+
+const (
+	lockfileKey = "lockfile"
+	verifyKey   = "verify"
+)
+
+//nolint:exhaustruct // CLI command definitions don't need all fields initialized
+var lockCommand = cli.Command{
+	Name:  "lock",
+	Usage: "Pins steplib steps to the version, source commit and executable hashes they currently resolve to.",
+	Description: `Resolves each composite step ID (e.g. https://github.com/bitrise-io/bitrise-steplib.git::script@1)
+   and records the result in the lockfile. Without step IDs it re-locks the steps already in the lockfile.
+   Step activation honors the lockfile when it exists.`,
+	ArgsUsage: "[<composite step ID>...]",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:   CollectionKey + ", " + collectionKeyShort,
+			Usage:  "Default StepLib of step IDs without one.",
+			EnvVar: CollectionPathEnvKey,
+		},
+		cli.StringFlag{
+			Name:   lockfileKey,
+			Value:  steplock.FileName,
+			Usage:  "Path of the lockfile.",
+			EnvVar: steplock.PathEnv,
+		},
+		cli.BoolFlag{
+			Name:  verifyKey,
+			Usage: "Check that the lockfile still matches the StepLib instead of writing it.",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		var err error
+		if c.Bool(verifyKey) {
+			err = verifyLock(c)
+		} else {
+			err = lock(c)
+		}
+		if err != nil {
+			failf("Command failed: %s", err)
+		}
+		return nil
+	},
+}
+
+func lock(c *cli.Context) error {
+	logger := log.NewDefaultLogger(false)
+	pth := c.String(lockfileKey)
+
+	lockfile, err := steplock.Read(pth)
+	if errors.Is(err, fs.ErrNotExist) && len(c.Args()) > 0 {
+		lockfile = steplock.Lockfile{FormatVersion: 0, Steps: nil}
+	} else if err != nil {
+		return err
+	}
+
+	ids := make([]stepid.CanonicalID, 0, len(c.Args()))
+	for _, arg := range c.Args() {
+		id, err := activator.ResolveCanonicalID(logger, arg, c.String(CollectionKey))
+		if err != nil {
+			return fmt.Errorf("parse step ID %s: %w", arg, err)
+		}
+		if !id.IsSteplibStep() {
+			return fmt.Errorf("%s is not a steplib step, only steplib steps can be locked", arg)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		for _, entry := range lockfile.Steps {
+			ids = append(ids, entry.CanonicalID())
+		}
+	}
+
+	specs := map[string]models.StepCollectionModel{}
+	for _, id := range ids {
+		spec, err := lockSpec(specs, id.SteplibSource, logger)
+		if err != nil {
+			return err
+		}
+		entry, err := steplock.Resolve(spec, id)
+		if err != nil {
+			return err
+		}
+		lockfile.Put(entry)
+		logger.Printf("%s@%s locked to %s", id.IDorURI, displayVersion(id.Version), entry.ResolvedVersion)
+	}
+
+	if err := steplock.Write(pth, lockfile); err != nil {
+		return err
+	}
+	logger.Donef("Lockfile written to %s", pth)
+	return nil
+}
+
+func verifyLock(c *cli.Context) error {
+	logger := log.NewDefaultLogger(false)
+	pth := c.String(lockfileKey)
+
+	lockfile, err := steplock.Read(pth)
+	if err != nil {
+		return err
+	}
+
+	specs := map[string]models.StepCollectionModel{}
+	failed := 0
+	for _, entry := range lockfile.Steps {
+		id := entry.CanonicalID()
+		spec, err := lockSpec(specs, id.SteplibSource, logger)
+		if err != nil {
+			return err
+		}
+
+		name := fmt.Sprintf("%s@%s", id.IDorURI, displayVersion(id.Version))
+		var mismatches []string
+		if current, err := steplock.Resolve(spec, id); err != nil {
+			mismatches = []string{err.Error()}
+		} else {
+			mismatches = entry.Mismatches(current)
+		}
+		if len(mismatches) == 0 {
+			logger.Printf("%s %s", colorstring.Green("ok"), name)
+			continue
+		}
+		failed++
+		logger.Printf("%s %s: %s", colorstring.Red("changed"), name, strings.Join(mismatches, "; "))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d locked steps no longer match the StepLib, run stepman lock to update %s", failed, len(lockfile.Steps), pth)
+	}
+	logger.Donef("All %d locked steps match the StepLib", len(lockfile.Steps))
+	return nil
+}
+
+// lockSpec returns the up to date spec of steplibURI, setting up or updating
+// the local copy of the steplib on first use.
+func lockSpec(specs map[string]models.StepCollectionModel, steplibURI string, logger stepman.Logger) (models.StepCollectionModel, error) {
+	if spec, ok := specs[steplibURI]; ok {
+		return spec, nil
+	}
+
+	exist, err := stepman.RootExistForLibrary(steplibURI)
+	if err != nil {
+		return models.StepCollectionModel{}, err
+	}
+	var spec models.StepCollectionModel
+	if exist {
+		spec, err = stepman.UpdateLibraryWithReader(steplibURI, steplibrary.NewInventoryReader(), logger)
+		if err != nil {
+			return models.StepCollectionModel{}, fmt.Errorf("update steplib %s: %w", steplibURI, err)
+		}
+	} else {
+		if err := stepman.SetupLibraryWithReader(steplibURI, steplibrary.NewInventoryReader(), logger); err != nil {
+			return models.StepCollectionModel{}, fmt.Errorf("setup steplib %s: %w", steplibURI, err)
+		}
+		spec, err = stepman.ReadStepSpec(steplibURI)
+		if err != nil {
+			return models.StepCollectionModel{}, err
+		}
+	}
+	specs[steplibURI] = spec
+	return spec, nil
+}
+
+func displayVersion(version string) string {
+	if version == "" {
+		return "latest"
+	}
+	return version
+}
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/v2/fileutil"
+	"github.com/bitrise-io/stepman/steplibrary"
+	"github.com/urfave/cli"
+)
+
+const (
+	baseURLKey    = "base-url"
+	maintainerKey = "maintainer"
+	numMajorKey   = "num-major"
+	platformKey   = "platform"
+)
+
+//nolint:exhaustruct // CLI command definitions don't need all fields initialized
+var mirrorCommand = cli.Command{
+	Name:  "mirror",
+	Usage: "Replicates a V2 inventory with its step executables and sources into a self-contained dir, and prints the stats as JSON. Re-running it updates the replica incrementally.",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  inventoryKey,
+			Usage: "V2 inventory to replicate: its base URL, or a comma-separated list of mirrors. Defaults to $BITRISE_STEPLIB_INVENTORY_URLS.",
+		},
+		flInventoryPublicKey,
+		cli.StringFlag{
+			Name:  outKey,
+			Usage: "Output dir of the replica.",
+		},
+		cli.StringFlag{
+			Name:  baseURLKey,
+			Usage: "https URL the replica will be served from.",
+		},
+		cli.StringSliceFlag{
+			Name:  IDKey,
+			Usage: "ID of a step to replicate, all steps if not set. Can be repeated or comma-separated.",
+		},
+		cli.StringFlag{
+			Name:  maintainerKey,
+			Usage: "Only replicate the steps of this maintainer (e.g. bitrise, verified, community).",
+		},
+		cli.UintFlag{
+			Name:  numMajorKey,
+			Usage: "Only replicate the versions of the latest N major versions of each step, all if 0.",
+		},
+		cli.StringSliceFlag{
+			Name:  platformKey,
+			Usage: "Platform (<GOOS>-<GOARCH>) to replicate the precompiled executables of, the current one if not set. Can be repeated or comma-separated.",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if err := mirror(c); err != nil {
+			failf("Command failed: %s", err)
+		}
+		return nil
+	},
+}
+
+func mirror(c *cli.Context) error {
+	inventory, err := inventoryOptions(c, inventoryKey)
+	if err != nil {
+		return err
+	}
+	if len(inventory.InventoryURLs) == 0 {
+		return fmt.Errorf("missing required input: --%s", inventoryKey)
+	}
+	outputDir := c.String(outKey)
+	if outputDir == "" {
+		return fmt.Errorf("missing required input: --%s", outKey)
+	}
+	baseURL := c.String(baseURLKey)
+	if baseURL == "" {
+		return fmt.Errorf("missing required input: --%s", baseURLKey)
+	}
+
+	platforms := splitListFlag(c.StringSlice(platformKey))
+	if len(platforms) == 0 {
+		platforms = []string{fmt.Sprintf("%s-%s", runtime.GOOS, runtime.GOARCH)}
+	}
+	opts := steplibrary.ReplicateOptions{
+		BaseURL:    baseURL,
+		StepIDs:    splitListFlag(c.StringSlice(IDKey)),
+		Maintainer: c.String(maintainerKey),
+		NumMajor:   c.Uint(numMajorKey),
+		Platforms:  platforms,
+	}
+
+	logger := log.NewDefaultLogger(false)
+	client := steplibrary.NewWithOptions(logger, "", fileutil.NewFileManager(), inventory)
+	stats, err := client.Replicate(context.Background(), outputDir, opts)
+	if err != nil {
+		return err
+	}
+
+	bytes, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bytes))
+	return nil
+}
+
+// splitListFlag flattens the values of a repeatable flag that also accepts
+// comma-separated lists, dropping blank items.
+func splitListFlag(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
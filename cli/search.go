@@ -0,0 +1,177 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/colorstring"
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/v2/fileutil"
+	"github.com/bitrise-io/stepman/internal/stepsearch"
+	"github.com/bitrise-io/stepman/steplibrary"
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+	"github.com/bitrise-io/stepman/stepman"
+	"github.com/urfave/cli"
+)
+
+const (
+	inventoryKey         = "inventory"
+	typeTagKey           = "type-tag"
+	projectTypeKey       = "project-type"
+	hostOSKey            = "host-os"
+	includeDeprecatedKey = "include-deprecated"
+	limitKey             = "limit"
+)
+
+//nolint:exhaustruct // CLI command definitions don't need all fields initialized
+var searchCommand = cli.Command{
+	Name:      "search",
+	Usage:     "Searches the steps of a StepLib by id, title, tags, summary and maintainer.",
+	ArgsUsage: "<query>",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:   CollectionKey + ", " + collectionKeyShort,
+			Usage:  "StepLib (spec.json) to search.",
+			EnvVar: CollectionPathEnvKey,
+		},
+		cli.StringFlag{
+			Name:  inventoryKey,
+			Usage: "V2 inventory to search instead of a StepLib: its base URL, or a comma-separated list of mirrors. Defaults to $BITRISE_STEPLIB_INVENTORY_URLS.",
+		},
+		flInventoryPublicKey,
+		cli.StringSliceFlag{
+			Name:  typeTagKey,
+			Usage: "Only steps with this type tag (repeatable).",
+		},
+		cli.StringSliceFlag{
+			Name:  projectTypeKey,
+			Usage: "Only steps supporting this project type (repeatable).",
+		},
+		cli.StringSliceFlag{
+			Name:  hostOSKey,
+			Usage: "Only steps supporting this host OS (repeatable).",
+		},
+		cli.BoolFlag{
+			Name:  includeDeprecatedKey,
+			Usage: "Include deprecated steps.",
+		},
+		cli.IntFlag{
+			Name:  limitKey,
+			Value: 20,
+			Usage: "Maximum number of results, 0 for all.",
+		},
+		flFormat,
+	},
+	Action: func(c *cli.Context) error {
+		if err := search(c); err != nil {
+			failf("Command failed: %s", err)
+		}
+		return nil
+	},
+}
+
+// SearchOutput is the JSON output of the search command.
+type SearchOutput struct {
+	Library string              `json:"library"`
+	Query   string              `json:"query"`
+	Results []stepsearch.Result `json:"results"`
+}
+
+func search(c *cli.Context) error {
+	format := c.String(FormatKey)
+	if format == "" {
+		format = OutputFormatRaw
+	} else if format != OutputFormatRaw && format != OutputFormatJSON {
+		return fmt.Errorf("invalid format: %s", format)
+	}
+
+	inventory, err := inventoryOptions(c, inventoryKey)
+	if err != nil {
+		return err
+	}
+	logger := log.NewDefaultLogger(false)
+	library, entries, err := searchEntries(context.Background(), c.String(CollectionKey), inventory, logger)
+	if err != nil {
+		return err
+	}
+
+	query := stepsearch.Query{
+		Text:              strings.Join(c.Args(), " "),
+		TypeTags:          c.StringSlice(typeTagKey),
+		ProjectTypeTags:   c.StringSlice(projectTypeKey),
+		HostOSTags:        c.StringSlice(hostOSKey),
+		IncludeDeprecated: c.Bool(includeDeprecatedKey),
+	}
+	results := stepsearch.Search(entries, query)
+	if limit := c.Int(limitKey); limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	output := SearchOutput{Library: library, Query: query.Text, Results: results}
+	if format == OutputFormatJSON {
+		bytes, err := json.Marshal(output)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(bytes))
+		return nil
+	}
+	printRawSearchResults(output)
+	return nil
+}
+
+// searchEntries loads the search entries of the V2 inventory if it has
+// mirrors, of the V1 StepLib steplibURI otherwise.
+func searchEntries(ctx context.Context, steplibURI string, inventory steplibrary.Options, logger stepman.Logger) (string, []steplibindex.SearchEntry, error) {
+	if len(inventory.InventoryURLs) > 0 {
+		client := steplibrary.NewWithOptions(logger, steplibURI, fileutil.NewFileManager(), inventory)
+		index, err := client.SearchIndex(ctx)
+		if err != nil {
+			return "", nil, err
+		}
+		return inventory.InventoryURLs[0], index.Steps, nil
+	}
+
+	if steplibURI == "" {
+		return "", nil, fmt.Errorf("missing required input: --%s or --%s", CollectionKey, inventoryKey)
+	}
+	if exist, err := stepman.RootExistForLibrary(steplibURI); err != nil {
+		return "", nil, err
+	} else if !exist {
+		if err := stepman.SetupLibraryWithReader(steplibURI, steplibrary.NewInventoryReader(), logger); err != nil {
+			return "", nil, fmt.Errorf("setup steplib %s: %w", steplibURI, err)
+		}
+	}
+	collection, err := stepman.ReadStepSpec(steplibURI)
+	if err != nil {
+		return "", nil, err
+	}
+	return steplibURI, stepsearch.FromCollection(collection), nil
+}
+
+func printRawSearchResults(output SearchOutput) {
+	if len(output.Results) == 0 {
+		fmt.Printf("No steps found in %s matching %q\n", output.Library, output.Query)
+		return
+	}
+
+	fmt.Println(colorstring.Bluef("Steps in %s matching %q:", output.Library, output.Query))
+	fmt.Println()
+	for _, result := range output.Results {
+		title := fmt.Sprintf("%s@%s", result.StepID, result.LatestVersion)
+		if result.Deprecated {
+			title += colorstring.Yellow(" [deprecated]")
+		}
+		fmt.Printf(" * %s\n", title)
+		fmt.Printf("   %s\n", result.Title)
+		if summary, _, _ := strings.Cut(strings.TrimSpace(result.Summary), "\n"); summary != "" {
+			fmt.Printf("   %s\n", summary)
+		}
+		if len(result.TypeTags) > 0 {
+			fmt.Printf("   Tags: %s\n", strings.Join(result.TypeTags, ", "))
+		}
+		fmt.Println()
+	}
+}
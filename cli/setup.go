@@ -6,6 +6,7 @@ import (
 
 	"github.com/bitrise-io/go-utils/command"
 	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/stepman/steplibrary"
 	"github.com/bitrise-io/stepman/stepman"
 	"github.com/urfave/cli"
 )
@@ -44,7 +45,7 @@ func Setup(steplibURI, copySpecJSONPath string, log stepman.Logger) error {
 	}
 
 	// Setup
-	if err := stepman.SetupLibrary(steplibURI, log); err != nil {
+	if err := stepman.SetupLibraryWithReader(steplibURI, steplibrary.NewInventoryReader(), log); err != nil {
 		return fmt.Errorf("setup failed: %s", err)
 	}
 
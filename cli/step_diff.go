@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bitrise-io/go-utils/colorstring"
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/go-utils/v2/fileutil"
+	"github.com/bitrise-io/stepman/internal/stepdiff"
+	"github.com/bitrise-io/stepman/models"
+	"github.com/bitrise-io/stepman/steplibrary"
+	"github.com/bitrise-io/stepman/stepman"
+	"github.com/urfave/cli"
+)
+
+const (
+	fromKey = "from"
+	toKey   = "to"
+)
+
+//nolint:exhaustruct // CLI command definitions don't need all fields initialized
+var stepDiffCommand = cli.Command{
+	Name:  "step-diff",
+	Usage: "Compares two versions of a step and lists the breaking, behavioral and cosmetic changes.",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:   CollectionKey + ", " + collectionKeyShort,
+			Usage:  "StepLib (spec.json) of the step.",
+			EnvVar: CollectionPathEnvKey,
+		},
+		cli.StringFlag{
+			Name:  inventoryKey,
+			Usage: "V2 inventory of the step instead of a StepLib: its base URL, or a comma-separated list of mirrors. Defaults to $BITRISE_STEPLIB_INVENTORY_URLS.",
+		},
+		flInventoryPublicKey,
+		cli.StringFlag{
+			Name:  IDKey + ", " + idKeyShort,
+			Usage: "ID of the step.",
+		},
+		cli.StringFlag{
+			Name:  fromKey,
+			Usage: "Version to compare from (the one in use).",
+		},
+		cli.StringFlag{
+			Name:  toKey,
+			Usage: "Version to compare to (the upgrade candidate), latest if empty.",
+		},
+		flFormat,
+	},
+	Action: func(c *cli.Context) error {
+		if err := stepDiff(c); err != nil {
+			failf("Command failed: %s", err)
+		}
+		return nil
+	},
+}
+
+// StepDiffOutput is the JSON output of the step-diff command.
+type StepDiffOutput struct {
+	Library string `json:"library"`
+	ID      string `json:"id"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	stepdiff.Diff
+}
+
+func stepDiff(c *cli.Context) error {
+	format := c.String(FormatKey)
+	if format == "" {
+		format = OutputFormatRaw
+	} else if format != OutputFormatRaw && format != OutputFormatJSON {
+		return fmt.Errorf("invalid format: %s", format)
+	}
+
+	id := c.String(IDKey)
+	if id == "" {
+		return fmt.Errorf("missing required input: --%s", IDKey)
+	}
+	if c.String(fromKey) == "" {
+		return fmt.Errorf("missing required input: --%s", fromKey)
+	}
+
+	inventory, err := inventoryOptions(c, inventoryKey)
+	if err != nil {
+		return err
+	}
+	logger := log.NewDefaultLogger(false)
+	load, library, err := stepModelLoader(context.Background(), c.String(CollectionKey), inventory, logger)
+	if err != nil {
+		return err
+	}
+	fromVersion, from, err := load(id, c.String(fromKey))
+	if err != nil {
+		return err
+	}
+	toVersion, to, err := load(id, c.String(toKey))
+	if err != nil {
+		return err
+	}
+
+	diff, err := stepdiff.Compare(from, to)
+	if err != nil {
+		return fmt.Errorf("compare %s %s and %s: %w", id, fromVersion, toVersion, err)
+	}
+
+	output := StepDiffOutput{Library: library, ID: id, From: fromVersion, To: toVersion, Diff: diff}
+	if format == OutputFormatJSON {
+		bytes, err := json.Marshal(output)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(bytes))
+		return nil
+	}
+	printRawStepDiff(output)
+	return nil
+}
+
+// stepModelLoader returns a function loading a step version from the V2
+// inventory if it has mirrors, from the V1 StepLib steplibURI otherwise, and
+// the name of the library it loads from. The function returns the resolved
+// version alongside its definition.
+func stepModelLoader(ctx context.Context, steplibURI string, inventory steplibrary.Options, logger stepman.Logger) (func(id, version string) (string, models.StepModel, error), string, error) {
+	if len(inventory.InventoryURLs) > 0 {
+		client := steplibrary.NewWithOptions(logger, steplibURI, fileutil.NewFileManager(), inventory)
+		return func(id, version string) (string, models.StepModel, error) {
+			info, step, err := client.StepModel(ctx, id, version)
+			if err != nil {
+				return "", models.StepModel{}, err
+			}
+			return info.Version, step, nil
+		}, inventory.InventoryURLs[0], nil
+	}
+
+	if steplibURI == "" {
+		return nil, "", fmt.Errorf("missing required input: --%s or --%s", CollectionKey, inventoryKey)
+	}
+	if exist, err := stepman.RootExistForLibrary(steplibURI); err != nil {
+		return nil, "", err
+	} else if !exist {
+		if err := stepman.SetupLibraryWithReader(steplibURI, steplibrary.NewInventoryReader(), logger); err != nil {
+			return nil, "", fmt.Errorf("setup steplib %s: %w", steplibURI, err)
+		}
+	}
+	collection, err := stepman.ReadStepSpec(steplibURI)
+	if err != nil {
+		return nil, "", err
+	}
+	return func(id, version string) (string, models.StepModel, error) {
+		stepVersion, stepFound, versionFound := collection.GetExistingStepVersion(id, version)
+		if !stepFound {
+			return "", models.StepModel{}, fmt.Errorf("%s steplib does not contain %s step", steplibURI, id)
+		}
+		if !versionFound {
+			return "", models.StepModel{}, fmt.Errorf("%s steplib does not contain %s step %s version", steplibURI, id, version)
+		}
+		return stepVersion.Version, stepVersion.Step, nil
+	}, steplibURI, nil
+}
+
+func printRawStepDiff(output StepDiffOutput) {
+	fmt.Println(colorstring.Bluef("%s %s -> %s (%s)", output.ID, output.From, output.To, output.Library))
+	if output.IsEmpty() {
+		fmt.Println("No changes")
+		return
+	}
+
+	for _, group := range []struct {
+		title   string
+		changes []stepdiff.Change
+	}{
+		{colorstring.Red("Breaking changes"), output.Breaking},
+		{colorstring.Yellow("Behavioral changes"), output.Behavioral},
+		{colorstring.Green("Cosmetic changes"), output.Cosmetic},
+	} {
+		if len(group.changes) == 0 {
+			continue
+		}
+		fmt.Println()
+		fmt.Printf("%s (%d):\n", group.title, len(group.changes))
+		for _, change := range group.changes {
+			fmt.Printf(" * %s\n", change.Message)
+		}
+	}
+}
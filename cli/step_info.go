@@ -1,14 +1,20 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 
+	"github.com/bitrise-io/go-utils/colorstring"
 	"github.com/bitrise-io/go-utils/log"
 	"github.com/bitrise-io/stepman/models"
+	"github.com/bitrise-io/stepman/steplibrary"
 	"github.com/bitrise-io/stepman/stepman"
 	"github.com/urfave/cli"
 )
 
+const explainKey = "explain"
+
 //nolint:exhaustruct // CLI command definitions don't need all fields initialized
 var stepInfoCommand = cli.Command{
 	Name:  "step-info",
@@ -31,6 +37,10 @@ var stepInfoCommand = cli.Command{
 			Name:  "format",
 			Usage: "Output format (options: raw, json).",
 		},
+		cli.BoolFlag{
+			Name:  explainKey,
+			Usage: "Explain which library of the steplib search path (" + stepman.SearchPathEnvKey + ") the step resolves to, and which libraries it shadows. The step info printed is still that of --library, if given.",
+		},
 		cli.StringFlag{
 			Name:   "collection, c",
 			Usage:  "[DEPRECATED] Collection of step.",
@@ -70,13 +80,33 @@ func stepInfo(c *cli.Context) error {
 		}
 	}
 
-	if library == "" {
-		return fmt.Errorf("step info: missing required input: library")
-	}
 	if id == "" {
 		return fmt.Errorf("step info: missing required input: id")
 	}
 
+	// A step without a library resolves against the search path. An
+	// explained step is placed on the search path, with the given library as
+	// its last layer, but a given library is still the one queried.
+	var resolution *stepman.LibraryResolution
+	if library != "git" && library != "path" && (library == "" || c.Bool(explainKey)) {
+		if searchPath := stepman.SearchPath(library); len(searchPath) > 0 {
+			resolver := stepman.NewLibraryResolver(steplibrary.NewInventoryReader())
+			explained, err := resolver.Explain(searchPath, id, log.NewDefaultLogger(false))
+			if err != nil {
+				return fmt.Errorf("step info: %s", err)
+			}
+			if library == "" {
+				library = explained.Library
+			}
+			resolution = &explained
+		} else if c.Bool(explainKey) {
+			return fmt.Errorf("step info: no steplib search path configured in %s", stepman.SearchPathEnvKey)
+		}
+	}
+	if library == "" {
+		return fmt.Errorf("step info: missing required input: library")
+	}
+
 	version := c.String(VersionKey)
 
 	format := c.String(FormatKey)
@@ -98,10 +128,39 @@ func stepInfo(c *cli.Context) error {
 		return err
 	}
 
+	if resolution != nil && c.Bool(explainKey) {
+		logger.Print(StepInfoExplanation{LibraryResolution: *resolution, StepInfo: stepInfo})
+		return nil
+	}
 	logger.Print(stepInfo)
 	return nil
 }
 
+// StepInfoExplanation is the output of the step-info command with --explain.
+type StepInfoExplanation struct {
+	stepman.LibraryResolution
+	StepInfo models.StepInfoModel `json:"step_info"`
+}
+
+// String ...
+func (e StepInfoExplanation) String() string {
+	str := fmt.Sprintf("%s %s\n", colorstring.Blue("Search path:"), strings.Join(e.SearchPath, ", "))
+	str += fmt.Sprintf("%s %s\n", colorstring.Blue("Resolved library:"), e.Library)
+	if len(e.Shadowed) > 0 {
+		str += fmt.Sprintf("%s %s\n", colorstring.Yellow("Shadowed libraries:"), strings.Join(e.Shadowed, ", "))
+	}
+	return str + "\n" + e.StepInfo.String()
+}
+
+// JSON ...
+func (e StepInfoExplanation) JSON() string {
+	bytes, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Sprintf(`"Failed to marshal step info explanation (%#v), err: %s"`, e, err)
+	}
+	return string(bytes)
+}
+
 // QueryStepInfo returns a matching step info.
 // In cases of git and path sources the step.yml is read, otherwise the step is looked up in a step library.
 func QueryStepInfo(library, id, version string, log stepman.Logger) (models.StepInfoModel, error) {
@@ -111,6 +170,9 @@ func QueryStepInfo(library, id, version string, log stepman.Logger) (models.Step
 	case "path":
 		return stepman.QueryStepInfoFromPath(id)
 	default: // library step
+		if err := stepman.SetupLibraryWithReader(library, steplibrary.NewInventoryReader(), log); err != nil {
+			return models.StepInfoModel{}, fmt.Errorf("setup %s: %w", library, err)
+		}
 		return stepman.QueryStepInfoFromLibrary(library, id, version, log)
 	}
 }
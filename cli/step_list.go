@@ -12,6 +12,7 @@ import (
 	"github.com/bitrise-io/go-utils/stringutil"
 	"github.com/bitrise-io/stepman/activator/steplib"
 	"github.com/bitrise-io/stepman/models"
+	"github.com/bitrise-io/stepman/steplibrary"
 	"github.com/bitrise-io/stepman/stepman"
 	"github.com/urfave/cli"
 )
@@ -21,7 +22,7 @@ func ListCachedSteps(steplibURI, maintaner string, log stepman.Logger) error {
 	if exist, err := stepman.RootExistForLibrary(steplibURI); err != nil {
 		return err
 	} else if !exist {
-		if err := stepman.SetupLibrary(steplibURI, log); err != nil {
+		if err := stepman.SetupLibraryWithReader(steplibURI, steplibrary.NewInventoryReader(), log); err != nil {
 			failf("Failed to setup steplib")
 		}
 	}
@@ -116,7 +117,7 @@ func listSteps(stepLibURI, maintaner string, format string, log stepman.Logger,
 	if exist, err := stepman.RootExistForLibrary(stepLibURI); err != nil {
 		return err
 	} else if !exist {
-		if err := stepman.SetupLibrary(stepLibURI, log); err != nil {
+		if err := stepman.SetupLibraryWithReader(stepLibURI, steplibrary.NewInventoryReader(), log); err != nil {
 			failf("Failed to setup steplib")
 		}
 	}
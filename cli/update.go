@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-io/stepman/steplibrary"
 	"github.com/bitrise-io/stepman/stepman"
 	"github.com/urfave/cli"
 )
@@ -36,6 +37,6 @@ func update(c *cli.Context) error {
 
 // UpdateLibrary ...
 func UpdateLibrary(uri string, log stepman.Logger) error {
-	_, err := stepman.UpdateLibrary(uri, log)
+	_, err := stepman.UpdateLibraryWithReader(uri, steplibrary.NewInventoryReader(), log)
 	return err
 }
@@ -0,0 +1,176 @@
+// Package credentials authenticates stepman's requests to private steplibs,
+// inventories and step storages. Credentials are mapped by host and come from
+// the STEPMAN_HTTP_AUTH env var and the user's netrc file; they are attached
+// to HTTPS requests (see Transport) and git commands (see AuthenticateGit),
+// and are never part of a URL, a command line, a log line or an error.
+package credentials
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// AuthEnvKey is the env var of the per-host credentials: a semicolon-separated
+// list of <host>=bearer:<token> and <host>=basic:<username>:<password>
+// entries, e.g.
+// steplib.example.com=bearer:abc;storage.example.com:8443=basic:ci:secret.
+// A host with a port only matches requests to that port.
+const AuthEnvKey = "STEPMAN_HTTP_AUTH"
+
+// NetrcEnvKey overrides the path of the netrc file, ~/.netrc by default.
+const NetrcEnvKey = "NETRC"
+
+// Scheme is the HTTP authentication scheme of a Credential.
+type Scheme string
+
+// The supported authentication schemes.
+const (
+	Bearer Scheme = "bearer"
+	Basic  Scheme = "basic"
+)
+
+// Credential authenticates the requests to a host.
+type Credential struct {
+	Scheme Scheme
+	// Token of a Bearer credential.
+	Token string
+	// Username and Password of a Basic credential.
+	Username string
+	Password string
+}
+
+// Header returns the Authorization header value of the credential.
+func (c Credential) Header() string {
+	if c.Scheme == Basic {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.Username+":"+c.Password))
+	}
+	return "Bearer " + c.Token
+}
+
+// String redacts the secret, so that printing a credential doesn't leak it.
+func (c Credential) String() string {
+	return fmt.Sprintf("%s credential (redacted)", c.Scheme)
+}
+
+// GoString is String for the %#v verb.
+func (c Credential) GoString() string {
+	return c.String()
+}
+
+// Provider looks up the credential of a host.
+type Provider interface {
+	// Lookup returns the credential of host (a URL's host, with an optional
+	// port), false if it has none.
+	Lookup(host string) (Credential, bool)
+}
+
+// Hosts is a Provider mapping hosts, with an optional port, to credentials.
+type Hosts map[string]Credential
+
+// Lookup prefers the credential of the exact host:port, then that of the
+// hostname.
+func (h Hosts) Lookup(host string) (Credential, bool) {
+	host = strings.ToLower(host)
+	if credential, ok := h[host]; ok {
+		return credential, true
+	}
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		credential, ok := h[hostname]
+		return credential, ok
+	}
+	return Credential{}, false
+}
+
+// Chain is a Provider returning the credential of the first Provider that has
+// one.
+type Chain []Provider
+
+// Lookup ...
+func (c Chain) Lookup(host string) (Credential, bool) {
+	for _, provider := range c {
+		if credential, ok := provider.Lookup(host); ok {
+			return credential, true
+		}
+	}
+	return Credential{}, false
+}
+
+// FromEnvironment returns the credentials of AuthEnvKey, taking precedence
+// over those of the netrc file. A netrc file that can't be read is reported as
+// a warning, and leaves the AuthEnvKey credentials only.
+func FromEnvironment() (Provider, error) {
+	envHosts, err := ParseAuthEnv(os.Getenv(AuthEnvKey))
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", AuthEnvKey, err)
+	}
+
+	netrcPth := os.Getenv(NetrcEnvKey)
+	if netrcPth == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return envHosts, nil
+		}
+		netrcPth = filepath.Join(home, ".netrc")
+	}
+	netrcHosts, err := ReadNetrc(netrcPth)
+	if err != nil {
+		log.Warnf("Failed to read netrc credentials, using the %s ones only: %s", AuthEnvKey, err)
+		return envHosts, nil
+	}
+
+	return Chain{envHosts, netrcHosts}, nil
+}
+
+// Default returns the FromEnvironment credentials, read once per process. Bad
+// credential config is reported as a warning, and leaves requests
+// unauthenticated.
+var Default = sync.OnceValue(func() Provider {
+	provider, err := FromEnvironment()
+	if err != nil {
+		log.Warnf("Failed to read credentials, requests are sent unauthenticated: %s", err)
+		return Hosts{}
+	}
+	return provider
+})
+
+// ParseAuthEnv parses the value of AuthEnvKey. Errors name the offending
+// entry by its index and host only, never by its secret.
+func ParseAuthEnv(value string) (Hosts, error) {
+	hosts := Hosts{}
+	for i, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, auth, ok := strings.Cut(entry, "=")
+		host = strings.ToLower(strings.TrimSpace(host))
+		if !ok || host == "" {
+			return nil, fmt.Errorf("entry #%d: not in <host>=<scheme>:<secret> format", i+1)
+		}
+
+		scheme, secret, _ := strings.Cut(auth, ":")
+		switch Scheme(strings.ToLower(scheme)) {
+		case Bearer:
+			if secret == "" {
+				return nil, fmt.Errorf("entry #%d (%s): empty bearer token", i+1, host)
+			}
+			hosts[host] = Credential{Scheme: Bearer, Token: secret, Username: "", Password: ""}
+		case Basic:
+			username, password, ok := strings.Cut(secret, ":")
+			if !ok || username == "" {
+				return nil, fmt.Errorf("entry #%d (%s): basic credential not in <username>:<password> format", i+1, host)
+			}
+			hosts[host] = Credential{Scheme: Basic, Token: "", Username: username, Password: password}
+		default:
+			return nil, fmt.Errorf("entry #%d (%s): unknown scheme, valid schemes: %s, %s", i+1, host, Bearer, Basic)
+		}
+	}
+	return hosts, nil
+}
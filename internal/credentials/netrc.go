@@ -0,0 +1,107 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// ReadNetrc reads the Basic credentials of the machines of the netrc file at
+// pth; a missing file has none. The default entry is ignored, so credentials
+// are only ever sent to the hosts they were configured for.
+func ReadNetrc(pth string) (Hosts, error) {
+	content, err := os.ReadFile(pth)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Hosts{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read netrc file: %w", err)
+	}
+	hosts, err := ParseNetrc(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("parse netrc file (%s): %w", pth, err)
+	}
+	return hosts, nil
+}
+
+// ParseNetrc parses the content of a netrc file. Like curl's and Go's netrc
+// readers, it reads tokens regardless of line breaks and skips the tokens it
+// doesn't know. Machines without a password are skipped.
+func ParseNetrc(content string) (Hosts, error) {
+	hosts := Hosts{}
+
+	machine, login, password := "", "", ""
+	inEntry := false
+	flush := func() {
+		if machine != "" && password != "" {
+			if _, ok := hosts[machine]; !ok {
+				hosts[machine] = Credential{Scheme: Basic, Token: "", Username: login, Password: password}
+			}
+		}
+		machine, login, password = "", "", ""
+	}
+
+	tokens := netrcTokens(content)
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		switch token.text {
+		case "machine", "login", "password", "account":
+			if i+1 >= len(tokens) {
+				return nil, fmt.Errorf("line %d: %s without a value", token.line, token.text)
+			}
+			i++
+			value := tokens[i].text
+			switch token.text {
+			case "machine":
+				flush()
+				inEntry = true
+				machine = strings.ToLower(value)
+			case "login":
+				if inEntry {
+					login = value
+				}
+			case "password":
+				if inEntry {
+					password = value
+				}
+			}
+		case "default", "macdef":
+			flush()
+			inEntry = false
+		}
+	}
+	flush()
+
+	return hosts, nil
+}
+
+// netrcToken is a whitespace-separated token of a netrc file and the line it
+// is on.
+type netrcToken struct {
+	text string
+	line int
+}
+
+// netrcTokens splits the content of a netrc file into tokens, dropping
+// comments and macro definitions: a macdef token is kept, but its name and
+// body, which runs until the next blank line, are not.
+func netrcTokens(content string) []netrcToken {
+	var tokens []netrcToken
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		for _, field := range strings.Fields(lines[i]) {
+			if strings.HasPrefix(field, "#") {
+				break
+			}
+			tokens = append(tokens, netrcToken{text: field, line: i + 1})
+			if field == "macdef" {
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				break
+			}
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,67 @@
+package credentials
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/stepman/internal/gitenv"
+)
+
+// Transport is an http.RoundTripper authenticating the HTTPS requests to the
+// hosts its Provider has a credential for. Requests over plain HTTP, and ones
+// already carrying an Authorization header, are sent as they are. As it is
+// consulted on every hop, a redirect to another host gets that host's
+// credential, if any, instead of the original one.
+type Transport struct {
+	base     http.RoundTripper
+	provider Provider
+}
+
+// NewTransport returns a Transport sending the requests through base, or
+// http.DefaultTransport if nil.
+func NewTransport(base http.RoundTripper, provider Provider) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{base: base, provider: provider}
+}
+
+// RoundTrip ...
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" || req.Header.Get("Authorization") != "" {
+		return t.base.RoundTrip(req)
+	}
+	credential, ok := t.provider.Lookup(req.URL.Host)
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the caller's request.
+	authenticated := req.Clone(req.Context())
+	authenticated.Header.Set("Authorization", credential.Header())
+	return t.base.RoundTrip(authenticated)
+}
+
+// AuthenticateGit makes the git command cmd, talking to the repository at
+// repoURL, authenticate with the Default credential of its host. The
+// credential is passed as an http.extraHeader through the env of the command
+// (see gitenv), so it is neither on its command line (which shows up in
+// process lists and error messages) nor written to a git config file. Only
+// HTTPS repository URLs are authenticated.
+func AuthenticateGit(cmd *command.Model, repoURL string) *command.Model {
+	return authenticateGit(cmd, repoURL, Default())
+}
+
+func authenticateGit(cmd *command.Model, repoURL string, provider Provider) *command.Model {
+	u, err := url.Parse(repoURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return cmd
+	}
+	credential, ok := provider.Lookup(u.Host)
+	if !ok {
+		return cmd
+	}
+
+	return gitenv.AppendConfig(cmd, "http.https://"+u.Host+"/.extraHeader", "Authorization: "+credential.Header())
+}
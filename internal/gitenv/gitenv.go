@@ -0,0 +1,41 @@
+// Package gitenv passes git config to a single git command through the
+// GIT_CONFIG_COUNT, GIT_CONFIG_KEY_<n> and GIT_CONFIG_VALUE_<n> env vars (git
+// 2.31+), so that neither the command line nor a git config file holds it.
+package gitenv
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/command"
+)
+
+const countKey = "GIT_CONFIG_COUNT"
+
+// AppendConfig adds the key=value git config to the env of cmd, after the
+// config entries its env may already define.
+func AppendConfig(cmd *command.Model, key, value string) *command.Model {
+	execCmd := cmd.GetCmd()
+	env := execCmd.Env
+	if env == nil {
+		env = execCmd.Environ()
+	}
+
+	// The last GIT_CONFIG_COUNT of the env is the effective one.
+	count := 0
+	for _, kv := range env {
+		if value, ok := strings.CutPrefix(kv, countKey+"="); ok {
+			if n, err := strconv.Atoi(value); err == nil {
+				count = n
+			}
+		}
+	}
+
+	index := strconv.Itoa(count)
+	execCmd.Env = append(env,
+		"GIT_CONFIG_KEY_"+index+"="+key,
+		"GIT_CONFIG_VALUE_"+index+"="+value,
+		countKey+"="+strconv.Itoa(count+1),
+	)
+	return cmd
+}
@@ -0,0 +1,80 @@
+package httpconfig
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/stepman/internal/credentials"
+	"github.com/bitrise-io/stepman/internal/gitenv"
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+// Logger is the minimal logging interface of the retries.
+type Logger interface {
+	Debugf(format string, v ...any)
+}
+
+// retryhttpLogger adapts Logger to the retryablehttp.Logger interface (Printf only).
+type retryhttpLogger struct{ l Logger }
+
+func (r *retryhttpLogger) Printf(f string, v ...any) { r.l.Debugf(f, v...) }
+
+// NewRetryableClient returns a retryablehttp client sending its requests
+// through the transport of the Default config, authenticated with the default
+// credentials (see credentials.Default), and retrying them by its retry
+// policy. The retries are logged to logger, or not at all if nil.
+func NewRetryableClient(logger Logger) *retryablehttp.Client {
+	return newRetryableClient(Default(), credentials.Default(), logger)
+}
+
+func newRetryableClient(config Config, provider credentials.Provider, logger Logger) *retryablehttp.Client {
+	client := retryablehttp.NewClient()
+	client.Logger = nil
+	if logger != nil {
+		client.Logger = &retryhttpLogger{l: logger}
+	}
+	client.RetryMax = config.MaxRetries
+	client.RetryWaitMin = config.RetryWaitMin
+	client.RetryWaitMax = config.RetryWaitMax
+
+	transport, err := config.Transport()
+	if err != nil {
+		// Load validates the config, so only an unreadable CA bundle gets
+		// here: the requests it'd be needed for fail with a TLS error anyway.
+		if logger != nil {
+			logger.Debugf("Failed to apply HTTP transport config: %s", err)
+		}
+		transport, _ = DefaultConfig().Transport()
+	}
+	client.HTTPClient.Transport = credentials.NewTransport(transport, provider)
+	return client
+}
+
+// ConfigureGit applies the Default config and the default credentials (see
+// credentials.AuthenticateGit) to the git command cmd talking to the
+// repository at repoURL: the proxy as http.proxy, and the read timeout as
+// http.lowSpeedTime. The CA bundle is not applied, as git's http.sslCAInfo
+// would replace the system CAs instead of extending them; use GIT_SSL_CAINFO
+// for git.
+func ConfigureGit(cmd *command.Model, repoURL string) *command.Model {
+	return configureGit(cmd, repoURL, Default())
+}
+
+func configureGit(cmd *command.Model, repoURL string, config Config) *command.Model {
+	credentials.AuthenticateGit(cmd, repoURL)
+
+	if u, err := url.Parse(repoURL); err != nil || u.Scheme != "https" {
+		return cmd
+	}
+	if config.Proxy != "" {
+		gitenv.AppendConfig(cmd, "http.proxy", config.Proxy)
+	}
+	if config.ReadTimeout > 0 {
+		// Abort a transfer below 1 byte/s for the read timeout.
+		seconds := max(int(config.ReadTimeout.Seconds()), 1)
+		gitenv.AppendConfig(cmd, "http.lowSpeedLimit", "1")
+		gitenv.AppendConfig(cmd, "http.lowSpeedTime", strconv.Itoa(seconds))
+	}
+	return cmd
+}
@@ -0,0 +1,302 @@
+// Package httpconfig is the transport config shared by all of stepman's
+// network calls: the HTTPS proxy, an extra CA bundle (e.g. of a
+// TLS-intercepting corporate proxy), connect and read timeouts and the retry
+// policy. It is read from the http section of the stepman config file
+// (~/.stepman/config.yml), overridden by the STEPMAN_* env vars below.
+//
+// NewRetryableClient builds the HTTP clients, ConfigureGit applies the config
+// to git commands.
+package httpconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+	"gopkg.in/yaml.v2"
+)
+
+// The env vars overriding the config file.
+const (
+	ConfigPathEnvKey     = "STEPMAN_CONFIG"
+	ProxyEnvKey          = "STEPMAN_HTTPS_PROXY"
+	CABundleEnvKey       = "STEPMAN_CA_BUNDLE"
+	ConnectTimeoutEnvKey = "STEPMAN_HTTP_CONNECT_TIMEOUT"
+	ReadTimeoutEnvKey    = "STEPMAN_HTTP_READ_TIMEOUT"
+	MaxRetriesEnvKey     = "STEPMAN_HTTP_MAX_RETRIES"
+	RetryWaitMinEnvKey   = "STEPMAN_HTTP_RETRY_WAIT_MIN"
+	RetryWaitMaxEnvKey   = "STEPMAN_HTTP_RETRY_WAIT_MAX"
+)
+
+// Config is the transport config. Durations are Go durations (e.g. 30s) in
+// both the config file and the env vars.
+type Config struct {
+	// Proxy is the URL of the proxy of HTTPS requests. If empty, the
+	// HTTPS_PROXY and NO_PROXY env vars apply.
+	Proxy string
+	// CABundle is the path of a PEM file of CA certificates trusted on top of
+	// the system ones.
+	CABundle string
+	// ConnectTimeout limits establishing a connection, TLS handshake included.
+	ConnectTimeout time.Duration
+	// ReadTimeout limits the wait for the next bytes of a response; 0 means no
+	// limit.
+	ReadTimeout time.Duration
+	// MaxRetries is the number of retries of a failed request, with an
+	// exponential backoff between RetryWaitMin and RetryWaitMax.
+	MaxRetries   int
+	RetryWaitMin time.Duration
+	RetryWaitMax time.Duration
+}
+
+// DefaultConfig is the config without a config file or env vars: the
+// timeouts of http.DefaultTransport and the retry policy of retryablehttp.
+func DefaultConfig() Config {
+	return Config{
+		Proxy:          "",
+		CABundle:       "",
+		ConnectTimeout: 30 * time.Second,
+		ReadTimeout:    0,
+		MaxRetries:     4,
+		RetryWaitMin:   time.Second,
+		RetryWaitMax:   30 * time.Second,
+	}
+}
+
+// ConfigPath returns the path of the stepman config file: ConfigPathEnvKey,
+// or config.yml in the stepman dir.
+func ConfigPath() string {
+	if pth := os.Getenv(ConfigPathEnvKey); pth != "" {
+		return pth
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	// The stepman dir, see stepman.GetStepmanDirPath.
+	return filepath.Join(home, ".stepman", "config.yml")
+}
+
+// fileModel is the http section of the config file.
+type fileModel struct {
+	HTTP struct {
+		Proxy          string `yaml:"proxy"`
+		CABundle       string `yaml:"ca_bundle"`
+		ConnectTimeout string `yaml:"connect_timeout"`
+		ReadTimeout    string `yaml:"read_timeout"`
+		MaxRetries     *int   `yaml:"max_retries"`
+		RetryWaitMin   string `yaml:"retry_wait_min"`
+		RetryWaitMax   string `yaml:"retry_wait_max"`
+	} `yaml:"http"`
+}
+
+// Load returns DefaultConfig, overridden by the config file at ConfigPath (if
+// it exists), overridden by the env vars.
+func Load() (Config, error) {
+	config := DefaultConfig()
+
+	if pth := ConfigPath(); pth != "" {
+		content, err := os.ReadFile(pth)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return Config{}, fmt.Errorf("read config file: %w", err)
+		}
+		if err == nil {
+			if err := config.applyFile(content); err != nil {
+				return Config{}, fmt.Errorf("config file (%s): %w", pth, err)
+			}
+		}
+	}
+
+	if err := config.applyEnv(); err != nil {
+		return Config{}, err
+	}
+	return config, config.validate()
+}
+
+func (c *Config) applyFile(content []byte) error {
+	var file fileModel
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return err
+	}
+
+	setString(&c.Proxy, file.HTTP.Proxy)
+	setString(&c.CABundle, file.HTTP.CABundle)
+	if file.HTTP.MaxRetries != nil {
+		c.MaxRetries = *file.HTTP.MaxRetries
+	}
+	for key, field := range map[string]struct {
+		value string
+		dest  *time.Duration
+	}{
+		"http.connect_timeout": {file.HTTP.ConnectTimeout, &c.ConnectTimeout},
+		"http.read_timeout":    {file.HTTP.ReadTimeout, &c.ReadTimeout},
+		"http.retry_wait_min":  {file.HTTP.RetryWaitMin, &c.RetryWaitMin},
+		"http.retry_wait_max":  {file.HTTP.RetryWaitMax, &c.RetryWaitMax},
+	} {
+		if err := setDuration(field.dest, field.value); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) applyEnv() error {
+	setString(&c.Proxy, os.Getenv(ProxyEnvKey))
+	setString(&c.CABundle, os.Getenv(CABundleEnvKey))
+	if value := os.Getenv(MaxRetriesEnvKey); value != "" {
+		maxRetries, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", MaxRetriesEnvKey, err)
+		}
+		c.MaxRetries = maxRetries
+	}
+	for key, dest := range map[string]*time.Duration{
+		ConnectTimeoutEnvKey: &c.ConnectTimeout,
+		ReadTimeoutEnvKey:    &c.ReadTimeout,
+		RetryWaitMinEnvKey:   &c.RetryWaitMin,
+		RetryWaitMaxEnvKey:   &c.RetryWaitMax,
+	} {
+		if err := setDuration(dest, os.Getenv(key)); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func (c Config) validate() error {
+	if c.Proxy != "" {
+		proxyURL, err := url.Parse(c.Proxy)
+		if err != nil || proxyURL.Scheme == "" || proxyURL.Host == "" {
+			// The proxy URL may hold credentials, so it is not echoed.
+			return errors.New("invalid proxy URL")
+		}
+	}
+	if c.ConnectTimeout < 0 || c.ReadTimeout < 0 || c.RetryWaitMin < 0 || c.RetryWaitMax < 0 {
+		return errors.New("negative timeout")
+	}
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("negative max retries: %d", c.MaxRetries)
+	}
+	if c.RetryWaitMin > c.RetryWaitMax {
+		return fmt.Errorf("retry wait min (%s) is greater than max (%s)", c.RetryWaitMin, c.RetryWaitMax)
+	}
+	return nil
+}
+
+func setString(dest *string, value string) {
+	if value != "" {
+		*dest = value
+	}
+}
+
+func setDuration(dest *time.Duration, value string) error {
+	if value == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*dest = d
+	return nil
+}
+
+// Default returns the Load config, read once per process. A bad config is
+// reported as a warning, and DefaultConfig is used instead.
+var Default = sync.OnceValue(func() Config {
+	config, err := Load()
+	if err != nil {
+		log.Warnf("Failed to read HTTP transport config, using the defaults: %s", err)
+		return DefaultConfig()
+	}
+	return config
+})
+
+// Transport returns an *http.Transport applying the proxy, CA bundle and
+// timeouts of the config.
+func (c Config) Transport() (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	transport.Proxy = http.ProxyFromEnvironment
+	if c.Proxy != "" {
+		proxyURL, err := url.Parse(c.Proxy)
+		if err != nil {
+			return nil, errors.New("invalid proxy URL")
+		}
+		transport.Proxy = httpsProxy(proxyURL)
+	}
+
+	if c.CABundle != "" {
+		pool, err := certPool(c.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12} //nolint:exhaustruct // only the roots differ from the defaults
+	}
+
+	dialer := &net.Dialer{Timeout: c.ConnectTimeout, KeepAlive: 30 * time.Second} //nolint:exhaustruct // the other zero values are net.Dialer's defaults
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil || c.ReadTimeout == 0 {
+			return conn, err
+		}
+		return &readTimeoutConn{Conn: conn, timeout: c.ReadTimeout}, nil
+	}
+	transport.TLSHandshakeTimeout = c.ConnectTimeout
+	transport.ResponseHeaderTimeout = c.ReadTimeout
+
+	return transport, nil
+}
+
+// httpsProxy proxies the HTTPS requests through proxyURL. Plain HTTP requests
+// keep using the HTTP_PROXY and NO_PROXY env vars.
+func httpsProxy(proxyURL *url.URL) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		if req.URL.Scheme == "https" {
+			return proxyURL, nil
+		}
+		return http.ProxyFromEnvironment(req)
+	}
+}
+
+// certPool returns the system CA pool extended with the PEM certificates of
+// the file at pth.
+func certPool(pth string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(pth)
+	if err != nil {
+		return nil, fmt.Errorf("read CA bundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("CA bundle (%s) holds no PEM certificates", pth)
+	}
+	return pool, nil
+}
+
+// readTimeoutConn fails a Read that waits for data longer than timeout.
+type readTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *readTimeoutConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
@@ -0,0 +1,239 @@
+package httpconfig
+
+import (
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/stepman/internal/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setConfigFile points ConfigPath to a config file with content, and clears
+// the env overrides.
+func setConfigFile(t *testing.T, content string) {
+	pth := filepath.Join(t.TempDir(), "config.yml")
+	if content != "" {
+		require.NoError(t, os.WriteFile(pth, []byte(content), 0o600))
+	}
+	t.Setenv(ConfigPathEnvKey, pth)
+	for _, key := range []string{ProxyEnvKey, CABundleEnvKey, ConnectTimeoutEnvKey, ReadTimeoutEnvKey, MaxRetriesEnvKey, RetryWaitMinEnvKey, RetryWaitMaxEnvKey} {
+		t.Setenv(key, "")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	const configFile = `http:
+  proxy: http://proxy.example.com:3128
+  ca_bundle: /etc/ssl/corp.pem
+  connect_timeout: 5s
+  read_timeout: 1m
+  max_retries: 0
+`
+
+	cases := map[string]struct {
+		file    string
+		env     map[string]string
+		want    Config
+		wantErr string
+	}{
+		"no config file": {
+			want: DefaultConfig(),
+		},
+		"config file": {
+			file: configFile,
+			want: Config{
+				Proxy:          "http://proxy.example.com:3128",
+				CABundle:       "/etc/ssl/corp.pem",
+				ConnectTimeout: 5 * time.Second,
+				ReadTimeout:    time.Minute,
+				MaxRetries:     0,
+				RetryWaitMin:   time.Second,
+				RetryWaitMax:   30 * time.Second,
+			},
+		},
+		"env overrides the config file": {
+			file: configFile,
+			env: map[string]string{
+				ProxyEnvKey:        "http://other-proxy.example.com",
+				ReadTimeoutEnvKey:  "10s",
+				MaxRetriesEnvKey:   "2",
+				RetryWaitMaxEnvKey: "2s",
+			},
+			want: Config{
+				Proxy:          "http://other-proxy.example.com",
+				CABundle:       "/etc/ssl/corp.pem",
+				ConnectTimeout: 5 * time.Second,
+				ReadTimeout:    10 * time.Second,
+				MaxRetries:     2,
+				RetryWaitMin:   time.Second,
+				RetryWaitMax:   2 * time.Second,
+			},
+		},
+		"invalid duration in the config file": {
+			file:    "http:\n  connect_timeout: 5\n",
+			wantErr: `http.connect_timeout: time: missing unit in duration "5"`,
+		},
+		"invalid env": {
+			env:     map[string]string{MaxRetriesEnvKey: "many"},
+			wantErr: `STEPMAN_HTTP_MAX_RETRIES: strconv.Atoi: parsing "many": invalid syntax`,
+		},
+		"invalid proxy URL is not echoed": {
+			env:     map[string]string{ProxyEnvKey: "user:secret@proxy"},
+			wantErr: "invalid proxy URL",
+		},
+		"retry wait min greater than max": {
+			env:     map[string]string{RetryWaitMinEnvKey: "1m"},
+			wantErr: "retry wait min (1m0s) is greater than max (30s)",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			setConfigFile(t, tc.file)
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+
+			config, err := Load()
+			if tc.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, config)
+		})
+	}
+}
+
+func TestConfig_Transport_CABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(server.Close)
+
+	get := func(config Config) error {
+		transport, err := config.Transport()
+		require.NoError(t, err)
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	require.Error(t, get(DefaultConfig()), "the test server's CA isn't trusted by default")
+
+	caBundle := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caBundle, certPEM, 0o600))
+	config := DefaultConfig()
+	config.CABundle = caBundle
+	require.NoError(t, get(config))
+
+	require.NoError(t, os.WriteFile(caBundle, []byte("not a certificate"), 0o600))
+	_, err := config.Transport()
+	require.EqualError(t, err, "CA bundle ("+caBundle+") holds no PEM certificates")
+}
+
+func TestConfig_Transport_proxy(t *testing.T) {
+	t.Setenv("HTTP_PROXY", "")
+	config := DefaultConfig()
+	config.Proxy = "http://proxy.example.com:3128"
+	transport, err := config.Transport()
+	require.NoError(t, err)
+
+	proxyURL, err := transport.Proxy(httptest.NewRequest(http.MethodGet, "https://steplib.example.com/v2/meta.json", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "http://proxy.example.com:3128", proxyURL.String())
+
+	proxyURL, err = transport.Proxy(httptest.NewRequest(http.MethodGet, "http://steplib.example.com/v2/meta.json", nil))
+	require.NoError(t, err)
+	assert.Nil(t, proxyURL, "plain HTTP falls back to the env")
+}
+
+func TestConfig_Transport_readTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "2")
+		_, _ = w.Write([]byte("a"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	config := DefaultConfig()
+	config.ReadTimeout = 50 * time.Millisecond
+	transport, err := config.Transport()
+	require.NoError(t, err)
+
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	_, err = io.ReadAll(resp.Body)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "timeout")
+}
+
+func TestNewRetryableClient(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	caBundle := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caBundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	config := DefaultConfig()
+	config.CABundle = caBundle
+	config.MaxRetries = 2
+	config.RetryWaitMin = time.Millisecond
+	config.RetryWaitMax = time.Millisecond
+	client := newRetryableClient(config, credentials.Hosts{serverURL.Host: {Scheme: credentials.Bearer, Token: "token"}}, nil)
+
+	_, err = client.Get(server.URL)
+	require.Error(t, err)
+	assert.Equal(t, int32(3), requests.Load(), "a request and 2 retries")
+}
+
+func TestConfigureGit(t *testing.T) {
+	config := DefaultConfig()
+	config.Proxy = "http://proxy.example.com:3128"
+	config.ReadTimeout = 1500 * time.Millisecond
+
+	cmd := command.New("git", "clone", "https://git.example.com/steps/script.git")
+	cmd.SetEnvs("GIT_ASKPASS=echo")
+	configureGit(cmd, "https://git.example.com/steps/script.git", config)
+	assert.Equal(t, []string{
+		"GIT_ASKPASS=echo",
+		"GIT_CONFIG_KEY_0=http.proxy",
+		"GIT_CONFIG_VALUE_0=http://proxy.example.com:3128",
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_1=http.lowSpeedLimit",
+		"GIT_CONFIG_VALUE_1=1",
+		"GIT_CONFIG_COUNT=2",
+		"GIT_CONFIG_KEY_2=http.lowSpeedTime",
+		"GIT_CONFIG_VALUE_2=1",
+		"GIT_CONFIG_COUNT=3",
+	}, cmd.GetCmd().Env)
+
+	cmd = command.New("git", "clone", "git@git.example.com:steps/script.git")
+	cmd.SetEnvs("GIT_ASKPASS=echo")
+	configureGit(cmd, "git@git.example.com:steps/script.git", config)
+	assert.Equal(t, []string{"GIT_ASKPASS=echo"}, cmd.GetCmd().Env, "SSH remotes are left alone")
+}
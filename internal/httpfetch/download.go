@@ -0,0 +1,352 @@
+package httpfetch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/stepman/internal/integrity"
+)
+
+const (
+	// partialSuffix names the partial file a failed download leaves
+	// alongside its destination, and partialMetaSuffix the JSON file
+	// describing it (see partialMeta).
+	partialSuffix     = ".partial"
+	partialMetaSuffix = ".partial.json"
+	// maxResumes bounds the resumes of a download within one call, after its
+	// connection dropped mid-body.
+	maxResumes = 3
+)
+
+// partialMeta tells what the partial file of a destination is a prefix of:
+// the response of URL with the strong validator ETag.
+type partialMeta struct {
+	URL  string `json:"url"`
+	ETag string `json:"etag"`
+}
+
+// partialDownload is the temp file a download writes to, with what's needed to
+// resume it.
+type partialDownload struct {
+	file     *os.File
+	verifier *integrity.Verifier
+	size     int64
+	// url is where the content of the file comes from.
+	url string
+	// etag is the strong validator of the response the file holds a prefix
+	// of, if the server accepts byte ranges for it. A download without one
+	// can't be resumed.
+	etag string
+}
+
+func (c *client) Download(ctx context.Context, destPath, url string) error {
+	return c.download(ctx, destPath, []string{url}, "", Hedge{Delay: 0, Latencies: nil})
+}
+
+func (c *client) DownloadWithHash(ctx context.Context, destPath, url, expectedHash string) error {
+	if expectedHash == "" {
+		return fmt.Errorf("hash is empty")
+	}
+	return c.download(ctx, destPath, []string{url}, expectedHash, Hedge{Delay: 0, Latencies: nil})
+}
+
+// download fetches the first of urls to respond (see sendHedged) into a temp
+// file alongside destPath and atomically renames it into place. When
+// expectedHash is non-empty the content is verified against it (see
+// integrity.Parse) before the rename, so a mismatched or partial file never
+// lands at destPath.
+//
+// A download the server can resume (see partialDownload.etag) is resumed
+// with a range request when its connection drops, and when it fails anyway
+// its temp file is kept as destPath's partial file, for the next download of
+// the same url to resume from.
+func (c *client) download(ctx context.Context, destPath string, urls []string, expectedHash string, hedge Hedge) (err error) {
+	var expected integrity.Hash
+	if expectedHash != "" {
+		if expected, err = integrity.Parse(expectedHash); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(destPath), 0o755); err != nil {
+		return fmt.Errorf("create dest dir for %s: %w", destPath, err)
+	}
+
+	p, err := claimPartial(destPath, urls, expected)
+	if err != nil {
+		return err
+	}
+	keep, closed := false, false
+	defer func() {
+		// A failed Close is intentionally a hard failure: it can mean the final
+		// write never flushed to disk, so the temp file may be incomplete.
+		if !closed {
+			if closeErr := p.file.Close(); closeErr != nil {
+				err = errors.Join(err, fmt.Errorf("close %s: %w", p.file.Name(), closeErr))
+				keep = false
+			}
+		}
+		if err == nil {
+			return
+		}
+		if keep {
+			if keepErr := p.keep(destPath); keepErr == nil {
+				return
+			}
+		}
+		// Best-effort cleanup of the temp file; the original error is what
+		// matters, so a failed remove is intentionally ignored.
+		_ = os.Remove(p.file.Name())
+	}()
+
+	for resumes := 0; ; resumes++ {
+		interrupted, err := c.fetchInto(ctx, urls, p, hedge)
+		if err == nil {
+			break
+		}
+		keep = interrupted && p.resumable()
+		if !keep || resumes == maxResumes || ctx.Err() != nil {
+			return err
+		}
+		// Resume from the mirror the file comes from.
+		urls = []string{p.url}
+	}
+
+	if err := p.verifier.Verify(); err != nil {
+		return fmt.Errorf("verify %s: %w", p.url, err)
+	}
+	closed = true
+	if err := p.file.Close(); err != nil {
+		return fmt.Errorf("close %s: %w", p.file.Name(), err)
+	}
+	if err := os.Rename(p.file.Name(), destPath); err != nil {
+		return fmt.Errorf("rename %s to %s: %w", p.file.Name(), destPath, err)
+	}
+	return nil
+}
+
+// fetchInto requests urls, p.url from the end of p if it can be resumed, and
+// writes the body of the first response to p. It reports whether the error,
+// if any, interrupted the body, so that the download may be resumed.
+func (c *client) fetchInto(ctx context.Context, urls []string, p *partialDownload, hedge Hedge) (interrupted bool, err error) {
+	var url string
+	var resp *http.Response
+	if len(urls) == 1 {
+		url = urls[0]
+		resp, err = c.send(ctx, OpDownload, url, p.header(url))
+	} else {
+		url, resp, err = c.sendHedged(ctx, urls, p, hedge)
+	}
+	if err != nil {
+		var statusErr *StatusError
+		if p.resumable() && errors.As(err, &statusErr) && statusErr.Code == http.StatusRequestedRangeNotSatisfiable {
+			// The partial file is no longer a prefix of the resource.
+			if err := p.reset(); err != nil {
+				return false, err
+			}
+			return c.fetchInto(ctx, urls, p, hedge)
+		}
+		return false, err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("close response body: %w", closeErr))
+		}
+	}()
+
+	if resp.StatusCode == http.StatusPartialContent && p.header(url).Get("Range") == "" {
+		// p is unchanged since the request, so this is the header it was sent
+		// with.
+		return false, fmt.Errorf("GET %s: unexpected status %d in reply to a request without Range", url, resp.StatusCode)
+	}
+	if resp.StatusCode == http.StatusPartialContent && !p.resumes(url, resp) {
+		// A range of another response, which the file is no prefix of: start
+		// over with the whole body. The retry has no Range header, so a 206
+		// can't make it recurse again.
+		if err := p.reset(); err != nil {
+			return false, err
+		}
+		return c.fetchInto(ctx, []string{url}, p, hedge)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		if err := p.reset(); err != nil {
+			return false, err
+		}
+		p.url, p.etag = url, resumeValidator(resp)
+	}
+
+	body := &readErrRecorder{Reader: resp.Body, err: nil}
+	n, err := io.Copy(io.MultiWriter(p.file, p.verifier), body)
+	p.size += n
+	if err != nil {
+		return body.err != nil, fmt.Errorf("write to %s: %w", p.file.Name(), err)
+	}
+	return false, nil
+}
+
+func (p *partialDownload) resumable() bool {
+	return p.etag != "" && p.size > 0
+}
+
+// header returns the header of a request of url: a range request from the end
+// of p if it can be resumed from url.
+func (p *partialDownload) header(url string) http.Header {
+	header := http.Header{}
+	if p.resumable() && url == p.url {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", p.size))
+		header.Set("If-Range", p.etag)
+	}
+	return header
+}
+
+// resumes tells whether the 206 resp of url continues p: a range of the
+// response p holds a prefix of, starting at its end.
+func (p *partialDownload) resumes(url string, resp *http.Response) bool {
+	if !p.resumable() || url != p.url || resp.Header.Get("ETag") != p.etag {
+		return false
+	}
+	start, ok := contentRangeStart(resp.Header.Get("Content-Range"))
+	return ok && start == p.size
+}
+
+// reset empties p, to write a whole response to it.
+func (p *partialDownload) reset() error {
+	if _, err := p.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("rewind %s: %w", p.file.Name(), err)
+	}
+	if err := p.file.Truncate(0); err != nil {
+		return fmt.Errorf("truncate %s: %w", p.file.Name(), err)
+	}
+	p.verifier.Reset()
+	p.size = 0
+	p.etag = ""
+	return nil
+}
+
+// keep makes the temp file of p the partial file of destPath. The metadata is
+// written first: a partial file without it is never resumed.
+func (p *partialDownload) keep(destPath string) error {
+	meta, err := json.Marshal(partialMeta{URL: p.url, ETag: p.etag})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(destPath+partialMetaSuffix, meta, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(p.file.Name(), destPath+partialSuffix)
+}
+
+// claimPartial returns the temp file of a download of one of urls to destPath,
+// verified against expected.
+// It takes over destPath's partial file if that holds a prefix of one of them,
+// and removes it otherwise. The partial file is renamed to the temp file before it is read,
+// so concurrent downloads never share it.
+func claimPartial(destPath string, urls []string, expected integrity.Hash) (*partialDownload, error) {
+	dir := filepath.Dir(destPath)
+	// Place the temp file alongside destPath so the final rename stays on
+	// one filesystem (cross-filesystem renames fail on most kernels).
+	tmp, err := os.CreateTemp(dir, "download-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("create temp file in %s: %w", dir, err)
+	}
+	p := &partialDownload{file: tmp, verifier: integrity.NewVerifier(expected), size: 0, url: "", etag: ""}
+
+	meta, ok := readPartialMeta(destPath)
+	// Whatever happens next, the partial file is either claimed or stale.
+	_ = os.Remove(destPath + partialMetaSuffix)
+	if !ok || !slices.Contains(urls, meta.URL) || meta.ETag == "" {
+		_ = os.Remove(destPath + partialSuffix)
+		return p, nil
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return nil, fmt.Errorf("close %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(destPath+partialSuffix, tmp.Name()); err != nil {
+		// Claimed by another download, or gone: start from scratch.
+		return reopen(p, os.O_RDWR|os.O_TRUNC)
+	}
+	if _, err := reopen(p, os.O_RDWR); err != nil {
+		return nil, err
+	}
+	// Hash the prefix, leaving the offset at its end for the rest.
+	n, err := io.Copy(p.verifier, p.file)
+	if err != nil {
+		_ = p.file.Close()
+		_ = os.Remove(p.file.Name())
+		return nil, fmt.Errorf("read %s: %w", p.file.Name(), err)
+	}
+	p.size, p.url, p.etag = n, meta.URL, meta.ETag
+	return p, nil
+}
+
+func reopen(p *partialDownload, flag int) (*partialDownload, error) {
+	file, err := os.OpenFile(p.file.Name(), flag, 0o600)
+	if err != nil {
+		_ = os.Remove(p.file.Name())
+		return nil, fmt.Errorf("open %s: %w", p.file.Name(), err)
+	}
+	p.file = file
+	return p, nil
+}
+
+func readPartialMeta(destPath string) (partialMeta, bool) {
+	var meta partialMeta
+	b, err := os.ReadFile(destPath + partialMetaSuffix)
+	if err != nil {
+		return meta, false
+	}
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return meta, false
+	}
+	return meta, true
+}
+
+// resumeValidator returns the validator to resume the download of resp with:
+// its ETag, if the server accepts byte ranges and the ETag is strong (a weak
+// one doesn't guarantee byte-for-byte equal content), or "".
+func resumeValidator(resp *http.Response) string {
+	etag := resp.Header.Get("ETag")
+	if resp.Header.Get("Accept-Ranges") != "bytes" || etag == "" || strings.HasPrefix(etag, "W/") {
+		return ""
+	}
+	return etag
+}
+
+// contentRangeStart parses the first byte position of a Content-Range header
+// ("bytes 100-199/200").
+func contentRangeStart(contentRange string) (int64, bool) {
+	rest, ok := strings.CutPrefix(contentRange, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	start, _, ok := strings.Cut(rest, "-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(start, 10, 64)
+	return n, err == nil
+}
+
+// readErrRecorder records the error of reading a response body, to tell it
+// from an error writing the file.
+type readErrRecorder struct {
+	io.Reader
+	err error
+}
+
+func (r *readErrRecorder) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,242 @@
+package httpfetch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rangeServer serves content, dropping the connection of its next drops
+// responses after dropAfter body bytes.
+type rangeServer struct {
+	mu           sync.Mutex
+	content      []byte
+	etag         string
+	acceptRanges bool
+	dropAfter    int
+	drops        int
+	ranges       []string
+}
+
+func newRangeServer(t *testing.T, s *rangeServer) *httptest.Server {
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *rangeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	content, etag := s.content, s.etag
+	if s.drops > 0 {
+		s.drops--
+		w = &droppingWriter{ResponseWriter: w, left: s.dropAfter}
+	}
+	s.mu.Unlock()
+
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !s.acceptRanges {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		_, _ = w.Write(content)
+		return
+	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+}
+
+func (s *rangeServer) requestedRanges() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.ranges...)
+}
+
+// droppingWriter sends the first left bytes of the body, then drops the
+// connection.
+type droppingWriter struct {
+	http.ResponseWriter
+	left int
+}
+
+func (w *droppingWriter) Write(p []byte) (int, error) {
+	if len(p) <= w.left {
+		w.left -= len(p)
+		return w.ResponseWriter.Write(p)
+	}
+	_, _ = w.ResponseWriter.Write(p[:w.left])
+	w.ResponseWriter.(http.Flusher).Flush()
+	panic(http.ErrAbortHandler)
+}
+
+func sha256Hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256-" + hex.EncodeToString(sum[:])
+}
+
+func dirEntries(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+var rangeContent = []byte(strings.Repeat("0123456789", 10))
+
+func TestDownload_resumesDroppedConnection(t *testing.T) {
+	s := &rangeServer{content: rangeContent, etag: `"v1"`, acceptRanges: true, dropAfter: 30, drops: 2}
+	server := newRangeServer(t, s)
+	dest := filepath.Join(t.TempDir(), "step")
+
+	err := NewWithClient(server.Client()).DownloadWithHash(t.Context(), dest, server.URL, sha256Hash(rangeContent))
+	require.NoError(t, err)
+
+	got, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, rangeContent, got)
+	assert.Equal(t, []string{"", "bytes=30-", "bytes=60-"}, s.requestedRanges())
+	assert.Equal(t, []string{"step"}, dirEntries(t, filepath.Dir(dest)))
+}
+
+func TestDownload_keepsPartialFile(t *testing.T) {
+	s := &rangeServer{content: rangeContent, etag: `"v1"`, acceptRanges: true, dropAfter: 10, drops: maxResumes + 1}
+	server := newRangeServer(t, s)
+	dest := filepath.Join(t.TempDir(), "step")
+	client := NewWithClient(server.Client())
+
+	require.Error(t, client.Download(t.Context(), dest, server.URL))
+	assert.Equal(t, []string{"step.partial", "step.partial.json"}, dirEntries(t, filepath.Dir(dest)))
+	partial, err := os.ReadFile(dest + partialSuffix)
+	require.NoError(t, err)
+	assert.Equal(t, rangeContent[:40], partial)
+
+	require.NoError(t, client.DownloadWithHash(t.Context(), dest, server.URL, sha256Hash(rangeContent)))
+	got, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, rangeContent, got)
+	assert.Equal(t, "bytes=40-", s.requestedRanges()[4])
+	assert.Equal(t, []string{"step"}, dirEntries(t, filepath.Dir(dest)))
+}
+
+func TestDownload_partialFileOfChangedContent(t *testing.T) {
+	s := &rangeServer{content: rangeContent, etag: `"v1"`, acceptRanges: true, dropAfter: 10, drops: maxResumes + 1}
+	server := newRangeServer(t, s)
+	dest := filepath.Join(t.TempDir(), "step")
+	client := NewWithClient(server.Client())
+	require.Error(t, client.Download(t.Context(), dest, server.URL))
+
+	changed := bytes.ToUpper([]byte(strings.Repeat("abcdefghij", 10)))
+	s.mu.Lock()
+	s.content, s.etag = changed, `"v2"`
+	s.mu.Unlock()
+
+	require.NoError(t, client.Download(t.Context(), dest, server.URL))
+	got, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, changed, got, "the If-Range mismatch returns the whole new content")
+	assert.Equal(t, []string{"step"}, dirEntries(t, filepath.Dir(dest)))
+}
+
+func TestDownload_partialFileOfAnotherURL(t *testing.T) {
+	s := &rangeServer{content: rangeContent, etag: `"v1"`, acceptRanges: true, dropAfter: 10, drops: maxResumes + 1}
+	server := newRangeServer(t, s)
+	dest := filepath.Join(t.TempDir(), "step")
+	client := NewWithClient(server.Client())
+	require.Error(t, client.Download(t.Context(), dest, server.URL+"/old"))
+
+	require.NoError(t, client.Download(t.Context(), dest, server.URL+"/new"))
+	assert.Equal(t, "", s.requestedRanges()[4])
+	assert.Equal(t, []string{"step"}, dirEntries(t, filepath.Dir(dest)))
+}
+
+func TestDownload_hashMismatchAfterResume(t *testing.T) {
+	s := &rangeServer{content: rangeContent, etag: `"v1"`, acceptRanges: true, dropAfter: 10, drops: maxResumes + 1}
+	server := newRangeServer(t, s)
+	dest := filepath.Join(t.TempDir(), "step")
+	client := NewWithClient(server.Client())
+	require.Error(t, client.Download(t.Context(), dest, server.URL))
+
+	err := client.DownloadWithHash(t.Context(), dest, server.URL, sha256Hash([]byte("other")))
+	require.ErrorContains(t, err, "hash mismatch")
+	assert.Empty(t, dirEntries(t, filepath.Dir(dest)))
+}
+
+func TestDownload_notResumable(t *testing.T) {
+	tests := map[string]struct {
+		etag         string
+		acceptRanges bool
+	}{
+		"no Accept-Ranges": {etag: `"v1"`, acceptRanges: false},
+		"no ETag":          {etag: "", acceptRanges: true},
+		"weak ETag":        {etag: `W/"v1"`, acceptRanges: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := &rangeServer{content: rangeContent, etag: tt.etag, acceptRanges: tt.acceptRanges, dropAfter: 30, drops: 1}
+			server := newRangeServer(t, s)
+			dest := filepath.Join(t.TempDir(), "step")
+
+			require.Error(t, NewWithClient(server.Client()).Download(t.Context(), dest, server.URL))
+			assert.Equal(t, []string{""}, s.requestedRanges(), "not resumed")
+			assert.Empty(t, dirEntries(t, filepath.Dir(dest)), "no partial file")
+		})
+	}
+}
+
+func TestDownloadWithHash_integrity(t *testing.T) {
+	s := &rangeServer{content: rangeContent, etag: `"v1"`, acceptRanges: true}
+	server := newRangeServer(t, s)
+	client := NewWithClient(server.Client())
+	sum256 := sha256.Sum256(rangeContent)
+	sum512 := sha512.Sum512(rangeContent)
+	sri := "sha256-" + base64.StdEncoding.EncodeToString(sum256[:]) + " sha512-" + base64.StdEncoding.EncodeToString(sum512[:])
+
+	dest := filepath.Join(t.TempDir(), "step")
+	require.NoError(t, client.DownloadWithHash(t.Context(), dest, server.URL, sri))
+	got, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, rangeContent, got)
+
+	dest = filepath.Join(t.TempDir(), "step")
+	err = client.DownloadWithHash(t.Context(), dest, server.URL, "sha256-8gQK85OfUDO+jKmzYwVbPlMQfEaIujm3HUUphpqcybI= sha512-"+base64.StdEncoding.EncodeToString(sum512[:]))
+	require.ErrorContains(t, err, "hash mismatch: expected sha256-8gQK85OfUDO+jKmzYwVbPlMQfEaIujm3HUUphpqcybI=")
+	assert.NoFileExists(t, dest)
+
+	err = client.DownloadWithHash(t.Context(), dest, server.URL, "sha256-abc")
+	require.ErrorContains(t, err, `invalid digest "sha256-abc"`)
+	assert.Len(t, s.requestedRanges(), 2, "a malformed hash fails before the request")
+}
+
+func TestDownload_unrequestedPartialContent(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("ETag", `"v2"`)
+		w.Header().Set("Content-Range", "bytes 0-9/100")
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(rangeContent[:10])
+	}))
+	t.Cleanup(server.Close)
+	dest := filepath.Join(t.TempDir(), "step")
+	client := NewWithClient(server.Client())
+
+	require.ErrorContains(t, client.Download(t.Context(), dest, server.URL), "unexpected status 206 in reply to a request without Range")
+	assert.Equal(t, int32(1), requests.Load())
+}
@@ -1,21 +1,20 @@
 // Package httpfetch is a minimal HTTP client wrapper that exposes a streaming
 // Get plus an atomic Download (temp file in dest dir + rename). It's the
 // shared transport for stepman's V2 inventory fetches and precompiled
-// binary downloads.
+// binary downloads. An Observer sees the requests of a Client, e.g. the
+// process-wide Counters (see Totals) or a JSON-lines Trace.
 package httpfetch
 
 import (
 	"bytes"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
-	"path/filepath"
+	"time"
 
+	"github.com/bitrise-io/stepman/internal/httpconfig"
 	"github.com/hashicorp/go-retryablehttp"
 )
 
@@ -25,158 +24,203 @@ type Client interface {
 	// Get streams the body of url. The caller closes the returned reader.
 	// Non-2xx responses are returned as an error.
 	Get(ctx context.Context, url string) (io.ReadCloser, error)
+	// GetConditional is Get with cache revalidation: the request carries
+	// If-None-Match / If-Modified-Since built from validators, and a 304
+	// response is reported as NotModified (with a nil Body) instead of an
+	// error. On a 2xx the caller closes Body.
+	GetConditional(ctx context.Context, url string, validators Validators) (ConditionalResponse, error)
 	// Download fetches url and atomically writes it to destPath. Missing
 	// parent directories are created. A temp file is created alongside
 	// destPath and renamed on success so partial downloads never appear at
-	// the final path.
+	// the final path. When the server accepts byte ranges and sends a strong
+	// ETag, a dropped connection is resumed with a range request, and a
+	// failed download is kept as destPath+".partial" for the next Download
+	// of url to resume, as long as the ETag is unchanged.
 	Download(ctx context.Context, destPath, url string) error
 	// DownloadWithHash behaves like Download but also verifies that the
-	// downloaded content matches expectedHash ("sha256-<hex>"). The temp file
-	// is removed and an error is returned if the hash does not match, so a
-	// mismatched file never appears at destPath.
+	// downloaded content matches expectedHash: one or more space-separated
+	// sha256, sha384 or sha512 digests in hex or SRI base64, all of which must
+	// match (see integrity.Parse). The temp file is removed and an error is
+	// returned if the hash does not match, so a mismatched file never appears
+	// at destPath. A resumed download is verified as a whole, the
+	// resumed-from prefix included.
 	DownloadWithHash(ctx context.Context, destPath, url, expectedHash string) error
+	// DownloadHedged behaves like DownloadWithHash for a resource served by
+	// each of urls, its mirrors: when a mirror hasn't responded within
+	// hedge.Delay, the next one is requested too, the first response is
+	// downloaded and the other requests are cancelled. A failed mirror is
+	// replaced right away. An empty expectedHash skips the verification.
+	DownloadHedged(ctx context.Context, destPath string, urls []string, expectedHash string, hedge Hedge) error
+	// CacheHit tells the Client's Observer that the caller served url from its
+	// own cache, without a request.
+	CacheHit(url string)
 }
 
-// Logger is the minimal logging interface Client needs; the retry adapter only
-// emits debug lines.
+// Logger is the minimal logging interface Client needs; the retries only
+// emit debug lines.
 type Logger interface {
 	Debugf(format string, v ...any)
 }
 
-// retryhttpLogger adapts Logger to the retryablehttp.Logger interface (Printf only).
-type retryhttpLogger struct{ l Logger }
-
-func (r *retryhttpLogger) Printf(f string, v ...any) { r.l.Debugf(f, v...) }
-
 type client struct {
 	httpClient *http.Client
+	observer   Observer
 }
 
 // NewClient returns a Client backed by a retryablehttp client, so callers get
-// transient-failure retries by default. Use NewWithClient to supply a specific
-// *http.Client (e.g. a test server's client).
+// transient-failure retries by default. Its transport, retry policy and
+// credentials are stepman's shared ones (see httpconfig.NewRetryableClient).
+// Its requests are counted in Totals, and traced if TraceEnvKey is set. Use
+// NewWithClient to supply a specific *http.Client (e.g. a test server's
+// client).
 func NewClient(logger Logger) Client {
-	rc := retryablehttp.NewClient()
-	rc.Logger = &retryhttpLogger{l: logger}
+	return newRetryingClient(httpconfig.NewRetryableClient(logger), defaultObserver())
+}
+
+func newRetryingClient(rc *retryablehttp.Client, observer Observer) *client {
 	rc.ErrorHandler = retryablehttp.PassthroughErrorHandler
-	return &client{httpClient: rc.StandardClient()}
+	// The hooks report the retries to the tracker of the request, if any.
+	rc.RequestLogHook = func(_ retryablehttp.Logger, req *http.Request, attempt int) {
+		if t := trackerFrom(req.Context()); t != nil {
+			t.attemptStarting(attempt)
+		}
+	}
+	checkRetry := rc.CheckRetry
+	rc.CheckRetry = func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+		if t := trackerFrom(ctx); t != nil {
+			t.attemptDone(resp, err)
+		}
+		return checkRetry(ctx, resp, err)
+	}
+	return &client{httpClient: rc.StandardClient(), observer: observer}
 }
 
 // NewWithClient returns a Client backed by the given httpClient, which must be
-// non-nil. Prefer NewClient unless you need a specific transport.
-func NewWithClient(httpClient *http.Client) Client {
-	return &client{httpClient: httpClient}
+// non-nil, notifying observers of its requests. Prefer NewClient unless you
+// need a specific transport.
+func NewWithClient(httpClient *http.Client, observers ...Observer) Client {
+	return &client{httpClient: httpClient, observer: Observers(observers)}
 }
 
 func (c *client) Get(ctx context.Context, url string) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, OpGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// send GETs url with the extra header, and returns the 2xx response; its Body
+// reports the end of the request to the Observer when closed. Non-2xx
+// responses are returned as a StatusError.
+func (c *client) send(ctx context.Context, op Op, url string, header http.Header) (*http.Response, error) {
+	ctx, t := track(ctx, c.observer, op, url)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("build request for %s: %w", url, err)
+		err = fmt.Errorf("build request for %s: %w", url, err)
+		t.finish(0, false, err)
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
 	}
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("GET %s: %w", url, err)
+		err = fmt.Errorf("GET %s: %w", url, err)
+		t.finish(0, false, err)
+		return nil, err
 	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		snippet, readErr := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		return nil, errors.Join(
-			&StatusError{URL: url, Code: resp.StatusCode, Body: string(bytes.TrimSpace(snippet))},
-			readErr,
-			resp.Body.Close(),
-		)
+		err := statusError(url, resp)
+		t.finish(resp.StatusCode, false, err)
+		return nil, err
 	}
-	return resp.Body, nil
+	resp.Body = &observedBody{ReadCloser: resp.Body, tracker: t, status: resp.StatusCode, readErr: nil}
+	return resp, nil
 }
 
-// StatusError is returned by Get when the server responds with a non-2xx
-// status, so callers can branch on the code (e.g. treat 404 as "not found")
-// via errors.As. Body holds a bounded snippet of the response body, which
-// usually explains the failure (a 404 page, S3's XML error, …).
-type StatusError struct {
-	URL  string
-	Code int
-	Body string
+func (c *client) CacheHit(url string) {
+	c.observer.CacheHit(CacheHit{URL: url, Time: time.Now()})
 }
 
-func (e *StatusError) Error() string {
-	return fmt.Sprintf("GET %s: unexpected status %d: %s", e.URL, e.Code, e.Body)
+// statusError builds the StatusError for a non-2xx response and closes its body.
+func statusError(url string, resp *http.Response) error {
+	snippet, readErr := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return errors.Join(
+		&StatusError{URL: url, Code: resp.StatusCode, Body: string(bytes.TrimSpace(snippet))},
+		readErr,
+		resp.Body.Close(),
+	)
 }
 
-func (c *client) Download(ctx context.Context, destPath, url string) error {
-	return c.download(ctx, destPath, url, "")
+// Validators are the cache validators of a previously fetched response. Empty
+// fields are not sent.
+type Validators struct {
+	ETag         string
+	LastModified string
 }
 
-func (c *client) DownloadWithHash(ctx context.Context, destPath, url, expectedHash string) error {
-	if expectedHash == "" {
-		return fmt.Errorf("hash is empty")
-	}
-	return c.download(ctx, destPath, url, expectedHash)
+// ConditionalResponse is the outcome of GetConditional. Validators holds the
+// response's own ETag / Last-Modified so the caller can store them for the
+// next revalidation; on NotModified it falls back to the request's validators
+// for any header the server omitted.
+type ConditionalResponse struct {
+	Body        io.ReadCloser
+	NotModified bool
+	Validators  Validators
 }
 
-// download fetches url into a temp file alongside destPath and atomically
-// renames it into place. When expectedHash is non-empty the content is verified
-// against it ("sha256-<hex>") before the rename, so a mismatched or partial
-// file never lands at destPath.
-func (c *client) download(ctx context.Context, destPath, url, expectedHash string) error {
-	if err := os.MkdirAll(filepath.Dir(destPath), 0o755); err != nil {
-		return fmt.Errorf("create dest dir for %s: %w", destPath, err)
-	}
-
-	tmpPath, hash, err := c.fetchToTemp(ctx, filepath.Dir(destPath), url)
+func (c *client) GetConditional(ctx context.Context, url string, validators Validators) (ConditionalResponse, error) {
+	ctx, t := track(ctx, c.observer, OpGetConditional, url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return err
+		err = fmt.Errorf("build request for %s: %w", url, err)
+		t.finish(0, false, err)
+		return ConditionalResponse{}, err
 	}
-	// Best-effort cleanup: on a verify/rename failure this removes the temp
-	// file; after a successful rename tmpPath is gone, so Remove fails harmlessly.
-	defer func() { _ = os.Remove(tmpPath) }()
-
-	if expectedHash != "" && hash != expectedHash {
-		return fmt.Errorf("hash mismatch (%s) expected %s, got %s", url, expectedHash, hash)
+	if validators.ETag != "" {
+		req.Header.Set("If-None-Match", validators.ETag)
 	}
-	if err := os.Rename(tmpPath, destPath); err != nil {
-		return fmt.Errorf("rename %s to %s: %w", tmpPath, destPath, err)
+	if validators.LastModified != "" {
+		req.Header.Set("If-Modified-Since", validators.LastModified)
 	}
-	return nil
-}
-
-// fetchToTemp streams url into a new temp file under dir and returns its path
-// and sha256 hash ("sha256-<hex>"). On error the temp file is removed and
-// path/hash are empty; on success the caller owns cleanup.
-func (c *client) fetchToTemp(ctx context.Context, dir, url string) (path string, hash string, err error) {
-	// Place the temp file alongside destPath so the final rename stays on
-	// one filesystem (cross-filesystem renames fail on most kernels).
-	tmp, err := os.CreateTemp(dir, "download-*.tmp")
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return "", "", fmt.Errorf("create temp file in %s: %w", dir, err)
+		err = fmt.Errorf("GET %s: %w", url, err)
+		t.finish(0, false, err)
+		return ConditionalResponse{}, err
 	}
-	defer func() {
-		// A failed Close is intentionally a hard failure: it can mean the final
-		// write never flushed to disk, so the temp file may be incomplete.
-		if closeErr := tmp.Close(); closeErr != nil {
-			err = errors.Join(err, fmt.Errorf("close %s: %w", tmp.Name(), closeErr))
+	got := Validators{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	if resp.StatusCode == http.StatusNotModified {
+		if got.ETag == "" {
+			got.ETag = validators.ETag
 		}
-		if err != nil {
-			// Best-effort cleanup of the partial temp file; the original error is
-			// what matters, so a failed remove is intentionally ignored.
-			_ = os.Remove(tmp.Name())
-			path = ""
-			hash = ""
+		if got.LastModified == "" {
+			got.LastModified = validators.LastModified
 		}
-	}()
-
-	body, err := c.Get(ctx, url)
-	if err != nil {
-		return "", "", err
+		err := resp.Body.Close()
+		t.finish(resp.StatusCode, true, err)
+		return ConditionalResponse{Body: nil, NotModified: true, Validators: got}, err
 	}
-	defer func() {
-		if closeErr := body.Close(); closeErr != nil {
-			err = errors.Join(err, fmt.Errorf("close response body: %w", closeErr))
-		}
-	}()
-
-	h := sha256.New()
-	if _, copyErr := io.Copy(io.MultiWriter(tmp, h), body); copyErr != nil {
-		return "", "", fmt.Errorf("write to %s: %w", tmp.Name(), copyErr)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := statusError(url, resp)
+		t.finish(resp.StatusCode, false, err)
+		return ConditionalResponse{}, err
 	}
-	return tmp.Name(), "sha256-" + hex.EncodeToString(h.Sum(nil)), nil
+	body := &observedBody{ReadCloser: resp.Body, tracker: t, status: resp.StatusCode, readErr: nil}
+	return ConditionalResponse{Body: body, NotModified: false, Validators: got}, nil
+}
+
+// StatusError is returned by Get when the server responds with a non-2xx
+// status, so callers can branch on the code (e.g. treat 404 as "not found")
+// via errors.As. Body holds a bounded snippet of the response body, which
+// usually explains the failure (a 404 page, S3's XML error, …).
+type StatusError struct {
+	URL  string
+	Code int
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("GET %s: unexpected status %d: %s", e.URL, e.Code, e.Body)
 }
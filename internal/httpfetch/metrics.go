@@ -0,0 +1,110 @@
+package httpfetch
+
+import (
+	"sync"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// TraceEnvKey is the env var of the path of the JSON-lines trace file the
+// Clients returned by NewClient append their events to (see Trace).
+const TraceEnvKey = "STEPMAN_HTTP_TRACE"
+
+// OpSummary sums up the requests of a kind.
+type OpSummary struct {
+	Requests int64 `json:"requests"`
+	// Failed requests got no response, or a non-2xx non-304 one.
+	Failed      int64 `json:"failed"`
+	Retries     int64 `json:"retries"`
+	NotModified int64 `json:"not_modified"`
+	Bytes       int64 `json:"bytes"`
+	// DurationMs is the sum of the durations of the requests.
+	DurationMs int64 `json:"duration_ms"`
+}
+
+// Summary sums up the requests of Clients, e.g. for build metrics.
+type Summary struct {
+	Ops map[Op]OpSummary `json:"ops"`
+	// CacheHits are the files served from a cache without a request.
+	CacheHits int64 `json:"cache_hits"`
+}
+
+// Counters is an Observer summing up the requests it sees.
+type Counters struct {
+	mu      sync.Mutex
+	summary Summary
+}
+
+// NewCounters returns Counters starting at zero.
+func NewCounters() *Counters {
+	return &Counters{mu: sync.Mutex{}, summary: Summary{Ops: map[Op]OpSummary{}, CacheHits: 0}}
+}
+
+// Summary returns a snapshot of the counters.
+func (c *Counters) Summary() Summary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ops := make(map[Op]OpSummary, len(c.summary.Ops))
+	for op, summary := range c.summary.Ops {
+		ops[op] = summary
+	}
+	return Summary{Ops: ops, CacheHits: c.summary.CacheHits}
+}
+
+func (c *Counters) RequestStarted(RequestStart) {}
+
+func (c *Counters) RequestRetried(e RetryAttempt) {
+	c.update(e.Op, func(s *OpSummary) { s.Retries++ })
+}
+
+func (c *Counters) RequestFinished(e RequestEnd) {
+	c.update(e.Op, func(s *OpSummary) {
+		s.Requests++
+		if e.Err != nil {
+			s.Failed++
+		}
+		if e.NotModified {
+			s.NotModified++
+		}
+		s.Bytes += e.Bytes
+		s.DurationMs += e.Duration.Milliseconds()
+	})
+}
+
+func (c *Counters) CacheHit(CacheHit) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.summary.CacheHits++
+}
+
+func (c *Counters) update(op Op, f func(*OpSummary)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	summary := c.summary.Ops[op]
+	f(&summary)
+	c.summary.Ops[op] = summary
+}
+
+// totals are the Counters of the Clients returned by NewClient.
+var totals = NewCounters()
+
+// Totals returns the summary of the requests of the Clients returned by
+// NewClient in this process.
+func Totals() Summary {
+	return totals.Summary()
+}
+
+// defaultObserver is the Observer of the Clients returned by NewClient: the
+// process-wide totals, plus a Trace if TraceEnvKey is set.
+var defaultObserver = sync.OnceValue(func() Observer {
+	observers := Observers{totals}
+	if pth := traceFilePath(); pth != "" {
+		trace, err := OpenTrace(pth)
+		if err != nil {
+			log.Warnf("Failed to open HTTP trace file, requests are not traced: %s", err)
+		} else {
+			observers = append(observers, trace)
+		}
+	}
+	return observers
+})
@@ -0,0 +1,227 @@
+package httpfetch
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Hedge is the strategy of DownloadHedged.
+type Hedge struct {
+	// Delay is how long a mirror gets to respond before the next one is
+	// requested too. With 0, every mirror is requested at once.
+	Delay time.Duration
+	// Latencies orders the mirrors, fastest first, and learns from the
+	// download. nil keeps the given order.
+	Latencies *Latencies
+}
+
+// Latencies remembers how long mirrors, told apart by the scheme and host of
+// their URLs, took to respond, and which ones failed. It's safe for
+// concurrent use.
+type Latencies struct {
+	mu      sync.Mutex
+	latency map[string]time.Duration
+	failed  map[string]bool
+}
+
+// NewLatencies returns Latencies that know of no mirror yet.
+func NewLatencies() *Latencies {
+	return &Latencies{mu: sync.Mutex{}, latency: map[string]time.Duration{}, failed: map[string]bool{}}
+}
+
+var sessionLatencies = NewLatencies()
+
+// SessionLatencies returns the Latencies shared by the downloads of this
+// process.
+func SessionLatencies() *Latencies {
+	return sessionLatencies
+}
+
+// Latency returns the remembered latency of the mirror of rawURL, and false if
+// it wasn't measured or its last request failed.
+func (l *Latencies) Latency(rawURL string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := mirrorKey(rawURL)
+	latency, ok := l.latency[key]
+	return latency, ok && !l.failed[key]
+}
+
+// Order returns urls sorted by the latency of their mirrors: the measured ones
+// fastest first, then the ones not measured yet, then the ones that failed,
+// each group in the given order.
+func (l *Latencies) Order(urls []string) []string {
+	if l == nil {
+		return urls
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rank := func(rawURL string) (int, time.Duration) {
+		key := mirrorKey(rawURL)
+		if l.failed[key] {
+			return 2, 0
+		}
+		if latency, ok := l.latency[key]; ok {
+			return 0, latency
+		}
+		return 1, 0
+	}
+	ordered := slices.Clone(urls)
+	slices.SortStableFunc(ordered, func(a, b string) int {
+		rankA, latencyA := rank(a)
+		rankB, latencyB := rank(b)
+		return cmp.Or(cmp.Compare(rankA, rankB), cmp.Compare(latencyA, latencyB))
+	})
+	return ordered
+}
+
+func (l *Latencies) record(rawURL string, latency time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := mirrorKey(rawURL)
+	l.latency[key] = latency
+	delete(l.failed, key)
+}
+
+// recordAtLeast records the latency of a mirror that was cancelled after
+// waiting for it for latency, unless it's known to be slower.
+func (l *Latencies) recordAtLeast(rawURL string, latency time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := mirrorKey(rawURL)
+	if latency > l.latency[key] {
+		l.latency[key] = latency
+	}
+}
+
+func (l *Latencies) fail(rawURL string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.failed[mirrorKey(rawURL)] = true
+}
+
+func mirrorKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+func (c *client) DownloadHedged(ctx context.Context, destPath string, urls []string, expectedHash string, hedge Hedge) error {
+	if len(urls) == 0 {
+		return fmt.Errorf("no URLs to download %s from", destPath)
+	}
+	return c.download(ctx, destPath, urls, expectedHash, hedge)
+}
+
+type hedgedResult struct {
+	index   int
+	resp    *http.Response
+	err     error
+	elapsed time.Duration
+}
+
+// sendHedged requests the urls of p, in the order of hedge.Latencies, each
+// once the previous one failed or got hedge.Delay to respond. It returns the
+// first 2xx response and its URL, and cancels the other requests. If every
+// request fails, the error lists each failure.
+func (c *client) sendHedged(ctx context.Context, urls []string, p *partialDownload, hedge Hedge) (string, *http.Response, error) {
+	urls = hedge.Latencies.Order(urls)
+	results := make(chan hedgedResult, len(urls))
+	cancels := make([]context.CancelFunc, 0, len(urls))
+	starts := make([]time.Time, 0, len(urls))
+	start := func() {
+		i, began := len(cancels), time.Now()
+		reqCtx, cancel := context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+		starts = append(starts, began)
+		header := p.header(urls[i])
+		go func() {
+			resp, err := c.send(reqCtx, OpDownload, urls[i], header)
+			results <- hedgedResult{index: i, resp: resp, err: err, elapsed: time.Since(began)}
+		}()
+	}
+
+	start()
+	timer := time.NewTimer(hedge.Delay)
+	defer timer.Stop()
+	pending := 1
+	var errs []error
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				hedge.Latencies.record(urls[r.index], r.elapsed)
+				for i, cancel := range cancels {
+					if i != r.index && cancel != nil {
+						hedge.Latencies.recordAtLeast(urls[i], time.Since(starts[i]))
+						cancel()
+					}
+				}
+				go discardHedged(results, pending)
+				r.resp.Body = &cancelingBody{ReadCloser: r.resp.Body, cancel: cancels[r.index]}
+				return urls[r.index], r.resp, nil
+			}
+			cancels[r.index]()
+			cancels[r.index] = nil
+			if ctx.Err() == nil {
+				hedge.Latencies.fail(urls[r.index])
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", urls[r.index], r.err))
+			if len(cancels) < len(urls) && ctx.Err() == nil {
+				// Don't wait for the delay to replace a failed mirror.
+				start()
+				pending++
+				timer.Reset(hedge.Delay)
+			}
+		case <-timer.C:
+			if len(cancels) < len(urls) {
+				start()
+				pending++
+				timer.Reset(hedge.Delay)
+			}
+		}
+	}
+	return "", nil, errors.Join(errs...)
+}
+
+// discardHedged closes the responses of the pending requests that lost the
+// race, which were cancelled.
+func discardHedged(results <-chan hedgedResult, pending int) {
+	for range pending {
+		if r := <-results; r.err == nil {
+			_ = r.resp.Body.Close()
+		}
+	}
+}
+
+// cancelingBody cancels the context of its request when closed.
+type cancelingBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,124 @@
+package httpfetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMirror returns a server responding with content after delay, or with
+// status if it's not 200, counting its requests.
+func newMirror(t *testing.T, delay time.Duration, status int, content string) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(content))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestDownloadHedged_slowMirror(t *testing.T) {
+	slow, slowRequests := newMirror(t, time.Minute, http.StatusOK, "from slow")
+	fast, fastRequests := newMirror(t, 0, http.StatusOK, "from fast")
+	latencies := NewLatencies()
+	hedge := Hedge{Delay: 20 * time.Millisecond, Latencies: latencies}
+	client := NewWithClient(&http.Client{})
+	dest := filepath.Join(t.TempDir(), "step")
+
+	require.NoError(t, client.DownloadHedged(t.Context(), dest, []string{slow.URL, fast.URL}, sha256Hash([]byte("from fast")), hedge))
+	got, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, "from fast", string(got))
+	assert.Equal(t, []string{fast.URL, slow.URL}, latencies.Order([]string{slow.URL, fast.URL}))
+
+	// The fast mirror is requested first now, and responds within the delay.
+	require.NoError(t, client.DownloadHedged(t.Context(), dest, []string{slow.URL, fast.URL}, "", hedge))
+	assert.Equal(t, int32(1), slowRequests.Load())
+	assert.Equal(t, int32(2), fastRequests.Load())
+}
+
+func TestDownloadHedged_firstMirrorInTime(t *testing.T) {
+	first, _ := newMirror(t, 0, http.StatusOK, "from first")
+	second, secondRequests := newMirror(t, 0, http.StatusOK, "from second")
+	dest := filepath.Join(t.TempDir(), "step")
+
+	err := NewWithClient(&http.Client{}).DownloadHedged(t.Context(), dest, []string{first.URL, second.URL}, "", Hedge{Delay: time.Minute, Latencies: nil})
+	require.NoError(t, err)
+	got, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, "from first", string(got))
+	assert.Equal(t, int32(0), secondRequests.Load())
+}
+
+func TestDownloadHedged_failedMirror(t *testing.T) {
+	failing, _ := newMirror(t, 0, http.StatusInternalServerError, "")
+	working, _ := newMirror(t, 0, http.StatusOK, "from working")
+	latencies := NewLatencies()
+	dest := filepath.Join(t.TempDir(), "step")
+
+	// A failed mirror doesn't wait for the delay to be replaced.
+	err := NewWithClient(&http.Client{}).DownloadHedged(t.Context(), dest, []string{failing.URL, working.URL}, "", Hedge{Delay: time.Minute, Latencies: latencies})
+	require.NoError(t, err)
+	got, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, "from working", string(got))
+
+	_, ok := latencies.Latency(failing.URL)
+	assert.False(t, ok)
+	assert.Equal(t, []string{working.URL, failing.URL}, latencies.Order([]string{failing.URL, working.URL}))
+}
+
+func TestDownloadHedged_allMirrorsFail(t *testing.T) {
+	notFound, _ := newMirror(t, 0, http.StatusNotFound, "")
+	forbidden, _ := newMirror(t, 0, http.StatusForbidden, "")
+	dest := filepath.Join(t.TempDir(), "step")
+
+	err := NewWithClient(&http.Client{}).DownloadHedged(t.Context(), dest, []string{notFound.URL, forbidden.URL}, "", Hedge{Delay: 0, Latencies: nil})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), notFound.URL+": GET "+notFound.URL+": unexpected status 404")
+	assert.Contains(t, err.Error(), forbidden.URL+": GET "+forbidden.URL+": unexpected status 403")
+	assert.Empty(t, dirEntries(t, filepath.Dir(dest)))
+}
+
+func TestLatencies_Order(t *testing.T) {
+	latencies := NewLatencies()
+	latencies.record("https://slow.example/a", 300*time.Millisecond)
+	latencies.record("https://fast.example/a", 100*time.Millisecond)
+	latencies.recordAtLeast("https://fast.example/b", 50*time.Millisecond)
+	latencies.fail("https://failed.example/a")
+
+	urls := []string{
+		"https://failed.example/step",
+		"https://new.example/step",
+		"https://slow.example/step",
+		"https://fast.example/step",
+	}
+	assert.Equal(t, []string{
+		"https://fast.example/step",
+		"https://slow.example/step",
+		"https://new.example/step",
+		"https://failed.example/step",
+	}, latencies.Order(urls))
+
+	latency, ok := latencies.Latency("https://fast.example/c")
+	assert.True(t, ok)
+	assert.Equal(t, 100*time.Millisecond, latency, "a cancelled request doesn't make a mirror faster")
+
+	latencies.record("https://failed.example/b", time.Second)
+	_, ok = latencies.Latency("https://failed.example/step")
+	assert.True(t, ok, "a response clears the failure")
+}
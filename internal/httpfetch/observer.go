@@ -0,0 +1,223 @@
+package httpfetch
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Op is the kind of a Client call.
+type Op string
+
+// The Client calls an Observer sees.
+const (
+	OpGet            Op = "get"
+	OpGetConditional Op = "get_conditional"
+	OpDownload       Op = "download"
+)
+
+// RequestStart is reported when a Client call sends its request.
+type RequestStart struct {
+	// ID identifies the request among the events of the process.
+	ID   uint64
+	Op   Op
+	URL  string
+	Time time.Time
+}
+
+// RetryAttempt is reported before a request is retried, with the outcome of
+// the previous attempt: its status, or the error if it got no response.
+type RetryAttempt struct {
+	ID uint64
+	Op Op
+	// Attempt is 1 for the first retry.
+	Attempt int
+	Status  int
+	Err     error
+}
+
+// RequestEnd is reported when a request is done: once the caller closed the
+// body of a successful response, or when it failed. Duration spans from the
+// start of the first attempt, retries and the reading of the body included.
+type RequestEnd struct {
+	ID          uint64
+	Op          Op
+	URL         string
+	Status      int
+	NotModified bool
+	// Bytes is the number of body bytes read.
+	Bytes    int64
+	Duration time.Duration
+	// Attempts is 1 plus the number of retries.
+	Attempts int
+	Err      error
+}
+
+// CacheHit is reported when a caller serves URL from its own cache, without a
+// request (see Client.CacheHit).
+type CacheHit struct {
+	URL  string
+	Time time.Time
+}
+
+// Observer is notified of the requests of a Client, e.g. for metrics or
+// tracing. Its methods are called synchronously, from the goroutines making
+// the requests, so they must be quick and safe for concurrent use.
+type Observer interface {
+	RequestStarted(RequestStart)
+	RequestRetried(RetryAttempt)
+	RequestFinished(RequestEnd)
+	CacheHit(CacheHit)
+}
+
+// Observers is an Observer notifying each of its elements in order.
+type Observers []Observer
+
+func (o Observers) RequestStarted(e RequestStart) {
+	for _, observer := range o {
+		observer.RequestStarted(e)
+	}
+}
+
+func (o Observers) RequestRetried(e RetryAttempt) {
+	for _, observer := range o {
+		observer.RequestRetried(e)
+	}
+}
+
+func (o Observers) RequestFinished(e RequestEnd) {
+	for _, observer := range o {
+		observer.RequestFinished(e)
+	}
+}
+
+func (o Observers) CacheHit(e CacheHit) {
+	for _, observer := range o {
+		observer.CacheHit(e)
+	}
+}
+
+type opKey struct{}
+
+// WithOp makes the requests of ctx report op to the Observer, e.g. OpDownload
+// for a download streamed with Get.
+func WithOp(ctx context.Context, op Op) context.Context {
+	return context.WithValue(ctx, opKey{}, op)
+}
+
+var requestIDs atomic.Uint64
+
+// tracker follows one request for the Observer. The retry hooks of the
+// retryablehttp client find it in the request's context.
+type tracker struct {
+	observer Observer
+	id       uint64
+	op       Op
+	url      string
+	start    time.Time
+
+	mu         sync.Mutex
+	attempts   int
+	lastStatus int
+	lastErr    error
+	bytes      int64
+	finished   bool
+}
+
+type trackerKey struct{}
+
+// track reports the start of a request and returns the context to send it
+// with.
+func track(ctx context.Context, observer Observer, op Op, url string) (context.Context, *tracker) {
+	if ctxOp, ok := ctx.Value(opKey{}).(Op); ok {
+		op = ctxOp
+	}
+	//nolint:exhaustruct // the mutable fields start at zero
+	t := &tracker{observer: observer, id: requestIDs.Add(1), op: op, url: url, start: time.Now(), attempts: 1}
+	observer.RequestStarted(RequestStart{ID: t.id, Op: op, URL: url, Time: t.start})
+	return context.WithValue(ctx, trackerKey{}, t), t
+}
+
+func trackerFrom(ctx context.Context) *tracker {
+	t, _ := ctx.Value(trackerKey{}).(*tracker)
+	return t
+}
+
+// attemptDone records the outcome of an attempt, reported with the retry
+// following it, if any.
+func (t *tracker) attemptDone(resp *http.Response, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastStatus, t.lastErr = 0, err
+	if resp != nil {
+		t.lastStatus = resp.StatusCode
+	}
+}
+
+// attemptStarting reports a retry for every attempt but the first (0).
+func (t *tracker) attemptStarting(attempt int) {
+	if attempt == 0 {
+		return
+	}
+	t.mu.Lock()
+	t.attempts = attempt + 1
+	event := RetryAttempt{ID: t.id, Op: t.op, Attempt: attempt, Status: t.lastStatus, Err: t.lastErr}
+	t.mu.Unlock()
+	t.observer.RequestRetried(event)
+}
+
+func (t *tracker) read(n int) {
+	t.mu.Lock()
+	t.bytes += int64(n)
+	t.mu.Unlock()
+}
+
+// finish reports the end of the request, once.
+func (t *tracker) finish(status int, notModified bool, err error) {
+	t.mu.Lock()
+	if t.finished {
+		t.mu.Unlock()
+		return
+	}
+	t.finished = true
+	event := RequestEnd{
+		ID:          t.id,
+		Op:          t.op,
+		URL:         t.url,
+		Status:      status,
+		NotModified: notModified,
+		Bytes:       t.bytes,
+		Duration:    time.Since(t.start),
+		Attempts:    t.attempts,
+		Err:         err,
+	}
+	t.mu.Unlock()
+	t.observer.RequestFinished(event)
+}
+
+// observedBody counts the bytes read from a response body, and finishes its
+// request when closed.
+type observedBody struct {
+	io.ReadCloser
+	tracker *tracker
+	status  int
+	readErr error
+}
+
+func (b *observedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.tracker.read(n)
+	if err != nil && err != io.EOF {
+		b.readErr = err
+	}
+	return n, err
+}
+
+func (b *observedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.tracker.finish(b.status, false, b.readErr)
+	return err
+}
@@ -0,0 +1,114 @@
+package httpfetch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+func traceFilePath() string {
+	return os.Getenv(TraceEnvKey)
+}
+
+// traceEvent is a line of the trace. The URLs are redacted, so a password in
+// one never ends up in the trace.
+type traceEvent struct {
+	Time        time.Time `json:"time"`
+	Event       string    `json:"event"`
+	ID          uint64    `json:"id,omitempty"`
+	Op          Op        `json:"op,omitempty"`
+	URL         string    `json:"url,omitempty"`
+	Attempt     int       `json:"attempt,omitempty"`
+	Status      int       `json:"status,omitempty"`
+	NotModified bool      `json:"not_modified,omitempty"`
+	Bytes       int64     `json:"bytes,omitempty"`
+	DurationMs  float64   `json:"duration_ms,omitempty"`
+	Attempts    int       `json:"attempts,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// Trace is an Observer writing its events to w as JSON lines: a
+// request_start, retry, request_end or cache_hit object per line.
+type Trace struct {
+	mu  sync.Mutex
+	w   io.Writer
+	now func() time.Time
+}
+
+// NewTrace returns a Trace writing to w.
+func NewTrace(w io.Writer) *Trace {
+	return &Trace{mu: sync.Mutex{}, w: w, now: time.Now}
+}
+
+// OpenTrace returns a Trace appending to the file at pth, so that the
+// processes of a build can share it.
+func OpenTrace(pth string) (*Trace, error) {
+	file, err := os.OpenFile(pth, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open trace file: %w", err)
+	}
+	return NewTrace(file), nil
+}
+
+func (t *Trace) RequestStarted(e RequestStart) {
+	//nolint:exhaustruct // the fields of other events are omitted
+	t.write(traceEvent{Time: e.Time, Event: "request_start", ID: e.ID, Op: e.Op, URL: redactURL(e.URL)})
+}
+
+func (t *Trace) RequestRetried(e RetryAttempt) {
+	//nolint:exhaustruct // the fields of other events are omitted
+	t.write(traceEvent{Time: t.now(), Event: "retry", ID: e.ID, Op: e.Op, Attempt: e.Attempt, Status: e.Status, Error: errorString(e.Err)})
+}
+
+func (t *Trace) RequestFinished(e RequestEnd) {
+	t.write(traceEvent{
+		Time:        t.now(),
+		Event:       "request_end",
+		ID:          e.ID,
+		Op:          e.Op,
+		URL:         redactURL(e.URL),
+		Attempt:     0,
+		Status:      e.Status,
+		NotModified: e.NotModified,
+		Bytes:       e.Bytes,
+		DurationMs:  float64(e.Duration.Microseconds()) / 1000,
+		Attempts:    e.Attempts,
+		Error:       errorString(e.Err),
+	})
+}
+
+func (t *Trace) CacheHit(e CacheHit) {
+	//nolint:exhaustruct // the fields of other events are omitted
+	t.write(traceEvent{Time: e.Time, Event: "cache_hit", URL: redactURL(e.URL)})
+}
+
+// write writes a line of the trace. A trace is best effort, so a failed write
+// doesn't fail the request.
+func (t *Trace) write(event traceEvent) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, _ = t.w.Write(append(line, '\n'))
+}
+
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Redacted()
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,185 @@
+// Package integrity verifies downloaded content against the hash of a step
+// executable (models.Executable.Hash). A hash is one digest or several,
+// separated by spaces as in a Subresource Integrity (SRI) attribute:
+//
+//	sha256-<hex>
+//	sha256-<base64> sha512-<base64>
+//
+// The algorithm is sha256, sha384 or sha512, and the digest either hex (the
+// original stepman format) or standard, padded base64 (SRI's). Content is
+// valid only if it matches every listed digest.
+package integrity
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// Algorithm is the hash function of a Digest.
+type Algorithm string
+
+// The supported algorithms.
+const (
+	SHA256 Algorithm = "sha256"
+	SHA384 Algorithm = "sha384"
+	SHA512 Algorithm = "sha512"
+)
+
+func (a Algorithm) newHash() (hash.Hash, bool) {
+	switch a {
+	case SHA256:
+		return sha256.New(), true
+	case SHA384:
+		return sha512.New384(), true
+	case SHA512:
+		return sha512.New(), true
+	default:
+		return nil, false
+	}
+}
+
+// Digest is the expected sum of a content for an Algorithm.
+type Digest struct {
+	Algorithm Algorithm
+	Sum       []byte
+	// Hex tells whether the digest was written in hex rather than base64,
+	// so that it's shown the same way.
+	Hex bool
+}
+
+func (d Digest) String() string {
+	return d.format(d.Sum)
+}
+
+// format writes sum the way d is written.
+func (d Digest) format(sum []byte) string {
+	if d.Hex {
+		return string(d.Algorithm) + "-" + hex.EncodeToString(sum)
+	}
+	return string(d.Algorithm) + "-" + base64.StdEncoding.EncodeToString(sum)
+}
+
+// Hash is the digests a content must all match.
+type Hash []Digest
+
+func (h Hash) String() string {
+	digests := make([]string, 0, len(h))
+	for _, d := range h {
+		digests = append(digests, d.String())
+	}
+	return strings.Join(digests, " ")
+}
+
+// Parse parses a hash of one or more space-separated digests.
+func Parse(value string) (Hash, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return nil, errors.New("hash is empty")
+	}
+	h := make(Hash, 0, len(fields))
+	for _, field := range fields {
+		d, err := parseDigest(field)
+		if err != nil {
+			return nil, err
+		}
+		h = append(h, d)
+	}
+	return h, nil
+}
+
+func parseDigest(value string) (Digest, error) {
+	name, encoded, ok := strings.Cut(value, "-")
+	if !ok {
+		return Digest{}, fmt.Errorf("invalid digest %q: expected <algorithm>-<digest>, e.g. sha256-<hex or base64>", value)
+	}
+	algorithm := Algorithm(name)
+	newHash, ok := algorithm.newHash()
+	if !ok {
+		return Digest{}, fmt.Errorf("invalid digest %q: unsupported algorithm %q, expected %s, %s or %s", value, name, SHA256, SHA384, SHA512)
+	}
+	size := newHash.Size()
+	if len(encoded) == hex.EncodedLen(size) {
+		if sum, err := hex.DecodeString(encoded); err == nil {
+			return Digest{Algorithm: algorithm, Sum: sum, Hex: true}, nil
+		}
+	}
+	if sum, err := base64.StdEncoding.DecodeString(encoded); err == nil && len(sum) == size {
+		return Digest{Algorithm: algorithm, Sum: sum, Hex: false}, nil
+	}
+	return Digest{}, fmt.Errorf("invalid digest %q: expected the %d-byte %s sum in hex or base64", value, size, name)
+}
+
+// Verifier hashes a content written to it with the algorithms of a Hash, to
+// verify it against the Hash.
+type Verifier struct {
+	expected Hash
+	hashes   map[Algorithm]hash.Hash
+}
+
+// NewVerifier returns a Verifier of expected. A nil expected accepts any
+// content.
+func NewVerifier(expected Hash) *Verifier {
+	hashes := map[Algorithm]hash.Hash{}
+	for _, d := range expected {
+		if _, ok := hashes[d.Algorithm]; !ok {
+			// Parse only returns digests of supported algorithms.
+			hashes[d.Algorithm], _ = d.Algorithm.newHash()
+		}
+	}
+	return &Verifier{expected: expected, hashes: hashes}
+}
+
+func (v *Verifier) Write(p []byte) (int, error) {
+	for _, h := range v.hashes {
+		// A hash.Hash never fails to write.
+		_, _ = h.Write(p)
+	}
+	return len(p), nil
+}
+
+// Reset forgets the content written so far.
+func (v *Verifier) Reset() {
+	for _, h := range v.hashes {
+		h.Reset()
+	}
+}
+
+// Verify checks the content written so far against every digest of the
+// expected Hash.
+func (v *Verifier) Verify() error {
+	var errs []error
+	for _, d := range v.expected {
+		if sum := v.hashes[d.Algorithm].Sum(nil); !bytes.Equal(sum, d.Sum) {
+			errs = append(errs, fmt.Errorf("hash mismatch: expected %s, got %s", d, d.format(sum)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// VerifyReader reads r to its end and checks it against expected.
+func VerifyReader(expected Hash, r io.Reader) error {
+	v := NewVerifier(expected)
+	if _, err := io.Copy(v, r); err != nil {
+		return fmt.Errorf("calculate hash: %w", err)
+	}
+	return v.Verify()
+}
+
+// VerifyFile checks the file at pth against expected.
+func VerifyFile(expected Hash, pth string) error {
+	f, err := os.Open(pth)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	return VerifyReader(expected, f)
+}
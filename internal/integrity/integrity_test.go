@@ -0,0 +1,101 @@
+package integrity
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const content = "hello\n"
+
+// The digests of content.
+const (
+	sha256Hex    = "sha256-5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+	sha256Base64 = "sha256-WJG1tSLV3whtD/CxEPvZ0hu0/HFjrzTQgoai6Eb2vgM="
+	sha384Base64 = "sha384-HQ8oTv4+3qS5yjvVFPoTSxfq42HMx6Hu/v+AG5vWYE4B8h9r8knvAwWZ8MIY8rqM"
+	sha512Base64 = "sha512-58IrmUxZ2c8rSOVJseJGZmNgRZMNPafBrLKZ0cO3+TH5Sq5B7dosKyB6NuEPi8uNRSI+VIePWzFufOO2vAGWKQ=="
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		value       string
+		wantString  string
+		expectedErr string
+	}{
+		"hex":                        {value: sha256Hex, wantString: sha256Hex},
+		"SRI base64":                 {value: sha256Base64, wantString: sha256Base64},
+		"multiple digests":           {value: " " + sha384Base64 + "  " + sha512Base64 + " ", wantString: sha384Base64 + " " + sha512Base64},
+		"empty":                      {value: " ", expectedErr: "hash is empty"},
+		"no algorithm":               {value: "5891b5b5", expectedErr: `invalid digest "5891b5b5": expected <algorithm>-<digest>, e.g. sha256-<hex or base64>`},
+		"unsupported algorithm":      {value: "md5-b1946ac92492d2347c6235b4d2611184", expectedErr: `invalid digest "md5-b1946ac92492d2347c6235b4d2611184": unsupported algorithm "md5", expected sha256, sha384 or sha512`},
+		"short hex":                  {value: "sha256-5891b5b5", expectedErr: `invalid digest "sha256-5891b5b5": expected the 32-byte sha256 sum in hex or base64`},
+		"digest of another size":     {value: "sha512-" + strings.TrimPrefix(sha256Base64, "sha256-"), expectedErr: "expected the 64-byte sha512 sum in hex or base64"},
+		"one malformed of two":       {value: sha256Hex + " sha384-abc", expectedErr: `invalid digest "sha384-abc"`},
+		"URL-safe base64 is not SRI": {value: "sha256-WJG1tSLV3whtD_CxEPvZ0hu0_HFjrzTQgoai6Eb2vgM=", expectedErr: "expected the 32-byte sha256 sum"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			h, err := Parse(tt.value)
+			if tt.expectedErr != "" {
+				require.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantString, h.String())
+		})
+	}
+}
+
+func TestVerifyReader(t *testing.T) {
+	tests := map[string]struct {
+		hash        string
+		expectedErr string
+	}{
+		"hex":              {hash: sha256Hex},
+		"SRI base64":       {hash: sha256Base64},
+		"all algorithms":   {hash: sha256Hex + " " + sha384Base64 + " " + sha512Base64},
+		"hex mismatch":     {hash: "sha256-" + strings.Repeat("0", 64), expectedErr: "hash mismatch: expected sha256-" + strings.Repeat("0", 64) + ", got " + sha256Hex},
+		"base64 mismatch":  {hash: "sha256-" + strings.Repeat("A", 43) + "=", expectedErr: "hash mismatch: expected sha256-" + strings.Repeat("A", 43) + "=, got " + sha256Base64},
+		"one of two wrong": {hash: sha256Base64 + " sha512-" + strings.Repeat("A", 86) + "==", expectedErr: "got " + sha512Base64},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			h, err := Parse(tt.hash)
+			require.NoError(t, err)
+			err = VerifyReader(h, strings.NewReader(content))
+			if tt.expectedErr != "" {
+				require.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestVerifier_Reset(t *testing.T) {
+	h, err := Parse(sha256Base64 + " " + sha512Base64)
+	require.NoError(t, err)
+	v := NewVerifier(h)
+
+	_, _ = v.Write([]byte("other content"))
+	require.Error(t, v.Verify())
+
+	v.Reset()
+	_, _ = v.Write([]byte(content))
+	require.NoError(t, v.Verify())
+}
+
+func TestVerifyFile(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "step")
+	require.NoError(t, os.WriteFile(pth, []byte(content), 0o644))
+	h, err := Parse(sha384Base64)
+	require.NoError(t, err)
+
+	require.NoError(t, VerifyFile(h, pth))
+	require.ErrorContains(t, VerifyFile(h, pth+"-missing"), "no such file or directory")
+	require.NoError(t, VerifyFile(nil, pth), "a nil Hash accepts any content")
+}
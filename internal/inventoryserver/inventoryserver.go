@@ -0,0 +1,134 @@
+// Package inventoryserver serves a generated V2 inventory tree over HTTP the
+// way the production inventory host does: at the steplibindex.Path URL layout,
+// with ETags (derived from size and modification time) for revalidation and
+// Cache-Control telling immutable files from mutable ones. It is a stand-in
+// for the host in development and integration tests.
+package inventoryserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+)
+
+// Cache-Control values of the immutable per-version files and of every other,
+// mutable file. Mutable files may be cached as long as the V2 client trusts its
+// own cached copy (steplibindex.DefaultIndexTTL).
+var (
+	immutableCacheControl = "public, max-age=31536000, immutable"
+	mutableCacheControl   = fmt.Sprintf("public, max-age=%d", int(steplibindex.DefaultIndexTTL.Seconds()))
+)
+
+// Logger is the logging interface the handler needs: one line per request.
+type Logger interface {
+	Infof(format string, v ...any)
+}
+
+type handler struct {
+	inventoryFS fs.FS
+	log         Logger
+}
+
+// NewHandler returns a handler serving the inventory tree rooted at
+// inventoryFS (the dir containing v2/, as for indexgen.Validate). Only GET and
+// HEAD requests of files are served; directories are not listed.
+func NewHandler(inventoryFS fs.FS, log Logger) http.Handler {
+	return &handler{inventoryFS: inventoryFS, log: log}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rw := &statusRecorder{ResponseWriter: w, status: http.StatusOK, bytes: 0}
+	h.serve(rw, r)
+	h.log.Infof("%s %s %d %dB %s", r.Method, r.URL.Path, rw.status, rw.bytes, time.Since(start).Round(time.Microsecond))
+}
+
+func (h *handler) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Dynamic segments are percent-escaped in the URL form only, so the
+	// decoded URL path is the FS form.
+	fsPath := strings.TrimPrefix(r.URL.Path, "/")
+	if !fs.ValidPath(fsPath) || fsPath == "." {
+		http.NotFound(w, r)
+		return
+	}
+	file, err := h.inventoryFS.Open(fsPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = file.Close() }()
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	content, err := readSeeker(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// A generation rewrites the files it changes, so size and modification
+	// time identify the content without reading it.
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	if steplibindex.IsImmutableFS(fsPath) {
+		w.Header().Set("Cache-Control", immutableCacheControl)
+	} else {
+		w.Header().Set("Cache-Control", mutableCacheControl)
+	}
+	// ServeContent sets Content-Type from the extension, answers
+	// If-None-Match with 304 and handles HEAD and Range requests.
+	http.ServeContent(w, r, fsPath, info.ModTime(), content)
+}
+
+// readSeeker returns file as an io.ReadSeeker, which the files of os.DirFS and
+// fstest.MapFS are; the content of any other is read into memory.
+func readSeeker(file fs.File) (io.ReadSeeker, error) {
+	if rs, ok := file.(io.ReadSeeker); ok {
+		return rs, nil
+	}
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(content), nil
+}
+
+// statusRecorder records the status code and body size of a response for the
+// request log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
@@ -0,0 +1,139 @@
+package inventoryserver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testLogger struct{ t *testing.T }
+
+func (l testLogger) Infof(format string, v ...any) { l.t.Logf("INFO "+format, v...) }
+
+func mustPath(p steplibindex.Path, err error) steplibindex.Path {
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func TestHandler(t *testing.T) {
+	stepJSON := mustPath(steplibindex.StepJSONPath("my step", "1.0.0"))
+	latest := mustPath(steplibindex.LatestPointerPath("my step"))
+	icon := mustPath(steplibindex.StepAssetPath("my step", "icon.svg"))
+	inventoryFS := fstest.MapFS{
+		stepJSON.FS():                   {Data: []byte(`{"title":"My Step"}`)},
+		latest.FS():                     {Data: []byte(`{"latest":"1.0.0"}`)},
+		icon.FS():                       {Data: []byte(`<svg xmlns="http://www.w3.org/2000/svg"/>`)},
+		steplibindex.MetaPath().FS():    {Data: []byte(`{}`)},
+		steplibindex.StepIDsPath().FS(): {Data: []byte(`{"step_ids":["my step"]}`)},
+	}
+	srv := httptest.NewServer(NewHandler(inventoryFS, testLogger{t}))
+	t.Cleanup(srv.Close)
+
+	cases := map[string]struct {
+		path             string
+		wantStatus       int
+		wantContentType  string
+		wantCacheControl string
+		wantBody         string
+	}{
+		"immutable step.json": {
+			path:             stepJSON.URL(),
+			wantStatus:       http.StatusOK,
+			wantContentType:  "application/json",
+			wantCacheControl: immutableCacheControl,
+			wantBody:         `{"title":"My Step"}`,
+		},
+		"mutable index file": {
+			path:             latest.URL(),
+			wantStatus:       http.StatusOK,
+			wantContentType:  "application/json",
+			wantCacheControl: mutableCacheControl,
+			wantBody:         `{"latest":"1.0.0"}`,
+		},
+		"mutable asset": {
+			path:             icon.URL(),
+			wantStatus:       http.StatusOK,
+			wantContentType:  "image/svg+xml",
+			wantCacheControl: mutableCacheControl,
+		},
+		"directory": {
+			path:       "/v2/index",
+			wantStatus: http.StatusNotFound,
+		},
+		"missing file": {
+			path:       "/v2/index/search.json",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			resp, err := srv.Client().Get(srv.URL + tc.path)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.wantStatus, resp.StatusCode)
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			assert.Contains(t, resp.Header.Get("Content-Type"), tc.wantContentType)
+			assert.Equal(t, tc.wantCacheControl, resp.Header.Get("Cache-Control"))
+			assert.NotEmpty(t, resp.Header.Get("ETag"))
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantBody, string(body))
+			}
+		})
+	}
+}
+
+func TestHandler_revalidation(t *testing.T) {
+	inventoryFS := fstest.MapFS{steplibindex.StepIDsPath().FS(): {Data: []byte(`{"step_ids":[]}`)}}
+	srv := httptest.NewServer(NewHandler(inventoryFS, testLogger{t}))
+	t.Cleanup(srv.Close)
+	url := srv.URL + steplibindex.StepIDsPath().URL()
+
+	resp, err := srv.Client().Get(url)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	etag := resp.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = srv.Client().Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	inventoryFS[steplibindex.StepIDsPath().FS()] = &fstest.MapFile{Data: []byte(`{"step_ids":["script"]}`)}
+	resp, err = srv.Client().Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "changed file")
+	assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+
+	etag = resp.Header.Get("ETag")
+	inventoryFS[steplibindex.StepIDsPath().FS()] = &fstest.MapFile{Data: []byte(`{"step_ids":["script"]}`), ModTime: time.Date(2026, 5, 15, 12, 0, 0, 0, time.UTC)}
+	req.Header.Set("If-None-Match", etag)
+	resp, err = srv.Client().Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "rewritten file")
+
+	resp, err = srv.Client().Post(url, "application/json", nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
@@ -0,0 +1,316 @@
+// Package stepdiff compares two versions of a step definition and sorts the
+// differences by their impact on workflows that use the older version:
+//
+//   - breaking: an existing workflow may stop working, e.g. a removed input or
+//     output, a removed value option, a new required input without a default.
+//   - behavioral: existing workflows keep working but the step may behave
+//     differently, e.g. a changed default value or toolkit, a new input with a
+//     default.
+//   - cosmetic: no effect on existing workflows, e.g. changed titles and
+//     descriptions, new outputs, new value options.
+//
+// Fields that change with every release (source, executables, published_at)
+// are not compared.
+package stepdiff
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	envmanModels "github.com/bitrise-io/envman/v2/models"
+	"github.com/bitrise-io/stepman/models"
+)
+
+// Change is one difference between the two step versions.
+type Change struct {
+	// Field is the changed field of step.yml, e.g. inputs.branch.value_options.
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Diff is the categorized difference between two step versions.
+type Diff struct {
+	Breaking   []Change `json:"breaking"`
+	Behavioral []Change `json:"behavioral"`
+	Cosmetic   []Change `json:"cosmetic"`
+}
+
+// IsEmpty returns true if the two versions don't differ.
+func (d Diff) IsEmpty() bool {
+	return len(d.Breaking) == 0 && len(d.Behavioral) == 0 && len(d.Cosmetic) == 0
+}
+
+func (d *Diff) breaking(field, format string, args ...any) {
+	d.Breaking = append(d.Breaking, Change{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (d *Diff) behavioral(field, format string, args ...any) {
+	d.Behavioral = append(d.Behavioral, Change{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (d *Diff) cosmetic(field, format string, args ...any) {
+	d.Cosmetic = append(d.Cosmetic, Change{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Compare returns how to differs from from.
+func Compare(from, to models.StepModel) (Diff, error) {
+	diff := Diff{Breaking: []Change{}, Behavioral: []Change{}, Cosmetic: []Change{}}
+
+	compareStep(&diff, from, to)
+	if err := compareInputs(&diff, from.Inputs, to.Inputs); err != nil {
+		return Diff{}, err
+	}
+	if err := compareOutputs(&diff, from.Outputs, to.Outputs); err != nil {
+		return Diff{}, err
+	}
+	sortChanges(&diff)
+	return diff, nil
+}
+
+func compareStep(diff *Diff, from, to models.StepModel) {
+	for field, values := range map[string][2]*string{
+		"title":           {from.Title, to.Title},
+		"summary":         {from.Summary, to.Summary},
+		"description":     {from.Description, to.Description},
+		"website":         {from.Website, to.Website},
+		"source_code_url": {from.SourceCodeURL, to.SourceCodeURL},
+		"support_url":     {from.SupportURL, to.SupportURL},
+	} {
+		if deref(values[0]) != deref(values[1]) {
+			diff.cosmetic(field, "%s changed", field)
+		}
+	}
+
+	compareTags(diff, "host_os_tags", "host OS", from.HostOsTags, to.HostOsTags)
+	compareTags(diff, "project_type_tags", "project type", from.ProjectTypeTags, to.ProjectTypeTags)
+	if added, removed := setDiff(from.TypeTags, to.TypeTags); len(added) > 0 || len(removed) > 0 {
+		diff.cosmetic("type_tags", "type tags changed from %v to %v", from.TypeTags, to.TypeTags)
+	}
+
+	for field, values := range map[string][2]any{
+		"toolkit":             {from.Toolkit, to.Toolkit},
+		"deps":                {from.Deps, to.Deps},
+		"dependencies":        {from.Dependencies, to.Dependencies},
+		"execution_container": {from.ExecutionContainer, to.ExecutionContainer},
+		"service_containers":  {from.ServiceContainers, to.ServiceContainers},
+	} {
+		if !reflect.DeepEqual(values[0], values[1]) {
+			diff.behavioral(field, "%s changed", field)
+		}
+	}
+	compareBool(diff, "is_requires_admin_user", from.IsRequiresAdminUser, to.IsRequiresAdminUser)
+	compareBool(diff, "is_always_run", from.IsAlwaysRun, to.IsAlwaysRun)
+	compareBool(diff, "is_skippable", from.IsSkippable, to.IsSkippable)
+	if deref(from.RunIf) != deref(to.RunIf) {
+		diff.behavioral("run_if", "run_if changed from %q to %q", deref(from.RunIf), deref(to.RunIf))
+	}
+	compareInt(diff, "timeout", from.Timeout, to.Timeout)
+	compareInt(diff, "no_output_timeout", from.NoOutputTimeout, to.NoOutputTimeout)
+}
+
+// compareTags reports dropped platform support as breaking: workflows on
+// that platform can no longer use the step.
+func compareTags(diff *Diff, field, name string, from, to []string) {
+	added, removed := setDiff(from, to)
+	// No tags means every platform is supported.
+	if len(to) > 0 && (len(removed) > 0 || len(from) == 0) {
+		diff.breaking(field, "%s support narrowed from %v to %v", name, from, to)
+	} else if len(added) > 0 || len(removed) > 0 {
+		diff.cosmetic(field, "%s support extended from %v to %v", name, from, to)
+	}
+}
+
+type envVar struct {
+	value string
+	opts  envmanModels.EnvironmentItemOptionsModel
+}
+
+func parseEnvVars(kind string, items []envmanModels.EnvironmentItemModel) ([]string, map[string]envVar, error) {
+	keys := []string{}
+	vars := map[string]envVar{}
+	for _, item := range items {
+		key, value, err := item.GetKeyValuePair()
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid %s: %w", kind, err)
+		}
+		opts, err := item.GetOptions()
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid options of %s %s: %w", kind, key, err)
+		}
+		keys = append(keys, key)
+		vars[key] = envVar{value: value, opts: opts}
+	}
+	return keys, vars, nil
+}
+
+func compareInputs(diff *Diff, from, to []envmanModels.EnvironmentItemModel) error {
+	fromKeys, fromInputs, err := parseEnvVars("input", from)
+	if err != nil {
+		return err
+	}
+	toKeys, toInputs, err := parseEnvVars("input", to)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range fromKeys {
+		if _, ok := toInputs[key]; !ok {
+			diff.breaking("inputs."+key, "input %s was removed", key)
+		}
+	}
+
+	for _, key := range toKeys {
+		field := "inputs." + key
+		input := toInputs[key]
+		required := deref(input.opts.IsRequired)
+
+		old, existed := fromInputs[key]
+		if !existed {
+			switch {
+			case required && input.value == "":
+				diff.breaking(field, "new required input %s has no default value", key)
+			case input.value != "":
+				diff.behavioral(field, "new input %s defaults to %q", key, input.value)
+			default:
+				diff.cosmetic(field, "new optional input %s", key)
+			}
+			continue
+		}
+
+		if required && !deref(old.opts.IsRequired) {
+			if input.value == "" {
+				diff.breaking(field+".is_required", "input %s became required and has no default value", key)
+			} else {
+				diff.behavioral(field+".is_required", "input %s became required", key)
+			}
+		} else if !required && deref(old.opts.IsRequired) {
+			diff.cosmetic(field+".is_required", "input %s became optional", key)
+		}
+
+		if old.value != input.value {
+			diff.behavioral(field, "default value of input %s changed from %q to %q", key, old.value, input.value)
+		}
+
+		compareValueOptions(diff, field+".value_options", key, old.opts.ValueOptions, input.opts.ValueOptions)
+
+		compareEnvOptions(diff, field, old.opts, input.opts)
+	}
+	return nil
+}
+
+// compareValueOptions reports values an input no longer accepts as breaking,
+// and new accepted values as cosmetic. No value options means any value.
+func compareValueOptions(diff *Diff, field, key string, from, to []string) {
+	switch {
+	case len(to) == 0:
+		if len(from) > 0 {
+			diff.cosmetic(field, "input %s accepts any value now", key)
+		}
+	case len(from) == 0:
+		diff.breaking(field, "input %s no longer accepts values other than %v", key, to)
+	default:
+		added, removed := setDiff(from, to)
+		if len(removed) > 0 {
+			diff.breaking(field, "input %s no longer accepts %v", key, removed)
+		}
+		if len(added) > 0 {
+			diff.cosmetic(field, "input %s accepts %v too", key, added)
+		}
+	}
+}
+
+func compareOutputs(diff *Diff, from, to []envmanModels.EnvironmentItemModel) error {
+	fromKeys, fromOutputs, err := parseEnvVars("output", from)
+	if err != nil {
+		return err
+	}
+	toKeys, toOutputs, err := parseEnvVars("output", to)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range fromKeys {
+		if _, ok := toOutputs[key]; !ok {
+			diff.breaking("outputs."+key, "output %s was removed", key)
+		}
+	}
+	for _, key := range toKeys {
+		old, existed := fromOutputs[key]
+		if !existed {
+			diff.cosmetic("outputs."+key, "new output %s", key)
+			continue
+		}
+		compareEnvOptions(diff, "outputs."+key, old.opts, toOutputs[key].opts)
+	}
+	return nil
+}
+
+func compareEnvOptions(diff *Diff, field string, from, to envmanModels.EnvironmentItemOptionsModel) {
+	for name, values := range map[string][2]*string{
+		"title":       {from.Title, to.Title},
+		"summary":     {from.Summary, to.Summary},
+		"description": {from.Description, to.Description},
+		"category":    {from.Category, to.Category},
+	} {
+		if deref(values[0]) != deref(values[1]) {
+			diff.cosmetic(field+"."+name, "%s of %s changed", name, field)
+		}
+	}
+	for name, values := range map[string][2]*bool{
+		"is_expand":            {from.IsExpand, to.IsExpand},
+		"skip_if_empty":        {from.SkipIfEmpty, to.SkipIfEmpty},
+		"is_dont_change_value": {from.IsDontChangeValue, to.IsDontChangeValue},
+		"is_template":          {from.IsTemplate, to.IsTemplate},
+		"is_sensitive":         {from.IsSensitive, to.IsSensitive},
+		"unset":                {from.Unset, to.Unset},
+	} {
+		if deref(values[0]) != deref(values[1]) {
+			diff.behavioral(field+"."+name, "%s of %s changed from %t to %t", name, field, deref(values[0]), deref(values[1]))
+		}
+	}
+}
+
+func compareBool(diff *Diff, field string, from, to *bool) {
+	if deref(from) != deref(to) {
+		diff.behavioral(field, "%s changed from %t to %t", field, deref(from), deref(to))
+	}
+}
+
+func compareInt(diff *Diff, field string, from, to *int) {
+	if deref(from) != deref(to) {
+		diff.behavioral(field, "%s changed from %d to %d", field, deref(from), deref(to))
+	}
+}
+
+// sortChanges orders the changes by field, as some come from map iteration.
+func sortChanges(diff *Diff) {
+	for _, changes := range [][]Change{diff.Breaking, diff.Behavioral, diff.Cosmetic} {
+		slices.SortStableFunc(changes, func(a, b Change) int { return strings.Compare(a.Field, b.Field) })
+	}
+}
+
+// setDiff returns the values of to missing from from and the values of from
+// missing from to.
+func setDiff(from, to []string) (added, removed []string) {
+	for _, v := range to {
+		if !slices.Contains(from, v) {
+			added = append(added, v)
+		}
+	}
+	for _, v := range from {
+		if !slices.Contains(to, v) {
+			removed = append(removed, v)
+		}
+	}
+	return added, removed
+}
+
+func deref[T any](p *T) T {
+	var zero T
+	if p == nil {
+		return zero
+	}
+	return *p
+}
@@ -0,0 +1,194 @@
+package stepdiff
+
+import (
+	"testing"
+
+	"github.com/bitrise-io/stepman/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+const baseStepYML = `
+title: Git Clone
+summary: Clones a repository
+host_os_tags: [osx-10.10, ubuntu-16.04]
+type_tags: [utility]
+toolkit:
+  go:
+    package_name: github.com/bitrise-steplib/steps-git-clone
+inputs:
+- repository_url: $GIT_REPOSITORY_URL
+  opts:
+    title: Repository URL
+    is_required: true
+- clone_depth:
+  opts:
+    title: Clone depth
+- merge: "yes"
+  opts:
+    title: Merge
+    value_options: ["yes", "no"]
+- manual_merge: "yes"
+  opts:
+    title: Manual merge
+outputs:
+- GIT_CLONE_COMMIT_HASH:
+  opts:
+    title: Cloned commit hash
+- GIT_CLONE_COMMIT_AUTHOR_NAME:
+`
+
+func parseStep(t *testing.T, stepYML string) models.StepModel {
+	t.Helper()
+	var step models.StepModel
+	require.NoError(t, yaml.Unmarshal([]byte(stepYML), &step))
+	return step
+}
+
+func TestCompare(t *testing.T) {
+	cases := map[string]struct {
+		to   string
+		want Diff
+	}{
+		"identical": {
+			to:   baseStepYML,
+			want: Diff{Breaking: []Change{}, Behavioral: []Change{}, Cosmetic: []Change{}},
+		},
+		"major upgrade": {
+			to: `
+title: Git Clone Repository
+summary: Clones a repository
+host_os_tags: [osx-10.10]
+type_tags: [utility]
+toolkit:
+  go:
+    package_name: github.com/bitrise-steplib/steps-git-clone
+inputs:
+- repository_url: $GIT_REPOSITORY_URL
+  opts:
+    title: Repository URL
+    is_required: true
+- clone_depth: 1
+  opts:
+    title: Clone depth
+- merge: "no"
+  opts:
+    title: Merge
+    value_options: ["no", "squash"]
+- token:
+  opts:
+    is_required: true
+- fetch_tags: "no"
+outputs:
+- GIT_CLONE_COMMIT_HASH:
+  opts:
+    title: Commit hash
+- GIT_CLONE_COMMIT_MESSAGE:
+`,
+			want: Diff{
+				Breaking: []Change{
+					{Field: "host_os_tags", Message: "host OS support narrowed from [osx-10.10 ubuntu-16.04] to [osx-10.10]"},
+					{Field: "inputs.manual_merge", Message: "input manual_merge was removed"},
+					{Field: "inputs.merge.value_options", Message: "input merge no longer accepts [yes]"},
+					{Field: "inputs.token", Message: "new required input token has no default value"},
+					{Field: "outputs.GIT_CLONE_COMMIT_AUTHOR_NAME", Message: "output GIT_CLONE_COMMIT_AUTHOR_NAME was removed"},
+				},
+				Behavioral: []Change{
+					{Field: "inputs.clone_depth", Message: `default value of input clone_depth changed from "" to "1"`},
+					{Field: "inputs.fetch_tags", Message: `new input fetch_tags defaults to "no"`},
+					{Field: "inputs.merge", Message: `default value of input merge changed from "yes" to "no"`},
+				},
+				Cosmetic: []Change{
+					{Field: "inputs.merge.value_options", Message: "input merge accepts [squash] too"},
+					{Field: "outputs.GIT_CLONE_COMMIT_HASH.title", Message: "title of outputs.GIT_CLONE_COMMIT_HASH changed"},
+					{Field: "outputs.GIT_CLONE_COMMIT_MESSAGE", Message: "new output GIT_CLONE_COMMIT_MESSAGE"},
+					{Field: "title", Message: "title changed"},
+				},
+			},
+		},
+		"behavior only": {
+			to: `
+title: Git Clone
+summary: Clones a repository
+host_os_tags: [osx-10.10, ubuntu-16.04, ubuntu-22.04]
+type_tags: [utility]
+is_always_run: true
+toolkit:
+  bash:
+    entry_file: step.sh
+inputs:
+- repository_url: $GIT_REPOSITORY_URL
+  opts:
+    title: Repository URL
+    is_required: true
+    is_sensitive: true
+- clone_depth:
+  opts:
+    title: Clone depth
+    is_required: true
+- merge: "yes"
+  opts:
+    title: Merge
+    value_options: ["yes", "no"]
+- manual_merge: "yes"
+  opts:
+    title: Manual merge
+    is_required: true
+- new_optional:
+outputs:
+- GIT_CLONE_COMMIT_HASH:
+  opts:
+    title: Cloned commit hash
+- GIT_CLONE_COMMIT_AUTHOR_NAME:
+`,
+			want: Diff{
+				Breaking: []Change{
+					{Field: "inputs.clone_depth.is_required", Message: "input clone_depth became required and has no default value"},
+				},
+				Behavioral: []Change{
+					{Field: "inputs.manual_merge.is_required", Message: "input manual_merge became required"},
+					{Field: "inputs.repository_url.is_sensitive", Message: "is_sensitive of inputs.repository_url changed from false to true"},
+					{Field: "is_always_run", Message: "is_always_run changed from false to true"},
+					{Field: "toolkit", Message: "toolkit changed"},
+				},
+				Cosmetic: []Change{
+					{Field: "host_os_tags", Message: "host OS support extended from [osx-10.10 ubuntu-16.04] to [osx-10.10 ubuntu-16.04 ubuntu-22.04]"},
+					{Field: "inputs.new_optional", Message: "new optional input new_optional"},
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := Compare(parseStep(t, baseStepYML), parseStep(t, tc.to))
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestCompareTags(t *testing.T) {
+	cases := map[string]struct {
+		from, to     []string
+		wantBreaking bool
+		wantCosmetic bool
+	}{
+		"unchanged":                   {from: []string{"a"}, to: []string{"a"}},
+		"support dropped":             {from: []string{"a", "b"}, to: []string{"a"}, wantBreaking: true},
+		"any platform to a few":       {from: nil, to: []string{"a"}, wantBreaking: true},
+		"a few platforms to any":      {from: []string{"a"}, to: nil, wantCosmetic: true},
+		"support added":               {from: []string{"a"}, to: []string{"a", "b"}, wantCosmetic: true},
+		"support swapped is breaking": {from: []string{"a"}, to: []string{"b"}, wantBreaking: true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var diff Diff
+			compareTags(&diff, "host_os_tags", "host OS", tc.from, tc.to)
+			assert.Equal(t, tc.wantBreaking, len(diff.Breaking) == 1, "breaking: %v", diff.Breaking)
+			assert.Equal(t, tc.wantCosmetic, len(diff.Cosmetic) == 1, "cosmetic: %v", diff.Cosmetic)
+		})
+	}
+}
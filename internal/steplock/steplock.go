@@ -0,0 +1,201 @@
+// Package steplock pins steplib step references to exact releases. A lockfile
+// records, for each composite step ID (steplib::id@constraint), the version
+// the constraint resolved to, the source commit of that version and the hash
+// of each precompiled executable, so a later activation of the same reference
+// gets the same bits, or fails loudly if the steplib no longer serves them.
+package steplock
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/bitrise-io/stepman/models"
+	"github.com/bitrise-io/stepman/stepid"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// FileName is the lockfile looked up in the working directory.
+	FileName = "stepman.lock"
+	// PathEnv overrides the lockfile path.
+	PathEnv = "STEPMAN_LOCKFILE"
+
+	formatVersion = 1
+)
+
+// Lockfile is the content of a stepman.lock file.
+type Lockfile struct {
+	FormatVersion int     `yaml:"format_version"`
+	Steps         []Entry `yaml:"steps"`
+}
+
+// Entry locks one composite step ID. Library, StepID and Version are the
+// reference as written (Version is the constraint, empty for latest); the
+// rest is what it resolved to.
+type Entry struct {
+	Library         string `yaml:"library"`
+	StepID          string `yaml:"id"`
+	Version         string `yaml:"version,omitempty"`
+	ResolvedVersion string `yaml:"resolved_version"`
+	Commit          string `yaml:"commit"`
+	// Executables maps a platform (see models.Executables) to the hash of
+	// its precompiled executable.
+	Executables map[string]string `yaml:"executables,omitempty"`
+}
+
+// Path returns the lockfile path: $STEPMAN_LOCKFILE if set, stepman.lock in
+// the working directory otherwise.
+func Path() string {
+	if pth := os.Getenv(PathEnv); pth != "" {
+		return pth
+	}
+	return FileName
+}
+
+// Load reads the lockfile at Path(). found is false if there is none.
+func Load() (lockfile Lockfile, found bool, err error) {
+	lockfile, err = Read(Path())
+	if errors.Is(err, fs.ErrNotExist) {
+		return Lockfile{}, false, nil
+	}
+	if err != nil {
+		return Lockfile{}, false, err
+	}
+	return lockfile, true, nil
+}
+
+// Read reads and parses the lockfile at pth.
+func Read(pth string) (Lockfile, error) {
+	bytes, err := os.ReadFile(pth)
+	if err != nil {
+		return Lockfile{}, fmt.Errorf("read lockfile: %w", err)
+	}
+	var lockfile Lockfile
+	if err := yaml.Unmarshal(bytes, &lockfile); err != nil {
+		return Lockfile{}, fmt.Errorf("parse lockfile %s: %w", pth, err)
+	}
+	if lockfile.FormatVersion != formatVersion {
+		return Lockfile{}, fmt.Errorf("lockfile %s: unsupported format_version %d, this stepman supports %d", pth, lockfile.FormatVersion, formatVersion)
+	}
+	return lockfile, nil
+}
+
+// Write writes lockfile to pth, with its entries sorted for stable diffs.
+func Write(pth string, lockfile Lockfile) error {
+	lockfile.FormatVersion = formatVersion
+	slices.SortFunc(lockfile.Steps, func(a, b Entry) int {
+		return strings.Compare(a.key(), b.key())
+	})
+	bytes, err := yaml.Marshal(lockfile)
+	if err != nil {
+		return fmt.Errorf("encode lockfile: %w", err)
+	}
+	if err := os.WriteFile(pth, bytes, 0o644); err != nil {
+		return fmt.Errorf("write lockfile: %w", err)
+	}
+	return nil
+}
+
+// Find returns the entry locking id.
+func (l Lockfile) Find(id stepid.CanonicalID) (Entry, bool) {
+	for _, entry := range l.Steps {
+		if entry.Library == id.SteplibSource && entry.StepID == id.IDorURI && entry.Version == id.Version {
+			return entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Put adds entry, replacing the entry of the same composite step ID if any.
+func (l *Lockfile) Put(entry Entry) {
+	for i := range l.Steps {
+		if l.Steps[i].key() == entry.key() {
+			l.Steps[i] = entry
+			return
+		}
+	}
+	l.Steps = append(l.Steps, entry)
+}
+
+// CanonicalID returns the composite step ID e locks.
+func (e Entry) CanonicalID() stepid.CanonicalID {
+	return stepid.CanonicalID{SteplibSource: e.Library, IDorURI: e.StepID, Version: e.Version}
+}
+
+func (e Entry) key() string {
+	return e.Library + "::" + e.StepID + "@" + e.Version
+}
+
+// Resolve resolves id against collection, the spec of id's steplib, and
+// returns the entry locking the result.
+func Resolve(collection models.StepCollectionModel, id stepid.CanonicalID) (Entry, error) {
+	stepVersion, stepFound, versionFound := collection.GetExistingStepVersion(id.IDorURI, id.Version)
+	if !stepFound {
+		return Entry{}, fmt.Errorf("step %s not found in %s", id.IDorURI, id.SteplibSource)
+	}
+	if !versionFound {
+		return Entry{}, fmt.Errorf("no version of step %s in %s matches %q", id.IDorURI, id.SteplibSource, id.Version)
+	}
+	return NewEntry(id, stepVersion.Version, stepVersion.Step), nil
+}
+
+// NewEntry returns the entry locking id to version, whose definition is step.
+func NewEntry(id stepid.CanonicalID, version string, step models.StepModel) Entry {
+	entry := Entry{
+		Library:         id.SteplibSource,
+		StepID:          id.IDorURI,
+		Version:         id.Version,
+		ResolvedVersion: version,
+		Commit:          "",
+		Executables:     nil,
+	}
+	if step.Source != nil {
+		entry.Commit = step.Source.Commit
+	}
+	if step.Executables != nil && len(*step.Executables) > 0 {
+		entry.Executables = map[string]string{}
+		for platform, executable := range *step.Executables {
+			entry.Executables[platform] = executable.Hash
+		}
+	}
+	return entry
+}
+
+// Mismatches describes how current, the same reference resolved again,
+// differs from e. It is empty if the lock still holds.
+func (e Entry) Mismatches(current Entry) []string {
+	var mismatches []string
+	if current.ResolvedVersion != e.ResolvedVersion {
+		mismatches = append(mismatches, fmt.Sprintf("resolves to %s, locked to %s", current.ResolvedVersion, e.ResolvedVersion))
+		// The rest describes another version, comparing it says nothing more.
+		return mismatches
+	}
+	if current.Commit != e.Commit {
+		mismatches = append(mismatches, fmt.Sprintf("source commit is %s, locked to %s", current.Commit, e.Commit))
+	}
+	platforms := slices.Collect(maps.Keys(e.Executables))
+	for platform := range current.Executables {
+		if _, ok := e.Executables[platform]; !ok {
+			platforms = append(platforms, platform)
+		}
+	}
+	slices.Sort(platforms)
+	for _, platform := range platforms {
+		locked, wasLocked := e.Executables[platform]
+		hash, exists := current.Executables[platform]
+		switch {
+		case !exists:
+			mismatches = append(mismatches, fmt.Sprintf("%s executable was removed", platform))
+		case !wasLocked:
+			mismatches = append(mismatches, fmt.Sprintf("%s executable was added", platform))
+		case hash != locked:
+			mismatches = append(mismatches, fmt.Sprintf("%s executable hash is %s, locked to %s", platform, hash, locked))
+		}
+	}
+	return mismatches
+}
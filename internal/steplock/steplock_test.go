@@ -0,0 +1,171 @@
+package steplock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/stepman/models"
+	"github.com/bitrise-io/stepman/stepid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testLibrary = "https://github.com/bitrise-io/bitrise-steplib.git"
+
+func testStep(commit string, executables models.Executables) models.StepModel {
+	//nolint:exhaustruct
+	step := models.StepModel{Source: &models.StepSourceModel{Git: "https://github.com/bitrise-steplib/steps-script.git", Commit: commit}}
+	if executables != nil {
+		step.Executables = &executables
+	}
+	return step
+}
+
+func testCollection() models.StepCollectionModel {
+	//nolint:exhaustruct
+	return models.StepCollectionModel{
+		SteplibSource: testLibrary,
+		Steps: models.StepHash{
+			"script": {
+				LatestVersionNumber: "2.0.0",
+				Versions: map[string]models.StepModel{
+					"1.1.0": testStep("c110", nil),
+					"1.2.0": testStep("c120", models.Executables{
+						"linux-amd64":  {StorageURI: "script/1.2.0/linux-amd64", Hash: "sha256-aa"},
+						"darwin-arm64": {StorageURI: "script/1.2.0/darwin-arm64", Hash: "sha256-bb"},
+					}),
+					"2.0.0": testStep("c200", nil),
+				},
+			},
+		},
+	}
+}
+
+func TestResolve(t *testing.T) {
+	cases := map[string]struct {
+		version string
+		want    Entry
+		wantErr string
+	}{
+		"minor locked": {
+			version: "1",
+			want: Entry{
+				Library: testLibrary, StepID: "script", Version: "1", ResolvedVersion: "1.2.0", Commit: "c120",
+				Executables: map[string]string{"linux-amd64": "sha256-aa", "darwin-arm64": "sha256-bb"},
+			},
+		},
+		"exact without executables": {
+			version: "1.1.0",
+			want:    Entry{Library: testLibrary, StepID: "script", Version: "1.1.0", ResolvedVersion: "1.1.0", Commit: "c110", Executables: nil},
+		},
+		"latest": {
+			version: "",
+			want:    Entry{Library: testLibrary, StepID: "script", Version: "", ResolvedVersion: "2.0.0", Commit: "c200", Executables: nil},
+		},
+		"no matching version": {
+			version: "3",
+			wantErr: `no version of step script in ` + testLibrary + ` matches "3"`,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := Resolve(testCollection(), stepid.CanonicalID{SteplibSource: testLibrary, IDorURI: "script", Version: tc.version})
+			if tc.wantErr != "" {
+				require.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestEntry_Mismatches(t *testing.T) {
+	locked := Entry{
+		Library: testLibrary, StepID: "script", Version: "1", ResolvedVersion: "1.2.0", Commit: "c120",
+		Executables: map[string]string{"linux-amd64": "sha256-aa", "darwin-arm64": "sha256-bb"},
+	}
+
+	cases := map[string]struct {
+		mutate func(e *Entry)
+		want   []string
+	}{
+		"unchanged": {
+			mutate: func(*Entry) {},
+			want:   nil,
+		},
+		"new version released": {
+			mutate: func(e *Entry) { e.ResolvedVersion = "1.3.0"; e.Commit = "c130" },
+			want:   []string{"resolves to 1.3.0, locked to 1.2.0"},
+		},
+		"version re-released from another commit": {
+			mutate: func(e *Entry) { e.Commit = "evil" },
+			want:   []string{"source commit is evil, locked to c120"},
+		},
+		"executables changed": {
+			mutate: func(e *Entry) {
+				e.Executables = map[string]string{"linux-amd64": "sha256-cc", "linux-arm64": "sha256-dd"}
+			},
+			want: []string{
+				"darwin-arm64 executable was removed",
+				"linux-amd64 executable hash is sha256-cc, locked to sha256-aa",
+				"linux-arm64 executable was added",
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			current := locked
+			current.Executables = map[string]string{}
+			for platform, hash := range locked.Executables {
+				current.Executables[platform] = hash
+			}
+			tc.mutate(&current)
+			assert.Equal(t, tc.want, locked.Mismatches(current))
+		})
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), FileName)
+	first := Entry{Library: testLibrary, StepID: "script", Version: "1", ResolvedVersion: "1.2.0", Commit: "c120", Executables: map[string]string{"linux-amd64": "sha256-aa"}}
+	second := Entry{Library: testLibrary, StepID: "git-clone", Version: "", ResolvedVersion: "8.0.0", Commit: "c800", Executables: nil}
+
+	var lockfile Lockfile
+	lockfile.Put(first)
+	lockfile.Put(second)
+	second.ResolvedVersion = "8.1.0"
+	lockfile.Put(second)
+	require.NoError(t, Write(pth, lockfile))
+
+	got, err := Read(pth)
+	require.NoError(t, err)
+	assert.Equal(t, Lockfile{FormatVersion: 1, Steps: []Entry{second, first}}, got, "entries are replaced by composite ID and sorted")
+
+	entry, found := got.Find(stepid.CanonicalID{SteplibSource: testLibrary, IDorURI: "script", Version: "1"})
+	assert.True(t, found)
+	assert.Equal(t, first, entry)
+	_, found = got.Find(stepid.CanonicalID{SteplibSource: testLibrary, IDorURI: "script", Version: "1.2"})
+	assert.False(t, found, "another constraint of the same step is not locked")
+
+	require.NoError(t, os.WriteFile(pth, []byte("format_version: 2\n"), 0o600))
+	_, err = Read(pth)
+	require.ErrorContains(t, err, "unsupported format_version 2")
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(PathEnv, filepath.Join(dir, "custom.lock"))
+
+	_, found, err := Load()
+	require.NoError(t, err)
+	assert.False(t, found, "missing lockfile")
+
+	require.NoError(t, Write(filepath.Join(dir, "custom.lock"), Lockfile{FormatVersion: 0, Steps: nil}))
+	_, found, err = Load()
+	require.NoError(t, err)
+	assert.True(t, found)
+}
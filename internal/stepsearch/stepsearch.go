@@ -0,0 +1,160 @@
+// Package stepsearch ranks steplib steps against a free-text query. It works
+// on steplibindex.SearchEntry values, which come either from a V2 inventory's
+// index/search.json or, for a V1 steplib, from its spec.json (see
+// FromCollection), so both steplib formats search the same way.
+package stepsearch
+
+import (
+	"cmp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/bitrise-io/stepman/models"
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+)
+
+// Query selects and ranks steps. Every word of Text must match the step
+// somewhere (its id, title, type tags, summary or maintainer); an empty Text
+// matches every step. The tag filters narrow the result further: a step must
+// carry each listed type tag, and must support each listed project type and
+// host OS. A step without project type (or host OS) tags supports all of them.
+type Query struct {
+	Text              string
+	TypeTags          []string
+	ProjectTypeTags   []string
+	HostOSTags        []string
+	IncludeDeprecated bool
+}
+
+// Result is one matching step with its relevance score; higher is better.
+type Result struct {
+	steplibindex.SearchEntry
+	Score int `json:"score"`
+}
+
+// Search returns the entries matching q, best match first. Ties are broken by
+// putting active steps before deprecated ones, then by step id.
+func Search(entries []steplibindex.SearchEntry, q Query) []Result {
+	terms := strings.Fields(strings.ToLower(q.Text))
+	results := []Result{}
+	for _, entry := range entries {
+		if entry.Deprecated && !q.IncludeDeprecated {
+			continue
+		}
+		if !matchesFilters(entry, q) {
+			continue
+		}
+		score, ok := scoreEntry(entry, terms)
+		if !ok {
+			continue
+		}
+		results = append(results, Result{SearchEntry: entry, Score: score})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Deprecated != b.Deprecated {
+			return !a.Deprecated
+		}
+		return a.StepID < b.StepID
+	})
+	return results
+}
+
+// FromCollection builds the search entries of a V1 steplib, describing each
+// step by its latest version like indexgen does for index/search.json.
+func FromCollection(collection models.StepCollectionModel) []steplibindex.SearchEntry {
+	entries := []steplibindex.SearchEntry{}
+	for id, group := range collection.Steps {
+		latest, found := group.LatestVersion()
+		if !found {
+			continue
+		}
+		deprecated := group.Info.RemovalDate != "" || group.Info.DeprecateNotes != ""
+		entries = append(entries, steplibindex.NewSearchEntry(id, group.LatestVersionNumber, latest, group.Info.Maintainer, deprecated))
+	}
+	slices.SortFunc(entries, func(a, b steplibindex.SearchEntry) int { return cmp.Compare(a.StepID, b.StepID) })
+	return entries
+}
+
+func matchesFilters(entry steplibindex.SearchEntry, q Query) bool {
+	for _, tag := range q.TypeTags {
+		if !containsFold(entry.TypeTags, tag) {
+			return false
+		}
+	}
+	for _, tag := range q.ProjectTypeTags {
+		if len(entry.ProjectTypeTags) > 0 && !containsFold(entry.ProjectTypeTags, tag) {
+			return false
+		}
+	}
+	for _, tag := range q.HostOSTags {
+		if len(entry.HostOSTags) > 0 && !containsFold(entry.HostOSTags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// Per-term weights: where a query word matches says how relevant the step is.
+// A hit on the step id outranks one in the title, which outranks the rest.
+const (
+	weightIDExact      = 100
+	weightIDPrefix     = 60
+	weightIDContains   = 40
+	weightTitleWord    = 30
+	weightTitleContain = 20
+	weightTypeTag      = 15
+	weightSummary      = 5
+	weightMaintainer   = 5
+)
+
+// scoreEntry sums the best score of each term; ok is false if some term
+// matches nowhere.
+func scoreEntry(entry steplibindex.SearchEntry, terms []string) (score int, ok bool) {
+	id := strings.ToLower(entry.StepID)
+	title := strings.ToLower(entry.Title)
+	titleWords := strings.FieldsFunc(title, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' })
+	summary := strings.ToLower(entry.Summary)
+
+	for _, term := range terms {
+		best := 0
+		switch {
+		case id == term:
+			best = weightIDExact
+		case strings.HasPrefix(id, term):
+			best = weightIDPrefix
+		case strings.Contains(id, term):
+			best = weightIDContains
+		}
+		switch {
+		case slices.Contains(titleWords, term):
+			best = max(best, weightTitleWord)
+		case strings.Contains(title, term):
+			best = max(best, weightTitleContain)
+		}
+		if containsFold(entry.TypeTags, term) {
+			best = max(best, weightTypeTag)
+		}
+		if strings.Contains(summary, term) {
+			best = max(best, weightSummary)
+		}
+		if strings.EqualFold(entry.Maintainer, term) {
+			best = max(best, weightMaintainer)
+		}
+		if best == 0 {
+			return 0, false
+		}
+		score += best
+	}
+	return score, true
+}
+
+func containsFold(values []string, s string) bool {
+	return slices.ContainsFunc(values, func(v string) bool { return strings.EqualFold(v, s) })
+}
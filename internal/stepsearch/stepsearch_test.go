@@ -0,0 +1,108 @@
+package stepsearch
+
+import (
+	"testing"
+
+	"github.com/bitrise-io/go-utils/pointers"
+	"github.com/bitrise-io/stepman/models"
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var entries = []steplibindex.SearchEntry{
+	{StepID: "git-clone", Title: "Git Clone Repository", Summary: "Checks out the repository.", TypeTags: []string{"utility"}, Maintainer: "bitrise"},
+	{StepID: "xcode-test", Title: "Xcode Test for iOS", Summary: "Runs Xcode tests.", TypeTags: []string{"test"}, ProjectTypeTags: []string{"ios", "react-native"}, HostOSTags: []string{"osx-10.10"}, Maintainer: "bitrise"},
+	{StepID: "gradle-unit-test", Title: "Android Unit Test", Summary: "Runs unit tests with Gradle.", TypeTags: []string{"test"}, ProjectTypeTags: []string{"android"}, Maintainer: "bitrise"},
+	{StepID: "script", Title: "Script", Summary: "Runs a script, e.g. to clone a repo with git.", TypeTags: []string{"utility"}, Maintainer: "bitrise"},
+	{StepID: "old-git", Title: "Old Git", Summary: "Legacy git step.", TypeTags: []string{"utility"}, Maintainer: "community", Deprecated: true},
+}
+
+func ids(results []Result) []string {
+	out := make([]string, len(results))
+	for i, r := range results {
+		out[i] = r.StepID
+	}
+	return out
+}
+
+func TestSearch(t *testing.T) {
+	cases := map[string]struct {
+		query Query
+		want  []string
+	}{
+		"id match outranks summary match": {
+			query: Query{Text: "git"},
+			want:  []string{"git-clone", "script"},
+		},
+		"every term must match": {
+			query: Query{Text: "git repository"},
+			want:  []string{"git-clone"},
+		},
+		"case-insensitive, ties ordered by id": {
+			query: Query{Text: "TEST"},
+			want:  []string{"gradle-unit-test", "xcode-test"},
+		},
+		"title word": {
+			query: Query{Text: "ios"},
+			want:  []string{"xcode-test"},
+		},
+		"deprecated steps on request, after active ones": {
+			query: Query{Text: "git", IncludeDeprecated: true},
+			want:  []string{"git-clone", "old-git", "script"},
+		},
+		"type tag filter": {
+			query: Query{TypeTags: []string{"test"}},
+			want:  []string{"gradle-unit-test", "xcode-test"},
+		},
+		"project type filter keeps steps without project types": {
+			query: Query{ProjectTypeTags: []string{"android"}},
+			want:  []string{"git-clone", "gradle-unit-test", "script"},
+		},
+		"host OS filter": {
+			query: Query{Text: "test", HostOSTags: []string{"linux"}},
+			want:  []string{"gradle-unit-test"},
+		},
+		"no match": {
+			query: Query{Text: "kotlin"},
+			want:  []string{},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, ids(Search(entries, tc.query)))
+		})
+	}
+}
+
+func TestFromCollection(t *testing.T) {
+	collection := models.StepCollectionModel{
+		Steps: models.StepHash{
+			"script": {
+				Info:                models.StepGroupInfoModel{Maintainer: "bitrise"},
+				LatestVersionNumber: "1.1.0",
+				Versions: map[string]models.StepModel{
+					"1.0.0": {Title: pointers.NewStringPtr("Old Script")},
+					"1.1.0": {Title: pointers.NewStringPtr("Script"), TypeTags: []string{"utility"}},
+				},
+			},
+			"legacy": {
+				Info:                models.StepGroupInfoModel{Maintainer: "community", DeprecateNotes: "use script"},
+				LatestVersionNumber: "0.1.0",
+				Versions:            map[string]models.StepModel{"0.1.0": {Title: pointers.NewStringPtr("Legacy")}},
+			},
+		},
+	}
+
+	got := FromCollection(collection)
+
+	require.Len(t, got, 2)
+	assert.Equal(t, steplibindex.SearchEntry{
+		StepID: "legacy", LatestVersion: "0.1.0", Title: "Legacy",
+		TypeTags: []string{}, ProjectTypeTags: []string{}, HostOSTags: []string{},
+		Maintainer: "community", Deprecated: true,
+	}, got[0])
+	assert.Equal(t, "script", got[1].StepID)
+	assert.Equal(t, "Script", got[1].Title, "described by the latest version")
+	assert.Equal(t, []string{"utility"}, got[1].TypeTags)
+}
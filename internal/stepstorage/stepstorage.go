@@ -0,0 +1,90 @@
+// Package stepstorage locates precompiled step executables on the step storage
+// hosts. Both activation paths — V1 (activator/steplib) and V2
+// (steplibrary.Client) — resolve executable download URLs through it, so they
+// honor the same hosts and the same override.
+package stepstorage
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/stepman/models"
+)
+
+// URLsEnv overrides DefaultURLs with a comma-separated list of storage base
+// URLs, tried in order.
+const URLsEnv = "BITRISE_PRECOMPILED_STEPS_STORAGE_URLS"
+
+// HedgeDelayEnv enables hedged executable downloads: a duration (e.g. "2s")
+// after which a storage host that hasn't responded yet is raced by the next
+// one, instead of failing over only once it failed (see
+// httpfetch.Client.DownloadHedged).
+const HedgeDelayEnv = "BITRISE_PRECOMPILED_STEPS_HEDGE_DELAY"
+
+// DefaultURLs are the storage base URLs used when URLsEnv is unset, in
+// failover order.
+var DefaultURLs = []string{
+	"https://steplib.bitrise.io",
+	"https://storage.googleapis.com/bitrise-steplib-storage",
+}
+
+// BaseURLs returns the configured storage base URLs: the URLsEnv list when
+// set, DefaultURLs otherwise.
+func BaseURLs() []string {
+	if override := os.Getenv(URLsEnv); override != "" {
+		return strings.Split(override, ",")
+	}
+	return DefaultURLs
+}
+
+// HedgeDelay returns the HedgeDelayEnv duration, and 0 when it's unset, which
+// means downloads don't hedge.
+func HedgeDelay() (time.Duration, error) {
+	value := os.Getenv(HedgeDelayEnv)
+	if value == "" {
+		return 0, nil
+	}
+	delay, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", HedgeDelayEnv, err)
+	}
+	if delay <= 0 {
+		return 0, fmt.Errorf("invalid %s: %s is not positive", HedgeDelayEnv, value)
+	}
+	return delay, nil
+}
+
+// ExecutableURLs joins each base URL with the executable's StorageURI, in the
+// order of bases. Blank bases are skipped; plain http bases are rejected.
+//
+// An absolute StorageURI (as in the step definitions of a replicated
+// inventory) is the only URL, regardless of bases.
+func ExecutableURLs(bases []string, executable models.Executable) ([]string, error) {
+	if strings.Contains(executable.StorageURI, "://") {
+		if strings.HasPrefix(executable.StorageURI, "http://") {
+			return nil, fmt.Errorf("http URL is unsupported, please use https: %s", executable.StorageURI)
+		}
+		return []string{executable.StorageURI}, nil
+	}
+
+	uri := strings.TrimLeft(executable.StorageURI, "/")
+	var urls []string
+	for _, base := range bases {
+		base = strings.TrimRight(strings.TrimSpace(base), "/")
+		if base == "" {
+			continue
+		}
+		url := fmt.Sprintf("%s/%s", base, uri)
+		if strings.HasPrefix(url, "http://") {
+			return nil, fmt.Errorf("http URL is unsupported, please use https: %s", url)
+		}
+		urls = append(urls, url)
+	}
+
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no storage URLs configured")
+	}
+	return urls, nil
+}
@@ -0,0 +1,136 @@
+package stepstorage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/stepman/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecutableURLs(t *testing.T) {
+	tests := []struct {
+		name         string
+		bases        []string
+		executable   models.Executable
+		expectedURLs []string
+		expectedErr  error
+	}{
+		{
+			name:  "Default list: steplib.bitrise.io first, GCS second",
+			bases: DefaultURLs,
+			executable: models.Executable{
+				StorageURI: "steps/step1.tar.gz",
+			},
+			expectedURLs: []string{
+				"https://steplib.bitrise.io/steps/step1.tar.gz",
+				"https://storage.googleapis.com/bitrise-steplib-storage/steps/step1.tar.gz",
+			},
+		},
+		{
+			name:  "Multiple bases",
+			bases: []string{"https://a.example.com", "https://b.example.com"},
+			executable: models.Executable{
+				StorageURI: "steps/step2.tar.gz",
+			},
+			expectedURLs: []string{
+				"https://a.example.com/steps/step2.tar.gz",
+				"https://b.example.com/steps/step2.tar.gz",
+			},
+		},
+		{
+			name:  "URL normalization: trailing slashes and leading StorageURI slash",
+			bases: []string{"https://a.example.com/// ", " https://b.example.com///"},
+			executable: models.Executable{
+				StorageURI: "/steps/step3.tar.gz",
+			},
+			expectedURLs: []string{
+				"https://a.example.com/steps/step3.tar.gz",
+				"https://b.example.com/steps/step3.tar.gz",
+			},
+		},
+		{
+			name:  "Input parsing: spaces and empty entries",
+			bases: []string{"", " https://a.example.com ", "", " https://b.example.com ", ""},
+			executable: models.Executable{
+				StorageURI: "steps/step4.tar.gz",
+			},
+			expectedURLs: []string{
+				"https://a.example.com/steps/step4.tar.gz",
+				"https://b.example.com/steps/step4.tar.gz",
+			},
+		},
+		{
+			name:  "http URL is rejected",
+			bases: []string{"http://a.example.com"},
+			executable: models.Executable{
+				StorageURI: "steps/step5.tar.gz",
+			},
+			expectedErr: fmt.Errorf("http URL is unsupported, please use https: http://a.example.com/steps/step5.tar.gz"),
+		},
+		{
+			name:  "Absolute StorageURI ignores the bases",
+			bases: []string{"https://a.example.com"},
+			executable: models.Executable{
+				StorageURI: "https://mirror.example.com/storage/steps/step7.tar.gz",
+			},
+			expectedURLs: []string{
+				"https://mirror.example.com/storage/steps/step7.tar.gz",
+			},
+		},
+		{
+			name:  "Absolute http StorageURI is rejected",
+			bases: []string{"https://a.example.com"},
+			executable: models.Executable{
+				StorageURI: "http://mirror.example.com/storage/steps/step8.tar.gz",
+			},
+			expectedErr: fmt.Errorf("http URL is unsupported, please use https: http://mirror.example.com/storage/steps/step8.tar.gz"),
+		},
+		{
+			name:  "All-empty list yields a configuration error",
+			bases: []string{"", "", ""},
+			executable: models.Executable{
+				StorageURI: "steps/step6.tar.gz",
+			},
+			expectedErr: fmt.Errorf("no storage URLs configured"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExecutableURLs(tt.bases, tt.executable)
+			if tt.expectedErr != nil {
+				require.EqualError(t, err, tt.expectedErr.Error())
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tt.expectedURLs, got)
+			}
+		})
+	}
+}
+
+func TestHedgeDelay(t *testing.T) {
+	tests := map[string]struct {
+		value         string
+		expectedDelay time.Duration
+		expectedErr   string
+	}{
+		"unset":    {value: "", expectedDelay: 0},
+		"duration": {value: "1500ms", expectedDelay: 1500 * time.Millisecond},
+		"invalid":  {value: "fast", expectedErr: `invalid BITRISE_PRECOMPILED_STEPS_HEDGE_DELAY: time: invalid duration "fast"`},
+		"zero":     {value: "0s", expectedErr: "invalid BITRISE_PRECOMPILED_STEPS_HEDGE_DELAY: 0s is not positive"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(HedgeDelayEnv, tt.value)
+			delay, err := HedgeDelay()
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedDelay, delay)
+		})
+	}
+}
@@ -124,6 +124,10 @@ type StepGroupInfoModel struct {
 	DeprecateNotes string            `json:"deprecate_notes,omitempty" yaml:"deprecate_notes,omitempty"`
 	AssetURLs      map[string]string `json:"asset_urls,omitempty" yaml:"asset_urls,omitempty"`
 	Maintainer     string            `json:"maintainer,omitempty" yaml:"maintainer,omitempty"`
+	// YankedVersions maps the yanked versions of the step to the reason they
+	// were yanked. A yanked version stays available when pinned exactly, but
+	// never satisfies a latest, major/minor locked or range constraint.
+	YankedVersions map[string]string `json:"yanked_versions,omitempty" yaml:"yanked_versions,omitempty"`
 }
 
 type StepGroupModel struct {
@@ -138,7 +142,10 @@ type Executables map[string]Executable
 
 type Executable struct {
 	StorageURI string `json:"storage_uri,omitempty" yaml:"storage_uri,omitempty"`
-	Hash       string `json:"hash,omitempty" yaml:"hash,omitempty"`
+	// Hash is one or more space-separated digests, all of which the executable
+	// must match: sha256, sha384 or sha512, in hex or SRI base64.
+	// Examples: sha256-<hex>, sha256-<base64> sha512-<base64>
+	Hash string `json:"hash,omitempty" yaml:"hash,omitempty"`
 }
 
 func (stepGroup StepGroupModel) LatestVersion() (StepModel, bool) {
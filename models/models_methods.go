@@ -38,6 +38,10 @@ func (stepInfo StepInfoModel) String() string {
 			str += strings.TrimSpace(stepInfo.GroupInfo.RemovalDate) + "\n"
 		}
 	}
+	if reason, yanked := stepInfo.GroupInfo.YankedVersions[stepInfo.Version]; yanked {
+		str += colorstring.Red("This version is yanked: ")
+		str += strings.TrimSpace(reason) + "\n"
+	}
 	if len(stepInfo.GroupInfo.Maintainer) > 0 {
 		str += fmt.Sprintf("%s %s\n", colorstring.Blue("Maintainer:"), stepInfo.GroupInfo.Maintainer)
 	}
@@ -303,6 +307,17 @@ func (collection StepCollectionModel) GetStepVersion(id, version string) (stepVe
 	return stepVersionModel, true, versionFound
 }
 
+// GetExistingStepVersion is GetStepVersion which also reports versionFound as
+// false when the resolved version is not one of the step's versions, so the
+// caller can index collection.Steps[id].Versions with it.
+func (collection StepCollectionModel) GetExistingStepVersion(id, version string) (stepVersion StepVersionModel, stepFound bool, versionFound bool) {
+	stepVersion, stepFound, versionFound = collection.GetStepVersion(id, version)
+	if _, exists := collection.Steps[id].Versions[stepVersion.Version]; !exists {
+		versionFound = false
+	}
+	return stepVersion, stepFound, versionFound
+}
+
 // GetDownloadLocations ...
 func (collection StepCollectionModel) GetDownloadLocations(id, version string) ([]DownloadLocationModel, error) {
 	step, stepFound, versionFound := collection.GetStep(id, version)
@@ -313,12 +328,20 @@ func (collection StepCollectionModel) GetDownloadLocations(id, version string) (
 		return []DownloadLocationModel{}, fmt.Errorf("collection (%s) doesn't contains step (%s) with version: %s", collection.SteplibSource, id, version)
 	}
 
+	return StepDownloadLocations(collection.DownloadLocations, id, version, step)
+}
+
+// StepDownloadLocations expands the steplib-level download location templates
+// (steplib.yml's download_locations) into the concrete source locations of one
+// step version: a zip location becomes <src><id>/<version>/step.zip, a git
+// location becomes the step's own source repository.
+func StepDownloadLocations(templates []DownloadLocationModel, id, version string, step StepModel) ([]DownloadLocationModel, error) {
 	if step.Source == nil {
 		return []DownloadLocationModel{}, errors.New("missing Source property")
 	}
 
 	locations := []DownloadLocationModel{}
-	for _, downloadLocation := range collection.DownloadLocations {
+	for _, downloadLocation := range templates {
 		switch downloadLocation.Type {
 		case "zip":
 			url := downloadLocation.Src + id + "/" + version + "/step.zip"
@@ -568,3 +568,39 @@ func TestStepCollectionModel_GetStepVersion(t *testing.T) {
 		})
 	}
 }
+
+func TestStepCollectionModel_GetExistingStepVersion(t *testing.T) {
+	collection := StepCollectionModel{
+		Steps: StepHash{
+			"step": StepGroupModel{
+				Versions:            map[string]StepModel{"1.0.0": {}, "1.1.0": {}},
+				LatestVersionNumber: "1.1.0",
+			},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		id           string
+		version      string
+		wantVersion  string
+		stepFound    bool
+		versionFound bool
+	}{
+		{name: "Lock Minor version", id: "step", version: "1.1", wantVersion: "1.1.0", stepFound: true, versionFound: true},
+		{name: "No version matches the major lock", id: "step", version: "2", stepFound: true, versionFound: false},
+		{name: "No version matches the minor lock", id: "step", version: "1.2", stepFound: true, versionFound: false},
+		{name: "Missing step", id: "missing", version: "1", stepFound: false, versionFound: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, stepFound, versionFound := collection.GetExistingStepVersion(tt.id, tt.version)
+			if stepFound != tt.stepFound || versionFound != tt.versionFound {
+				t.Errorf("StepCollectionModel.GetExistingStepVersion() found = %v, %v, want %v, %v", stepFound, versionFound, tt.stepFound, tt.versionFound)
+			}
+			if tt.versionFound && got.Version != tt.wantVersion {
+				t.Errorf("StepCollectionModel.GetExistingStepVersion() version = %s, want %s", got.Version, tt.wantVersion)
+			}
+		})
+	}
+}
@@ -1,23 +1,58 @@
 package models
 
 import (
+	"cmp"
 	"fmt"
 	"strconv"
 	"strings"
 )
 
-// Semver represents a semantic version
+// Semver represents a semantic version, as defined by SemVer 2.0: an optional
+// pre-release (e.g. beta.1 in 4.0.0-beta.1) and build metadata (e.g. 42 in
+// 4.0.0+42) may follow the version core.
 type Semver struct {
 	Major, Minor, Patch uint64
+	// PreRelease is the dot separated pre-release identifiers, without the
+	// leading hyphen. A pre-release has lower precedence than its version core.
+	PreRelease string
+	// Build is the dot separated build metadata, without the leading plus sign.
+	// It is ignored when determining precedence.
+	Build string
 }
 
 // String converts a Semver to string
 func (v *Semver) String() string {
-	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.PreRelease != "" {
+		s += "-" + v.PreRelease
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// IsPreRelease returns true for pre-release versions, which are only used when
+// pinned exactly, never to satisfy a latest or major/minor locked constraint.
+func (v Semver) IsPreRelease() bool {
+	return v.PreRelease != ""
 }
 
 func ParseSemver(version string) (Semver, error) {
-	versionParts := strings.Split(version, ".")
+	core, build, hasBuild := strings.Cut(version, "+")
+	core, preRelease, hasPreRelease := strings.Cut(core, "-")
+	if hasBuild {
+		if err := validateIdentifiers(build, false); err != nil {
+			return Semver{}, fmt.Errorf("parse %s: invalid build metadata: %s", version, err)
+		}
+	}
+	if hasPreRelease {
+		if err := validateIdentifiers(preRelease, true); err != nil {
+			return Semver{}, fmt.Errorf("parse %s: invalid pre-release: %s", version, err)
+		}
+	}
+
+	versionParts := strings.Split(core, ".")
 	if len(versionParts) != 3 {
 		return Semver{}, fmt.Errorf("parse %s: should consist by 3 components", version)
 	}
@@ -36,12 +71,46 @@ func ParseSemver(version string) (Semver, error) {
 	}
 
 	return Semver{
-		Major: major,
-		Minor: minor,
-		Patch: patch,
+		Major:      major,
+		Minor:      minor,
+		Patch:      patch,
+		PreRelease: preRelease,
+		Build:      build,
 	}, nil
 }
 
+// validateIdentifiers checks dot separated SemVer identifiers: non-empty,
+// made of [0-9A-Za-z-], and for pre-releases, numeric ones without leading
+// zeros.
+func validateIdentifiers(identifiers string, isPreRelease bool) error {
+	for _, identifier := range strings.Split(identifiers, ".") {
+		if identifier == "" {
+			return fmt.Errorf("empty identifier in %q", identifiers)
+		}
+		for _, r := range identifier {
+			if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '-') {
+				return fmt.Errorf("identifier %q contains %q", identifier, r)
+			}
+		}
+		if isPreRelease && isNumeric(identifier) && len(identifier) > 1 && identifier[0] == '0' {
+			return fmt.Errorf("numeric identifier %q has a leading zero", identifier)
+		}
+	}
+	return nil
+}
+
+func isNumeric(identifier string) bool {
+	for _, r := range identifier {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// CmpSemver compares a and b by SemVer 2.0 precedence: the version core
+// first, then a pre-release sorts before the release, then the pre-release
+// identifiers one by one. Build metadata is ignored.
 func CmpSemver(a, b Semver) int {
 	if a.Major < b.Major {
 		return -1
@@ -64,18 +133,57 @@ func CmpSemver(a, b Semver) int {
 		return 1
 	}
 
-	return 0
+	return cmpPreRelease(a.PreRelease, b.PreRelease)
+}
+
+func cmpPreRelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+
+	aIdentifiers, bIdentifiers := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aIdentifiers) && i < len(bIdentifiers); i++ {
+		if c := cmpIdentifier(aIdentifiers[i], bIdentifiers[i]); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(aIdentifiers), len(bIdentifiers))
+}
+
+// cmpIdentifier compares numeric identifiers numerically and others in ASCII
+// order; a numeric identifier sorts before a non-numeric one.
+func cmpIdentifier(a, b string) int {
+	aNumeric, bNumeric := isNumeric(a), isNumeric(b)
+	switch {
+	case aNumeric && bNumeric:
+		if c := cmp.Compare(len(a), len(b)); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	case aNumeric:
+		return -1
+	case bNumeric:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
 }
 
 // HighestForMajorMinor returns the highest-patch version in `versions` whose
-// major and minor match target. ok is false when none match. Callers own the
-// parsing of raw version strings (and thus how malformed entries are handled).
+// major and minor match target, ignoring pre-releases. ok is false when none
+// match. Callers own the parsing of raw version strings (and thus how
+// malformed entries are handled).
 func HighestForMajorMinor(versions []Semver, target Semver) (best Semver, ok bool) {
 	for _, v := range versions {
-		if v.Major != target.Major || v.Minor != target.Minor {
+		if v.Major != target.Major || v.Minor != target.Minor || v.IsPreRelease() {
 			continue
 		}
-		if !ok || v.Patch > best.Patch {
+		if !ok || CmpSemver(v, best) > 0 {
 			best = v
 			ok = true
 		}
@@ -89,7 +197,7 @@ type VersionLockType int
 const (
 	// InvalidVersionConstraint is the value assigned to a VersionLockType if not explicitly initialized
 	InvalidVersionConstraint VersionLockType = iota
-	// Fixed is an exact version, e.g. 1.2.5
+	// Fixed is an exact version, e.g. 1.2.5 or 2.0.0-beta.1
 	Fixed
 	// Latest means the latest available version
 	Latest
@@ -97,12 +205,22 @@ const (
 	MajorLocked
 	// MinorLocked means the latest available version with a given major and minor version, e.g. 1.2.*
 	MinorLocked
+	// Range means the latest available version satisfying all of the comparators, e.g. >=2.3.1 <3 !=2.4.0
+	Range
+	// Caret means the latest available version not changing the left-most non-zero component, e.g. ^2.3.1
+	Caret
+	// Tilde means the latest available version with a given major and minor version, from a given patch, e.g. ~2.3.1
+	Tilde
 )
 
 // VersionConstraint describes a version and a cosntraint (e.g. use latest major version available)
 type VersionConstraint struct {
 	VersionLockType VersionLockType
 	Version         Semver
+	// Comparators are the conditions of a Range, Caret or Tilde constraint,
+	// all of which must hold. Version is the base version of a Caret or Tilde
+	// constraint.
+	Comparators []VersionComparator
 }
 
 // ParseRequiredVersion returns VersionConstraint model from raw version string
@@ -111,6 +229,24 @@ func ParseRequiredVersion(version string) (VersionConstraint, error) {
 		return VersionConstraint{
 			VersionLockType: Latest,
 			Version:         Semver{},
+			Comparators:     nil,
+		}, nil
+	}
+
+	if isRangeConstraint(version) {
+		return parseRangeConstraint(version)
+	}
+
+	// Pre-releases and versions with build metadata can only be pinned.
+	if strings.ContainsAny(version, "-+") {
+		semver, err := ParseSemver(version)
+		if err != nil {
+			return VersionConstraint{}, err
+		}
+		return VersionConstraint{
+			VersionLockType: Fixed,
+			Version:         semver,
+			Comparators:     nil,
 		}, nil
 	}
 
@@ -130,10 +266,13 @@ func ParseRequiredVersion(version string) (VersionConstraint, error) {
 		return VersionConstraint{
 			VersionLockType: MajorLocked,
 			Version: Semver{
-				Major: major,
-				Minor: 0,
-				Patch: 0,
+				Major:      major,
+				Minor:      0,
+				Patch:      0,
+				PreRelease: "",
+				Build:      "",
 			},
+			Comparators: nil,
 		}, nil
 	}
 
@@ -147,10 +286,13 @@ func ParseRequiredVersion(version string) (VersionConstraint, error) {
 		return VersionConstraint{
 			VersionLockType: MinorLocked,
 			Version: Semver{
-				Major: major,
-				Minor: minor,
-				Patch: 0,
+				Major:      major,
+				Minor:      minor,
+				Patch:      0,
+				PreRelease: "",
+				Build:      "",
 			},
+			Comparators: nil,
 		}, nil
 	}
 
@@ -162,13 +304,19 @@ func ParseRequiredVersion(version string) (VersionConstraint, error) {
 	return VersionConstraint{
 		VersionLockType: Fixed,
 		Version: Semver{
-			Major: major,
-			Minor: minor,
-			Patch: patch,
+			Major:      major,
+			Minor:      minor,
+			Patch:      patch,
+			PreRelease: "",
+			Build:      "",
 		},
+		Comparators: nil,
 	}, nil
 }
 
+// latestMatchingStepVersion resolves constraint among the versions of
+// stepVersions. Pre-releases and yanked versions only resolve when pinned
+// exactly, so Latest finds nothing for a step with pre-releases only.
 func latestMatchingStepVersion(constraint VersionConstraint, stepVersions StepGroupModel) (StepVersionModel, bool) {
 	switch constraint.VersionLockType {
 	case Fixed:
@@ -186,69 +334,57 @@ func latestMatchingStepVersion(constraint VersionConstraint, stepVersions StepGr
 				LatestAvailableVersion: stepVersions.LatestVersionNumber,
 			}, true
 		}
+	case Latest:
+		return latestStepVersion(stepVersions, func(version Semver) bool {
+			return !version.IsPreRelease()
+		})
 	case MinorLocked:
-		{
-			latestVersion := Semver{
-				Major: constraint.Version.Major,
-				Minor: constraint.Version.Minor,
-				Patch: 0,
-			}
-			latestStep := StepModel{}
-
-			for fullVersion, step := range stepVersions.Versions {
-				stepVersion, err := ParseSemver(fullVersion)
-				if err != nil {
-					continue
-				}
-				if stepVersion.Major != constraint.Version.Major ||
-					stepVersion.Minor != constraint.Version.Minor {
-					continue
-				}
-
-				if stepVersion.Patch > latestVersion.Patch {
-					latestVersion = stepVersion
-					latestStep = step
-				}
-			}
-
-			return StepVersionModel{
-				Step:                   latestStep,
-				Version:                latestVersion.String(),
-				LatestAvailableVersion: stepVersions.LatestVersionNumber,
-			}, true
-		}
+		return latestStepVersion(stepVersions, func(version Semver) bool {
+			return !version.IsPreRelease() && version.Major == constraint.Version.Major && version.Minor == constraint.Version.Minor
+		})
 	case MajorLocked:
-		{
-			latestStepVersion := Semver{
-				Major: constraint.Version.Major,
-				Minor: 0,
-				Patch: 0,
-			}
-			latestStep := StepModel{}
-
-			for fullVersion, step := range stepVersions.Versions {
-				stepVersion, err := ParseSemver(fullVersion)
-				if err != nil {
-					continue
-				}
-				if stepVersion.Major != constraint.Version.Major {
-					continue
-				}
-
-				if stepVersion.Minor > latestStepVersion.Minor ||
-					(stepVersion.Minor == latestStepVersion.Minor && stepVersion.Patch > latestStepVersion.Patch) {
-					latestStepVersion = stepVersion
-					latestStep = step
-				}
-			}
+		return latestStepVersion(stepVersions, func(version Semver) bool {
+			return !version.IsPreRelease() && version.Major == constraint.Version.Major
+		})
+	}
 
-			return StepVersionModel{
-				Step:                   latestStep,
-				Version:                latestStepVersion.String(),
-				LatestAvailableVersion: stepVersions.LatestVersionNumber,
-			}, true
-		}
+	if constraint.IsRange() {
+		return latestStepVersion(stepVersions, constraint.Matches)
 	}
 
 	return StepVersionModel{}, false
 }
+
+// latestStepVersion returns the latest not yanked version of stepVersions
+// matching matches. Versions equal by precedence (e.g. differing in build
+// metadata only) are ordered by their key, so the result doesn't depend on map
+// iteration order. The returned Version is the key as written in the steplib.
+func latestStepVersion(stepVersions StepGroupModel, matches func(Semver) bool) (StepVersionModel, bool) {
+	var latestVersion Semver
+	latestVersionStr := ""
+	for fullVersion := range stepVersions.Versions {
+		stepVersion, err := ParseSemver(fullVersion)
+		if err != nil || !matches(stepVersion) || isYanked(stepVersions, fullVersion) {
+			continue
+		}
+		c := CmpSemver(stepVersion, latestVersion)
+		if latestVersionStr == "" || c > 0 || c == 0 && fullVersion > latestVersionStr {
+			latestVersion = stepVersion
+			latestVersionStr = fullVersion
+		}
+	}
+	if latestVersionStr == "" {
+		return StepVersionModel{}, false
+	}
+
+	return StepVersionModel{
+		Step:                   stepVersions.Versions[latestVersionStr],
+		Version:                latestVersionStr,
+		LatestAvailableVersion: stepVersions.LatestVersionNumber,
+	}, true
+}
+
+func isYanked(stepVersions StepGroupModel, version string) bool {
+	_, yanked := stepVersions.Info.YankedVersions[version]
+	return yanked
+}
@@ -29,6 +29,35 @@ func Test_parseRequiredVersion(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:            "pinned pre-release",
+			requiredVersion: "2.0.0-beta.1",
+			want: VersionConstraint{
+				VersionLockType: Fixed,
+				Version: Semver{
+					Major:      2,
+					PreRelease: "beta.1",
+				},
+			},
+		},
+		{
+			name:            "pinned version with build metadata",
+			requiredVersion: "2.0.0-rc.1+build.5",
+			want: VersionConstraint{
+				VersionLockType: Fixed,
+				Version: Semver{
+					Major:      2,
+					PreRelease: "rc.1",
+					Build:      "build.5",
+				},
+			},
+		},
+		{
+			name:            "pre-release of a partial version",
+			requiredVersion: "2.0-beta.1",
+			want:            VersionConstraint{},
+			wantErr:         true,
+		},
 		{
 			name:            "locked minor version",
 			requiredVersion: "1.2.x",
@@ -158,6 +187,12 @@ func TestHighestForMajorMinor(t *testing.T) {
 			target:   sv(1, 5, 0),
 			wantOK:   false,
 		},
+		"ignores pre-releases": {
+			versions: []Semver{sv(1, 1, 0), {Major: 1, Minor: 1, Patch: 1, PreRelease: "rc.1"}},
+			target:   sv(1, 1, 0),
+			want:     sv(1, 1, 0),
+			wantOK:   true,
+		},
 		"empty input returns ok=false": {
 			versions: nil,
 			target:   sv(1, 0, 0),
@@ -182,15 +217,33 @@ func Test_latestMatchingStepVersion(t *testing.T) {
 	}
 	stepGroup := StepGroupModel{
 		Versions: map[string]StepModel{
-			"1.0.0": step,
-			"1.1.0": step,
-			"1.1.1": step,
-			"1.2.0": step,
-			"2.0.0": step,
-			"2.1.1": step,
+			"1.0.0":      step,
+			"1.1.0":      step,
+			"1.1.1":      step,
+			"1.2.0":      step,
+			"1.2.1-rc.1": step,
+			"1.3.0-beta": step,
+			"2.0.0":      step,
+			"2.1.1":      step,
 		},
 		LatestVersionNumber: "2.0.0",
 	}
+	withYanked := stepGroup
+	withYanked.Info = StepGroupInfoModel{YankedVersions: map[string]string{"1.1.1": "broken", "1.2.0": "broken", "2.1.1": "broken"}}
+	withBuildMetadata := StepGroupModel{
+		Versions: map[string]StepModel{
+			"1.0.0":         step,
+			"1.1.0+build.2": step,
+			"1.1.0+build.1": step,
+		},
+		LatestVersionNumber: "1.1.0+build.2",
+	}
+	preReleasesOnly := StepGroupModel{
+		Versions: map[string]StepModel{
+			"1.0.0-beta.1": step,
+			"1.0.0-rc.1":   step,
+		},
+	}
 
 	tests := []struct {
 		name            string
@@ -250,6 +303,180 @@ func Test_latestMatchingStepVersion(t *testing.T) {
 			},
 			want1: true,
 		},
+		{
+			name: "Pinned pre-release",
+			requiredVersion: VersionConstraint{
+				VersionLockType: Fixed,
+				Version: Semver{
+					Major:      1,
+					Minor:      3,
+					PreRelease: "beta",
+				},
+			},
+			stepVersions: stepGroup,
+			want: StepVersionModel{
+				Step:                   step,
+				Version:                "1.3.0-beta",
+				LatestAvailableVersion: "2.0.0",
+			},
+			want1: true,
+		},
+		{
+			name: "Range skips pre-releases",
+			requiredVersion: VersionConstraint{
+				VersionLockType: Range,
+				Comparators: []VersionComparator{
+					{Operator: ">=", Version: Semver{Major: 1, Minor: 1}},
+					{Operator: "<", Version: Semver{Major: 2}},
+					{Operator: "!=", Version: Semver{Major: 1, Minor: 2}},
+				},
+			},
+			stepVersions: stepGroup,
+			want: StepVersionModel{
+				Step:                   step,
+				Version:                "1.1.1",
+				LatestAvailableVersion: "2.0.0",
+			},
+			want1: true,
+		},
+		{
+			name: "Pinned yanked version",
+			requiredVersion: VersionConstraint{
+				VersionLockType: Fixed,
+				Version:         Semver{Major: 1, Minor: 2},
+			},
+			stepVersions: withYanked,
+			want: StepVersionModel{
+				Step:                   step,
+				Version:                "1.2.0",
+				LatestAvailableVersion: "2.0.0",
+			},
+			want1: true,
+		},
+		{
+			name: "Lock Minor version skips yanked",
+			requiredVersion: VersionConstraint{
+				VersionLockType: MinorLocked,
+				Version:         Semver{Major: 1, Minor: 1},
+			},
+			stepVersions: withYanked,
+			want: StepVersionModel{
+				Step:                   step,
+				Version:                "1.1.0",
+				LatestAvailableVersion: "2.0.0",
+			},
+			want1: true,
+		},
+		{
+			name: "Lock Minor version with only yanked versions",
+			requiredVersion: VersionConstraint{
+				VersionLockType: MinorLocked,
+				Version:         Semver{Major: 1, Minor: 2},
+			},
+			stepVersions: withYanked,
+			want:         StepVersionModel{},
+			want1:        false,
+		},
+		{
+			name: "Lock Major version skips yanked",
+			requiredVersion: VersionConstraint{
+				VersionLockType: MajorLocked,
+				Version:         Semver{Major: 1},
+			},
+			stepVersions: withYanked,
+			want: StepVersionModel{
+				Step:                   step,
+				Version:                "1.1.0",
+				LatestAvailableVersion: "2.0.0",
+			},
+			want1: true,
+		},
+		{
+			name: "Range skips yanked",
+			requiredVersion: VersionConstraint{
+				VersionLockType: Range,
+				Comparators:     []VersionComparator{{Operator: ">=", Version: Semver{Major: 2}}},
+			},
+			stepVersions: withYanked,
+			want: StepVersionModel{
+				Step:                   step,
+				Version:                "2.0.0",
+				LatestAvailableVersion: "2.0.0",
+			},
+			want1: true,
+		},
+		{
+			name: "Lock Minor version returns the version as written",
+			requiredVersion: VersionConstraint{
+				VersionLockType: MinorLocked,
+				Version:         Semver{Major: 1, Minor: 1},
+			},
+			stepVersions: withBuildMetadata,
+			want: StepVersionModel{
+				Step:                   step,
+				Version:                "1.1.0+build.2",
+				LatestAvailableVersion: "1.1.0+build.2",
+			},
+			want1: true,
+		},
+		{
+			name: "Lock Major version breaks ties by version key",
+			requiredVersion: VersionConstraint{
+				VersionLockType: MajorLocked,
+				Version:         Semver{Major: 1},
+			},
+			stepVersions: withBuildMetadata,
+			want: StepVersionModel{
+				Step:                   step,
+				Version:                "1.1.0+build.2",
+				LatestAvailableVersion: "1.1.0+build.2",
+			},
+			want1: true,
+		},
+		{
+			name:            "Latest skips pre-releases and yanked versions",
+			requiredVersion: VersionConstraint{VersionLockType: Latest},
+			stepVersions:    withYanked,
+			want: StepVersionModel{
+				Step:                   step,
+				Version:                "2.0.0",
+				LatestAvailableVersion: "2.0.0",
+			},
+			want1: true,
+		},
+		{
+			name:            "Latest of a step with pre-releases only",
+			requiredVersion: VersionConstraint{VersionLockType: Latest},
+			stepVersions:    preReleasesOnly,
+			want:            StepVersionModel{},
+			want1:           false,
+		},
+		{
+			name: "Pinned pre-release of a step with pre-releases only",
+			requiredVersion: VersionConstraint{
+				VersionLockType: Fixed,
+				Version:         Semver{Major: 1, PreRelease: "rc.1"},
+			},
+			stepVersions: preReleasesOnly,
+			want: StepVersionModel{
+				Step:                   step,
+				Version:                "1.0.0-rc.1",
+				LatestAvailableVersion: "",
+			},
+			want1: true,
+		},
+		{
+			name: "Range without match",
+			requiredVersion: VersionConstraint{
+				VersionLockType: Range,
+				Comparators: []VersionComparator{
+					{Operator: ">", Version: Semver{Major: 2, Minor: 1, Patch: 1}},
+				},
+			},
+			stepVersions: stepGroup,
+			want:         StepVersionModel{},
+			want1:        false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -263,3 +490,74 @@ func Test_latestMatchingStepVersion(t *testing.T) {
 		})
 	}
 }
+
+func TestParseSemver(t *testing.T) {
+	cases := map[string]struct {
+		version string
+		want    Semver
+		wantErr string
+	}{
+		"release":                      {version: "1.2.3", want: Semver{Major: 1, Minor: 2, Patch: 3}},
+		"pre-release":                  {version: "1.2.3-beta.1", want: Semver{Major: 1, Minor: 2, Patch: 3, PreRelease: "beta.1"}},
+		"pre-release with hyphens":     {version: "1.2.3-x-y.0", want: Semver{Major: 1, Minor: 2, Patch: 3, PreRelease: "x-y.0"}},
+		"build metadata":               {version: "1.2.3+20260501.sha-1f2e", want: Semver{Major: 1, Minor: 2, Patch: 3, Build: "20260501.sha-1f2e"}},
+		"pre-release and build":        {version: "1.2.3-rc.1+001", want: Semver{Major: 1, Minor: 2, Patch: 3, PreRelease: "rc.1", Build: "001"}},
+		"empty pre-release":            {version: "1.2.3-", wantErr: "empty identifier"},
+		"empty pre-release identifier": {version: "1.2.3-rc..1", wantErr: "empty identifier"},
+		"numeric leading zero":         {version: "1.2.3-rc.01", wantErr: "leading zero"},
+		"invalid character":            {version: "1.2.3-rc_1", wantErr: "contains"},
+		"empty build":                  {version: "1.2.3+", wantErr: "invalid build metadata"},
+		"missing patch":                {version: "1.2-rc.1", wantErr: "should consist by 3 components"},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseSemver(tc.version)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, tc.version, got.String(), "round trip")
+		})
+	}
+}
+
+func TestCmpSemver(t *testing.T) {
+	// The precedence example of the SemVer 2.0 spec, lowest first.
+	ordered := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1-rc.1",
+		"1.0.1",
+		"1.10.0",
+	}
+	for i := range ordered {
+		for j := range ordered {
+			a, err := ParseSemver(ordered[i])
+			require.NoError(t, err)
+			b, err := ParseSemver(ordered[j])
+			require.NoError(t, err)
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			assert.Equal(t, want, CmpSemver(a, b), "%s vs %s", ordered[i], ordered[j])
+		}
+	}
+
+	a, err := ParseSemver("1.0.0-rc.1+build.1")
+	require.NoError(t, err)
+	b, err := ParseSemver("1.0.0-rc.1+build.2")
+	require.NoError(t, err)
+	assert.Equal(t, 0, CmpSemver(a, b), "build metadata is ignored")
+}
@@ -0,0 +1,222 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// VersionComparator is one condition of a Range, Caret or Tilde constraint,
+// e.g. >=2.3.1 or !=2.4.0.
+type VersionComparator struct {
+	// Operator is one of >=, >, <=, <, =, !=.
+	Operator string
+	Version  Semver
+}
+
+func (c VersionComparator) matches(v Semver) bool {
+	cmp := CmpSemver(v, c.Version)
+	switch c.Operator {
+	case ">=":
+		return cmp >= 0
+	case ">":
+		return cmp > 0
+	case "<=":
+		return cmp <= 0
+	case "<":
+		return cmp < 0
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	}
+	return false
+}
+
+// String converts a VersionComparator to string
+func (c VersionComparator) String() string {
+	return c.Operator + c.Version.String()
+}
+
+// isRangeConstraint returns true if version uses the range syntax: an
+// operator, a caret, a tilde or several space separated conditions.
+func isRangeConstraint(version string) bool {
+	return strings.ContainsAny(version, "<>=!^~ ")
+}
+
+// parseRangeConstraint parses space separated conditions, all of which must
+// hold:
+//   - comparators: >=2.3.1, >2.3.1, <=2.3.1, <3, =2.3.1, !=2.4.0
+//   - caret ranges, allowing changes that don't modify the left-most non-zero
+//     component: ^2.3.1 is >=2.3.1 <3.0.0, ^0.2.3 is >=0.2.3 <0.3.0
+//   - tilde ranges, allowing patch changes: ~2.3.1 is >=2.3.1 <2.4.0, ~2 is
+//     >=2.0.0 <3.0.0
+//
+// Versions may omit the minor and patch components: <3 is <3.0.0, >2.3 is
+// >=2.4.0 and <=2.3 is <2.4.0. A single caret (tilde) condition is a Caret
+// (Tilde) constraint, anything else is a Range.
+func parseRangeConstraint(version string) (VersionConstraint, error) {
+	tokens := strings.Fields(version)
+	var conditions []string
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		// Allow a space between an operator and its version: >= 2.3.1
+		if strings.Trim(token, "<>=!^~") == "" && i+1 < len(tokens) {
+			token += tokens[i+1]
+			i++
+		}
+		conditions = append(conditions, token)
+	}
+	if len(conditions) == 0 {
+		return VersionConstraint{}, fmt.Errorf("parse %s: empty version range", version)
+	}
+
+	constraint := VersionConstraint{
+		VersionLockType: Range,
+		Version:         Semver{Major: 0, Minor: 0, Patch: 0, PreRelease: "", Build: ""},
+		Comparators:     nil,
+	}
+	for _, condition := range conditions {
+		comparators, err := parseCondition(condition)
+		if err != nil {
+			return VersionConstraint{}, fmt.Errorf("parse %s: %s", version, err)
+		}
+		constraint.Comparators = append(constraint.Comparators, comparators...)
+	}
+
+	if len(conditions) == 1 {
+		switch conditions[0][0] {
+		case '^':
+			constraint.VersionLockType = Caret
+			constraint.Version = constraint.Comparators[0].Version
+		case '~':
+			constraint.VersionLockType = Tilde
+			constraint.Version = constraint.Comparators[0].Version
+		}
+	}
+	return constraint, nil
+}
+
+// parseCondition turns a single condition into the comparators it stands for.
+func parseCondition(condition string) ([]VersionComparator, error) {
+	operator := ""
+	for _, op := range []string{">=", "<=", "!=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(condition, op) {
+			operator = op
+			break
+		}
+	}
+	if operator == "" {
+		return nil, fmt.Errorf("condition %q has no operator", condition)
+	}
+
+	version, components, err := parsePartialSemver(strings.TrimPrefix(condition, operator))
+	if err != nil {
+		return nil, fmt.Errorf("condition %q: %s", condition, err)
+	}
+	full := components == 3
+	next := nextVersion(version, components)
+
+	switch operator {
+	case ">=", "<":
+		return []VersionComparator{{Operator: operator, Version: version}}, nil
+	case ">":
+		if full {
+			return []VersionComparator{{Operator: ">", Version: version}}, nil
+		}
+		return []VersionComparator{{Operator: ">=", Version: next}}, nil
+	case "<=":
+		if full {
+			return []VersionComparator{{Operator: "<=", Version: version}}, nil
+		}
+		return []VersionComparator{{Operator: "<", Version: next}}, nil
+	case "=":
+		if full {
+			return []VersionComparator{{Operator: "=", Version: version}}, nil
+		}
+		return []VersionComparator{{Operator: ">=", Version: version}, {Operator: "<", Version: next}}, nil
+	case "!=":
+		if !full {
+			return nil, fmt.Errorf("condition %q: an exclusion needs a full version", condition)
+		}
+		return []VersionComparator{{Operator: "!=", Version: version}}, nil
+	case "^":
+		upper := Semver{Major: version.Major + 1, Minor: 0, Patch: 0, PreRelease: "", Build: ""}
+		switch {
+		case version.Major > 0 || components == 1:
+		case version.Minor > 0 || components == 2:
+			upper = Semver{Major: 0, Minor: version.Minor + 1, Patch: 0, PreRelease: "", Build: ""}
+		default:
+			upper = Semver{Major: 0, Minor: 0, Patch: version.Patch + 1, PreRelease: "", Build: ""}
+		}
+		return []VersionComparator{{Operator: ">=", Version: version}, {Operator: "<", Version: upper}}, nil
+	default: // "~"
+		upper := Semver{Major: version.Major, Minor: version.Minor + 1, Patch: 0, PreRelease: "", Build: ""}
+		if components == 1 {
+			upper = Semver{Major: version.Major + 1, Minor: 0, Patch: 0, PreRelease: "", Build: ""}
+		}
+		return []VersionComparator{{Operator: ">=", Version: version}, {Operator: "<", Version: upper}}, nil
+	}
+}
+
+// parsePartialSemver parses a version of 1 to 3 components, filling the
+// omitted ones with zeros. Only a full version may have a pre-release.
+func parsePartialSemver(version string) (Semver, int, error) {
+	if version == "" {
+		return Semver{}, 0, fmt.Errorf("missing version")
+	}
+	parts := strings.Split(version, ".")
+	if strings.ContainsAny(version, "-+") || len(parts) == 3 {
+		semver, err := ParseSemver(version)
+		return semver, 3, err
+	}
+	if len(parts) > 3 {
+		return Semver{}, 0, fmt.Errorf("version %q has more than 3 components", version)
+	}
+
+	var components [2]uint64
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 0)
+		if err != nil {
+			return Semver{}, 0, fmt.Errorf("version %q: invalid component %q", version, part)
+		}
+		components[i] = n
+	}
+	return Semver{Major: components[0], Minor: components[1], Patch: 0, PreRelease: "", Build: ""}, len(parts), nil
+}
+
+// nextVersion returns the first version above every version a partial
+// version stands for: 2 -> 3.0.0, 2.3 -> 2.4.0.
+func nextVersion(version Semver, components int) Semver {
+	switch components {
+	case 1:
+		return Semver{Major: version.Major + 1, Minor: 0, Patch: 0, PreRelease: "", Build: ""}
+	case 2:
+		return Semver{Major: version.Major, Minor: version.Minor + 1, Patch: 0, PreRelease: "", Build: ""}
+	}
+	return version
+}
+
+// Matches returns true if v satisfies a Range, Caret or Tilde constraint.
+// Pre-releases never match a range, they have to be pinned.
+func (c VersionConstraint) Matches(v Semver) bool {
+	if v.IsPreRelease() || len(c.Comparators) == 0 {
+		return false
+	}
+	for _, comparator := range c.Comparators {
+		if !comparator.matches(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsRange returns true for constraints resolved by matching their
+// comparators against the available versions: Range, Caret and Tilde.
+func (c VersionConstraint) IsRange() bool {
+	switch c.VersionLockType {
+	case Range, Caret, Tilde:
+		return true
+	}
+	return false
+}
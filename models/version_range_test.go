@@ -0,0 +1,89 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRequiredVersion_ranges(t *testing.T) {
+	v := func(major, minor, patch uint64) Semver {
+		return Semver{Major: major, Minor: minor, Patch: patch}
+	}
+
+	cases := map[string]struct {
+		version      string
+		wantLockType VersionLockType
+		wantVersion  Semver
+		want         string
+		wantErr      string
+	}{
+		"range":                       {version: ">=2.3.1 <3", wantLockType: Range, want: ">=2.3.1 <3.0.0"},
+		"range with exclusion":        {version: ">=2.3.1 <3 !=2.4.0", wantLockType: Range, want: ">=2.3.1 <3.0.0 !=2.4.0"},
+		"operator separated by space": {version: ">= 2.3.1", wantLockType: Range, want: ">=2.3.1"},
+		"exclusion":                   {version: "!=2.4.0", wantLockType: Range, want: "!=2.4.0"},
+		"greater than partial":        {version: ">2.3", wantLockType: Range, want: ">=2.4.0"},
+		"at most partial":             {version: "<=2.3", wantLockType: Range, want: "<2.4.0"},
+		"equal partial":               {version: "=2", wantLockType: Range, want: ">=2.0.0 <3.0.0"},
+		"caret":                       {version: "^2.3.1", wantLockType: Caret, wantVersion: v(2, 3, 1), want: ">=2.3.1 <3.0.0"},
+		"caret below 1.0.0":           {version: "^0.2.3", wantLockType: Caret, wantVersion: v(0, 2, 3), want: ">=0.2.3 <0.3.0"},
+		"caret below 0.1.0":           {version: "^0.0.3", wantLockType: Caret, wantVersion: v(0, 0, 3), want: ">=0.0.3 <0.0.4"},
+		"caret partial":               {version: "^0.2", wantLockType: Caret, wantVersion: v(0, 2, 0), want: ">=0.2.0 <0.3.0"},
+		"tilde":                       {version: "~2.3.1", wantLockType: Tilde, wantVersion: v(2, 3, 1), want: ">=2.3.1 <2.4.0"},
+		"tilde partial":               {version: "~2.3", wantLockType: Tilde, wantVersion: v(2, 3, 0), want: ">=2.3.0 <2.4.0"},
+		"tilde major":                 {version: "~2", wantLockType: Tilde, wantVersion: v(2, 0, 0), want: ">=2.0.0 <3.0.0"},
+		"partial exclusion":           {version: "!=2.4", wantErr: "needs a full version"},
+		"missing version":             {version: ">=", wantErr: "missing version"},
+		"invalid version":             {version: ">=x", wantErr: "invalid component"},
+		"missing operator":            {version: ">=2.3.1 3", wantErr: "has no operator"},
+		"too many components":         {version: "<1.2.3.4", wantErr: "more than 3 components"},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseRequiredVersion(tc.version)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantLockType, got.VersionLockType)
+			assert.Equal(t, tc.wantVersion, got.Version)
+			assert.True(t, got.IsRange())
+
+			var comparators []string
+			for _, comparator := range got.Comparators {
+				comparators = append(comparators, comparator.String())
+			}
+			assert.Equal(t, tc.want, strings.Join(comparators, " "))
+		})
+	}
+}
+
+func TestVersionConstraint_Matches(t *testing.T) {
+	constraint, err := ParseRequiredVersion(">=2.3.1 <3 !=2.4.0")
+	require.NoError(t, err)
+
+	for version, want := range map[string]bool{
+		"2.3.0":       false,
+		"2.3.1":       true,
+		"2.4.0":       false,
+		"2.4.1":       true,
+		"2.99.0":      true,
+		"2.5.0-rc.1":  false,
+		"3.0.0":       false,
+		"3.0.0-rc.1":  false,
+		"2.3.1+build": true,
+	} {
+		semver, err := ParseSemver(version)
+		require.NoError(t, err)
+		assert.Equal(t, want, constraint.Matches(semver), version)
+	}
+
+	fixed, err := ParseRequiredVersion("2.3.1")
+	require.NoError(t, err)
+	assert.False(t, fixed.IsRange())
+	assert.False(t, fixed.Matches(Semver{Major: 2, Minor: 3, Patch: 1}), "only range constraints match")
+}
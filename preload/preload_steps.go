@@ -8,6 +8,7 @@ import (
 	"github.com/bitrise-io/go-utils/colorstring"
 	"github.com/bitrise-io/go-utils/pathutil"
 	"github.com/bitrise-io/stepman/models"
+	"github.com/bitrise-io/stepman/steplibrary"
 	"github.com/bitrise-io/stepman/stepman"
 )
 
@@ -40,7 +41,7 @@ func CacheSteps(log stepman.Logger, steplibURL, maintaner string, opts CacheOpts
 	if exist, err := stepman.RootExistForLibrary(steplibURL); err != nil {
 		return err
 	} else if !exist {
-		if err := stepman.SetupLibrary(steplibURL, log); err != nil {
+		if err := stepman.SetupLibraryWithReader(steplibURL, steplibrary.NewInventoryReader(), log); err != nil {
 			return fmt.Errorf("failed to setup steplib: %w", err)
 		}
 	}
@@ -146,6 +147,11 @@ func preloadStepVersions(log stepman.Logger, steplibURL string, stepLib models.S
 
 	// Preload latest version
 	latestVersionNumber := step.LatestVersionNumber
+	if latestVersionNumber == "" {
+		// Pre-releases only resolve when pinned, there is nothing to preload.
+		log.Debugf("Step %s has no release, skipping it", stepID)
+		return results, nil
+	}
 	latestVersion, found := step.LatestVersion()
 	if !found {
 		return results, fmt.Errorf("failed to find latest version for step %s", stepID)
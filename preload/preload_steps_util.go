@@ -33,6 +33,10 @@ func filterPreloadedStepVersions(stepID string, steps map[string]models.StepMode
 		if err != nil {
 			return filteredSteps, fmt.Errorf("failed to parse version %s: %w", stepVersion, err)
 		}
+		// Pre-releases are never the latest patch of a minor version
+		if version.IsPreRelease() {
+			continue
+		}
 
 		if _, found := allMajorMinor[version.Major]; !found {
 			allMajorMinor[version.Major] = map[uint64]models.Semver{}
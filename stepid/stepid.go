@@ -55,6 +55,12 @@ func CreateCanonicalIDFromString(compositeVersionStr, defaultStepLibSource strin
 	}, nil
 }
 
+// HasSource reports whether compositeVersionStr names its source, i.e. it is
+// not a bare step ID resolving against the default StepLib source.
+func HasSource(compositeVersionStr string) bool {
+	return getStepSource(compositeVersionStr) != ""
+}
+
 func Validate(compositeVersionString string) error {
 	ver := getStepVersion(compositeVersionString)
 	src := getStepSource(compositeVersionString)
@@ -91,6 +97,12 @@ func (sIDData CanonicalID) IsUniqueResourceID() bool {
 	return false
 }
 
+// IsSteplibStep returns true if the step is referenced from a StepLib,
+// not by a local path or a direct git URL.
+func (sIDData CanonicalID) IsSteplibStep() bool {
+	return isStepLibSource(sIDData.SteplibSource)
+}
+
 // returns true if step source is StepLib
 func isStepLibSource(source string) bool {
 	switch source {
@@ -181,3 +181,22 @@ func TestCreateCanonicalIDFromString(t *testing.T) {
 		}
 	}
 }
+
+func TestValidate(t *testing.T) {
+	const steplib = "https://github.com/bitrise-io/bitrise-steplib.git::"
+	for composite, wantErr := range map[string]bool{
+		steplib + "script@2.3.1":      false,
+		steplib + "script@2":          false,
+		steplib + "script@^2.3.1":     false,
+		steplib + "script@~2.3":       false,
+		steplib + "script@>=2.3.1 <3": false,
+		steplib + "script@!=2.4.0":    false,
+		steplib + "script@!=2.4":      true,
+		steplib + "script@>=2.x":      true,
+		"git::url.git@>=2.x":          false,
+		"path::./step@<=invalid":      false,
+	} {
+		err := Validate(composite)
+		require.Equal(t, wantErr, err != nil, "%s: %v", composite, err)
+	}
+}
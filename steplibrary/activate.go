@@ -0,0 +1,122 @@
+package steplibrary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/stepman/internal/httpfetch"
+	"github.com/bitrise-io/stepman/internal/steplock"
+	"github.com/bitrise-io/stepman/internal/stepstorage"
+	"github.com/bitrise-io/stepman/models"
+	"github.com/bitrise-io/stepman/stepid"
+	"github.com/bitrise-io/stepman/stepman"
+)
+
+// ActivateStep does what FetchStepMetadata does and then makes the step
+// runnable from outputPaths.CodePath, using nothing but the inventory: the
+// precompiled executable for the current platform when the step ships one,
+// the step source (from the inventory's download locations) otherwise or when
+// every executable download fails. A step locked in stepman.lock (see
+// steplock) activates its locked version, and fails if the inventory no longer
+// serves the locked commit and executables.
+func (c *Client) ActivateStep(ctx context.Context, stepID, version string, outputPaths ActivateOutputPaths) (ActivateResult, error) {
+	id := stepid.CanonicalID{SteplibSource: c.steplibURI, IDorURI: stepID, Version: version}
+	lockfile, _, err := steplock.Load()
+	if err != nil {
+		return ActivateResult{}, err
+	}
+	lock, isLocked := lockfile.Find(id)
+	if isLocked {
+		c.log.Debugf("Step %s@%s is locked to %s in %s", stepID, version, lock.ResolvedVersion, steplock.Path())
+		version = lock.ResolvedVersion
+	}
+
+	result, stepModel, meta, err := c.fetchStep(ctx, stepID, version, outputPaths)
+	if err != nil {
+		return ActivateResult{}, err
+	}
+	if isLocked {
+		if mismatches := lock.Mismatches(steplock.NewEntry(id, result.StepInfo.Version, stepModel)); len(mismatches) > 0 {
+			return ActivateResult{}, fmt.Errorf("step %s@%s does not match %s: %s", stepID, result.StepInfo.Version, steplock.Path(), strings.Join(mismatches, "; "))
+		}
+	}
+
+	if execPath := c.activateExecutable(ctx, stepID, stepModel, outputPaths.CodePath); execPath != "" {
+		result.ExecutablePath = execPath
+		return result, nil
+	}
+
+	resolvedVersion := result.StepInfo.Version
+	locations, err := models.StepDownloadLocations(meta.DownloadLocations, stepID, resolvedVersion, stepModel)
+	if err != nil {
+		return ActivateResult{}, fmt.Errorf("resolve download locations of %s@%s: %w", stepID, resolvedVersion, err)
+	}
+	if err := stepman.DownloadStepSource(locations, stepID, resolvedVersion, stepModel.Source.Commit, outputPaths.CodePath, c.log); err != nil {
+		return ActivateResult{}, fmt.Errorf("download step source: %w", err)
+	}
+
+	return result, nil
+}
+
+// activateExecutable downloads step's precompiled executable for c.platform
+// into destDir, trying each storage URL in order (or racing them, see
+// Client.hedgeDelay), and returns its path. It
+// returns "" when the step has no usable executable or every download failed;
+// the caller then falls back to source activation.
+func (c *Client) activateExecutable(ctx context.Context, stepID string, step models.StepModel, destDir string) string {
+	if step.Executables == nil {
+		return ""
+	}
+	executable, ok := (*step.Executables)[c.platform]
+	if !ok || executable.Hash == "" || executable.StorageURI == "" {
+		c.log.Infof("No prebuilt executable found for %s, fallback to step source activation", c.platform)
+		return ""
+	}
+
+	urls, err := stepstorage.ExecutableURLs(c.storageURLs, executable)
+	if err != nil {
+		c.log.Warnf("Failed to build executable download URLs, fallback to step source activation: %s", err)
+		return ""
+	}
+
+	if err := os.MkdirAll(destDir, 0o755); err != nil {
+		c.log.Warnf("Failed to create %s, fallback to step source activation: %s", destDir, err)
+		return ""
+	}
+	execPath := filepath.Join(destDir, stepID)
+
+	if c.hedgeDelay > 0 && len(urls) > 1 {
+		c.log.Debugf("Downloading executable for %s from %d storage URLs, hedged after %s", c.platform, len(urls), c.hedgeDelay)
+		hedge := httpfetch.Hedge{Delay: c.hedgeDelay, Latencies: httpfetch.SessionLatencies()}
+		err := c.fetcher.DownloadHedged(ctx, execPath, urls, executable.Hash, hedge)
+		if err == nil {
+			err = os.Chmod(execPath, 0o755)
+		}
+		if err != nil {
+			c.log.Warnf("Failed to download step executable, fallback to step source activation: %s", err)
+			return ""
+		}
+		return execPath
+	}
+
+	var errs []error
+	for _, url := range urls {
+		c.log.Debugf("Downloading executable for %s from %s", c.platform, url)
+		if err := c.fetcher.DownloadWithHash(ctx, execPath, url, executable.Hash); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := os.Chmod(execPath, 0o755); err != nil {
+			errs = append(errs, fmt.Errorf("make %s executable: %w", execPath, err))
+			break
+		}
+		return execPath
+	}
+
+	c.log.Warnf("Failed to download step executable, fallback to step source activation: %s", errors.Join(errs...))
+	return ""
+}
@@ -0,0 +1,210 @@
+package steplibrary
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/go-utils/v2/fileutil"
+	"github.com/bitrise-io/stepman/internal/httpfetch"
+	"github.com/bitrise-io/stepman/internal/steplock"
+	"github.com/bitrise-io/stepman/models"
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testPlatform   = "linux-amd64"
+	testSteplibURI = "https://github.com/bitrise-io/bitrise-steplib.git"
+)
+
+var testExecutable = []byte("#!/bin/sh\necho hello\n")
+
+// newActivateClient returns a Client over newFakeAPI whose "script" step ships
+// testExecutable for testPlatform at storageURLs, and whose inventory serves
+// step sources as zips from zipBaseURL.
+func newActivateClient(t *testing.T, fetcher httpfetch.Client, storageURLs []string, zipBaseURL string) *Client {
+	sum := sha256.Sum256(testExecutable)
+	api := newFakeAPI()
+	meta := api.meta[steplibindex.FormatVersion]
+	meta.DownloadLocations = []models.DownloadLocationModel{{Type: "zip", Src: zipBaseURL + "/"}}
+	api.meta[steplibindex.FormatVersion] = meta
+	step := api.stepModel["script"]
+	step.Source = &models.StepSourceModel{Git: "https://github.com/bitrise-steplib/steps-script.git", Commit: "abc123"}
+	step.Executables = &models.Executables{
+		testPlatform: {StorageURI: "script/2.4.1/" + testPlatform, Hash: "sha256-" + hex.EncodeToString(sum[:])},
+	}
+	api.stepModel["script"] = step
+
+	return &Client{
+		log:          testLogger{t},
+		steplibURI:   testSteplibURI,
+		inventoryURL: "https://steplib.example",
+		api:          api,
+		fileManager:  fileutil.NewFileManager(),
+		fetcher:      fetcher,
+		storageURLs:  storageURLs,
+		platform:     testPlatform,
+	}
+}
+
+func TestClient_ActivateStep_precompiledExecutable(t *testing.T) {
+	var requested []string
+	storage := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		_, _ = w.Write(testExecutable)
+	}))
+	defer storage.Close()
+
+	client := newActivateClient(t, httpfetch.NewWithClient(storage.Client()), []string{storage.URL}, "http://unused.example")
+	dir := t.TempDir()
+	paths := ActivateOutputPaths{YMLPath: filepath.Join(dir, "step.yml"), CodePath: filepath.Join(dir, "src")}
+
+	got, err := client.ActivateStep(t.Context(), "script", "2", paths)
+	require.NoError(t, err)
+
+	assert.Equal(t, "2.4.1", got.StepInfo.Version, "resolved version")
+	assert.Equal(t, []string{"/script/2.4.1/" + testPlatform}, requested, "storage requests")
+	require.Equal(t, filepath.Join(paths.CodePath, "script"), got.ExecutablePath, "ExecutablePath")
+	info, err := os.Stat(got.ExecutablePath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o755), info.Mode().Perm(), "executable mode")
+	assert.FileExists(t, paths.YMLPath, "step.yml written")
+}
+
+func TestClient_ActivateStep_hedgedExecutable(t *testing.T) {
+	slow := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Minute):
+			_, _ = w.Write(testExecutable)
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	fast := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(testExecutable)
+	}))
+	defer fast.Close()
+
+	client := newActivateClient(t, httpfetch.NewWithClient(fast.Client()), []string{slow.URL, fast.URL}, "http://unused.example")
+	client.hedgeDelay = 20 * time.Millisecond
+	dir := t.TempDir()
+	paths := ActivateOutputPaths{YMLPath: filepath.Join(dir, "step.yml"), CodePath: filepath.Join(dir, "src")}
+
+	got, err := client.ActivateStep(t.Context(), "script", "2", paths)
+	require.NoError(t, err)
+
+	require.Equal(t, filepath.Join(paths.CodePath, "script"), got.ExecutablePath, "ExecutablePath")
+	content, err := os.ReadFile(got.ExecutablePath)
+	require.NoError(t, err)
+	assert.Equal(t, testExecutable, content)
+}
+
+func TestClient_ActivateStep_fallsBackToSource(t *testing.T) {
+	storage := httptest.NewTLSServer(http.NotFoundHandler())
+	defer storage.Close()
+
+	var zipRequests []string
+	sources := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zipRequests = append(zipRequests, r.URL.Path)
+		_, _ = w.Write(zipWithFile(t, "step.sh", "echo from source"))
+	}))
+	defer sources.Close()
+
+	client := newActivateClient(t, httpfetch.NewWithClient(storage.Client()), []string{storage.URL}, sources.URL)
+	dir := t.TempDir()
+	paths := ActivateOutputPaths{YMLPath: filepath.Join(dir, "step.yml"), CodePath: filepath.Join(dir, "src")}
+
+	got, err := client.ActivateStep(t.Context(), "script", "2", paths)
+	require.NoError(t, err)
+
+	assert.Empty(t, got.ExecutablePath, "ExecutablePath")
+	assert.Equal(t, []string{"/script/2.4.1/step.zip"}, zipRequests, "source requests")
+	assert.FileExists(t, filepath.Join(paths.CodePath, "step.sh"), "source unzipped")
+}
+
+func TestClient_ActivateStep_noExecutableAndNoSource(t *testing.T) {
+	client := newActivateClient(t, fakeGetFetcher{}, []string{"https://storage.example"}, "http://unused.example")
+	client.platform = "plan9-arm"
+	api := client.api.(fakeAPI)
+	step := api.stepModel["script"]
+	step.Source = nil
+	api.stepModel["script"] = step
+	dir := t.TempDir()
+
+	_, err := client.ActivateStep(t.Context(), "script", "2", ActivateOutputPaths{YMLPath: filepath.Join(dir, "step.yml"), CodePath: dir})
+	require.ErrorContains(t, err, "missing Source property")
+}
+
+func TestClient_ActivateStep_locked(t *testing.T) {
+	storage := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(testExecutable)
+	}))
+	defer storage.Close()
+	sum := sha256.Sum256(testExecutable)
+	hash := "sha256-" + hex.EncodeToString(sum[:])
+
+	cases := map[string]struct {
+		lock        steplock.Entry
+		wantVersion string
+		wantErr     string
+	}{
+		"locked version": {
+			lock:        steplock.Entry{Library: testSteplibURI, StepID: "script", Version: "2", ResolvedVersion: "2.4.0", Commit: "abc123", Executables: map[string]string{testPlatform: hash}},
+			wantVersion: "2.4.0",
+		},
+		"commit mismatch": {
+			lock:    steplock.Entry{Library: testSteplibURI, StepID: "script", Version: "2", ResolvedVersion: "2.4.1", Commit: "def456", Executables: map[string]string{testPlatform: hash}},
+			wantErr: "step script@2.4.1 does not match",
+		},
+		"executable hash mismatch": {
+			lock:    steplock.Entry{Library: testSteplibURI, StepID: "script", Version: "2", ResolvedVersion: "2.4.1", Commit: "abc123", Executables: map[string]string{testPlatform: "sha256-00"}},
+			wantErr: testPlatform + " executable hash is " + hash + ", locked to sha256-00",
+		},
+		"other library": {
+			lock:        steplock.Entry{Library: "https://other.example/steplib.git", StepID: "script", Version: "2", ResolvedVersion: "2.4.0", Commit: "def456"},
+			wantVersion: "2.4.1",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			lockPath := filepath.Join(t.TempDir(), steplock.FileName)
+			require.NoError(t, steplock.Write(lockPath, steplock.Lockfile{Steps: []steplock.Entry{tc.lock}}))
+			t.Setenv(steplock.PathEnv, lockPath)
+
+			client := newActivateClient(t, httpfetch.NewWithClient(storage.Client()), []string{storage.URL}, "http://unused.example")
+			dir := t.TempDir()
+			paths := ActivateOutputPaths{YMLPath: filepath.Join(dir, "step.yml"), CodePath: filepath.Join(dir, "src")}
+
+			got, err := client.ActivateStep(t.Context(), "script", "2", paths)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				assert.NoFileExists(t, filepath.Join(paths.CodePath, "script"), "nothing activated")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantVersion, got.StepInfo.Version, "resolved version")
+		})
+	}
+}
+
+func zipWithFile(t *testing.T, name, content string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create(name)
+	require.NoError(t, err)
+	_, err = w.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
@@ -12,6 +12,10 @@ type ResolvedStepVersion struct {
 }
 
 type API interface {
+	// GetMeta returns the inventory-level metadata of the given format
+	// version's tree. Mirrors `v<N>/meta.json`; a missing tree surfaces as the
+	// implementation's not-found error.
+	GetMeta(ctx context.Context, formatVersion int) (steplibindex.Meta, error)
 	GetAllStepIDs(ctx context.Context) ([]string, error)
 	GetLatestStepVersions(ctx context.Context, id string) (steplibindex.LatestPointer, error)
 	// GetAllStepVersions returns all available versions of a step.
@@ -23,4 +27,10 @@ type API interface {
 	// GetStepModel fetches the V2 per-version step manifest (mirrors
 	// `steps/<id>/<version>/step.json`, which serializes models.StepModel).
 	GetStepModel(ctx context.Context, step ResolvedStepVersion) (models.StepModel, error)
+	// GetSearchIndex returns the latest-version summary of every step.
+	// Mirrors `index/search.json`.
+	GetSearchIndex(ctx context.Context) (steplibindex.SearchIndex, error)
+	// GetStepAsset returns the content of one of a step's assets (file is
+	// its name, e.g. icon.svg). Mirrors `steps/<id>/assets/<file>`.
+	GetStepAsset(ctx context.Context, id, file string) ([]byte, error)
 }
@@ -0,0 +1,197 @@
+package steplibrary
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bitrise-io/stepman/internal/httpfetch"
+	"github.com/bitrise-io/stepman/models"
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+	"github.com/bitrise-io/stepman/stepman"
+)
+
+// CachedAPI wraps HTTPAPI with an on-disk response cache. Immutable per-version
+// files (steps/<id>/<version>/…, see steplibindex.IsImmutableFS) are served
+// from disk once cached. Every other file is served from disk for IndexTTL and
+// then revalidated with a conditional request (If-None-Match /
+// If-Modified-Since), so an unchanged file costs a 304 instead of a download.
+type CachedAPI struct {
+	http     *HTTPAPI
+	cacheDir string
+	indexTTL time.Duration
+	log      stepman.Logger
+	now      func() time.Time
+}
+
+// NewCachedAPI returns a CachedAPI storing its entries under cacheDir. Entries
+// are keyed by the wrapped API's base URL, so several inventories can share
+// one cacheDir, and by its verification key (see HTTPAPI.VerifyWith), so a
+// verifying reader never trusts entries an unverified one stored; call
+// VerifyWith before NewCachedAPI.
+func NewCachedAPI(api *HTTPAPI, cacheDir string, indexTTL time.Duration, log stepman.Logger) *CachedAPI {
+	key := api.BaseURL
+	if api.verifier != nil {
+		key += "\n" + hex.EncodeToString(api.verifier.publicKey)
+	}
+	sum := sha256.Sum256([]byte(key))
+	return &CachedAPI{
+		http:     api,
+		cacheDir: filepath.Join(cacheDir, hex.EncodeToString(sum[:8])),
+		indexTTL: indexTTL,
+		log:      log,
+		now:      time.Now,
+	}
+}
+
+func (c *CachedAPI) GetMeta(ctx context.Context, formatVersion int) (steplibindex.Meta, error) {
+	return readMeta(ctx, c.fetchJSON, formatVersion)
+}
+
+func (c *CachedAPI) GetAllStepIDs(ctx context.Context) ([]string, error) {
+	return readAllStepIDs(ctx, c.fetchJSON)
+}
+
+func (c *CachedAPI) GetSearchIndex(ctx context.Context) (steplibindex.SearchIndex, error) {
+	return readSearchIndex(ctx, c.fetchJSON)
+}
+
+func (c *CachedAPI) GetLatestStepVersions(ctx context.Context, id string) (steplibindex.LatestPointer, error) {
+	return readLatestStepVersions(ctx, c.fetchJSON, id)
+}
+
+func (c *CachedAPI) GetAllStepVersions(ctx context.Context, id string) ([]string, error) {
+	return readAllStepVersions(ctx, c.fetchJSON, id)
+}
+
+func (c *CachedAPI) GetStepGroupInfo(ctx context.Context, id string) (steplibindex.StepInfo, error) {
+	return readStepGroupInfo(ctx, c.fetchJSON, id)
+}
+
+func (c *CachedAPI) GetStepModel(ctx context.Context, step ResolvedStepVersion) (models.StepModel, error) {
+	return readStepModel(ctx, c.fetchJSON, step)
+}
+
+// GetStepAsset fetches the asset uncached: assets are only read by Replicate,
+// once per run.
+func (c *CachedAPI) GetStepAsset(ctx context.Context, id, file string) ([]byte, error) {
+	return c.http.GetStepAsset(ctx, id, file)
+}
+
+// cacheEntry is one cached inventory file: the response body plus the
+// validators needed to revalidate it.
+type cacheEntry struct {
+	ETag         string          `json:"etag,omitempty"`
+	LastModified string          `json:"last_modified,omitempty"`
+	FetchedAt    time.Time       `json:"fetched_at"`
+	Body         json.RawMessage `json:"body"`
+}
+
+func (c *CachedAPI) fetchJSON(ctx context.Context, p steplibindex.Path, dst any) error {
+	url := c.http.BaseURL + p.URL()
+	entryPath := filepath.Join(c.cacheDir, filepath.FromSlash(p.FS()))
+
+	entry, cached := readCacheEntry(entryPath)
+	if cached && (p.Immutable() || c.now().Sub(entry.FetchedAt) < c.indexTTL) {
+		c.http.Fetcher.CacheHit(url)
+		return decodeCacheEntry(url, entry, dst)
+	}
+
+	var validators httpfetch.Validators
+	if cached {
+		validators = httpfetch.Validators{ETag: entry.ETag, LastModified: entry.LastModified}
+	}
+	resp, err := c.http.Fetcher.GetConditional(ctx, url, validators)
+	if err != nil {
+		return err
+	}
+
+	if resp.NotModified {
+		if !cached {
+			return fmt.Errorf("GET %s: server answered 304 Not Modified to an unconditional request", url)
+		}
+	} else {
+		body, readErr := io.ReadAll(resp.Body)
+		if err := errors.Join(readErr, resp.Body.Close()); err != nil {
+			return fmt.Errorf("read response body for %s: %w", url, err)
+		}
+		entry = cacheEntry{Body: body}
+	}
+	entry.ETag = resp.Validators.ETag
+	entry.LastModified = resp.Validators.LastModified
+	entry.FetchedAt = c.now()
+
+	// Verify and decode before storing so a tampered or malformed response is
+	// never cached. Cache hits were verified when they were stored.
+	if c.http.verifier != nil && !resp.NotModified {
+		if err := c.http.verifier.verify(ctx, p, entry.Body); err != nil {
+			return err
+		}
+	}
+	if err := decodeCacheEntry(url, entry, dst); err != nil {
+		return err
+	}
+	if err := writeCacheEntry(entryPath, entry); err != nil {
+		// The response is already decoded; a broken cache only costs the
+		// next run a re-download, so it must not fail this one.
+		c.log.Warnf("Failed to cache %s: %s", url, err)
+	}
+	return nil
+}
+
+func decodeCacheEntry(url string, entry cacheEntry, dst any) error {
+	if err := json.Unmarshal(entry.Body, dst); err != nil {
+		return fmt.Errorf("decode %s: %w", url, err)
+	}
+	return nil
+}
+
+// readCacheEntry loads the entry at pth. A missing, unreadable or corrupt
+// entry is reported as not cached, so it is simply fetched again.
+func readCacheEntry(pth string) (cacheEntry, bool) {
+	bytes, err := os.ReadFile(pth)
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(bytes, &entry); err != nil || len(entry.Body) == 0 {
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+// writeCacheEntry stores entry at pth via a temp file and rename, so
+// concurrent stepman processes never read a half-written entry.
+func writeCacheEntry(pth string, entry cacheEntry) (err error) {
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(pth)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".entry-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	if _, err := tmp.Write(bytes); err != nil {
+		return errors.Join(err, tmp.Close())
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), pth)
+}
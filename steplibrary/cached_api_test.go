@@ -0,0 +1,169 @@
+package steplibrary
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/stepman/internal/httpfetch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingInventory serves a tiny mutable inventory with ETags and counts
+// requests per path and per outcome, so tests can assert what hit the network.
+type countingInventory struct {
+	mu       sync.Mutex
+	files    map[string]string
+	requests map[string]int
+	notMod   map[string]int
+}
+
+func newCountingInventory() *countingInventory {
+	return &countingInventory{
+		files: map[string]string{
+			"/v2/index/step_ids.json":              `{"step_ids":["hello-step"]}`,
+			"/v2/steps/hello-step/2.0.0/step.json": `{"title":"Hello"}`,
+		},
+		requests: map[string]int{},
+		notMod:   map[string]int{},
+	}
+}
+
+func (i *countingInventory) set(path, body string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.files[path] = body
+}
+
+func (i *countingInventory) counts(path string) (requests, notModified int) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.requests[path], i.notMod[path]
+}
+
+func (i *countingInventory) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.requests[r.URL.Path]++
+	body, ok := i.files[r.URL.Path]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	etag := `"` + body + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		i.notMod[r.URL.Path]++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	_, _ = w.Write([]byte(body))
+}
+
+func newTestCachedAPI(t *testing.T, srv *httptest.Server, cacheDir string, now *time.Time) *CachedAPI {
+	t.Helper()
+	api := NewCachedAPI(NewHTTPAPI(srv.URL, httpfetch.NewWithClient(srv.Client())), cacheDir, time.Minute, testLogger{t})
+	api.now = func() time.Time { return *now }
+	return api
+}
+
+func TestCachedAPI_immutableStepJSONIsFetchedOnce(t *testing.T) {
+	inv := newCountingInventory()
+	srv := httptest.NewServer(inv)
+	t.Cleanup(srv.Close)
+	cacheDir := t.TempDir()
+	now := time.Date(2026, 5, 15, 12, 0, 0, 0, time.UTC)
+	step := ResolvedStepVersion{ID: "hello-step", Version: "2.0.0"}
+
+	for range 2 {
+		// A fresh CachedAPI per round: the cache must survive across processes.
+		api := newTestCachedAPI(t, srv, cacheDir, &now)
+		got, err := api.GetStepModel(t.Context(), step)
+		require.NoError(t, err, "GetStepModel")
+		require.NotNil(t, got.Title, "Title")
+		assert.Equal(t, "Hello", *got.Title, "Title")
+		// Far past any TTL: immutable files are never revalidated.
+		now = now.Add(24 * time.Hour)
+	}
+
+	requests, _ := inv.counts("/v2/steps/hello-step/2.0.0/step.json")
+	assert.Equal(t, 1, requests, "step.json requests")
+}
+
+func TestCachedAPI_indexFileIsRevalidatedAfterTTL(t *testing.T) {
+	inv := newCountingInventory()
+	srv := httptest.NewServer(inv)
+	t.Cleanup(srv.Close)
+	now := time.Date(2026, 5, 15, 12, 0, 0, 0, time.UTC)
+	counters := httpfetch.NewCounters()
+	api := NewCachedAPI(NewHTTPAPI(srv.URL, httpfetch.NewWithClient(srv.Client(), counters)), t.TempDir(), time.Minute, testLogger{t})
+	api.now = func() time.Time { return now }
+	const path = "/v2/index/step_ids.json"
+
+	got, err := api.GetAllStepIDs(t.Context())
+	require.NoError(t, err, "first fetch")
+	assert.Equal(t, []string{"hello-step"}, got)
+
+	now = now.Add(30 * time.Second)
+	_, err = api.GetAllStepIDs(t.Context())
+	require.NoError(t, err, "fetch within TTL")
+	requests, _ := inv.counts(path)
+	assert.Equal(t, 1, requests, "within TTL the cached copy is used")
+
+	now = now.Add(time.Minute)
+	got, err = api.GetAllStepIDs(t.Context())
+	require.NoError(t, err, "revalidation")
+	assert.Equal(t, []string{"hello-step"}, got, "304 serves the cached body")
+	requests, notModified := inv.counts(path)
+	assert.Equal(t, 2, requests, "past TTL the file is revalidated")
+	assert.Equal(t, 1, notModified, "unchanged file answers 304")
+	summary := counters.Summary()
+	assert.Equal(t, int64(1), summary.CacheHits, "cache hits observed")
+	assert.Equal(t, int64(1), summary.Ops[httpfetch.OpGetConditional].NotModified, "revalidations observed")
+
+	inv.set(path, `{"step_ids":["git-clone","hello-step"]}`)
+	now = now.Add(2 * time.Minute)
+	got, err = api.GetAllStepIDs(t.Context())
+	require.NoError(t, err, "refetch")
+	assert.Equal(t, []string{"git-clone", "hello-step"}, got, "changed file replaces the cached copy")
+}
+
+func TestCachedAPI_doesNotCacheErrors(t *testing.T) {
+	inv := newCountingInventory()
+	inv.set("/v2/index/step_ids.json", `not json`)
+	srv := httptest.NewServer(inv)
+	t.Cleanup(srv.Close)
+	now := time.Date(2026, 5, 15, 12, 0, 0, 0, time.UTC)
+	api := newTestCachedAPI(t, srv, t.TempDir(), &now)
+
+	_, err := api.GetAllStepIDs(t.Context())
+	require.Error(t, err, "malformed body")
+
+	inv.set("/v2/index/step_ids.json", `{"step_ids":["hello-step"]}`)
+	got, err := api.GetAllStepIDs(t.Context())
+	require.NoError(t, err, "malformed body was not cached")
+	assert.Equal(t, []string{"hello-step"}, got)
+}
+
+func TestCachedAPI_separatesInventoriesByBaseURL(t *testing.T) {
+	first := newCountingInventory()
+	second := newCountingInventory()
+	second.set("/v2/index/step_ids.json", `{"step_ids":["other-step"]}`)
+	srvA := httptest.NewServer(first)
+	t.Cleanup(srvA.Close)
+	srvB := httptest.NewServer(second)
+	t.Cleanup(srvB.Close)
+	cacheDir := t.TempDir()
+	now := time.Date(2026, 5, 15, 12, 0, 0, 0, time.UTC)
+
+	gotA, err := newTestCachedAPI(t, srvA, cacheDir, &now).GetAllStepIDs(t.Context())
+	require.NoError(t, err)
+	gotB, err := newTestCachedAPI(t, srvB, cacheDir, &now).GetAllStepIDs(t.Context())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"hello-step"}, gotA)
+	assert.Equal(t, []string{"other-step"}, gotB)
+}
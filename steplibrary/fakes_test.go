@@ -4,9 +4,13 @@ import (
 	"context"
 	"errors"
 	"io"
+	"io/fs"
 	"strings"
+	"testing"
+	"time"
 
 	"github.com/bitrise-io/go-utils/pointers"
+	"github.com/bitrise-io/stepman/internal/httpfetch"
 	"github.com/bitrise-io/stepman/models"
 	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
 )
@@ -15,6 +19,7 @@ import (
 // fixtures and injectable errors. Construct the standard "script" fixtures with
 // newFakeAPI; override individual fields for table-driven and error cases.
 type fakeAPI struct {
+	meta              map[int]steplibindex.Meta
 	ids               []string
 	listErr           error
 	latestVersions    map[string]steplibindex.LatestPointer
@@ -24,13 +29,23 @@ type fakeAPI struct {
 	groupInfo         map[string]steplibindex.StepInfo
 	groupInfoErr      error
 	stepModel         map[string]models.StepModel
+	searchIndex       steplibindex.SearchIndex
+	assets            map[string][]byte
 }
 
 // newFakeAPI returns a fakeAPI pre-populated with the standard "script" step
-// fixtures (versions 1.0.0–3.0.0, latest 3.0.0, bitrise maintainer, a minimal
-// step model).
+// fixtures (versions 1.0.0–3.0.0 plus the 1.1.6-rc.1 and 4.0.0-beta.1
+// pre-releases, latest 3.0.0, bitrise maintainer, a minimal step model) in a
+// current-format inventory.
 func newFakeAPI() fakeAPI {
 	return fakeAPI{
+		meta: map[int]steplibindex.Meta{
+			steplibindex.FormatVersion: {
+				FormatVersion:    steplibindex.FormatVersion,
+				UpdatedAt:        time.Date(2026, 5, 15, 12, 0, 0, 0, time.UTC),
+				SteplibCommitSHA: "deadbeefcafef00d",
+			},
+		},
 		ids: []string{"xcode-test", "script"},
 		latestVersions: map[string]steplibindex.LatestPointer{
 			"script": {
@@ -40,7 +55,7 @@ func newFakeAPI() fakeAPI {
 			},
 		},
 		allVersions: map[string][]string{
-			"script": {"1.0.0", "1.1.5", "1.2.0", "2.0.0", "2.4.0", "2.4.1", "3.0.0"},
+			"script": {"1.0.0", "1.1.5", "1.1.6-rc.1", "1.2.0", "2.0.0", "2.4.0", "2.4.1", "3.0.0", "4.0.0-beta.1"},
 		},
 		groupInfo: map[string]steplibindex.StepInfo{
 			"script": {Maintainer: "bitrise", Deprecation: nil, AssetURLs: []string{"assets/icon.svg"}},
@@ -51,10 +66,22 @@ func newFakeAPI() fakeAPI {
 	}
 }
 
+func (f fakeAPI) GetMeta(_ context.Context, formatVersion int) (steplibindex.Meta, error) {
+	v, ok := f.meta[formatVersion]
+	if !ok {
+		return steplibindex.Meta{}, fs.ErrNotExist
+	}
+	return v, nil
+}
+
 func (f fakeAPI) GetAllStepIDs(_ context.Context) ([]string, error) {
 	return f.ids, f.listErr
 }
 
+func (f fakeAPI) GetSearchIndex(_ context.Context) (steplibindex.SearchIndex, error) {
+	return f.searchIndex, nil
+}
+
 func (f fakeAPI) GetLatestStepVersions(_ context.Context, id string) (steplibindex.LatestPointer, error) {
 	if f.latestVersionsErr != nil {
 		return steplibindex.LatestPointer{}, f.latestVersionsErr
@@ -96,6 +123,14 @@ func (f fakeAPI) GetStepModel(_ context.Context, step ResolvedStepVersion) (mode
 	return v, nil
 }
 
+func (f fakeAPI) GetStepAsset(_ context.Context, id, file string) ([]byte, error) {
+	v, ok := f.assets[id+"/"+file]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return v, nil
+}
+
 // fakeGetFetcher implements httpfetch.Client.Get, returning a fixed body whose
 // Close returns closeErr. Used to exercise fetchJSON's close-error path.
 type fakeGetFetcher struct {
@@ -107,6 +142,10 @@ func (f fakeGetFetcher) Get(_ context.Context, _ string) (io.ReadCloser, error)
 	return errReadCloser{Reader: strings.NewReader(f.body), closeErr: f.closeErr}, nil
 }
 
+func (f fakeGetFetcher) GetConditional(_ context.Context, _ string, _ httpfetch.Validators) (httpfetch.ConditionalResponse, error) {
+	return httpfetch.ConditionalResponse{}, errors.New("GetConditional not used")
+}
+
 func (f fakeGetFetcher) Download(_ context.Context, _, _ string) error {
 	return errors.New("Download not used")
 }
@@ -115,6 +154,12 @@ func (f fakeGetFetcher) DownloadWithHash(_ context.Context, _, _, _ string) erro
 	return errors.New("DownloadWithHash not used")
 }
 
+func (f fakeGetFetcher) DownloadHedged(_ context.Context, _ string, _ []string, _ string, _ httpfetch.Hedge) error {
+	return errors.New("DownloadHedged not used")
+}
+
+func (f fakeGetFetcher) CacheHit(string) {}
+
 // errReadCloser wraps a reader and returns closeErr from Close.
 type errReadCloser struct {
 	io.Reader
@@ -122,3 +167,11 @@ type errReadCloser struct {
 }
 
 func (e errReadCloser) Close() error { return e.closeErr }
+
+// testLogger routes stepman log output to t.Log.
+type testLogger struct{ t *testing.T }
+
+func (l testLogger) Debugf(f string, a ...any) { l.t.Logf("DEBUG "+f, a...) }
+func (l testLogger) Errorf(f string, a ...any) { l.t.Logf("ERROR "+f, a...) }
+func (l testLogger) Warnf(f string, a ...any)  { l.t.Logf("WARN "+f, a...) }
+func (l testLogger) Infof(f string, a ...any)  { l.t.Logf("INFO "+f, a...) }
@@ -0,0 +1,107 @@
+package steplibrary
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+
+	"github.com/bitrise-io/stepman/models"
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+)
+
+// FSAPI reads the V2 inventory from an fs.FS rooted at the inventory root (the
+// dir containing v2/, i.e. an indexgen output dir), at each file's
+// steplibindex Path.FS() location. It serves file:// inventories and
+// inventory trees copied onto air-gapped machines, with no HTTP server.
+type FSAPI struct {
+	FS fs.FS
+
+	verifier *verifier
+}
+
+func NewFSAPI(inventoryFS fs.FS) *FSAPI {
+	return &FSAPI{FS: inventoryFS, verifier: nil}
+}
+
+// VerifyWith makes f refuse any file that doesn't match the inventory's
+// signed manifest.json; see HTTPAPI.VerifyWith.
+func (f *FSAPI) VerifyWith(publicKey ed25519.PublicKey) {
+	f.verifier = newVerifier(publicKey, f.readRaw)
+}
+
+func (f *FSAPI) GetMeta(ctx context.Context, formatVersion int) (steplibindex.Meta, error) {
+	return readMeta(ctx, f.readJSON, formatVersion)
+}
+
+func (f *FSAPI) GetAllStepIDs(ctx context.Context) ([]string, error) {
+	return readAllStepIDs(ctx, f.readJSON)
+}
+
+func (f *FSAPI) GetSearchIndex(ctx context.Context) (steplibindex.SearchIndex, error) {
+	return readSearchIndex(ctx, f.readJSON)
+}
+
+func (f *FSAPI) GetLatestStepVersions(ctx context.Context, id string) (steplibindex.LatestPointer, error) {
+	return readLatestStepVersions(ctx, f.readJSON, id)
+}
+
+func (f *FSAPI) GetAllStepVersions(ctx context.Context, id string) ([]string, error) {
+	return readAllStepVersions(ctx, f.readJSON, id)
+}
+
+func (f *FSAPI) GetStepGroupInfo(ctx context.Context, id string) (steplibindex.StepInfo, error) {
+	return readStepGroupInfo(ctx, f.readJSON, id)
+}
+
+func (f *FSAPI) GetStepModel(ctx context.Context, step ResolvedStepVersion) (models.StepModel, error) {
+	return readStepModel(ctx, f.readJSON, step)
+}
+
+func (f *FSAPI) GetStepAsset(ctx context.Context, id, file string) ([]byte, error) {
+	p, err := steplibindex.StepAssetPath(id, file)
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := f.readRaw(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if f.verifier != nil {
+		if err := f.verifier.verify(ctx, p, bytes); err != nil {
+			return nil, err
+		}
+	}
+	return bytes, nil
+}
+
+// readJSON reads and decodes the file at p. A missing file surfaces as an
+// error wrapping fs.ErrNotExist, the FS counterpart of HTTPAPI's 404
+// StatusError.
+func (f *FSAPI) readJSON(ctx context.Context, p steplibindex.Path, dst any) error {
+	bytes, err := f.readRaw(ctx, p)
+	if err != nil {
+		return err
+	}
+	if f.verifier != nil {
+		if err := f.verifier.verify(ctx, p, bytes); err != nil {
+			return err
+		}
+	}
+	if err := json.Unmarshal(bytes, dst); err != nil {
+		return fmt.Errorf("decode %s: %w", p.FS(), err)
+	}
+	return nil
+}
+
+func (f *FSAPI) readRaw(ctx context.Context, p steplibindex.Path) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	bytes, err := fs.ReadFile(f.FS, p.FS())
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", p.FS(), err)
+	}
+	return bytes, nil
+}
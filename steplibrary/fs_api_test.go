@@ -0,0 +1,75 @@
+package steplibrary
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/bitrise-io/stepman/internal/httpfetch"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFSAPI(t *testing.T) {
+	inventory := fstest.MapFS{
+		"v2/index/step_ids.json":                   {Data: []byte(`{"step_ids":["hello-step","git-clone"]}`)},
+		"v2/index/steps/hello-step/latest.json":    {Data: []byte(`{"step_id":"hello-step","latest":"2.0.0","latest_by_major":{"1":"1.1.0","2":"2.0.0"}}`)},
+		"v2/index/steps/hello-step/versions.json":  {Data: []byte(`{"step_id":"hello-step","versions":["2.0.0","1.1.0"]}`)},
+		"v2/steps/hello-step/step-info.json":       {Data: []byte(`{"maintainer":"bitrise","deprecation":null,"asset_urls":[]}`)},
+		"v2/steps/hello-step/2.0.0/step.json":      {Data: []byte(`{"title":"Hello"}`)},
+		"v2/index/steps/broken-step/versions.json": {Data: []byte(`{`)},
+	}
+	api := NewFSAPI(inventory)
+	ctx := t.Context()
+
+	t.Run("GetAllStepIDs", func(t *testing.T) {
+		got, err := api.GetAllStepIDs(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"hello-step", "git-clone"}, got)
+	})
+
+	t.Run("GetLatestStepVersions", func(t *testing.T) {
+		got, err := api.GetLatestStepVersions(ctx, "hello-step")
+		require.NoError(t, err)
+		assert.Equal(t, "2.0.0", got.Latest, "Latest")
+		assert.Equal(t, "1.1.0", got.LatestByMajor["1"], "LatestByMajor[1]")
+	})
+
+	t.Run("GetAllStepVersions", func(t *testing.T) {
+		got, err := api.GetAllStepVersions(ctx, "hello-step")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"2.0.0", "1.1.0"}, got)
+	})
+
+	t.Run("GetStepGroupInfo", func(t *testing.T) {
+		got, err := api.GetStepGroupInfo(ctx, "hello-step")
+		require.NoError(t, err)
+		assert.Equal(t, "bitrise", got.Maintainer)
+	})
+
+	t.Run("GetStepModel", func(t *testing.T) {
+		got, err := api.GetStepModel(ctx, ResolvedStepVersion{ID: "hello-step", Version: "2.0.0"})
+		require.NoError(t, err)
+		require.NotNil(t, got.Title)
+		assert.Equal(t, "Hello", *got.Title)
+	})
+
+	t.Run("missing file wraps fs.ErrNotExist", func(t *testing.T) {
+		_, err := api.GetLatestStepVersions(ctx, "missing-step")
+		require.ErrorIs(t, err, fs.ErrNotExist)
+	})
+
+	t.Run("malformed file is a decode error", func(t *testing.T) {
+		_, err := api.GetAllStepVersions(ctx, "broken-step")
+		require.ErrorContains(t, err, "decode v2/index/steps/broken-step/versions.json")
+	})
+}
+
+func TestNewAPI_selectsImplementationByScheme(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	fetcher := httpfetch.NewClient(testLogger{t})
+
+	assert.IsType(t, &FSAPI{}, newAPI(testLogger{t}, "file://"+t.TempDir(), nil, fetcher), "file:// inventory")
+	assert.IsType(t, &CachedAPI{}, newAPI(testLogger{t}, "https://steplib.example", nil, fetcher), "https inventory")
+}
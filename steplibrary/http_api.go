@@ -2,8 +2,11 @@ package steplibrary
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/bitrise-io/stepman/internal/httpfetch"
@@ -16,72 +19,75 @@ import (
 type HTTPAPI struct {
 	BaseURL string
 	Fetcher httpfetch.Client
+
+	verifier *verifier
 }
 
 func NewHTTPAPI(baseURL string, fetcher httpfetch.Client) *HTTPAPI {
 	return &HTTPAPI{
-		BaseURL: strings.TrimRight(baseURL, "/"),
-		Fetcher: fetcher,
+		BaseURL:  strings.TrimRight(baseURL, "/"),
+		Fetcher:  fetcher,
+		verifier: nil,
 	}
 }
 
+// VerifyWith makes h refuse any file that doesn't match the inventory's
+// manifest.json signed by publicKey's private key (see indexgen
+// Options.SigningKey). Failures wrap ErrVerification.
+func (h *HTTPAPI) VerifyWith(publicKey ed25519.PublicKey) {
+	h.verifier = newVerifier(publicKey, h.fetchRaw)
+}
+
+func (h *HTTPAPI) GetMeta(ctx context.Context, formatVersion int) (steplibindex.Meta, error) {
+	return readMeta(ctx, h.fetchJSON, formatVersion)
+}
+
 func (h *HTTPAPI) GetAllStepIDs(ctx context.Context) ([]string, error) {
-	var out steplibindex.StepIDs
-	if err := h.fetchJSON(ctx, steplibindex.StepIDsPath().URL(), &out); err != nil {
-		return nil, err
-	}
-	return out.StepIDs, nil
+	return readAllStepIDs(ctx, h.fetchJSON)
+}
+
+func (h *HTTPAPI) GetSearchIndex(ctx context.Context) (steplibindex.SearchIndex, error) {
+	return readSearchIndex(ctx, h.fetchJSON)
 }
 
 func (h *HTTPAPI) GetLatestStepVersions(ctx context.Context, id string) (steplibindex.LatestPointer, error) {
-	p, err := steplibindex.LatestPointerPath(id)
-	if err != nil {
-		return steplibindex.LatestPointer{}, err
-	}
-	var out steplibindex.LatestPointer
-	if err := h.fetchJSON(ctx, p.URL(), &out); err != nil {
-		return steplibindex.LatestPointer{}, err
-	}
-	return out, nil
+	return readLatestStepVersions(ctx, h.fetchJSON, id)
 }
 
 func (h *HTTPAPI) GetAllStepVersions(ctx context.Context, id string) ([]string, error) {
-	p, err := steplibindex.VersionsPath(id)
-	if err != nil {
-		return nil, err
-	}
-	var out steplibindex.Versions
-	if err := h.fetchJSON(ctx, p.URL(), &out); err != nil {
-		return nil, err
-	}
-	return out.Versions, nil
+	return readAllStepVersions(ctx, h.fetchJSON, id)
 }
 
 func (h *HTTPAPI) GetStepGroupInfo(ctx context.Context, id string) (steplibindex.StepInfo, error) {
-	p, err := steplibindex.StepInfoPath(id)
-	if err != nil {
-		return steplibindex.StepInfo{}, err
-	}
-	var out steplibindex.StepInfo
-	if err := h.fetchJSON(ctx, p.URL(), &out); err != nil {
-		return steplibindex.StepInfo{}, err
-	}
-	return out, nil
+	return readStepGroupInfo(ctx, h.fetchJSON, id)
 }
 
 func (h *HTTPAPI) GetStepModel(ctx context.Context, step ResolvedStepVersion) (models.StepModel, error) {
-	p, err := steplibindex.StepJSONPath(step.ID, step.Version)
+	return readStepModel(ctx, h.fetchJSON, step)
+}
+
+func (h *HTTPAPI) GetStepAsset(ctx context.Context, id, file string) ([]byte, error) {
+	p, err := steplibindex.StepAssetPath(id, file)
 	if err != nil {
-		return models.StepModel{}, err
+		return nil, err
+	}
+	body, err := h.fetchRaw(ctx, p)
+	if err != nil {
+		return nil, err
 	}
-	var out models.StepModel
-	if err := h.fetchJSON(ctx, p.URL(), &out); err != nil {
-		return models.StepModel{}, err
+	if h.verifier != nil {
+		if err := h.verifier.verify(ctx, p, body); err != nil {
+			return nil, err
+		}
 	}
-	return out, nil
+	return body, nil
 }
 
-func (h *HTTPAPI) fetchJSON(ctx context.Context, path string, dst any) (err error) {
+func (h *HTTPAPI) fetchJSON(ctx context.Context, p steplibindex.Path, dst any) (err error) {
+	if h.verifier != nil {
+		return h.fetchVerifiedJSON(ctx, p, dst)
+	}
+	path := p.URL()
 	body, err := h.Fetcher.Get(ctx, h.BaseURL+path)
 	if err != nil {
 		return err
@@ -96,3 +102,32 @@ func (h *HTTPAPI) fetchJSON(ctx context.Context, path string, dst any) (err erro
 	}
 	return nil
 }
+
+// fetchVerifiedJSON buffers the file so its exact bytes can be verified before
+// they are decoded.
+func (h *HTTPAPI) fetchVerifiedJSON(ctx context.Context, p steplibindex.Path, dst any) error {
+	body, err := h.fetchRaw(ctx, p)
+	if err != nil {
+		return err
+	}
+	if err := h.verifier.verify(ctx, p, body); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, dst); err != nil {
+		return fmt.Errorf("decode %s%s: %w", h.BaseURL, p.URL(), err)
+	}
+	return nil
+}
+
+func (h *HTTPAPI) fetchRaw(ctx context.Context, p steplibindex.Path) ([]byte, error) {
+	url := h.BaseURL + p.URL()
+	body, err := h.Fetcher.Get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	bytes, readErr := io.ReadAll(body)
+	if err := errors.Join(readErr, body.Close()); err != nil {
+		return nil, fmt.Errorf("read response body for %s: %w", url, err)
+	}
+	return bytes, nil
+}
@@ -18,7 +18,7 @@ type parsedStep struct {
 	id         string
 	info       steplibindex.StepInfo // step-info.yml + assets/ listing
 	assetFiles []string              // relative paths under assets/, sorted
-	versions   []parsedVersion       // sorted ascending by semver; last is latest
+	versions   []parsedVersion       // sorted ascending by semver
 }
 
 // parsedVersion is a single step version with its semver parsed once at collect
@@ -29,9 +29,27 @@ type parsedVersion struct {
 	model   models.StepModel
 }
 
-// latest returns the highest-semver version. Only valid for steps with at least
-// one version.
-func (s parsedStep) latest() parsedVersion { return s.versions[len(s.versions)-1] }
+// latest returns the highest-semver release. Yanked releases are skipped
+// unless every release is yanked. Pre-releases only resolve when pinned, so ok
+// is false for a step with pre-releases only.
+func (s parsedStep) latest() (latest parsedVersion, ok bool) {
+	for i := len(s.versions) - 1; i >= 0; i-- {
+		if !s.versions[i].semver.IsPreRelease() && !s.isYanked(s.versions[i].version) {
+			return s.versions[i], true
+		}
+	}
+	for i := len(s.versions) - 1; i >= 0; i-- {
+		if !s.versions[i].semver.IsPreRelease() {
+			return s.versions[i], true
+		}
+	}
+	return parsedVersion{}, false
+}
+
+func (s parsedStep) isYanked(version string) bool {
+	_, yanked := s.info.YankedVersions[version]
+	return yanked
+}
 
 func collectSteps(inputFS fs.FS, log stepman.Logger) ([]parsedStep, error) {
 	entries, err := fs.ReadDir(inputFS, "steps")
@@ -82,9 +100,10 @@ func readStepGroupInfo(inputFS fs.FS, path string) (steplibindex.StepInfo, error
 		return steplibindex.StepInfo{}, err
 	}
 	out := steplibindex.StepInfo{
-		Maintainer:  sgi.Maintainer,
-		Deprecation: nil,
-		AssetURLs:   nil,
+		Maintainer:     sgi.Maintainer,
+		Deprecation:    nil,
+		AssetURLs:      nil,
+		YankedVersions: sgi.YankedVersions,
 	}
 	if sgi.RemovalDate != "" || sgi.DeprecateNotes != "" {
 		out.Deprecation = &steplibindex.Deprecation{
@@ -150,7 +169,7 @@ func assetURLsForFiles(assetFiles []string) []string {
 func collectStep(inputFS fs.FS, id string, log stepman.Logger) (parsedStep, error) {
 	s := parsedStep{
 		id:         id,
-		info:       steplibindex.StepInfo{Maintainer: "", Deprecation: nil, AssetURLs: nil},
+		info:       steplibindex.StepInfo{Maintainer: "", Deprecation: nil, AssetURLs: nil, YankedVersions: nil},
 		assetFiles: nil,
 		versions:   nil,
 	}
@@ -190,7 +209,11 @@ func collectStep(inputFS fs.FS, id string, log stepman.Logger) (parsedStep, erro
 	}
 
 	sort.Slice(s.versions, func(i, j int) bool {
-		return models.CmpSemver(s.versions[i].semver, s.versions[j].semver) < 0
+		if c := models.CmpSemver(s.versions[i].semver, s.versions[j].semver); c != 0 {
+			return c < 0
+		}
+		// Same precedence, differing in build metadata only.
+		return s.versions[i].version < s.versions[j].version
 	})
 	return s, nil
 }
@@ -0,0 +1,152 @@
+package indexgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"slices"
+
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+)
+
+// InventoryDiff lists what changed between two inventories, for reviewing a
+// regenerated inventory before publishing it. Every list is sorted.
+type InventoryDiff struct {
+	AddedSteps   []string `json:"added_steps"`
+	RemovedSteps []string `json:"removed_steps"`
+	// AddedVersions and RemovedVersions only cover steps present in both
+	// inventories: every version of an added or removed step is implied.
+	AddedVersions      []StepVersion       `json:"added_versions"`
+	RemovedVersions    []StepVersion       `json:"removed_versions"`
+	DeprecationChanges []DeprecationChange `json:"deprecation_changes"`
+}
+
+// StepVersion is a version of a step.
+type StepVersion struct {
+	StepID  string `json:"step_id"`
+	Version string `json:"version"`
+}
+
+// DeprecationChange is a step of both inventories whose deprecation changed. A
+// nil Old means the step got deprecated, a nil New means it got undeprecated.
+type DeprecationChange struct {
+	StepID string                    `json:"step_id"`
+	Old    *steplibindex.Deprecation `json:"old"`
+	New    *steplibindex.Deprecation `json:"new"`
+}
+
+// IsEmpty reports whether the inventories have the same steps, versions and
+// deprecations.
+func (d InventoryDiff) IsEmpty() bool {
+	return len(d.AddedSteps) == 0 && len(d.RemovedSteps) == 0 &&
+		len(d.AddedVersions) == 0 && len(d.RemovedVersions) == 0 &&
+		len(d.DeprecationChanges) == 0
+}
+
+// Diff compares the inventory trees rooted at oldFS and newFS (each the dir
+// containing v2/, as for Validate). It reads the index files and step-info.json
+// only, so step definition changes within a version are not reported.
+func Diff(oldFS, newFS fs.FS) (InventoryDiff, error) {
+	var oldIDs, newIDs steplibindex.StepIDs
+	if err := readFSJSON(oldFS, steplibindex.StepIDsPath().FS(), &oldIDs); err != nil {
+		return InventoryDiff{}, fmt.Errorf("old inventory: %w", err)
+	}
+	if err := readFSJSON(newFS, steplibindex.StepIDsPath().FS(), &newIDs); err != nil {
+		return InventoryDiff{}, fmt.Errorf("new inventory: %w", err)
+	}
+
+	diff := InventoryDiff{
+		AddedSteps:         missingFrom(oldIDs.StepIDs, newIDs.StepIDs),
+		RemovedSteps:       missingFrom(newIDs.StepIDs, oldIDs.StepIDs),
+		AddedVersions:      []StepVersion{},
+		RemovedVersions:    []StepVersion{},
+		DeprecationChanges: []DeprecationChange{},
+	}
+	for _, id := range newIDs.StepIDs {
+		if !slices.Contains(oldIDs.StepIDs, id) {
+			continue
+		}
+
+		oldVersions, err := readVersions(oldFS, id)
+		if err != nil {
+			return InventoryDiff{}, fmt.Errorf("old inventory: %w", err)
+		}
+		newVersions, err := readVersions(newFS, id)
+		if err != nil {
+			return InventoryDiff{}, fmt.Errorf("new inventory: %w", err)
+		}
+		for _, version := range missingFrom(oldVersions, newVersions) {
+			diff.AddedVersions = append(diff.AddedVersions, StepVersion{StepID: id, Version: version})
+		}
+		for _, version := range missingFrom(newVersions, oldVersions) {
+			diff.RemovedVersions = append(diff.RemovedVersions, StepVersion{StepID: id, Version: version})
+		}
+
+		oldInfo, err := readStepInfo(oldFS, id)
+		if err != nil {
+			return InventoryDiff{}, fmt.Errorf("old inventory: %w", err)
+		}
+		newInfo, err := readStepInfo(newFS, id)
+		if err != nil {
+			return InventoryDiff{}, fmt.Errorf("new inventory: %w", err)
+		}
+		if !equalDeprecations(oldInfo.Deprecation, newInfo.Deprecation) {
+			diff.DeprecationChanges = append(diff.DeprecationChanges, DeprecationChange{StepID: id, Old: oldInfo.Deprecation, New: newInfo.Deprecation})
+		}
+	}
+	return diff, nil
+}
+
+// missingFrom returns the sorted elements of values that are not in base.
+func missingFrom(base, values []string) []string {
+	missing := []string{}
+	for _, value := range values {
+		if !slices.Contains(base, value) {
+			missing = append(missing, value)
+		}
+	}
+	slices.Sort(missing)
+	return missing
+}
+
+func equalDeprecations(a, b *steplibindex.Deprecation) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func readVersions(inventoryFS fs.FS, id string) ([]string, error) {
+	p, err := steplibindex.VersionsPath(id)
+	if err != nil {
+		return nil, err
+	}
+	var versions steplibindex.Versions
+	if err := readFSJSON(inventoryFS, p.FS(), &versions); err != nil {
+		return nil, err
+	}
+	return versions.Versions, nil
+}
+
+func readStepInfo(inventoryFS fs.FS, id string) (steplibindex.StepInfo, error) {
+	p, err := steplibindex.StepInfoPath(id)
+	if err != nil {
+		return steplibindex.StepInfo{}, err
+	}
+	var info steplibindex.StepInfo
+	if err := readFSJSON(inventoryFS, p.FS(), &info); err != nil {
+		return steplibindex.StepInfo{}, err
+	}
+	return info, nil
+}
+
+func readFSJSON(inventoryFS fs.FS, p string, v any) error {
+	bytes, err := fs.ReadFile(inventoryFS, p)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(bytes, v); err != nil {
+		return fmt.Errorf("decode %s: %w", p, err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package indexgen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	clone := steplibCloneDir(t)
+	oldDir := t.TempDir()
+	_, err := generateFromSteplibClone(os.DirFS(clone), oldDir, Options{GeneratedAt: fixedTime}, testLogger{t})
+	require.NoError(t, err)
+
+	changeSteplib(t, clone)
+	require.NoError(t, os.RemoveAll(filepath.Join(clone, "steps/hello-step/1.1.0")))
+	require.NoError(t, os.MkdirAll(filepath.Join(clone, "steps/hello-step/3.0.0"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(clone, "steps/hello-step/3.0.0/step.yml"), minimalStepYAML("Hello v3"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(clone, "steps/deprecated-step/step-info.yml"), []byte("maintainer: bitrise\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(clone, "steps/hello-step/step-info.yml"), []byte("maintainer: bitrise\nremoval_date: \"2027-01-01\"\ndeprecate_notes: Use hello-step-v2\n"), 0o600))
+	newDir := t.TempDir()
+	_, err = generateFromSteplibClone(os.DirFS(clone), newDir, Options{GeneratedAt: fixedTime}, testLogger{t})
+	require.NoError(t, err)
+
+	diff, err := Diff(os.DirFS(oldDir), os.DirFS(newDir))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new-step"}, diff.AddedSteps)
+	assert.Equal(t, []string{"bash-step"}, diff.RemovedSteps)
+	assert.Equal(t, []StepVersion{{StepID: "hello-step", Version: "3.0.0"}}, diff.AddedVersions)
+	assert.Equal(t, []StepVersion{{StepID: "hello-step", Version: "1.1.0"}}, diff.RemovedVersions)
+	require.Len(t, diff.DeprecationChanges, 2)
+	assert.Equal(t, "deprecated-step", diff.DeprecationChanges[0].StepID)
+	assert.NotNil(t, diff.DeprecationChanges[0].Old)
+	assert.Nil(t, diff.DeprecationChanges[0].New, "undeprecated")
+	assert.Equal(t, DeprecationChange{StepID: "hello-step", Old: nil, New: &steplibindex.Deprecation{RemovalDate: "2027-01-01", Notes: "Use hello-step-v2"}}, diff.DeprecationChanges[1])
+
+	same, err := Diff(os.DirFS(newDir), os.DirFS(newDir))
+	require.NoError(t, err)
+	assert.True(t, same.IsEmpty())
+
+	_, err = Diff(os.DirFS(t.TempDir()), os.DirFS(newDir))
+	require.ErrorContains(t, err, "old inventory")
+}
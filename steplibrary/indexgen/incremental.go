@@ -0,0 +1,383 @@
+package indexgen
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/v2/fileutil"
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+	"github.com/bitrise-io/stepman/stepman"
+)
+
+// Changes lists the files an incremental generation added or modified
+// (Written) and deleted (Removed) compared to the previously published tree.
+// Paths are relative to the output dir and sorted, e.g.
+// v2/steps/script/1.0.0/step.json, so a publisher mirroring the inventory to
+// remote storage only uploads Written and deletes Removed.
+type Changes struct {
+	Written []string
+	Removed []string
+}
+
+// GenerateIncremental is Generate for an outputDir that already holds an
+// inventory generated from an earlier commit of the same steplib. Instead of
+// re-reading every step, it git-diffs the steplib clone against the commit
+// recorded in the published meta.json and regenerates only the changed steps'
+// steps/<id> and index/steps/<id> subtrees, plus the steplib-wide index files
+// and meta.json. The staged tree is validated and published just like
+// Generate's.
+//
+// With no previous inventory, or one whose commit the clone can't diff
+// against (e.g. after a force push), every step is regenerated.
+func GenerateIncremental(steplibURI, outputDir string, opts Options, log stepman.Logger) (Stats, Changes, error) {
+	if err := stepman.SetupLibrary(steplibURI, log); err != nil {
+		return Stats{}, Changes{}, fmt.Errorf("setup steplib %s: %w", steplibURI, err)
+	}
+	route, found := stepman.ReadRoute(steplibURI)
+	if !found {
+		return Stats{}, Changes{}, fmt.Errorf("no route for steplib %s after setup", steplibURI)
+	}
+	libDir := stepman.GetLibraryBaseDirPath(route)
+
+	opts, err := withDefaults(opts, libDir)
+	if err != nil {
+		return Stats{}, Changes{}, err
+	}
+	changed, err := changedStepIDs(libDir, outputDir, opts.SteplibCommitSHA, log)
+	if err != nil {
+		return Stats{}, Changes{}, err
+	}
+	return updateFromSteplibClone(os.DirFS(libDir), outputDir, changed, opts, log)
+}
+
+// changedStepIDs returns the IDs of the steps whose sources in the steplib
+// clone at libDir differ between commit and the commit the inventory at
+// outputDir was generated from. Without a usable previous commit it returns
+// every step of the clone and of the previous inventory.
+func changedStepIDs(libDir, outputDir, commit string, log stepman.Logger) ([]string, error) {
+	var previous steplibindex.Meta
+	err := readInventoryJSON(outputDir, steplibindex.MetaPath().FS(), &previous)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		log.Infof("No inventory at %s yet, generating every step", outputDir)
+		return everyStepID(os.DirFS(libDir), outputDir)
+	case err != nil:
+		return nil, fmt.Errorf("read previous meta.json: %w", err)
+	case previous.SteplibCommitSHA == "":
+		log.Warnf("Inventory at %s doesn't record its steplib commit, regenerating every step", outputDir)
+		return everyStepID(os.DirFS(libDir), outputDir)
+	case previous.SteplibCommitSHA == commit:
+		return []string{}, nil
+	}
+
+	out, err := command.New("git", "diff", "--name-only", "--no-renames", previous.SteplibCommitSHA, commit, "--", "steps").
+		SetDir(libDir).
+		RunAndReturnTrimmedOutput()
+	if err != nil {
+		log.Warnf("Failed to diff steplib %s..%s, regenerating every step: %s", previous.SteplibCommitSHA, commit, err)
+		return everyStepID(os.DirFS(libDir), outputDir)
+	}
+	return stepIDsOfPaths(strings.Split(out, "\n")), nil
+}
+
+// stepIDsOfPaths maps steplib paths (steps/<id>/...) to their sorted,
+// deduplicated step IDs. Other paths are ignored.
+func stepIDsOfPaths(paths []string) []string {
+	ids := []string{}
+	for _, p := range paths {
+		rest, ok := strings.CutPrefix(p, "steps/")
+		if !ok {
+			continue
+		}
+		id, _, ok := strings.Cut(rest, "/")
+		if !ok || id == "" || slices.Contains(ids, id) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// everyStepID returns the step dirs of the clone and the steps of the
+// inventory at outputDir, so that regenerating them also drops the steps
+// removed from the steplib.
+func everyStepID(inputFS fs.FS, outputDir string) ([]string, error) {
+	entries, err := fs.ReadDir(inputFS, "steps")
+	if err != nil {
+		return nil, fmt.Errorf("read steps: %w", err)
+	}
+	var paths []string
+	for _, e := range entries {
+		if e.IsDir() {
+			paths = append(paths, "steps/"+e.Name()+"/")
+		}
+	}
+	var previous steplibindex.StepIDs
+	if err := readInventoryJSON(outputDir, steplibindex.StepIDsPath().FS(), &previous); err == nil {
+		for _, id := range previous.StepIDs {
+			paths = append(paths, "steps/"+id+"/")
+		}
+	}
+	return stepIDsOfPaths(paths), nil
+}
+
+// updateFromSteplibClone is generateFromSteplibClone for the changedStepIDs
+// only: it stages a copy of the inventory at outputDir (if any), replaces the
+// changed steps' subtrees with ones generated from inputFS (dropping the steps
+// no longer in inputFS), rewrites step_ids.json, search.json and meta.json,
+// then validates and publishes the staged tree. The returned Stats count the
+// regenerated steps only.
+func updateFromSteplibClone(inputFS fs.FS, outputDir string, changedStepIDs []string, opts Options, log stepman.Logger) (_ Stats, _ Changes, err error) {
+	start := time.Now()
+	opts, err = withDefaults(opts, "")
+	if err != nil {
+		return Stats{}, Changes{}, err
+	}
+
+	steplibYML, err := readSteplibYML(inputFS)
+	if err != nil {
+		return Stats{}, Changes{}, fmt.Errorf("read steplib.yml: %w", err)
+	}
+
+	staging, err := createStagingDir(outputDir)
+	if err != nil {
+		return Stats{}, Changes{}, err
+	}
+	defer func() {
+		if rmErr := os.RemoveAll(staging); rmErr != nil {
+			err = errors.Join(err, fmt.Errorf("clean staging dir %s: %w", staging, rmErr))
+		}
+	}()
+	if err := copyTree(staging, outputDir); err != nil {
+		return Stats{}, Changes{}, fmt.Errorf("stage previous inventory: %w", err)
+	}
+
+	var stepIDs steplibindex.StepIDs
+	if err := readInventoryJSON(staging, steplibindex.StepIDsPath().FS(), &stepIDs); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Stats{}, Changes{}, fmt.Errorf("read previous step_ids.json: %w", err)
+	}
+	var searchIndex steplibindex.SearchIndex
+	if err := readInventoryJSON(staging, steplibindex.SearchIndexPath().FS(), &searchIndex); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Stats{}, Changes{}, fmt.Errorf("read previous search.json: %w", err)
+	}
+	// The manifest covers the whole tree, writeManifest re-signs it if needed.
+	for _, p := range []string{steplibindex.ManifestPath().FS(), steplibindex.ManifestSignaturePath().FS()} {
+		if err := os.Remove(filepath.Join(staging, p)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return Stats{}, Changes{}, err
+		}
+	}
+
+	w := newWriter(staging, fileutil.NewFileManager())
+	var steps []parsedStep
+	for _, id := range changedStepIDs {
+		if err := removeStepSubtrees(staging, id); err != nil {
+			return Stats{}, Changes{}, err
+		}
+		s, found, err := collectChangedStep(inputFS, id, log)
+		if err != nil {
+			return Stats{}, Changes{}, err
+		}
+		if !found {
+			continue
+		}
+		if err := writeStepFiles(w, inputFS, s); err != nil {
+			return Stats{}, Changes{}, fmt.Errorf("write step %s: %w", s.id, err)
+		}
+		if err := writeStepIndexFiles(w, s); err != nil {
+			return Stats{}, Changes{}, fmt.Errorf("write index files of step %s: %w", s.id, err)
+		}
+		steps = append(steps, s)
+	}
+
+	if err := writeUpdatedIndexFiles(w, stepIDs, searchIndex, changedStepIDs, steps); err != nil {
+		return Stats{}, Changes{}, fmt.Errorf("write index files: %w", err)
+	}
+	if err := writeMeta(w, steplibYML, opts); err != nil {
+		return Stats{}, Changes{}, err
+	}
+	if opts.SigningKey != nil {
+		if err := writeManifest(w, opts.SigningKey); err != nil {
+			return Stats{}, Changes{}, fmt.Errorf("sign inventory: %w", err)
+		}
+	}
+
+	if err := validateStaged(staging); err != nil {
+		return Stats{}, Changes{}, err
+	}
+	changes, err := diffTrees(outputDir, staging)
+	if err != nil {
+		return Stats{}, Changes{}, err
+	}
+	if err := publish(staging, outputDir); err != nil {
+		return Stats{}, Changes{}, err
+	}
+
+	return buildStats(steps, w, start), changes, nil
+}
+
+// collectChangedStep collects step id from inputFS. found is false if the
+// step was removed from the steplib or has no parseable versions.
+func collectChangedStep(inputFS fs.FS, id string, log stepman.Logger) (parsedStep, bool, error) {
+	info, err := fs.Stat(inputFS, "steps/"+id)
+	if errors.Is(err, fs.ErrNotExist) || err == nil && !info.IsDir() {
+		log.Infof("Step %s was removed", id)
+		return parsedStep{}, false, nil
+	} else if err != nil {
+		return parsedStep{}, false, err
+	}
+
+	s, err := collectStep(inputFS, id, log)
+	if err != nil {
+		return parsedStep{}, false, err
+	}
+	if len(s.versions) == 0 {
+		log.Warnf("step %s has no parseable versions, skipping", s.id)
+		return parsedStep{}, false, nil
+	}
+	return s, true, nil
+}
+
+// removeStepSubtrees deletes the steps/<id> and index/steps/<id> dirs of the
+// inventory rooted at root.
+func removeStepSubtrees(root, id string) error {
+	stepDir, err := steplibindex.StepDirFS(id)
+	if err != nil {
+		return err
+	}
+	indexDir, err := steplibindex.IndexStepDirFS(id)
+	if err != nil {
+		return err
+	}
+	for _, dir := range []string{stepDir, indexDir} {
+		if err := os.RemoveAll(filepath.Join(root, dir)); err != nil {
+			return fmt.Errorf("remove %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// writeUpdatedIndexFiles rewrites step_ids.json and search.json: the entries
+// of changedStepIDs are replaced with those of the regenerated steps.
+func writeUpdatedIndexFiles(w *writer, previousIDs steplibindex.StepIDs, previousSearch steplibindex.SearchIndex, changedStepIDs []string, steps []parsedStep) error {
+	ids := []string{}
+	for _, id := range previousIDs.StepIDs {
+		if !slices.Contains(changedStepIDs, id) {
+			ids = append(ids, id)
+		}
+	}
+	entries := []steplibindex.SearchEntry{}
+	for _, entry := range previousSearch.Steps {
+		if !slices.Contains(changedStepIDs, entry.StepID) {
+			entries = append(entries, entry)
+		}
+	}
+	for _, s := range steps {
+		ids = append(ids, s.id)
+		entries = append(entries, buildSearchEntry(s))
+	}
+	slices.Sort(ids)
+	slices.SortFunc(entries, func(a, b steplibindex.SearchEntry) int { return strings.Compare(a.StepID, b.StepID) })
+
+	if err := w.writeJSON(steplibindex.StepIDsPath().FS(), steplibindex.StepIDs{StepIDs: ids}); err != nil {
+		return err
+	}
+	return w.writeJSON(steplibindex.SearchIndexPath().FS(), steplibindex.SearchIndex{Steps: entries})
+}
+
+// readInventoryJSON decodes the file at relPath of the inventory rooted at
+// root into v.
+func readInventoryJSON(root, relPath string, v any) error {
+	bytes, err := os.ReadFile(filepath.Join(root, relPath))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes, v)
+}
+
+// copyTree copies every file under src into dst, keeping the files' perms.
+// A missing src is an empty tree.
+func copyTree(dst, src string) error {
+	if _, err := os.Stat(src); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return fs.WalkDir(os.DirFS(src), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, filepath.FromSlash(p))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o700)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		bytes, err := os.ReadFile(filepath.Join(src, filepath.FromSlash(p)))
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, bytes, info.Mode().Perm())
+	})
+}
+
+// diffTrees compares the files under newDir to those under oldDir (missing
+// means empty).
+func diffTrees(oldDir, newDir string) (Changes, error) {
+	oldFiles, err := fileDigests(oldDir)
+	if err != nil {
+		return Changes{}, err
+	}
+	newFiles, err := fileDigests(newDir)
+	if err != nil {
+		return Changes{}, err
+	}
+
+	changes := Changes{Written: []string{}, Removed: []string{}}
+	for p, digest := range newFiles {
+		if oldFiles[p] != digest {
+			changes.Written = append(changes.Written, p)
+		}
+	}
+	for p := range oldFiles {
+		if _, ok := newFiles[p]; !ok {
+			changes.Removed = append(changes.Removed, p)
+		}
+	}
+	slices.Sort(changes.Written)
+	slices.Sort(changes.Removed)
+	return changes, nil
+}
+
+// fileDigests returns the digest of every file under dir, keyed by its
+// slash-separated path relative to dir.
+func fileDigests(dir string) (map[string]string, error) {
+	files := map[string]string{}
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return files, nil
+	}
+	dirFS := os.DirFS(dir)
+	err := fs.WalkDir(dirFS, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		bytes, err := fs.ReadFile(dirFS, p)
+		if err != nil {
+			return err
+		}
+		files[p] = steplibindex.Digest(bytes)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("digest %s: %w", dir, err)
+	}
+	return files, nil
+}
@@ -0,0 +1,160 @@
+package indexgen
+
+import (
+	"crypto/ed25519"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/stepman/internal/specfixtures"
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// steplibCloneDir copies the sample steplib into a writable temp dir.
+func steplibCloneDir(t *testing.T) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "steplib")
+	require.NoError(t, os.CopyFS(dir, specfixtures.SteplibClone()), "copy steplib fixture")
+	return dir
+}
+
+// changeSteplib edits hello-step, adds new-step and removes bash-step.
+func changeSteplib(t *testing.T, dir string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "steps/hello-step/2.0.0/step.yml"), minimalStepYAML("Hello v2"), 0o600))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "steps/new-step/1.0.0"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "steps/new-step/step-info.yml"), []byte("maintainer: community\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "steps/new-step/1.0.0/step.yml"), minimalStepYAML("New"), 0o600))
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, "steps/bash-step")))
+}
+
+func TestUpdateFromSteplibClone_matches_full_generation(t *testing.T) {
+	for name, signingKey := range map[string]ed25519.PrivateKey{
+		"unsigned": nil,
+		"signed":   ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			clone := steplibCloneDir(t)
+			out := t.TempDir()
+			opts := Options{GeneratedAt: fixedTime, SteplibCommitSHA: "1111111111111111111111111111111111111111", SigningKey: signingKey}
+			_, err := generateFromSteplibClone(os.DirFS(clone), out, opts, testLogger{t})
+			require.NoError(t, err, "initial generation")
+
+			changeSteplib(t, clone)
+			opts.SteplibCommitSHA = "2222222222222222222222222222222222222222"
+			stats, changes, err := updateFromSteplibClone(os.DirFS(clone), out, []string{"bash-step", "hello-step", "new-step"}, opts, testLogger{t})
+			require.NoError(t, err, "incremental generation")
+			assert.Equal(t, 2, stats.StepCount, "regenerated steps")
+
+			full := t.TempDir()
+			_, err = generateFromSteplibClone(os.DirFS(clone), full, opts, testLogger{t})
+			require.NoError(t, err, "full generation")
+			assert.Equal(t, hashAllFiles(t, full), hashAllFiles(t, out), "incremental output matches a full generation")
+
+			assert.Contains(t, changes.Written, mustFS(steplibindex.StepJSONPath("hello-step", "2.0.0")))
+			assert.Contains(t, changes.Written, mustFS(steplibindex.StepJSONPath("new-step", "1.0.0")))
+			assert.Contains(t, changes.Written, steplibindex.StepIDsPath().FS())
+			assert.Contains(t, changes.Written, steplibindex.SearchIndexPath().FS())
+			assert.Contains(t, changes.Written, steplibindex.MetaPath().FS())
+			assert.NotContains(t, changes.Written, mustFS(steplibindex.StepJSONPath("hello-step", "1.0.0")), "unchanged version")
+			assert.NotContains(t, changes.Written, mustFS(steplibindex.StepInfoPath("deprecated-step")), "unchanged step")
+			assert.Contains(t, changes.Removed, mustFS(steplibindex.StepJSONPath("bash-step", "1.0.0")))
+			assert.Contains(t, changes.Removed, mustFS(steplibindex.VersionsPath("bash-step")))
+			if signingKey != nil {
+				assert.Contains(t, changes.Written, steplibindex.ManifestPath().FS())
+			}
+		})
+	}
+}
+
+func TestUpdateFromSteplibClone_without_previous_inventory(t *testing.T) {
+	clone := steplibCloneDir(t)
+	out := filepath.Join(t.TempDir(), "inventory")
+	ids, err := everyStepID(os.DirFS(clone), out)
+	require.NoError(t, err)
+
+	_, changes, err := updateFromSteplibClone(os.DirFS(clone), out, ids, Options{GeneratedAt: fixedTime}, testLogger{t})
+	require.NoError(t, err)
+
+	full := t.TempDir()
+	_, err = generateFromSteplibClone(os.DirFS(clone), full, Options{GeneratedAt: fixedTime}, testLogger{t})
+	require.NoError(t, err)
+	hashes := hashAllFiles(t, out)
+	assert.Equal(t, hashAllFiles(t, full), hashes)
+	assert.Len(t, changes.Written, len(hashes), "every file is new")
+	assert.Empty(t, changes.Removed)
+}
+
+func TestUpdateFromSteplibClone_invalid_tree_not_published(t *testing.T) {
+	clone := steplibCloneDir(t)
+	out := t.TempDir()
+	_, err := generateFromSteplibClone(os.DirFS(clone), out, Options{GeneratedAt: fixedTime}, testLogger{t})
+	require.NoError(t, err)
+	before := hashAllFiles(t, out)
+
+	// A step.yml without source fails validation.
+	require.NoError(t, os.WriteFile(filepath.Join(clone, "steps/hello-step/2.0.0/step.yml"), []byte("title: Broken\n"), 0o600))
+	_, _, err = updateFromSteplibClone(os.DirFS(clone), out, []string{"hello-step"}, Options{GeneratedAt: fixedTime}, testLogger{t})
+	require.ErrorContains(t, err, "failed validation")
+	assert.Equal(t, before, hashAllFiles(t, out), "previous inventory left untouched")
+}
+
+func TestChangedStepIDs(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	clone := steplibCloneDir(t)
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = clone
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, "git %v: %s", args, output)
+	}
+	git("init", "-q")
+	git("add", "-A")
+	git("commit", "-q", "-m", "initial")
+	previous, err := headCommitSHA(clone)
+	require.NoError(t, err)
+
+	out := t.TempDir()
+	_, err = generateFromSteplibClone(os.DirFS(clone), out, Options{GeneratedAt: fixedTime, SteplibCommitSHA: previous}, testLogger{t})
+	require.NoError(t, err)
+
+	changeSteplib(t, clone)
+	require.NoError(t, os.WriteFile(filepath.Join(clone, "README.md"), []byte("readme"), 0o600))
+	git("add", "-A")
+	git("commit", "-q", "-m", "change steps")
+	head, err := headCommitSHA(clone)
+	require.NoError(t, err)
+
+	got, err := changedStepIDs(clone, out, head, testLogger{t})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bash-step", "hello-step", "new-step"}, got)
+
+	got, err = changedStepIDs(clone, out, previous, testLogger{t})
+	require.NoError(t, err)
+	assert.Empty(t, got, "inventory is up to date")
+
+	// A previous commit unknown to the clone regenerates every step, including
+	// the removed one.
+	_, err = generateFromSteplibClone(specfixtures.SteplibClone(), out, Options{GeneratedAt: fixedTime, SteplibCommitSHA: "0123456789012345678901234567890123456789"}, testLogger{t})
+	require.NoError(t, err)
+	got, err = changedStepIDs(clone, out, head, testLogger{t})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bash-step", "deprecated-step", "hello-step", "multi-platform-step", "new-step"}, got)
+}
+
+func TestStepIDsOfPaths(t *testing.T) {
+	got := stepIDsOfPaths([]string{
+		"steps/script/1.0.0/step.yml",
+		"steps/script/step-info.yml",
+		"steps/git-clone/assets/icon.svg",
+		"steps/README.md",
+		"steplib.yml",
+		"",
+	})
+	assert.Equal(t, []string{"git-clone", "script"}, got)
+}
@@ -51,28 +51,43 @@ func writeIndexFiles(w *writer, steps []parsedStep) error {
 		return err
 	}
 
+	if err := w.writeJSON(steplibindex.SearchIndexPath().FS(), buildSearchIndex(steps)); err != nil {
+		return err
+	}
+
 	for _, s := range steps {
-		latestPath, err := steplibindex.LatestPointerPath(s.id)
-		if err != nil {
-			return err
-		}
-		if err := w.writeJSON(latestPath.FS(), buildLatestPointer(s)); err != nil {
-			return err
-		}
-		versionsPath, err := steplibindex.VersionsPath(s.id)
-		if err != nil {
-			return err
-		}
-		if err := w.writeJSON(versionsPath.FS(), buildVersionsJSON(s)); err != nil {
+		if err := writeStepIndexFiles(w, s); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// writeStepIndexFiles emits the derived index files of a single step under
+// index/steps/<id>/.
+func writeStepIndexFiles(w *writer, s parsedStep) error {
+	latestPath, err := steplibindex.LatestPointerPath(s.id)
+	if err != nil {
+		return err
+	}
+	if err := w.writeJSON(latestPath.FS(), buildLatestPointer(s)); err != nil {
+		return err
+	}
+	versionsPath, err := steplibindex.VersionsPath(s.id)
+	if err != nil {
+		return err
+	}
+	return w.writeJSON(versionsPath.FS(), buildVersionsJSON(s))
+}
+
 func buildLatestPointer(s parsedStep) steplibindex.LatestPointer {
 	byMajor := map[string]models.Semver{}
 	for _, v := range s.versions {
+		// Pre-releases and yanked versions are listed in versions.json only: a
+		// major locked reference must not pick them up.
+		if v.semver.IsPreRelease() || s.isYanked(v.version) {
+			continue
+		}
 		majorKey := strconv.FormatUint(v.semver.Major, 10)
 		cur, ok := byMajor[majorKey]
 		if !ok || models.CmpSemver(v.semver, cur) > 0 {
@@ -83,9 +98,11 @@ func buildLatestPointer(s parsedStep) steplibindex.LatestPointer {
 	for k, v := range byMajor {
 		latestByMajor[k] = v.String()
 	}
+	// Latest stays empty for a step with pre-releases only.
+	latest, _ := s.latest()
 	return steplibindex.LatestPointer{
 		StepID:        s.id,
-		Latest:        s.latest().version,
+		Latest:        latest.version,
 		LatestByMajor: latestByMajor,
 	}
 }
@@ -101,3 +118,24 @@ func buildVersionsJSON(s parsedStep) steplibindex.Versions {
 		Versions: versions,
 	}
 }
+
+// buildSearchIndex describes every step by its latest version. steps is
+// already sorted by id, so the entries are too.
+func buildSearchIndex(steps []parsedStep) steplibindex.SearchIndex {
+	entries := make([]steplibindex.SearchEntry, 0, len(steps))
+	for _, s := range steps {
+		entries = append(entries, buildSearchEntry(s))
+	}
+	return steplibindex.SearchIndex{Steps: entries}
+}
+
+// buildSearchEntry describes a step with pre-releases only by its newest
+// pre-release, with no latest_version, so it can still be found and pinned.
+func buildSearchEntry(s parsedStep) steplibindex.SearchEntry {
+	latest, ok := s.latest()
+	if !ok {
+		newest := s.versions[len(s.versions)-1]
+		return steplibindex.NewSearchEntry(s.id, "", newest.model, s.info.Maintainer, s.info.Deprecation != nil)
+	}
+	return steplibindex.NewSearchEntry(s.id, latest.version, latest.model, s.info.Maintainer, s.info.Deprecation != nil)
+}
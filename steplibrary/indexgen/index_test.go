@@ -1,11 +1,14 @@
 package indexgen
 
 import (
+	"os"
 	"path/filepath"
 	"testing"
+	"testing/fstest"
 
 	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestIndex_per_step_latest_pointer(t *testing.T) {
@@ -43,3 +46,97 @@ func TestIndex_versions_newest_first(t *testing.T) {
 	assert.Equal(t, "hello-step", versions.StepID, "StepID")
 	assert.Equal(t, []string{"2.0.0", "1.1.0", "1.0.0"}, versions.Versions, "Versions newest-first")
 }
+
+func TestIndex_search_index(t *testing.T) {
+	root := runGenerateFromSteplibClone(t)
+
+	var index steplibindex.SearchIndex
+	readJSON(t, filepath.Join(root, steplibindex.SearchIndexPath().FS()), &index)
+
+	require.Len(t, index.Steps, 4, "one entry per step")
+	byID := map[string]steplibindex.SearchEntry{}
+	for _, entry := range index.Steps {
+		byID[entry.StepID] = entry
+	}
+	hello := byID["hello-step"]
+	assert.Equal(t, "2.0.0", hello.LatestVersion, "LatestVersion")
+	assert.Equal(t, "Hello Step", hello.Title, "Title")
+	assert.Equal(t, "bitrise", hello.Maintainer, "Maintainer")
+	assert.False(t, hello.Deprecated, "hello-step Deprecated")
+	assert.True(t, byID["deprecated-step"].Deprecated, "deprecated-step Deprecated")
+}
+
+func TestIndex_pre_releases_listed_but_not_latest(t *testing.T) {
+	inputFS := fstest.MapFS{
+		"steplib.yml":                          {Data: []byte("format_version: '0.9.0'\n")},
+		"steps/my-step/step-info.yml":          {Data: []byte("maintainer: test\n")},
+		"steps/my-step/1.0.0/step.yml":         {Data: minimalStepYAML("My Step")},
+		"steps/my-step/1.1.0-rc.1/step.yml":    {Data: minimalStepYAML("My Step")},
+		"steps/my-step/2.0.0-beta.2/step.yml":  {Data: minimalStepYAML("My Step")},
+		"steps/my-step/2.0.0-beta.10/step.yml": {Data: minimalStepYAML("My Step")},
+		"steps/rc-step/step-info.yml":          {Data: []byte("maintainer: test\n")},
+		"steps/rc-step/1.0.0-rc.1/step.yml":    {Data: minimalStepYAML("RC Step")},
+	}
+	out := t.TempDir()
+	_, err := generateFromSteplibClone(inputFS, out, Options{GeneratedAt: fixedTime}, testLogger{t})
+	require.NoError(t, err, "generateFromSteplibClone")
+
+	var versions steplibindex.Versions
+	readJSON(t, filepath.Join(out, mustFS(steplibindex.VersionsPath("my-step"))), &versions)
+	assert.Equal(t, []string{"2.0.0-beta.10", "2.0.0-beta.2", "1.1.0-rc.1", "1.0.0"}, versions.Versions, "pre-releases listed by precedence")
+
+	var latest steplibindex.LatestPointer
+	readJSON(t, filepath.Join(out, mustFS(steplibindex.LatestPointerPath("my-step"))), &latest)
+	assert.Equal(t, "1.0.0", latest.Latest, "Latest skips pre-releases")
+	assert.Equal(t, map[string]string{"1": "1.0.0"}, latest.LatestByMajor, "a major with pre-releases only has no pointer")
+
+	var rcLatest steplibindex.LatestPointer
+	readJSON(t, filepath.Join(out, mustFS(steplibindex.LatestPointerPath("rc-step"))), &rcLatest)
+	assert.Empty(t, rcLatest.Latest, "a step with pre-releases only has no latest")
+	assert.Empty(t, rcLatest.LatestByMajor, "LatestByMajor")
+
+	var index steplibindex.SearchIndex
+	readJSON(t, filepath.Join(out, steplibindex.SearchIndexPath().FS()), &index)
+	require.Len(t, index.Steps, 2, "search entries")
+	assert.Equal(t, "rc-step", index.Steps[1].StepID, "StepID")
+	assert.Empty(t, index.Steps[1].LatestVersion, "a step with pre-releases only is listed without a latest version")
+	assert.Equal(t, "RC Step", index.Steps[1].Title, "described by its newest pre-release")
+
+	assert.Empty(t, Validate(os.DirFS(out)), "Validate")
+}
+
+func TestIndex_yanked_versions_listed_but_not_latest(t *testing.T) {
+	inputFS := fstest.MapFS{
+		"steplib.yml":                      {Data: []byte("format_version: '0.9.0'\n")},
+		"steps/my-step/step-info.yml":      {Data: []byte("maintainer: test\nyanked_versions:\n  2.1.0: crashes on start\n  1.2.0: broken inputs\n")},
+		"steps/my-step/1.1.0/step.yml":     {Data: minimalStepYAML("My Step")},
+		"steps/my-step/1.2.0/step.yml":     {Data: minimalStepYAML("My Step")},
+		"steps/my-step/2.0.0/step.yml":     {Data: minimalStepYAML("My Step")},
+		"steps/my-step/2.1.0/step.yml":     {Data: minimalStepYAML("My Step")},
+		"steps/yanked-step/step-info.yml":  {Data: []byte("maintainer: test\nyanked_versions:\n  1.0.0: broken\n")},
+		"steps/yanked-step/1.0.0/step.yml": {Data: minimalStepYAML("Yanked Step")},
+	}
+	out := t.TempDir()
+	_, err := generateFromSteplibClone(inputFS, out, Options{GeneratedAt: fixedTime}, testLogger{t})
+	require.NoError(t, err, "generateFromSteplibClone")
+
+	var versions steplibindex.Versions
+	readJSON(t, filepath.Join(out, mustFS(steplibindex.VersionsPath("my-step"))), &versions)
+	assert.Equal(t, []string{"2.1.0", "2.0.0", "1.2.0", "1.1.0"}, versions.Versions, "yanked versions listed")
+
+	var info steplibindex.StepInfo
+	readJSON(t, filepath.Join(out, mustFS(steplibindex.StepInfoPath("my-step"))), &info)
+	assert.Equal(t, map[string]string{"2.1.0": "crashes on start", "1.2.0": "broken inputs"}, info.YankedVersions, "YankedVersions")
+
+	var latest steplibindex.LatestPointer
+	readJSON(t, filepath.Join(out, mustFS(steplibindex.LatestPointerPath("my-step"))), &latest)
+	assert.Equal(t, "2.0.0", latest.Latest, "Latest skips yanked versions")
+	assert.Equal(t, map[string]string{"1": "1.1.0", "2": "2.0.0"}, latest.LatestByMajor, "LatestByMajor skips yanked versions")
+
+	var yankedLatest steplibindex.LatestPointer
+	readJSON(t, filepath.Join(out, mustFS(steplibindex.LatestPointerPath("yanked-step"))), &yankedLatest)
+	assert.Equal(t, "1.0.0", yankedLatest.Latest, "a step with every version yanked points at its newest")
+	assert.Empty(t, yankedLatest.LatestByMajor, "LatestByMajor")
+
+	assert.Empty(t, Validate(os.DirFS(out)), "Validate")
+}
@@ -8,9 +8,15 @@
 // staged tree is never published, so any existing inventory at the output dir
 // is left untouched on a validation failure, and a successful Generate
 // guarantees the published inventory passes Validate.
+//
+// GenerateIncremental updates a published inventory in the same way, but only
+// regenerates the steps that changed since the steplib commit it was generated
+// from, and reports the files it changed. Diff compares two published
+// inventories.
 package indexgen
 
 import (
+	"crypto/ed25519"
 	"errors"
 	"fmt"
 	"io/fs"
@@ -35,22 +41,28 @@ type Options struct {
 	// SteplibCommitSHA is written to meta.json. Optional: the URI entry point
 	// fills it from the clone's HEAD commit when empty.
 	SteplibCommitSHA string
+	// SigningKey, when set, signs the inventory: a manifest.json listing the
+	// digest of every file is written next to meta.json, along with its
+	// ed25519 signature (see steplibindex.Manifest). Readers configured with
+	// the matching public key refuse files that don't match it.
+	SigningKey ed25519.PrivateKey
 }
 
 // Stats summarizes a successful generation.
 type Stats struct {
-	StepCount    int
-	VersionCount int
-	FilesWritten int
-	BytesWritten int64
-	Duration     time.Duration
+	StepCount    int           `json:"step_count"`
+	VersionCount int           `json:"version_count"`
+	FilesWritten int           `json:"files_written"`
+	BytesWritten int64         `json:"bytes_written"`
+	Duration     time.Duration `json:"duration_ns"`
 }
 
 // Generate sets up the steplib identified by steplibURI (cloning it into
 // stepman's local cache via stepman.SetupLibrary if not already present) and
 // writes the V2 inventory tree to outputDir. It is the URI-based entry point
-// (the bitrise steps generate-steplib subcommand calls it); generateFromSteplibClone
-// is the lower-level core that reads from an already-available filesystem.
+// (stepman inventory generate and the bitrise steps generate-steplib
+// subcommand call it); generateFromSteplibClone is the lower-level core that
+// reads from an already-available filesystem.
 func Generate(steplibURI, outputDir string, opts Options, log stepman.Logger) (Stats, error) {
 	if err := stepman.SetupLibrary(steplibURI, log); err != nil {
 		return Stats{}, fmt.Errorf("setup steplib %s: %w", steplibURI, err)
@@ -140,16 +152,16 @@ func generateFromSteplibClone(inputFS fs.FS, outputDir string, opts Options, log
 	if err := writeInventory(w, inputFS, steps, steplibYML, opts); err != nil {
 		return Stats{}, err
 	}
+	if opts.SigningKey != nil {
+		if err := writeManifest(w, opts.SigningKey); err != nil {
+			return Stats{}, fmt.Errorf("sign inventory: %w", err)
+		}
+	}
 
 	// Validate the fully-staged tree before publishing: an invalid tree is never
-	// published, so any existing inventory at outputDir is left untouched. staging
-	// is the dir CONTAINING the version dir (v2/), the root Validate expects.
-	if violations := Validate(os.DirFS(staging)); len(violations) > 0 {
-		errs := make([]error, len(violations))
-		for i, v := range violations {
-			errs[i] = v
-		}
-		return Stats{}, fmt.Errorf("staged inventory failed validation (%d violations):\n%w", len(violations), errors.Join(errs...))
+	// published, so any existing inventory at outputDir is left untouched.
+	if err := validateStaged(staging); err != nil {
+		return Stats{}, err
 	}
 
 	if err := publish(staging, outputDir); err != nil {
@@ -159,6 +171,20 @@ func generateFromSteplibClone(inputFS fs.FS, outputDir string, opts Options, log
 	return buildStats(steps, w, start), nil
 }
 
+// validateStaged runs Validate against the staged tree. staging is the dir
+// CONTAINING the version dir (v2/), the root Validate expects.
+func validateStaged(staging string) error {
+	violations := Validate(os.DirFS(staging))
+	if len(violations) == 0 {
+		return nil
+	}
+	errs := make([]error, len(violations))
+	for i, v := range violations {
+		errs[i] = v
+	}
+	return fmt.Errorf("staged inventory failed validation (%d violations):\n%w", len(violations), errors.Join(errs...))
+}
+
 // createStagingDir makes a fresh staging directory as a sibling of outputDir
 // (same filesystem, so publish's rename is atomic and never cross-device).
 func createStagingDir(outputDir string) (string, error) {
@@ -184,6 +210,11 @@ func writeInventory(w *writer, inputFS fs.FS, steps []parsedStep, steplibYML mod
 	if err := writeIndexFiles(w, steps); err != nil {
 		return fmt.Errorf("write index files: %w", err)
 	}
+	return writeMeta(w, steplibYML, opts)
+}
+
+// writeMeta emits meta.json.
+func writeMeta(w *writer, steplibYML models.StepCollectionModel, opts Options) error {
 	meta := steplibindex.Meta{
 		FormatVersion:     steplibindex.FormatVersion,
 		UpdatedAt:         opts.GeneratedAt,
@@ -91,9 +91,9 @@ func TestGenerator_stats(t *testing.T) {
 	// hello-step:3 + deprecated:1 + multi-platform:1 + bash:1
 	assert.Equal(t, 6, stats.VersionCount, "VersionCount")
 	// step-level: bash(2) + deprecated(2) + hello(5) + multi-platform(3) = 12
-	// index/:      step_ids + 4×(latest+versions) = 9
+	// index/:      step_ids + search + 4×(latest+versions) = 10
 	// meta.json:  1
-	assert.Equal(t, 22, stats.FilesWritten, "FilesWritten")
+	assert.Equal(t, 23, stats.FilesWritten, "FilesWritten")
 	assert.Positive(t, stats.BytesWritten, "BytesWritten")
 }
 
@@ -0,0 +1,102 @@
+package indexgen
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+)
+
+// writeManifest signs the staged tree: it digests every file under the
+// format-version dir into manifest.json and signs manifest.json's bytes into
+// manifest.json.sig. It must run after every other file is written.
+func writeManifest(w *writer, key ed25519.PrivateKey) error {
+	files, err := digestTree(os.DirFS(w.outputDir))
+	if err != nil {
+		return err
+	}
+	manifest := steplibindex.Manifest{Files: files}
+	bytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	bytes = append(bytes, '\n')
+	if err := w.writeBytes(steplibindex.ManifestPath().FS(), bytes); err != nil {
+		return fmt.Errorf("write manifest.json: %w", err)
+	}
+	if err := w.writeBytes(steplibindex.ManifestSignaturePath().FS(), steplibindex.SignManifest(key, bytes)); err != nil {
+		return fmt.Errorf("write manifest.json.sig: %w", err)
+	}
+	return nil
+}
+
+// digestTree returns the digest of every file under the format-version dir of
+// inventoryFS, except the manifest and its signature.
+func digestTree(inventoryFS fs.FS) (map[string]string, error) {
+	files := map[string]string{}
+	err := fs.WalkDir(inventoryFS, steplibindex.VersionDir(), func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || isManifestFile(p) {
+			return err
+		}
+		bytes, err := fs.ReadFile(inventoryFS, p)
+		if err != nil {
+			return err
+		}
+		files[p] = steplibindex.Digest(bytes)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("digest inventory files: %w", err)
+	}
+	return files, nil
+}
+
+func isManifestFile(p string) bool {
+	return p == steplibindex.ManifestPath().FS() || p == steplibindex.ManifestSignaturePath().FS()
+}
+
+// checkManifest validates a signed inventory's manifest.json against the tree:
+// every file must be listed with its current digest and every listed file must
+// exist. Unsigned inventories (no manifest.json) pass. The signature itself
+// needs the publisher's public key, so it is checked by readers, not here.
+func (v *validator) checkManifest() []ValidationError {
+	manifestPath := steplibindex.ManifestPath().FS()
+	sigPath := steplibindex.ManifestSignaturePath().FS()
+	if _, err := fs.Stat(v.fs, manifestPath); err != nil {
+		return nil
+	}
+
+	var manifest steplibindex.Manifest
+	issues, ok := v.readJSON(manifestPath, &manifest)
+	v.consume(sigPath)
+	if _, err := fs.Stat(v.fs, sigPath); err != nil {
+		issues = append(issues, violationf(sigPath, "missing or unreadable: %s", err))
+	}
+	if !ok {
+		return issues
+	}
+
+	actual, err := digestTree(v.fs)
+	if err != nil {
+		return append(issues, violationf(manifestPath, "%s", err))
+	}
+	for p, digest := range actual {
+		listed, found := manifest.Files[p]
+		switch {
+		case !found:
+			issues = append(issues, violationf(p, "not listed in %s", path.Base(manifestPath)))
+		case listed != digest:
+			issues = append(issues, violationf(p, "digest is %s, %s lists %s", digest, path.Base(manifestPath), listed))
+		}
+	}
+	for p := range manifest.Files {
+		if _, found := actual[p]; !found {
+			issues = append(issues, violationf(manifestPath, "lists %s, which does not exist", p))
+		}
+	}
+	return issues
+}
@@ -0,0 +1,108 @@
+package indexgen
+
+import (
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/stepman/internal/specfixtures"
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSigningKey is a fixed key so signed output stays deterministic.
+var testSigningKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+
+func runSignedGenerate(t *testing.T) string {
+	t.Helper()
+	out := t.TempDir()
+	_, err := generateFromSteplibClone(
+		specfixtures.SteplibClone(),
+		out,
+		Options{GeneratedAt: fixedTime, SteplibCommitSHA: "deadbeefcafef00d", SigningKey: testSigningKey},
+		testLogger{t},
+	)
+	require.NoError(t, err, "generateFromSteplibClone")
+	return out
+}
+
+func TestGenerator_signed_manifest(t *testing.T) {
+	root := runSignedGenerate(t)
+
+	manifestJSON, err := os.ReadFile(filepath.Join(root, steplibindex.ManifestPath().FS()))
+	require.NoError(t, err, "read manifest.json")
+	sig, err := os.ReadFile(filepath.Join(root, steplibindex.ManifestSignaturePath().FS()))
+	require.NoError(t, err, "read manifest.json.sig")
+	require.NoError(t, steplibindex.VerifyManifest(testSigningKey.Public().(ed25519.PublicKey), manifestJSON, sig), "signature")
+
+	var manifest steplibindex.Manifest
+	readJSON(t, filepath.Join(root, steplibindex.ManifestPath().FS()), &manifest)
+	for _, p := range []string{
+		steplibindex.MetaPath().FS(),
+		steplibindex.StepIDsPath().FS(),
+		mustFS(steplibindex.LatestPointerPath("hello-step")),
+		mustFS(steplibindex.VersionsPath("hello-step")),
+		mustFS(steplibindex.StepJSONPath("hello-step", "1.0.0")),
+	} {
+		bytes, err := os.ReadFile(filepath.Join(root, p))
+		require.NoError(t, err, "read %s", p)
+		assert.Equal(t, steplibindex.Digest(bytes), manifest.Files[p], "digest of %s", p)
+	}
+	assert.NotContains(t, manifest.Files, steplibindex.ManifestPath().FS(), "manifest lists itself")
+}
+
+func TestGenerator_unsigned_has_no_manifest(t *testing.T) {
+	root := runGenerateFromSteplibClone(t)
+	assert.NoFileExists(t, filepath.Join(root, steplibindex.ManifestPath().FS()))
+	assert.NoFileExists(t, filepath.Join(root, steplibindex.ManifestSignaturePath().FS()))
+}
+
+func TestValidate_signed_inventory(t *testing.T) {
+	cases := map[string]struct {
+		mutate   func(t *testing.T, root string)
+		wantPath string
+		wantMsg  string
+	}{
+		"clean signed output is valid": {
+			mutate: func(*testing.T, string) {},
+		},
+		"file changed after signing": {
+			mutate: func(t *testing.T, root string) {
+				seedFile(t, root, mustFS(steplibindex.StepJSONPath("hello-step", "1.0.0")), `{"source":{"git":"https://evil.example/x.git","commit":"abc"}}`)
+			},
+			wantPath: "hello-step/1.0.0/step.json", wantMsg: "digest is",
+		},
+		"file added after signing": {
+			mutate: func(t *testing.T, root string) {
+				require.NoError(t, os.WriteFile(filepath.Join(root, "v2", "extra.json"), []byte("{}"), 0o600))
+			},
+			wantPath: "v2/extra.json", wantMsg: "not listed",
+		},
+		"listed file removed": {
+			mutate: func(t *testing.T, root string) {
+				removeFile(t, root, mustFS(steplibindex.StepJSONPath("hello-step", "1.0.0")))
+			},
+			wantPath: "manifest.json", wantMsg: "does not exist",
+		},
+		"signature missing": {
+			mutate:   func(t *testing.T, root string) { removeFile(t, root, steplibindex.ManifestSignaturePath().FS()) },
+			wantPath: "manifest.json.sig", wantMsg: "missing",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			root := runSignedGenerate(t)
+			tc.mutate(t, root)
+
+			got := Validate(os.DirFS(root))
+			if tc.wantMsg == "" {
+				assert.Empty(t, got, "violations")
+				return
+			}
+			assert.NotNil(t, flagMatching(got, tc.wantPath, tc.wantMsg), "want violation %q at %q, got %v", tc.wantMsg, tc.wantPath, got)
+		})
+	}
+}
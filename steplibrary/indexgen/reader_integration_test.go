@@ -1,15 +1,23 @@
 package indexgen_test
 
 import (
+	"crypto/ed25519"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
 	"time"
 
+	"github.com/bitrise-io/go-utils/v2/fileutil"
 	"github.com/bitrise-io/stepman/internal/httpfetch"
+	"github.com/bitrise-io/stepman/internal/inventoryserver"
 	"github.com/bitrise-io/stepman/internal/specfixtures"
 	"github.com/bitrise-io/stepman/steplibrary"
 	"github.com/bitrise-io/stepman/steplibrary/indexgen"
+	"github.com/bitrise-io/stepman/stepman"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -45,7 +53,7 @@ func TestHTTPAPI_Integration(t *testing.T) {
 
 	// The tree is rooted under v2/; serving outDir lets the reader's v2/-prefixed
 	// path helpers resolve against srv.URL directly.
-	srv := httptest.NewServer(http.FileServer(http.Dir(outDir)))
+	srv := httptest.NewServer(inventoryserver.NewHandler(os.DirFS(outDir), testLogger{t}))
 	t.Cleanup(srv.Close)
 
 	api := steplibrary.NewHTTPAPI(srv.URL, httpfetch.NewWithClient(srv.Client()))
@@ -100,3 +108,178 @@ func TestHTTPAPI_Integration(t *testing.T) {
 		assert.Equal(t, "https://github.com/example/hello-step.git", got.Source.Git, "Source.Git")
 	})
 }
+
+// TestFSAPI_Integration reads a freshly generated inventory straight from disk
+// through steplibrary.FSAPI, the file:// / air-gapped counterpart of the HTTP
+// reader above.
+func TestFSAPI_Integration(t *testing.T) {
+	outDir := t.TempDir()
+	_, err := indexgen.GenerateFromSteplibCloneForTest(
+		specfixtures.SteplibClone(),
+		outDir,
+		indexgen.Options{GeneratedAt: time.Date(2026, 5, 15, 12, 0, 0, 0, time.UTC), SteplibCommitSHA: ""},
+		testLogger{t},
+	)
+	require.NoError(t, err, "generate V2 inventory")
+
+	api := steplibrary.NewFSAPI(os.DirFS(outDir))
+	ctx := t.Context()
+
+	ids, err := api.GetAllStepIDs(ctx)
+	require.NoError(t, err, "GetAllStepIDs")
+	assert.Equal(t, []string{"bash-step", "deprecated-step", "hello-step", "multi-platform-step"}, ids, "step IDs")
+
+	latest, err := api.GetLatestStepVersions(ctx, "hello-step")
+	require.NoError(t, err, "GetLatestStepVersions")
+	assert.Equal(t, "2.0.0", latest.Latest, "Latest")
+
+	step, err := api.GetStepModel(ctx, steplibrary.ResolvedStepVersion{ID: "hello-step", Version: "2.0.0"})
+	require.NoError(t, err, "GetStepModel")
+	require.NotNil(t, step.Title, "Title")
+	assert.Equal(t, "Hello Step", *step.Title, "Title")
+}
+
+// TestSignedInventory_Integration generates a signed inventory and reads it
+// back through verifying readers: genuine files pass, while a wrong key or a
+// file tampered with after signing is refused with ErrVerification.
+func TestSignedInventory_Integration(t *testing.T) {
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	publicKey := key.Public().(ed25519.PublicKey)
+	outDir := t.TempDir()
+	_, err := indexgen.GenerateFromSteplibCloneForTest(
+		specfixtures.SteplibClone(),
+		outDir,
+		indexgen.Options{GeneratedAt: time.Date(2026, 5, 15, 12, 0, 0, 0, time.UTC), SteplibCommitSHA: "", SigningKey: key},
+		testLogger{t},
+	)
+	require.NoError(t, err, "generate signed V2 inventory")
+
+	tamperedPath := filepath.Join(outDir, "v2", "steps", "hello-step", "1.0.0", "step.json")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/steps/hello-step/1.0.0/step.json" {
+			_, _ = w.Write([]byte(`{"title":"Hello Step","source":{"git":"https://evil.example/hello-step.git","commit":"abc"}}`))
+			return
+		}
+		if r.URL.Path == "/v2/steps/hello-step/assets/icon.svg" {
+			_, _ = w.Write([]byte(`<svg onload="alert(1)"/>`))
+			return
+		}
+		http.FileServer(http.Dir(outDir)).ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	ctx := t.Context()
+
+	t.Run("HTTPAPI accepts genuine files and refuses a tampered one", func(t *testing.T) {
+		api := steplibrary.NewHTTPAPI(srv.URL, httpfetch.NewWithClient(srv.Client()))
+		api.VerifyWith(publicKey)
+
+		latest, err := api.GetLatestStepVersions(ctx, "hello-step")
+		require.NoError(t, err, "GetLatestStepVersions")
+		assert.Equal(t, "2.0.0", latest.Latest, "Latest")
+
+		_, err = api.GetStepModel(ctx, steplibrary.ResolvedStepVersion{ID: "hello-step", Version: "1.0.0"})
+		require.ErrorIs(t, err, steplibrary.ErrVerification)
+		require.ErrorContains(t, err, "v2/steps/hello-step/1.0.0/step.json has digest")
+
+		_, err = api.GetStepAsset(ctx, "hello-step", "icon.svg")
+		require.ErrorIs(t, err, steplibrary.ErrVerification, "tampered asset")
+	})
+
+	t.Run("FSAPI verifies assets", func(t *testing.T) {
+		api := steplibrary.NewFSAPI(os.DirFS(outDir))
+		api.VerifyWith(publicKey)
+
+		genuine, err := os.ReadFile(filepath.Join(outDir, "v2", "steps", "hello-step", "assets", "icon.svg"))
+		require.NoError(t, err)
+		got, err := api.GetStepAsset(ctx, "hello-step", "icon.svg")
+		require.NoError(t, err, "GetStepAsset")
+		assert.Equal(t, genuine, got)
+	})
+
+	t.Run("a different public key is refused", func(t *testing.T) {
+		other := ed25519.NewKeyFromSeed(append(make([]byte, ed25519.SeedSize-1), 1)).Public().(ed25519.PublicKey)
+		api := steplibrary.NewFSAPI(os.DirFS(outDir))
+		api.VerifyWith(other)
+
+		_, err := api.GetAllStepIDs(ctx)
+		require.ErrorIs(t, err, steplibrary.ErrVerification)
+		require.ErrorContains(t, err, "signature does not match")
+	})
+
+	t.Run("Client verifies a file:// inventory", func(t *testing.T) {
+		t.Setenv("HOME", t.TempDir())
+		client := steplibrary.NewWithOptions(testLogger{t}, "", fileutil.NewFileManager(), steplibrary.Options{InventoryURLs: []string{"file://" + outDir}, PublicKey: publicKey})
+
+		got, err := client.FetchStepMetadata(ctx, "hello-step", "1", steplibrary.ActivateOutputPaths{YMLPath: filepath.Join(t.TempDir(), "step.yml"), CodePath: ""})
+		require.NoError(t, err, "FetchStepMetadata")
+		assert.Equal(t, "1.1.0", got.StepInfo.Version, "resolved version")
+
+		require.NoError(t, os.WriteFile(tamperedPath, []byte(`{"title":"Hello Step"}`), 0o600))
+		_, err = client.FetchStepMetadata(ctx, "hello-step", "1.0.0", steplibrary.ActivateOutputPaths{YMLPath: filepath.Join(t.TempDir(), "step.yml"), CodePath: ""})
+		require.ErrorIs(t, err, steplibrary.ErrVerification)
+	})
+}
+
+// TestStepCollection_Integration converts a freshly generated inventory back
+// into a V1 spec.json model and checks it matches the source steplib.
+func TestStepCollection_Integration(t *testing.T) {
+	outDir := t.TempDir()
+	_, err := indexgen.GenerateFromSteplibCloneForTest(
+		specfixtures.SteplibClone(),
+		outDir,
+		indexgen.Options{GeneratedAt: time.Date(2026, 5, 15, 12, 0, 0, 0, time.UTC), SteplibCommitSHA: ""},
+		testLogger{t},
+	)
+	require.NoError(t, err, "generate V2 inventory")
+
+	client := steplibrary.New(testLogger{t}, "", "file://"+outDir, fileutil.NewFileManager())
+	spec, err := client.StepCollection(t.Context())
+	require.NoError(t, err, "StepCollection")
+
+	assert.Equal(t, "https://github.com/example/test-steplib.git", spec.SteplibSource, "SteplibSource")
+	require.Len(t, spec.DownloadLocations, 2, "DownloadLocations")
+	assert.Len(t, spec.Steps, 4, "steps")
+
+	hello := spec.Steps["hello-step"]
+	assert.Equal(t, "2.0.0", hello.LatestVersionNumber, "LatestVersionNumber")
+	assert.ElementsMatch(t, []string{"1.0.0", "1.1.0", "2.0.0"}, slices.Collect(maps.Keys(hello.Versions)), "versions")
+	assert.Equal(t, map[string]string{"icon.svg": "file://" + outDir + "/v2/steps/hello-step/assets/icon.svg"}, hello.Info.AssetURLs, "asset URLs")
+	require.NotNil(t, hello.Versions["1.0.0"].Title, "Title")
+	assert.Equal(t, "Hello Step", *hello.Versions["1.0.0"].Title, "Title")
+
+	deprecated := spec.Steps["deprecated-step"]
+	assert.NotEmpty(t, deprecated.Info.DeprecateNotes, "DeprecateNotes")
+	assert.NotEmpty(t, deprecated.Info.RemovalDate, "RemovalDate")
+}
+
+// TestSetupLibrary_Integration sets up a library from a freshly generated
+// inventory and updates it once the inventory is regenerated.
+func TestSetupLibrary_Integration(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	outDir := t.TempDir()
+	generate := func(generatedAt time.Time) {
+		_, err := indexgen.GenerateFromSteplibCloneForTest(specfixtures.SteplibClone(), outDir, indexgen.Options{GeneratedAt: generatedAt}, testLogger{t})
+		require.NoError(t, err, "generate V2 inventory")
+	}
+	generatedAt := time.Date(2026, 5, 15, 12, 0, 0, 0, time.UTC)
+	generate(generatedAt)
+
+	libraryURI := stepman.InventoryURIPrefix + "file://" + outDir
+	require.NoError(t, stepman.SetupLibraryWithReader(libraryURI, steplibrary.NewInventoryReader(), testLogger{t}), "SetupLibraryWithReader")
+
+	spec, err := stepman.ReadStepSpec(libraryURI)
+	require.NoError(t, err)
+	assert.Equal(t, generatedAt.Unix(), spec.GeneratedAtTimeStamp, "GeneratedAtTimeStamp")
+	assert.Len(t, spec.Steps, 4, "steps")
+
+	stepInfo, err := stepman.QueryStepInfoFromLibrary(libraryURI, "hello-step", "1.0.0", testLogger{t})
+	require.NoError(t, err, "QueryStepInfoFromLibrary")
+	assert.Equal(t, "1.0.0", stepInfo.Version)
+	assert.Equal(t, "Hello Step", *stepInfo.Step.Title)
+
+	generatedAt = generatedAt.Add(time.Hour)
+	generate(generatedAt)
+	spec, err = stepman.UpdateLibraryWithReader(libraryURI, steplibrary.NewInventoryReader(), testLogger{t})
+	require.NoError(t, err, "UpdateLibraryWithReader")
+	assert.Equal(t, generatedAt.Unix(), spec.GeneratedAtTimeStamp, "updated GeneratedAtTimeStamp")
+}
@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"io/fs"
 	"path"
+	"slices"
 	"sort"
 	"strings"
 
+	"github.com/bitrise-io/stepman/internal/integrity"
 	"github.com/bitrise-io/stepman/models"
 	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
 )
@@ -94,8 +96,10 @@ func (v *validator) collect() []ValidationError {
 		for _, id := range stepIDs.StepIDs {
 			issues = append(issues, v.checkStep(id)...)
 		}
+		issues = append(issues, v.checkSearchIndex(stepIDs)...)
 	}
 
+	issues = append(issues, v.checkManifest()...)
 	issues = append(issues, v.staleFileViolations()...)
 	return issues
 }
@@ -172,6 +176,13 @@ func (v *validator) checkStep(id string) []ValidationError {
 		issues = append(issues, violationf(versionsPath, "step_id is %q, expected %q", versions.StepID, id))
 	}
 
+	info, infoIssues := v.checkStepInfo(infoP.FS(), stepDir)
+	issues = append(issues, infoIssues...)
+	isYanked := func(ver string) bool {
+		_, yanked := info.YankedVersions[ver]
+		return yanked
+	}
+
 	// Cross-check pointers against the versions list.
 	declaredVersions := map[string]bool{}
 	if haveVersions {
@@ -180,7 +191,13 @@ func (v *validator) checkStep(id string) []ValidationError {
 		}
 	}
 	if haveLatest && haveVersions {
-		if !declaredVersions[latest.Latest] {
+		hasRelease := slices.ContainsFunc(versions.Versions, func(ver string) bool { return !isPreRelease(ver) })
+		if latest.Latest == "" {
+			// Only a step with pre-releases only has no latest version.
+			if hasRelease {
+				issues = append(issues, violationf(latestPath, "latest is empty, but %s has releases", versionsPath))
+			}
+		} else if !declaredVersions[latest.Latest] {
 			issues = append(issues, violationf(latestPath, "latest %q is not in %s", latest.Latest, versionsPath))
 		}
 		for major, ver := range latest.LatestByMajor {
@@ -190,6 +207,25 @@ func (v *validator) checkStep(id string) []ValidationError {
 			if !strings.HasPrefix(ver, major+".") {
 				issues = append(issues, violationf(latestPath, "latest_by_major[%q]=%q has a different major", major, ver))
 			}
+			if isPreRelease(ver) {
+				issues = append(issues, violationf(latestPath, "latest_by_major[%q]=%q is a pre-release", major, ver))
+			}
+			if isYanked(ver) {
+				issues = append(issues, violationf(latestPath, "latest_by_major[%q]=%q is yanked", major, ver))
+			}
+		}
+		if isPreRelease(latest.Latest) {
+			issues = append(issues, violationf(latestPath, "latest %q is a pre-release", latest.Latest))
+		}
+		if isYanked(latest.Latest) && slices.ContainsFunc(versions.Versions, func(ver string) bool { return !isPreRelease(ver) && !isYanked(ver) }) {
+			issues = append(issues, violationf(latestPath, "latest %q is yanked, but %s has versions that are not", latest.Latest, versionsPath))
+		}
+	}
+	if haveVersions {
+		for ver := range info.YankedVersions {
+			if !declaredVersions[ver] {
+				issues = append(issues, violationf(infoP.FS(), "yanked version %q is not in %s", ver, versionsPath))
+			}
 		}
 	}
 
@@ -200,11 +236,41 @@ func (v *validator) checkStep(id string) []ValidationError {
 		}
 	}
 
-	issues = append(issues, v.checkStepInfo(infoP.FS(), stepDir)...)
 	return issues
 }
 
-// checkStepJSON validates v2/steps/<id>/<version>/step.json. versionsPath is the
+// checkSearchIndex validates index/search.json against step_ids.json: exactly
+// one entry per step, in step_ids order, each naming the step's latest version.
+func (v *validator) checkSearchIndex(ids steplibindex.StepIDs) []ValidationError {
+	p := steplibindex.SearchIndexPath().FS()
+	var index steplibindex.SearchIndex
+	issues, ok := v.readJSON(p, &index)
+	if !ok {
+		return issues
+	}
+	got := make([]string, len(index.Steps))
+	for i, entry := range index.Steps {
+		got[i] = entry.StepID
+	}
+	if !slices.Equal(got, ids.StepIDs) {
+		issues = append(issues, violationf(p, "step ids %v do not match %s", got, steplibindex.StepIDsPath().FS()))
+	}
+	for _, entry := range index.Steps {
+		latestP, err := steplibindex.LatestPointerPath(entry.StepID)
+		if err != nil {
+			issues = append(issues, violationf(p, "step id %q is invalid: %s", entry.StepID, err))
+			continue
+		}
+		var latest steplibindex.LatestPointer
+		if _, ok := v.readJSON(latestP.FS(), &latest); ok && latest.Latest != entry.LatestVersion {
+			issues = append(issues, violationf(p, "latest_version of %s is %q, %s has %q", entry.StepID, entry.LatestVersion, latestP.FS(), latest.Latest))
+		}
+	}
+	return issues
+}
+
+// checkStepJSON validates v2/steps/<id>/<version>/step.json, including the hash
+// format of its executables. versionsPath is the
 // step's versions.json, where an invalid version string is reported (the version
 // comes from there).
 func (v *validator) checkStepJSON(id, version, versionsPath string) []ValidationError {
@@ -227,26 +293,35 @@ func (v *validator) checkStepJSON(id, version, versionsPath string) []Validation
 	if step.Source.Commit == "" {
 		issues = append(issues, violationf(p, "missing source.commit"))
 	}
+	if step.Executables != nil {
+		for platform, executable := range *step.Executables {
+			// Rejected here rather than by every activation of the step.
+			if _, err := integrity.Parse(executable.Hash); err != nil {
+				issues = append(issues, violationf(p, "executables[%q].hash is invalid: %s", platform, err))
+			}
+		}
+	}
 	return issues
 }
 
 // checkStepInfo validates the step's step-info.json (at infoPath) and that each
 // asset_urls entry is a step-relative path resolving to a real file under stepDir.
-func (v *validator) checkStepInfo(infoPath, stepDir string) []ValidationError {
+// It returns the parsed step info, empty if it is unreadable.
+func (v *validator) checkStepInfo(infoPath, stepDir string) (steplibindex.StepInfo, []ValidationError) {
+	var info steplibindex.StepInfo
 	if _, err := fs.Stat(v.fs, infoPath); err != nil {
 		// step-info.json is mandatory: the generator writes it for every step.
 		v.consume(infoPath)
-		return []ValidationError{violationf(infoPath, "missing or unreadable: %s", err)}
+		return info, []ValidationError{violationf(infoPath, "missing or unreadable: %s", err)}
 	}
-	var info steplibindex.StepInfo
 	if issues, ok := v.readJSON(infoPath, &info); !ok {
-		return issues
+		return steplibindex.StepInfo{}, issues
 	}
 	var issues []ValidationError
 	for _, rel := range info.AssetURLs {
 		issues = append(issues, v.checkAssetURL(infoPath, stepDir, rel)...)
 	}
-	return issues
+	return info, issues
 }
 
 // checkAssetURL validates one asset_urls entry (attributed to infoPath): it must
@@ -297,3 +372,10 @@ func (v *validator) staleFileViolations() []ValidationError {
 	}
 	return issues
 }
+
+// isPreRelease reports whether ver is a pre-release; an unparseable version
+// is reported elsewhere, not here.
+func isPreRelease(ver string) bool {
+	sv, err := models.ParseSemver(ver)
+	return err == nil && sv.IsPreRelease()
+}
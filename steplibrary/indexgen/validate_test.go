@@ -29,6 +29,14 @@ func seedFile(t *testing.T, root, relPath, content string) {
 	require.NoError(t, os.WriteFile(filepath.Join(root, relPath), []byte(content), 0o644))
 }
 
+func replaceInFile(t *testing.T, root, relPath, old, new string) {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join(root, relPath))
+	require.NoError(t, err)
+	require.Contains(t, string(content), old)
+	seedFile(t, root, relPath, strings.Replace(string(content), old, new, 1))
+}
+
 func removeFile(t *testing.T, root, relPath string) {
 	t.Helper()
 	require.NoError(t, os.Remove(filepath.Join(root, relPath)))
@@ -43,6 +51,10 @@ func mustFS(p steplibindex.Path, err error) string {
 	return p.FS()
 }
 
+// multiPlatformDarwinHash is the hash of multi-platform-step's darwin-amd64
+// executable in the fixture steplib.
+const multiPlatformDarwinHash = "sha256-a7310f721466c0c5e4386cfe83f8a6c41254f2c99e272a446e4789df8c04f3d0"
+
 // TestValidate mutates a freshly generated (and therefore valid) inventory and
 // asserts the matching consistency check fires. The clean baseline must produce
 // no violations; every other case proves a specific check. Comparison via the
@@ -97,6 +109,31 @@ func TestValidate(t *testing.T) {
 			},
 			wantPath: "hello-step/latest.json", wantMsg: "different major",
 		},
+		"latest points at a pre-release": {
+			mutate: func(t *testing.T, root string) {
+				seedFile(t, root, mustFS(steplibindex.VersionsPath("hello-step")), `{"step_id": "hello-step", "versions": ["3.0.0-beta.1", "2.0.0", "1.1.0", "1.0.0"]}`)
+				seedFile(t, root, mustFS(steplibindex.LatestPointerPath("hello-step")), `{"step_id": "hello-step", "latest": "3.0.0-beta.1", "latest_by_major": {"1": "1.1.0", "2": "2.0.0", "3": "3.0.0-beta.1"}}`)
+			},
+			wantPath: "hello-step/latest.json", wantMsg: "is a pre-release",
+		},
+		"latest is empty while there are releases": {
+			mutate: func(t *testing.T, root string) {
+				seedFile(t, root, mustFS(steplibindex.LatestPointerPath("hello-step")), `{"step_id": "hello-step", "latest": "", "latest_by_major": {"1": "1.1.0", "2": "2.0.0"}}`)
+			},
+			wantPath: "hello-step/latest.json", wantMsg: "latest is empty",
+		},
+		"latest points at a yanked version": {
+			mutate: func(t *testing.T, root string) {
+				seedFile(t, root, mustFS(steplibindex.StepInfoPath("hello-step")), `{"maintainer": "bitrise", "deprecation": null, "asset_urls": ["assets/icon.svg"], "yanked_versions": {"2.0.0": "broken"}}`)
+			},
+			wantPath: "hello-step/latest.json", wantMsg: "is yanked",
+		},
+		"yanked version missing from versions.json": {
+			mutate: func(t *testing.T, root string) {
+				seedFile(t, root, mustFS(steplibindex.StepInfoPath("hello-step")), `{"maintainer": "bitrise", "deprecation": null, "asset_urls": ["assets/icon.svg"], "yanked_versions": {"9.9.9": "broken"}}`)
+			},
+			wantPath: "hello-step/step-info.json", wantMsg: "yanked version",
+		},
 		"latest.json step_id mismatch": {
 			mutate: func(t *testing.T, root string) {
 				seedFile(t, root, mustFS(steplibindex.LatestPointerPath("hello-step")), `{"step_id": "wrong-id", "latest": "2.0.0", "latest_by_major": {"1": "1.1.0", "2": "2.0.0"}}`)
@@ -113,6 +150,24 @@ func TestValidate(t *testing.T) {
 			mutate:   func(t *testing.T, root string) { removeFile(t, root, mustFS(steplibindex.StepInfoPath("hello-step"))) },
 			wantPath: "hello-step/step-info.json", wantMsg: "missing",
 		},
+		"SRI and multiple executable digests are valid": {
+			mutate: func(t *testing.T, root string) {
+				replaceInFile(t, root, mustFS(steplibindex.StepJSONPath("multi-platform-step", "3.2.1")),
+					multiPlatformDarwinHash, "sha256-8gQK85OfUDO+jKmzYwVbPlMQfEaIujm3HUUphpqcybI= sha384-M7G5scHuhce5TDMHJLR6Z0Yn9QitKJKRa1Yvdan6WrvsEZ1SV6BT4mG2JZti7QNT")
+			},
+		},
+		"malformed executable hash": {
+			mutate: func(t *testing.T, root string) {
+				replaceInFile(t, root, mustFS(steplibindex.StepJSONPath("multi-platform-step", "3.2.1")), multiPlatformDarwinHash, "sha256-a7310f72")
+			},
+			wantPath: "multi-platform-step/3.2.1/step.json", wantMsg: `executables["darwin-amd64"].hash is invalid`,
+		},
+		"executable hash of an unsupported algorithm": {
+			mutate: func(t *testing.T, root string) {
+				replaceInFile(t, root, mustFS(steplibindex.StepJSONPath("multi-platform-step", "3.2.1")), multiPlatformDarwinHash, "md5-3b6b4f1e2e8b8a9e4f7a4b5e6c7d8e9f")
+			},
+			wantPath: "multi-platform-step/3.2.1/step.json", wantMsg: `unsupported algorithm "md5"`,
+		},
 		"step-info asset that does not exist": {
 			mutate: func(t *testing.T, root string) {
 				removeFile(t, root, mustFS(steplibindex.StepAssetPath("hello-step", "icon.svg")))
@@ -150,6 +205,18 @@ func TestValidate(t *testing.T) {
 			},
 			wantPath: "hello-step/assets/extra.svg", wantMsg: "unexpected",
 		},
+		"search.json missing a step": {
+			mutate: func(t *testing.T, root string) {
+				seedFile(t, root, steplibindex.SearchIndexPath().FS(), `{"steps":[{"step_id":"bash-step","latest_version":"1.0.0"}]}`)
+			},
+			wantPath: "search.json", wantMsg: "do not match",
+		},
+		"search.json names a stale latest version": {
+			mutate: func(t *testing.T, root string) {
+				seedFile(t, root, steplibindex.SearchIndexPath().FS(), `{"steps":[{"step_id":"bash-step","latest_version":"1.0.0"},{"step_id":"deprecated-step","latest_version":"1.0.0"},{"step_id":"hello-step","latest_version":"1.1.0"},{"step_id":"multi-platform-step","latest_version":"3.2.1"}]}`)
+			},
+			wantPath: "search.json", wantMsg: "latest_version of hello-step",
+		},
 		"stale file under index/": {
 			mutate: func(t *testing.T, root string) {
 				seedFile(t, root, filepath.Join(steplibindex.VersionDir(), steplibindex.IndexRootFS, "stale.json"), "{}")
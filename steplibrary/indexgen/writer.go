@@ -29,6 +29,10 @@ func (w *writer) writeJSON(relPath string, v any) error {
 		return err
 	}
 	bytes = append(bytes, '\n')
+	return w.writeBytes(relPath, bytes)
+}
+
+func (w *writer) writeBytes(relPath string, bytes []byte) error {
 	full := filepath.Join(w.outputDir, relPath)
 	// Files we author get owner-only perms (no group/other needed).
 	if err := os.MkdirAll(filepath.Dir(full), 0o700); err != nil {
@@ -0,0 +1,86 @@
+package steplibrary
+
+import (
+	"context"
+
+	"github.com/bitrise-io/stepman/models"
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+)
+
+// jsonSource loads the inventory file at p and decodes it into dst. Each API
+// implementation supplies its own (plain HTTP, cached HTTP, …); the helpers
+// below map every API method onto the steplibindex path it mirrors, so the
+// implementations can't drift on layout.
+type jsonSource func(ctx context.Context, p steplibindex.Path, dst any) error
+
+func readMeta(ctx context.Context, src jsonSource, formatVersion int) (steplibindex.Meta, error) {
+	var out steplibindex.Meta
+	if err := src(ctx, steplibindex.MetaPathFor(formatVersion), &out); err != nil {
+		return steplibindex.Meta{}, err
+	}
+	return out, nil
+}
+
+func readAllStepIDs(ctx context.Context, src jsonSource) ([]string, error) {
+	var out steplibindex.StepIDs
+	if err := src(ctx, steplibindex.StepIDsPath(), &out); err != nil {
+		return nil, err
+	}
+	return out.StepIDs, nil
+}
+
+func readSearchIndex(ctx context.Context, src jsonSource) (steplibindex.SearchIndex, error) {
+	var out steplibindex.SearchIndex
+	if err := src(ctx, steplibindex.SearchIndexPath(), &out); err != nil {
+		return steplibindex.SearchIndex{}, err
+	}
+	return out, nil
+}
+
+func readLatestStepVersions(ctx context.Context, src jsonSource, id string) (steplibindex.LatestPointer, error) {
+	p, err := steplibindex.LatestPointerPath(id)
+	if err != nil {
+		return steplibindex.LatestPointer{}, err
+	}
+	var out steplibindex.LatestPointer
+	if err := src(ctx, p, &out); err != nil {
+		return steplibindex.LatestPointer{}, err
+	}
+	return out, nil
+}
+
+func readAllStepVersions(ctx context.Context, src jsonSource, id string) ([]string, error) {
+	p, err := steplibindex.VersionsPath(id)
+	if err != nil {
+		return nil, err
+	}
+	var out steplibindex.Versions
+	if err := src(ctx, p, &out); err != nil {
+		return nil, err
+	}
+	return out.Versions, nil
+}
+
+func readStepGroupInfo(ctx context.Context, src jsonSource, id string) (steplibindex.StepInfo, error) {
+	p, err := steplibindex.StepInfoPath(id)
+	if err != nil {
+		return steplibindex.StepInfo{}, err
+	}
+	var out steplibindex.StepInfo
+	if err := src(ctx, p, &out); err != nil {
+		return steplibindex.StepInfo{}, err
+	}
+	return out, nil
+}
+
+func readStepModel(ctx context.Context, src jsonSource, step ResolvedStepVersion) (models.StepModel, error) {
+	p, err := steplibindex.StepJSONPath(step.ID, step.Version)
+	if err != nil {
+		return models.StepModel{}, err
+	}
+	var out models.StepModel
+	if err := src(ctx, p, &out); err != nil {
+		return models.StepModel{}, err
+	}
+	return out, nil
+}
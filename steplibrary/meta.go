@@ -0,0 +1,73 @@
+package steplibrary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+
+	"github.com/bitrise-io/stepman/internal/httpfetch"
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+)
+
+// ErrUnsupportedFormat is returned (wrapped) when the inventory is published
+// only in a format version this stepman cannot read.
+var ErrUnsupportedFormat = errors.New("unsupported inventory format version")
+
+// inventoryMeta returns the inventory's meta.json, fetching and checking it on
+// first use and reusing it for the rest of the session, so every activation in
+// one session reads the same inventory snapshot's metadata.
+func (c *Client) inventoryMeta(ctx context.Context) (steplibindex.Meta, error) {
+	c.metaMu.Lock()
+	defer c.metaMu.Unlock()
+	if c.meta != nil {
+		return *c.meta, nil
+	}
+	meta, err := c.negotiateFormat(ctx)
+	if err != nil {
+		return steplibindex.Meta{}, err
+	}
+	c.meta = &meta
+	return meta, nil
+}
+
+// negotiateFormat picks this stepman's format version tree out of the
+// side-by-side v<N>/ trees the inventory may host, and fails with an upgrade
+// hint when only a newer format is published.
+func (c *Client) negotiateFormat(ctx context.Context) (steplibindex.Meta, error) {
+	meta, err := c.api.GetMeta(ctx, steplibindex.FormatVersion)
+	if err != nil {
+		if !isNotFound(err) {
+			return steplibindex.Meta{}, fmt.Errorf("fetch inventory metadata: %w", err)
+		}
+		// No tree for our format: tell "not an inventory" apart from "only a
+		// newer format is published".
+		if newer, newerErr := c.api.GetMeta(ctx, steplibindex.FormatVersion+1); newerErr == nil {
+			return steplibindex.Meta{}, newerFormatError(c.inventoryURL, newer.FormatVersion)
+		}
+		return steplibindex.Meta{}, fmt.Errorf("fetch inventory metadata: %w", err)
+	}
+
+	switch {
+	case meta.FormatVersion > steplibindex.FormatVersion:
+		return steplibindex.Meta{}, newerFormatError(c.inventoryURL, meta.FormatVersion)
+	case meta.FormatVersion < steplibindex.FormatVersion:
+		return steplibindex.Meta{}, fmt.Errorf("%w: %s has format version %d, this stepman reads format version %d", ErrUnsupportedFormat, c.inventoryURL, meta.FormatVersion, steplibindex.FormatVersion)
+	}
+	return meta, nil
+}
+
+func newerFormatError(inventoryURL string, formatVersion int) error {
+	return fmt.Errorf("%w: %s has format version %d, but this stepman only supports format version %d: upgrade stepman to use this steplib", ErrUnsupportedFormat, inventoryURL, formatVersion, steplibindex.FormatVersion)
+}
+
+// isNotFound reports whether err means the requested inventory file does not
+// exist, for any API implementation.
+func isNotFound(err error) bool {
+	var statusErr *httpfetch.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code == http.StatusNotFound
+	}
+	return errors.Is(err, fs.ErrNotExist)
+}
@@ -0,0 +1,141 @@
+package steplibrary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/bitrise-io/stepman/models"
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+	"github.com/bitrise-io/stepman/stepman"
+)
+
+// InventoryURLsEnv overrides a default inventory with a comma-separated list
+// of mirrors, tried in order (see MirrorURLs).
+const InventoryURLsEnv = "BITRISE_STEPLIB_INVENTORY_URLS"
+
+// MirrorURLs returns the mirrors of a caller's default inventory: the
+// InventoryURLsEnv list when set, defaults otherwise. It is applied where a
+// default inventory is picked (an inventory library's client, the CLI's
+// inventory flags when not given); NewWithOptions takes its URLs as they are.
+func MirrorURLs(defaults []string) []string {
+	if override := os.Getenv(InventoryURLsEnv); override != "" {
+		return nonBlank(strings.Split(override, ","))
+	}
+	return nonBlank(defaults)
+}
+
+// nonBlank returns the trimmed urls, dropping blank ones.
+func nonBlank(urls []string) []string {
+	var out []string
+	for _, url := range urls {
+		if url = strings.TrimSpace(url); url != "" {
+			out = append(out, url)
+		}
+	}
+	return out
+}
+
+// Mirror is one copy of an inventory, served from URL.
+type Mirror struct {
+	URL string
+	API API
+}
+
+// MirrorAPI reads an inventory from an ordered list of mirrors: each call is
+// answered by the first mirror that succeeds. A mirror that fails with
+// anything but not-found (an outage, a 5xx, a malformed file) is skipped for
+// the rest of the session. A not-found answer doesn't disqualify a mirror,
+// since it may only be lagging behind for that one file.
+type MirrorAPI struct {
+	mirrors []Mirror
+	log     stepman.Logger
+
+	mu     sync.Mutex
+	failed map[string]error
+}
+
+func NewMirrorAPI(mirrors []Mirror, log stepman.Logger) *MirrorAPI {
+	return &MirrorAPI{
+		mirrors: mirrors,
+		log:     log,
+		mu:      sync.Mutex{},
+		failed:  map[string]error{},
+	}
+}
+
+func (m *MirrorAPI) GetMeta(ctx context.Context, formatVersion int) (steplibindex.Meta, error) {
+	return tryMirrors(ctx, m, func(api API) (steplibindex.Meta, error) { return api.GetMeta(ctx, formatVersion) })
+}
+
+func (m *MirrorAPI) GetAllStepIDs(ctx context.Context) ([]string, error) {
+	return tryMirrors(ctx, m, func(api API) ([]string, error) { return api.GetAllStepIDs(ctx) })
+}
+
+func (m *MirrorAPI) GetSearchIndex(ctx context.Context) (steplibindex.SearchIndex, error) {
+	return tryMirrors(ctx, m, func(api API) (steplibindex.SearchIndex, error) { return api.GetSearchIndex(ctx) })
+}
+
+func (m *MirrorAPI) GetLatestStepVersions(ctx context.Context, id string) (steplibindex.LatestPointer, error) {
+	return tryMirrors(ctx, m, func(api API) (steplibindex.LatestPointer, error) { return api.GetLatestStepVersions(ctx, id) })
+}
+
+func (m *MirrorAPI) GetAllStepVersions(ctx context.Context, id string) ([]string, error) {
+	return tryMirrors(ctx, m, func(api API) ([]string, error) { return api.GetAllStepVersions(ctx, id) })
+}
+
+func (m *MirrorAPI) GetStepGroupInfo(ctx context.Context, id string) (steplibindex.StepInfo, error) {
+	return tryMirrors(ctx, m, func(api API) (steplibindex.StepInfo, error) { return api.GetStepGroupInfo(ctx, id) })
+}
+
+func (m *MirrorAPI) GetStepModel(ctx context.Context, step ResolvedStepVersion) (models.StepModel, error) {
+	return tryMirrors(ctx, m, func(api API) (models.StepModel, error) { return api.GetStepModel(ctx, step) })
+}
+
+func (m *MirrorAPI) GetStepAsset(ctx context.Context, id, file string) ([]byte, error) {
+	return tryMirrors(ctx, m, func(api API) ([]byte, error) { return api.GetStepAsset(ctx, id, file) })
+}
+
+// tryMirrors runs call against each usable mirror in order and returns the
+// first success. If none succeeds, the error lists the outcome on every
+// mirror, including those skipped for an earlier failure.
+func tryMirrors[T any](ctx context.Context, m *MirrorAPI, call func(API) (T, error)) (T, error) {
+	var zero T
+	var errs []error
+	for _, mirror := range m.mirrors {
+		if earlier := m.failure(mirror.URL); earlier != nil {
+			errs = append(errs, fmt.Errorf("%s: skipped, failed earlier in this session: %w", mirror.URL, earlier))
+			continue
+		}
+
+		v, err := call(mirror.API)
+		if err == nil {
+			return v, nil
+		}
+		if ctx.Err() != nil {
+			// Cancelled by the caller: not the mirror's fault.
+			return zero, err
+		}
+		if !isNotFound(err) {
+			m.markFailed(mirror.URL, err)
+			m.log.Warnf("Inventory mirror %s failed, skipping it for this session: %s", mirror.URL, err)
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", mirror.URL, err))
+	}
+	return zero, fmt.Errorf("all %d inventory mirrors failed: %w", len(m.mirrors), errors.Join(errs...))
+}
+
+func (m *MirrorAPI) failure(url string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.failed[url]
+}
+
+func (m *MirrorAPI) markFailed(url string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failed[url] = err
+}
@@ -0,0 +1,132 @@
+package steplibrary
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/go-utils/v2/fileutil"
+	"github.com/bitrise-io/stepman/internal/httpfetch"
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingAPI counts the GetAllStepIDs calls reaching the wrapped API.
+type countingAPI struct {
+	API
+	calls *int
+}
+
+func (c countingAPI) GetAllStepIDs(ctx context.Context) ([]string, error) {
+	*c.calls++
+	return c.API.GetAllStepIDs(ctx)
+}
+
+func TestMirrorAPI(t *testing.T) {
+	outage := &httpfetch.StatusError{URL: "https://a.example/v2/index/step_ids.json", Code: 503, Body: "unavailable"}
+	healthy := newFakeAPI()
+	down := newFakeAPI()
+	down.listErr = outage
+	lagging := newFakeAPI()
+	lagging.listErr = fs.ErrNotExist
+
+	t.Run("fails over and skips the failed mirror for the session", func(t *testing.T) {
+		var downCalls, healthyCalls int
+		api := NewMirrorAPI([]Mirror{
+			{URL: "https://a.example", API: countingAPI{API: down, calls: &downCalls}},
+			{URL: "https://b.example", API: countingAPI{API: healthy, calls: &healthyCalls}},
+		}, testLogger{t})
+
+		for range 2 {
+			ids, err := api.GetAllStepIDs(t.Context())
+			require.NoError(t, err)
+			assert.Equal(t, healthy.ids, ids)
+		}
+		assert.Equal(t, 1, downCalls, "failed mirror calls")
+		assert.Equal(t, 2, healthyCalls, "healthy mirror calls")
+	})
+
+	t.Run("not found does not disqualify a mirror", func(t *testing.T) {
+		var laggingCalls, healthyCalls int
+		api := NewMirrorAPI([]Mirror{
+			{URL: "https://a.example", API: countingAPI{API: lagging, calls: &laggingCalls}},
+			{URL: "https://b.example", API: countingAPI{API: healthy, calls: &healthyCalls}},
+		}, testLogger{t})
+
+		for range 2 {
+			_, err := api.GetAllStepIDs(t.Context())
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 2, laggingCalls, "lagging mirror calls")
+	})
+
+	t.Run("error reports every mirror", func(t *testing.T) {
+		api := NewMirrorAPI([]Mirror{
+			{URL: "https://a.example", API: down},
+			{URL: "https://b.example", API: lagging},
+		}, testLogger{t})
+
+		_, err := api.GetAllStepIDs(t.Context())
+		require.ErrorContains(t, err, "all 2 inventory mirrors failed")
+		require.ErrorContains(t, err, "https://a.example: GET https://a.example/v2/index/step_ids.json: unexpected status 503")
+		require.ErrorContains(t, err, "https://b.example: file does not exist")
+
+		_, err = api.GetAllStepIDs(t.Context())
+		require.ErrorContains(t, err, "https://a.example: skipped, failed earlier in this session")
+		require.ErrorIs(t, err, fs.ErrNotExist)
+	})
+
+	t.Run("cancellation does not disqualify a mirror", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		cancelled := newFakeAPI()
+		cancelled.listErr = context.Canceled
+		api := NewMirrorAPI([]Mirror{
+			{URL: "https://a.example", API: cancelled},
+			{URL: "https://b.example", API: healthy},
+		}, testLogger{t})
+
+		_, err := api.GetAllStepIDs(ctx)
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Empty(t, api.failed, "failed mirrors")
+	})
+}
+
+func TestMirrorURLs(t *testing.T) {
+	defaults := []string{"https://a.example", "https://b.example"}
+
+	assert.Equal(t, defaults, MirrorURLs(defaults), "defaults")
+
+	t.Setenv(InventoryURLsEnv, " https://c.example/ ,,https://d.example")
+	assert.Equal(t, []string{"https://c.example/", "https://d.example"}, MirrorURLs(defaults), "env override")
+}
+
+func TestNewWithOptions_ignoresInventoryURLsEnv(t *testing.T) {
+	t.Setenv(InventoryURLsEnv, "https://c.example")
+
+	client := NewWithOptions(testLogger{t}, "", fileutil.NewFileManager(), Options{InventoryURLs: []string{"file:///inventory", " "}, PublicKey: nil})
+	assert.Equal(t, "file:///inventory", client.inventoryURL)
+	assert.IsType(t, &FSAPI{}, client.api, "a single mirror")
+}
+
+func TestNewInventoryReader_inventoryURLsEnv(t *testing.T) {
+	inventoryDir := t.TempDir()
+	updatedAt := time.Date(2026, 5, 15, 12, 0, 0, 0, time.UTC)
+	meta, err := json.Marshal(steplibindex.Meta{FormatVersion: steplibindex.FormatVersion, UpdatedAt: updatedAt})
+	require.NoError(t, err)
+	metaPath := filepath.Join(inventoryDir, filepath.FromSlash(steplibindex.MetaPath().FS()))
+	require.NoError(t, os.MkdirAll(filepath.Dir(metaPath), 0o755))
+	require.NoError(t, os.WriteFile(metaPath, meta, 0o644))
+
+	// The library's own URL is replaced by the mirrors, the first of which is
+	// down.
+	t.Setenv(InventoryURLsEnv, fileURLPrefix+filepath.Join(t.TempDir(), "missing")+","+fileURLPrefix+inventoryDir)
+	got, err := NewInventoryReader().UpdatedAt("https://inventory.invalid", testLogger{t})
+	require.NoError(t, err)
+	assert.True(t, updatedAt.Equal(got), "updated at %s", got)
+}
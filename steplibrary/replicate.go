@@ -0,0 +1,536 @@
+package steplibrary
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitrise-io/go-utils/v2/fileutil"
+	"github.com/bitrise-io/stepman/internal/integrity"
+	"github.com/bitrise-io/stepman/internal/stepstorage"
+	"github.com/bitrise-io/stepman/models"
+	"github.com/bitrise-io/stepman/steplibrary/indexgen"
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+)
+
+// Layout of a replica besides its v2/ inventory tree. The replica is meant to
+// be served as a whole from ReplicateOptions.BaseURL.
+const (
+	// ReplicaStorageDir holds the replicated precompiled executables, at their
+	// original storage URI.
+	ReplicaStorageDir = "storage"
+	// ReplicaSourcesDir holds the replicated step source archives, at
+	// <id>/<version>/step.zip.
+	ReplicaSourcesDir = "step-archives"
+	// ReplicaStateFile records the source inventory and options of the last
+	// successful Replicate, so the next run can skip what didn't change.
+	ReplicaStateFile = "mirror.json"
+)
+
+// replicateWorkers is the number of steps Replicate processes concurrently.
+const replicateWorkers = 10
+
+// ReplicateOptions select what Replicate copies.
+type ReplicateOptions struct {
+	// BaseURL is the https URL the replica will be served from: the storage
+	// URIs of the replicated executables and the zip download location are
+	// rewritten to point under it, so the replica is self-contained. It must be
+	// https, as executables are only ever downloaded over https (see
+	// stepstorage.ExecutableURLs).
+	BaseURL string `json:"base_url"`
+	// StepIDs limits the replica to these steps when set.
+	StepIDs []string `json:"step_ids,omitempty"`
+	// Maintainer limits the replica to the steps of this maintainer when set.
+	Maintainer string `json:"maintainer,omitempty"`
+	// NumMajor limits every step to the versions of its latest NumMajor major
+	// versions when non-zero.
+	NumMajor uint `json:"num_major,omitempty"`
+	// Platforms (<GOOS>-<GOARCH>) whose precompiled executables are
+	// replicated. The executables of other platforms are dropped from the step
+	// definitions.
+	Platforms []string `json:"platforms,omitempty"`
+}
+
+// ReplicateStats summarizes a Replicate run.
+type ReplicateStats struct {
+	// UpToDate is set when the previous replica was already up to date and
+	// nothing was written.
+	UpToDate bool `json:"up_to_date"`
+	Steps    int  `json:"steps"`
+	Versions int  `json:"versions"`
+	// FetchedVersions, DownloadedExecutables and DownloadedSources count what
+	// this run fetched, as opposed to what it reused from the previous replica.
+	FetchedVersions       int `json:"fetched_versions"`
+	DownloadedExecutables int `json:"downloaded_executables"`
+	DownloadedSources     int `json:"downloaded_sources"`
+}
+
+// replicaState is the content of ReplicaStateFile.
+type replicaState struct {
+	InventoryURL string           `json:"inventory_url"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+	Options      ReplicateOptions `json:"options"`
+}
+
+// replicatedStep is the outcome of replicating one step.
+type replicatedStep struct {
+	included bool
+	stats    ReplicateStats
+}
+
+// Replicate copies the inventory, filtered by opts, into outputDir along with
+// the precompiled executables of opts.Platforms and the step source archives,
+// so the replica can be served on its own (e.g. on an air-gapped site). The
+// replica's v2/ tree passes indexgen.Validate; it is unsigned, as rewriting the
+// storage URIs changes the signed files.
+//
+// Replicate is resumable and incremental: downloads land atomically and are
+// kept when a run fails, and a re-run reuses the step versions, executables
+// and sources of the previous replica. When the inventory's meta.json and opts
+// are unchanged since the previous replica, Replicate does nothing.
+func (c *Client) Replicate(ctx context.Context, outputDir string, opts ReplicateOptions) (ReplicateStats, error) {
+	if opts.BaseURL == "" {
+		return ReplicateStats{}, errors.New("no base URL given")
+	}
+	if u, err := url.Parse(opts.BaseURL); err != nil || u.Scheme != "https" || u.Host == "" {
+		return ReplicateStats{}, fmt.Errorf("base URL must be an https URL, executables are not downloaded from anything else: %s", opts.BaseURL)
+	}
+	opts.BaseURL = strings.TrimRight(opts.BaseURL, "/")
+
+	meta, err := c.inventoryMeta(ctx)
+	if err != nil {
+		return ReplicateStats{}, err
+	}
+
+	previous, err := readReplicaState(outputDir)
+	if err != nil {
+		return ReplicateStats{}, err
+	}
+	// The previous replica's step versions were rewritten for its options, so
+	// they are only reused with the same options.
+	reuse := previous != nil && previous.InventoryURL == c.inventoryURL && reflect.DeepEqual(previous.Options, opts)
+	if reuse && previous.UpdatedAt.Equal(meta.UpdatedAt) {
+		c.log.Infof("Replica in %s is up to date", outputDir)
+		return ReplicateStats{UpToDate: true}, nil
+	}
+
+	ids, err := c.api.GetAllStepIDs(ctx)
+	if err != nil {
+		return ReplicateStats{}, fmt.Errorf("fetch step IDs: %w", err)
+	}
+	if len(opts.StepIDs) > 0 {
+		for _, id := range opts.StepIDs {
+			if !slices.Contains(ids, id) {
+				return ReplicateStats{}, fmt.Errorf("step %s is not in the inventory", id)
+			}
+		}
+		ids = slices.Compact(slices.Sorted(slices.Values(opts.StepIDs)))
+	}
+
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		return ReplicateStats{}, fmt.Errorf("create output dir %s: %w", outputDir, err)
+	}
+	staging, err := os.MkdirTemp(outputDir, ".mirror-staging-*")
+	if err != nil {
+		return ReplicateStats{}, fmt.Errorf("create staging dir: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(staging); err != nil {
+			c.log.Warnf("Failed to remove staging dir %s: %s", staging, err)
+		}
+	}()
+
+	replicated := make([]replicatedStep, len(ids))
+	errs := make([]error, len(ids))
+	queue := make(chan int)
+	wg := sync.WaitGroup{}
+	for range min(replicateWorkers, len(ids)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				replicated[i], errs[i] = c.replicateStep(ctx, ids[i], meta, outputDir, staging, opts, reuse)
+			}
+		}()
+	}
+	for i := range ids {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	stats := ReplicateStats{}
+	var includedIDs []string
+	for i, id := range ids {
+		if errs[i] != nil {
+			return ReplicateStats{}, fmt.Errorf("step %s: %w", id, errs[i])
+		}
+		if !replicated[i].included {
+			continue
+		}
+		includedIDs = append(includedIDs, id)
+		stats.Steps++
+		stats.Versions += replicated[i].stats.Versions
+		stats.FetchedVersions += replicated[i].stats.FetchedVersions
+		stats.DownloadedExecutables += replicated[i].stats.DownloadedExecutables
+		stats.DownloadedSources += replicated[i].stats.DownloadedSources
+	}
+	if len(includedIDs) == 0 {
+		return ReplicateStats{}, errors.New("no steps match the filters")
+	}
+
+	if err := c.writeReplicaIndex(ctx, staging, meta, includedIDs, opts); err != nil {
+		return ReplicateStats{}, err
+	}
+	if violations := indexgen.Validate(os.DirFS(staging)); len(violations) > 0 {
+		errs := make([]error, len(violations))
+		for i, v := range violations {
+			errs[i] = v
+		}
+		return ReplicateStats{}, fmt.Errorf("replica failed validation (%d violations):\n%w", len(violations), errors.Join(errs...))
+	}
+
+	// Swap in the new tree, then record the state it was built from.
+	treeDir := filepath.Join(outputDir, steplibindex.VersionDir())
+	if err := os.RemoveAll(treeDir); err != nil {
+		return ReplicateStats{}, fmt.Errorf("clear %s: %w", treeDir, err)
+	}
+	if err := os.Rename(filepath.Join(staging, steplibindex.VersionDir()), treeDir); err != nil {
+		return ReplicateStats{}, fmt.Errorf("publish replica to %s: %w", treeDir, err)
+	}
+	state := replicaState{InventoryURL: c.inventoryURL, UpdatedAt: meta.UpdatedAt, Options: opts}
+	if err := writeReplicaJSON(filepath.Join(outputDir, ReplicaStateFile), state); err != nil {
+		return ReplicateStats{}, err
+	}
+	return stats, nil
+}
+
+// replicateStep writes step id's files into the staging tree and downloads the
+// executables and sources of its versions into outputDir. A step filtered out
+// by opts.Maintainer is reported as not included.
+func (c *Client) replicateStep(ctx context.Context, id string, meta steplibindex.Meta, outputDir, staging string, opts ReplicateOptions, reuse bool) (replicatedStep, error) {
+	info, err := c.api.GetStepGroupInfo(ctx, id)
+	if err != nil {
+		return replicatedStep{}, fmt.Errorf("fetch step info: %w", err)
+	}
+	if opts.Maintainer != "" && info.Maintainer != opts.Maintainer {
+		return replicatedStep{}, nil
+	}
+	latest, err := c.api.GetLatestStepVersions(ctx, id)
+	if err != nil {
+		return replicatedStep{}, fmt.Errorf("fetch latest version: %w", err)
+	}
+	versions, err := c.api.GetAllStepVersions(ctx, id)
+	if err != nil {
+		return replicatedStep{}, fmt.Errorf("fetch versions: %w", err)
+	}
+
+	versions, err = latestMajorVersions(versions, opts.NumMajor)
+	if err != nil {
+		return replicatedStep{}, err
+	}
+	// The API may hand out its cached maps, so filter into new ones.
+	latestByMajor := make(map[string]string, len(latest.LatestByMajor))
+	for major, version := range latest.LatestByMajor {
+		if slices.Contains(versions, version) {
+			latestByMajor[major] = version
+		}
+	}
+	latest.LatestByMajor = latestByMajor
+	if info.YankedVersions != nil {
+		yanked := map[string]string{}
+		for version, reason := range info.YankedVersions {
+			if slices.Contains(versions, version) {
+				yanked[version] = reason
+			}
+		}
+		info.YankedVersions = yanked
+	}
+
+	infoPath, err := steplibindex.StepInfoPath(id)
+	if err != nil {
+		return replicatedStep{}, err
+	}
+	if err := writeReplicaJSON(filepath.Join(staging, infoPath.FS()), info); err != nil {
+		return replicatedStep{}, err
+	}
+	for _, rel := range info.AssetURLs {
+		file := path.Base(rel)
+		assetPath, err := steplibindex.StepAssetPath(id, file)
+		if err != nil {
+			return replicatedStep{}, err
+		}
+		asset, err := c.api.GetStepAsset(ctx, id, file)
+		if err != nil {
+			return replicatedStep{}, fmt.Errorf("fetch asset %s: %w", rel, err)
+		}
+		if err := writeReplicaFile(filepath.Join(staging, assetPath.FS()), asset); err != nil {
+			return replicatedStep{}, err
+		}
+	}
+	latestPath, err := steplibindex.LatestPointerPath(id)
+	if err != nil {
+		return replicatedStep{}, err
+	}
+	if err := writeReplicaJSON(filepath.Join(staging, latestPath.FS()), latest); err != nil {
+		return replicatedStep{}, err
+	}
+	versionsPath, err := steplibindex.VersionsPath(id)
+	if err != nil {
+		return replicatedStep{}, err
+	}
+	if err := writeReplicaJSON(filepath.Join(staging, versionsPath.FS()), steplibindex.Versions{StepID: id, Versions: versions}); err != nil {
+		return replicatedStep{}, err
+	}
+
+	result := replicatedStep{included: true, stats: ReplicateStats{Versions: len(versions)}}
+	for _, version := range versions {
+		stepPath, err := steplibindex.StepJSONPath(id, version)
+		if err != nil {
+			return replicatedStep{}, err
+		}
+		if reuse {
+			// step.json is immutable: the previous replica's copy is current.
+			previous := filepath.Join(outputDir, stepPath.FS())
+			if _, err := os.Stat(previous); err == nil {
+				if err := copyReplicaFile(previous, filepath.Join(staging, stepPath.FS())); err != nil {
+					return replicatedStep{}, err
+				}
+				continue
+			}
+		}
+
+		step, err := c.api.GetStepModel(ctx, ResolvedStepVersion{ID: id, Version: version})
+		if err != nil {
+			return replicatedStep{}, fmt.Errorf("fetch version %s: %w", version, err)
+		}
+		result.stats.FetchedVersions++
+
+		downloaded, err := c.replicateExecutables(ctx, &step, outputDir, opts)
+		if err != nil {
+			return replicatedStep{}, fmt.Errorf("version %s: %w", version, err)
+		}
+		result.stats.DownloadedExecutables += downloaded
+
+		downloaded, err = c.replicateSource(ctx, id, version, step, meta, outputDir)
+		if err != nil {
+			return replicatedStep{}, fmt.Errorf("version %s: %w", version, err)
+		}
+		result.stats.DownloadedSources += downloaded
+
+		if err := writeReplicaJSON(filepath.Join(staging, stepPath.FS()), step); err != nil {
+			return replicatedStep{}, err
+		}
+	}
+	return result, nil
+}
+
+// replicateExecutables downloads the executables of opts.Platforms into the
+// replica's storage dir, drops the other platforms' executables from step and
+// rewrites the storage URIs to point into the replica. It returns the number of
+// downloaded executables; ones already in the replica with a matching hash are
+// kept.
+func (c *Client) replicateExecutables(ctx context.Context, step *models.StepModel, outputDir string, opts ReplicateOptions) (int, error) {
+	if step.Executables == nil {
+		return 0, nil
+	}
+	executables := models.Executables{}
+	downloaded := 0
+	for platform, executable := range *step.Executables {
+		if !slices.Contains(opts.Platforms, platform) {
+			continue
+		}
+		uri, err := replicaStorageURI(executable.StorageURI)
+		if err != nil {
+			return 0, err
+		}
+		dest := filepath.Join(outputDir, ReplicaStorageDir, filepath.FromSlash(uri))
+		expected, err := integrity.Parse(executable.Hash)
+		if err != nil {
+			return 0, fmt.Errorf("%s executable: %w", platform, err)
+		}
+		if err := integrity.VerifyFile(expected, dest); err != nil {
+			urls, err := stepstorage.ExecutableURLs(c.storageURLs, executable)
+			if err != nil {
+				return 0, err
+			}
+			var errs []error
+			for _, url := range urls {
+				if err := c.fetcher.DownloadWithHash(ctx, dest, url, executable.Hash); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				errs = nil
+				break
+			}
+			if errs != nil {
+				return 0, fmt.Errorf("download %s executable: %w", platform, errors.Join(errs...))
+			}
+			downloaded++
+		}
+		executable.StorageURI = opts.BaseURL + "/" + ReplicaStorageDir + "/" + uri
+		executables[platform] = executable
+	}
+	step.Executables = &executables
+	return downloaded, nil
+}
+
+// replicateSource downloads the source archive of the step version from the
+// inventory's zip download location into the replica's sources dir, unless it
+// is already there. Steps of an inventory without a zip location are skipped.
+func (c *Client) replicateSource(ctx context.Context, id, version string, step models.StepModel, meta steplibindex.Meta, outputDir string) (int, error) {
+	locations, err := models.StepDownloadLocations(meta.DownloadLocations, id, version, step)
+	if err != nil {
+		return 0, fmt.Errorf("resolve download locations: %w", err)
+	}
+	dest := filepath.Join(outputDir, ReplicaSourcesDir, id, version, "step.zip")
+	for _, location := range locations {
+		if location.Type != "zip" {
+			continue
+		}
+		if _, err := os.Stat(dest); err == nil {
+			return 0, nil
+		}
+		if err := c.fetcher.Download(ctx, dest, location.Src); err != nil {
+			return 0, fmt.Errorf("download source: %w", err)
+		}
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// writeReplicaIndex writes the replica's meta.json, step_ids.json and
+// search.json for the included steps.
+func (c *Client) writeReplicaIndex(ctx context.Context, staging string, meta steplibindex.Meta, ids []string, opts ReplicateOptions) error {
+	locations := make([]models.DownloadLocationModel, 0, len(meta.DownloadLocations))
+	for _, location := range meta.DownloadLocations {
+		if location.Type == "zip" {
+			location.Src = opts.BaseURL + "/" + ReplicaSourcesDir + "/"
+		}
+		locations = append(locations, location)
+	}
+	meta.DownloadLocations = locations
+	if err := writeReplicaJSON(filepath.Join(staging, steplibindex.MetaPath().FS()), meta); err != nil {
+		return err
+	}
+
+	if err := writeReplicaJSON(filepath.Join(staging, steplibindex.StepIDsPath().FS()), steplibindex.StepIDs{StepIDs: ids}); err != nil {
+		return err
+	}
+
+	index, err := c.api.GetSearchIndex(ctx)
+	if err != nil {
+		return fmt.Errorf("fetch search index: %w", err)
+	}
+	entries := []steplibindex.SearchEntry{}
+	for _, entry := range index.Steps {
+		if slices.Contains(ids, entry.StepID) {
+			entries = append(entries, entry)
+		}
+	}
+	index.Steps = entries
+	return writeReplicaJSON(filepath.Join(staging, steplibindex.SearchIndexPath().FS()), index)
+}
+
+// latestMajorVersions keeps the versions of the numMajor highest major
+// versions, in their original order; all of them when numMajor is 0. Majors
+// are picked among releases, so the latest release's major is always kept.
+func latestMajorVersions(versions []string, numMajor uint) ([]string, error) {
+	if numMajor == 0 {
+		return versions, nil
+	}
+	var majors, releaseMajors []uint64
+	for _, version := range versions {
+		semver, err := models.ParseSemver(version)
+		if err != nil {
+			return nil, fmt.Errorf("parse version %s: %w", version, err)
+		}
+		majors = append(majors, semver.Major)
+		if !semver.IsPreRelease() {
+			releaseMajors = append(releaseMajors, semver.Major)
+		}
+	}
+	if len(releaseMajors) > 0 {
+		majors = releaseMajors
+	}
+	slices.Sort(majors)
+	majors = slices.Compact(majors)
+	majors = majors[max(0, len(majors)-int(numMajor)):]
+
+	var kept []string
+	for _, version := range versions {
+		semver, err := models.ParseSemver(version)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(majors, semver.Major) {
+			kept = append(kept, version)
+		}
+	}
+	return kept, nil
+}
+
+// replicaStorageURI returns the path of an executable under the replica's
+// storage dir: its storage URI, or the path of an absolute one.
+func replicaStorageURI(storageURI string) (string, error) {
+	if strings.Contains(storageURI, "://") {
+		u, err := url.Parse(storageURI)
+		if err != nil {
+			return "", fmt.Errorf("parse storage URI %s: %w", storageURI, err)
+		}
+		storageURI = u.Path
+	}
+	uri := path.Clean(strings.TrimLeft(storageURI, "/"))
+	if !fs.ValidPath(uri) || uri == "." {
+		return "", fmt.Errorf("invalid storage URI: %s", storageURI)
+	}
+	return uri, nil
+}
+
+func readReplicaState(outputDir string) (*replicaState, error) {
+	bytes, err := os.ReadFile(filepath.Join(outputDir, ReplicaStateFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var state replicaState
+	if err := json.Unmarshal(bytes, &state); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", ReplicaStateFile, err)
+	}
+	return &state, nil
+}
+
+// writeReplicaJSON writes v to pth in the generator's JSON format.
+func writeReplicaJSON(pth string, v any) error {
+	bytes, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeReplicaFile(pth, append(bytes, '\n'))
+}
+
+func writeReplicaFile(pth string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(pth), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(pth, content, 0o644)
+}
+
+func copyReplicaFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	return fileutil.NewFileManager().CopyFile(src, dst, &fileutil.CopyOptions{Overwrite: true})
+}
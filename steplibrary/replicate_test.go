@@ -0,0 +1,233 @@
+package steplibrary
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/stepman/internal/httpfetch"
+	"github.com/bitrise-io/stepman/models"
+	"github.com/bitrise-io/stepman/steplibrary/indexgen"
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testReplicaBaseURL = "https://mirror.example.com"
+
+// newReplicateClient returns a newActivateClient whose storage server also
+// serves the step sources, and whose API holds the step assets.
+// It returns the request paths of the storage server.
+func newReplicateClient(t *testing.T) (*Client, func() []string) {
+	var mu sync.Mutex
+	var requested []string
+	storage := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		if strings.HasSuffix(r.URL.Path, "/step.zip") {
+			_, _ = w.Write([]byte("zip"))
+			return
+		}
+		_, _ = w.Write(testExecutable)
+	}))
+	t.Cleanup(storage.Close)
+
+	client := newActivateClient(t, httpfetch.NewWithClient(storage.Client()), []string{storage.URL}, storage.URL+"/zips")
+	api := client.api.(fakeAPI)
+	api.searchIndex = steplibindex.SearchIndex{Steps: []steplibindex.SearchEntry{
+		{StepID: "script", LatestVersion: "3.0.0", Title: "Script", Summary: "Runs a shell script.", Maintainer: "bitrise", TypeTags: []string{}, ProjectTypeTags: []string{}},
+		{StepID: "xcode-test", LatestVersion: "6.0.0", Title: "Xcode Test", Summary: "Runs Xcode tests.", Maintainer: "bitrise", TypeTags: []string{}, ProjectTypeTags: []string{}},
+	}}
+	api.assets = map[string][]byte{"script/icon.svg": []byte("<svg/>")}
+	client.api = api
+
+	return client, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), requested...)
+	}
+}
+
+func TestClient_Replicate(t *testing.T) {
+	client, requested := newReplicateClient(t)
+	outputDir := t.TempDir()
+	opts := ReplicateOptions{BaseURL: testReplicaBaseURL + "/", StepIDs: []string{"script"}, Platforms: []string{testPlatform}}
+
+	stats, err := client.Replicate(t.Context(), outputDir, opts)
+	require.NoError(t, err)
+	assert.Equal(t, ReplicateStats{Steps: 1, Versions: 9, FetchedVersions: 9, DownloadedExecutables: 1, DownloadedSources: 9}, stats)
+	assert.Empty(t, indexgen.Validate(os.DirFS(outputDir)), "replica passes validation")
+
+	assert.FileExists(t, filepath.Join(outputDir, ReplicaStorageDir, "script", "2.4.1", testPlatform))
+	assert.FileExists(t, filepath.Join(outputDir, ReplicaSourcesDir, "script", "2.4.1", "step.zip"))
+
+	stepPath, err := steplibindex.StepJSONPath("script", "2.4.1")
+	require.NoError(t, err)
+	var step models.StepModel
+	readJSONFile(t, filepath.Join(outputDir, stepPath.FS()), &step)
+	require.NotNil(t, step.Executables)
+	assert.Equal(t, testReplicaBaseURL+"/storage/script/2.4.1/"+testPlatform, (*step.Executables)[testPlatform].StorageURI, "storage URI rewritten")
+
+	var meta steplibindex.Meta
+	readJSONFile(t, filepath.Join(outputDir, steplibindex.MetaPath().FS()), &meta)
+	assert.Equal(t, []models.DownloadLocationModel{{Type: "zip", Src: testReplicaBaseURL + "/step-archives/"}}, meta.DownloadLocations, "zip location rewritten")
+
+	var ids steplibindex.StepIDs
+	readJSONFile(t, filepath.Join(outputDir, steplibindex.StepIDsPath().FS()), &ids)
+	assert.Equal(t, []string{"script"}, ids.StepIDs)
+
+	// Unchanged inventory: nothing to do.
+	requestCount := len(requested())
+	stats, err = client.Replicate(t.Context(), outputDir, opts)
+	require.NoError(t, err)
+	assert.Equal(t, ReplicateStats{UpToDate: true}, stats)
+	assert.Len(t, requested(), requestCount, "no downloads when up to date")
+
+	// Updated inventory: the step versions, executables and sources of the
+	// previous replica are reused.
+	api := client.api.(fakeAPI)
+	meta = api.meta[steplibindex.FormatVersion]
+	meta.UpdatedAt = meta.UpdatedAt.Add(time.Hour)
+	api.meta[steplibindex.FormatVersion] = meta
+	client.meta = nil // a new run renegotiates the inventory
+	stats, err = client.Replicate(t.Context(), outputDir, opts)
+	require.NoError(t, err)
+	assert.Equal(t, ReplicateStats{Steps: 1, Versions: 9}, stats)
+	assert.Len(t, requested(), requestCount, "no downloads when resuming")
+	assert.Empty(t, indexgen.Validate(os.DirFS(outputDir)), "updated replica passes validation")
+}
+
+func TestClient_Replicate_assetsFailOver(t *testing.T) {
+	client, _ := newReplicateClient(t)
+	healthy := client.api.(fakeAPI)
+	lagging := healthy
+	lagging.assets = nil
+	client.api = NewMirrorAPI([]Mirror{
+		{URL: "https://a.example", API: lagging},
+		{URL: "https://b.example", API: healthy},
+	}, testLogger{t})
+	outputDir := t.TempDir()
+
+	_, err := client.Replicate(t.Context(), outputDir, ReplicateOptions{BaseURL: testReplicaBaseURL, StepIDs: []string{"script"}})
+	require.NoError(t, err)
+
+	icon, err := steplibindex.StepAssetPath("script", "icon.svg")
+	require.NoError(t, err)
+	content, err := os.ReadFile(filepath.Join(outputDir, icon.FS()))
+	require.NoError(t, err)
+	assert.Equal(t, "<svg/>", string(content))
+}
+
+func TestClient_Replicate_filters(t *testing.T) {
+	cases := map[string]struct {
+		opts         ReplicateOptions
+		yanked       map[string]string
+		wantVersions []string
+		wantYanked   map[string]string
+		wantLatest   map[string]string
+		wantExes     bool
+		wantErr      string
+	}{
+		"latest major": {
+			opts:         ReplicateOptions{BaseURL: testReplicaBaseURL, StepIDs: []string{"script"}, NumMajor: 1},
+			wantVersions: []string{"3.0.0"},
+			wantLatest:   map[string]string{"3": "3.0.0"},
+		},
+		"latest two majors with executables": {
+			opts:         ReplicateOptions{BaseURL: testReplicaBaseURL, StepIDs: []string{"script"}, NumMajor: 2, Platforms: []string{testPlatform}},
+			wantVersions: []string{"2.0.0", "2.4.0", "2.4.1", "3.0.0"},
+			wantLatest:   map[string]string{"2": "2.4.1", "3": "3.0.0"},
+			wantExes:     true,
+		},
+		"yanked versions of dropped majors": {
+			opts:         ReplicateOptions{BaseURL: testReplicaBaseURL, StepIDs: []string{"script"}, NumMajor: 2},
+			yanked:       map[string]string{"1.2.0": "broken", "2.4.0": "broken"},
+			wantVersions: []string{"2.0.0", "2.4.0", "2.4.1", "3.0.0"},
+			wantLatest:   map[string]string{"2": "2.4.1", "3": "3.0.0"},
+			wantYanked:   map[string]string{"2.4.0": "broken"},
+		},
+		"maintainer matches": {
+			opts:         ReplicateOptions{BaseURL: testReplicaBaseURL, StepIDs: []string{"script"}, Maintainer: "bitrise", NumMajor: 1},
+			wantVersions: []string{"3.0.0"},
+			wantLatest:   map[string]string{"3": "3.0.0"},
+		},
+		"maintainer filters out every step": {
+			opts:    ReplicateOptions{BaseURL: testReplicaBaseURL, StepIDs: []string{"script"}, Maintainer: "community"},
+			wantErr: "no steps match the filters",
+		},
+		"unknown step": {
+			opts:    ReplicateOptions{BaseURL: testReplicaBaseURL, StepIDs: []string{"missing"}},
+			wantErr: "step missing is not in the inventory",
+		},
+		"no base URL": {
+			opts:    ReplicateOptions{StepIDs: []string{"script"}},
+			wantErr: "no base URL given",
+		},
+		"file base URL": {
+			opts:    ReplicateOptions{BaseURL: "file:///srv/mirror", StepIDs: []string{"script"}},
+			wantErr: "base URL must be an https URL, executables are not downloaded from anything else: file:///srv/mirror",
+		},
+		"http base URL": {
+			opts:    ReplicateOptions{BaseURL: "http://mirror.example.com", StepIDs: []string{"script"}},
+			wantErr: "base URL must be an https URL, executables are not downloaded from anything else: http://mirror.example.com",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			client, _ := newReplicateClient(t)
+			api := client.api.(fakeAPI)
+			groupInfo := api.groupInfo["script"]
+			groupInfo.YankedVersions = tc.yanked
+			api.groupInfo["script"] = groupInfo
+			outputDir := t.TempDir()
+
+			_, err := client.Replicate(t.Context(), outputDir, tc.opts)
+			if tc.wantErr != "" {
+				require.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Empty(t, indexgen.Validate(os.DirFS(outputDir)))
+
+			versionsPath, err := steplibindex.VersionsPath("script")
+			require.NoError(t, err)
+			var versions steplibindex.Versions
+			readJSONFile(t, filepath.Join(outputDir, versionsPath.FS()), &versions)
+			assert.Equal(t, tc.wantVersions, versions.Versions)
+
+			latestPath, err := steplibindex.LatestPointerPath("script")
+			require.NoError(t, err)
+			var latest steplibindex.LatestPointer
+			readJSONFile(t, filepath.Join(outputDir, latestPath.FS()), &latest)
+			assert.Equal(t, tc.wantLatest, latest.LatestByMajor)
+
+			infoPath, err := steplibindex.StepInfoPath("script")
+			require.NoError(t, err)
+			var info steplibindex.StepInfo
+			readJSONFile(t, filepath.Join(outputDir, infoPath.FS()), &info)
+			assert.Equal(t, tc.wantYanked, info.YankedVersions)
+
+			stepPath, err := steplibindex.StepJSONPath("script", "3.0.0")
+			require.NoError(t, err)
+			var step models.StepModel
+			readJSONFile(t, filepath.Join(outputDir, stepPath.FS()), &step)
+			require.NotNil(t, step.Executables)
+			assert.Equal(t, tc.wantExes, len(*step.Executables) > 0, "executables")
+		})
+	}
+}
+
+func readJSONFile(t *testing.T, pth string, v any) {
+	t.Helper()
+	bytes, err := os.ReadFile(pth)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(bytes, v))
+}
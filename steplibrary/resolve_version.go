@@ -7,6 +7,7 @@ import (
 	"path"
 	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/bitrise-io/stepman/models"
 	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
@@ -43,7 +44,7 @@ func (c *Client) getStepVersionInfo(ctx context.Context, stepID, version string)
 		return models.StepInfoModel{}, ResolvedStepVersion{}, fmt.Errorf("fetching group info of `%s`: %w", stepID, err)
 	}
 
-	resolvedVersion, err := c.resolveVersion(ctx, stepID, version, versionConstraint, latestVersions)
+	resolvedVersion, err := c.resolveVersion(ctx, stepID, version, versionConstraint, latestVersions, groupInfo.YankedVersions)
 	if err != nil {
 		return models.StepInfoModel{}, ResolvedStepVersion{}, err
 	}
@@ -61,9 +62,15 @@ func (c *Client) getStepVersionInfo(ctx context.Context, stepID, version string)
 
 // resolveVersion turns a parsed version constraint into a concrete version
 // string, fetching the step's version list when the constraint needs it.
-func (c *Client) resolveVersion(ctx context.Context, stepID, version string, constraint models.VersionConstraint, latestVersions steplibindex.LatestPointer) (string, error) {
+// Pre-releases and yanked versions only resolve when pinned: indexgen leaves
+// them out of the latest.json pointers, and resolveMinorLocked and resolveRange
+// skip them. A pinned yanked version resolves with a warning.
+func (c *Client) resolveVersion(ctx context.Context, stepID, version string, constraint models.VersionConstraint, latestVersions steplibindex.LatestPointer, yanked map[string]string) (string, error) {
 	switch constraint.VersionLockType {
 	case models.Latest:
+		if latestVersions.Latest == "" {
+			return "", fmt.Errorf("%s steplib does not contain a release of %s step, pin one of its pre-releases", c.inventoryURL, stepID)
+		}
 		return latestVersions.Latest, nil
 	case models.Fixed:
 		resolved := constraint.Version.String()
@@ -76,6 +83,9 @@ func (c *Client) resolveVersion(ctx context.Context, stepID, version string, con
 		if !slices.Contains(allVersions, resolved) {
 			return "", fmt.Errorf("%s steplib does not contain %s step %s version", c.inventoryURL, stepID, resolved)
 		}
+		if reason, ok := yanked[resolved]; ok {
+			c.log.Warnf("Step %s@%s is yanked: %s", stepID, resolved, reason)
+		}
 		return resolved, nil
 	case models.MajorLocked:
 		majorKey := strconv.FormatUint(constraint.Version.Major, 10)
@@ -89,7 +99,17 @@ func (c *Client) resolveVersion(ctx context.Context, stepID, version string, con
 		if err != nil {
 			return "", fmt.Errorf("fetching all versions of `%s`: %w", stepID, err)
 		}
-		resolved, err := resolveMinorLocked(allVersions, constraint.Version)
+		resolved, err := resolveMinorLocked(withoutYanked(allVersions, yanked), constraint.Version)
+		if err != nil {
+			return "", fmt.Errorf("%s steplib: %w", c.inventoryURL, err)
+		}
+		return resolved, nil
+	case models.Range, models.Caret, models.Tilde:
+		allVersions, err := c.api.GetAllStepVersions(ctx, stepID)
+		if err != nil {
+			return "", fmt.Errorf("fetching all versions of `%s`: %w", stepID, err)
+		}
+		resolved, err := resolveRange(withoutYanked(allVersions, yanked), constraint)
 		if err != nil {
 			return "", fmt.Errorf("%s steplib: %w", c.inventoryURL, err)
 		}
@@ -116,6 +136,7 @@ func toStepGroupInfoModel(info steplibindex.StepInfo) models.StepGroupInfoModel
 		AssetURLs:      assetURLs,
 		RemovalDate:    "",
 		DeprecateNotes: "",
+		YankedVersions: info.YankedVersions,
 	}
 	if info.Deprecation != nil {
 		out.RemovalDate = info.Deprecation.RemovalDate
@@ -124,6 +145,20 @@ func toStepGroupInfoModel(info steplibindex.StepInfo) models.StepGroupInfoModel
 	return out
 }
 
+// withoutYanked returns the versions that are not yanked.
+func withoutYanked(versions []string, yanked map[string]string) []string {
+	if len(yanked) == 0 {
+		return versions
+	}
+	out := make([]string, 0, len(versions))
+	for _, v := range versions {
+		if _, ok := yanked[v]; !ok {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
 // resolveMinorLocked picks the highest patch within `versions` matching the
 // constraint's Major+Minor. An unparseable entry is an error — versions.json is
 // expected to hold only valid semver.
@@ -143,3 +178,35 @@ func resolveMinorLocked(versions []string, constraint models.Semver) (string, er
 	}
 	return best.String(), nil
 }
+
+// resolveRange picks the highest version within `versions` satisfying a
+// Range, Caret or Tilde constraint. Like resolveMinorLocked, an unparseable
+// entry is an error.
+func resolveRange(versions []string, constraint models.VersionConstraint) (string, error) {
+	best := ""
+	var bestSemver models.Semver
+	for _, raw := range versions {
+		sv, err := models.ParseSemver(raw)
+		if err != nil {
+			return "", fmt.Errorf("parse version %q: %w", raw, err)
+		}
+		if !constraint.Matches(sv) {
+			continue
+		}
+		if best == "" || models.CmpSemver(sv, bestSemver) > 0 {
+			best, bestSemver = raw, sv
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("no version matches %s", describeRange(constraint))
+	}
+	return best, nil
+}
+
+func describeRange(constraint models.VersionConstraint) string {
+	comparators := make([]string, 0, len(constraint.Comparators))
+	for _, comparator := range constraint.Comparators {
+		comparators = append(comparators, comparator.String())
+	}
+	return strings.Join(comparators, " ")
+}
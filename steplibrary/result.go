@@ -1,8 +1,22 @@
 package steplibrary
 
-import "github.com/bitrise-io/stepman/models"
+import (
+	"time"
+
+	"github.com/bitrise-io/stepman/models"
+)
 
 type ActivateResult struct {
 	StepInfo    models.StepInfoModel
 	StepYMLPath string
+
+	// ExecutablePath is the precompiled step executable ActivateStep
+	// installed, or empty if the step was activated from source.
+	ExecutablePath string
+
+	// SteplibCommitSHA and InventoryUpdatedAt identify the inventory snapshot
+	// the step was resolved against (from meta.json), so build logs can record
+	// it. SteplibCommitSHA is empty if the inventory didn't publish one.
+	SteplibCommitSHA   string
+	InventoryUpdatedAt time.Time
 }
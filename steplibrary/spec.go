@@ -0,0 +1,163 @@
+package steplibrary
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitrise-io/go-utils/v2/fileutil"
+	"github.com/bitrise-io/stepman/models"
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+	"github.com/bitrise-io/stepman/stepman"
+)
+
+const (
+	// specFormatVersion is the format_version of a V1 spec.json.
+	specFormatVersion = "1.0.0"
+	// specWorkers is the number of steps StepCollection fetches concurrently.
+	specWorkers = 10
+)
+
+// inventoryReader implements stepman.InventoryReader, so stepman can set up
+// libraries from a V2 inventory (see stepman.InventoryURIPrefix).
+type inventoryReader struct{}
+
+// NewInventoryReader returns the stepman.InventoryReader to set up inventory
+// libraries with (see stepman.SetupLibraryWithReader).
+func NewInventoryReader() stepman.InventoryReader {
+	return inventoryReader{}
+}
+
+func (inventoryReader) UpdatedAt(inventoryURL string, log stepman.Logger) (time.Time, error) {
+	client, err := newInventoryClient(inventoryURL, log)
+	if err != nil {
+		return time.Time{}, err
+	}
+	meta, err := client.inventoryMeta(context.Background())
+	if err != nil {
+		return time.Time{}, err
+	}
+	return meta.UpdatedAt, nil
+}
+
+func (inventoryReader) StepCollection(inventoryURL string, log stepman.Logger) (models.StepCollectionModel, error) {
+	client, err := newInventoryClient(inventoryURL, log)
+	if err != nil {
+		return models.StepCollectionModel{}, err
+	}
+	return client.StepCollection(context.Background())
+}
+
+// newInventoryClient builds the client of a library's inventory, verified with
+// the PublicKeyEnv key if set. The InventoryURLsEnv mirrors, when set, replace
+// inventoryURL (see MirrorURLs).
+func newInventoryClient(inventoryURL string, log stepman.Logger) (*Client, error) {
+	publicKey, err := PublicKeyFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	opts := Options{InventoryURLs: MirrorURLs([]string{inventoryURL}), PublicKey: publicKey}
+	return NewWithOptions(log, stepman.InventoryURIPrefix+inventoryURL, fileutil.NewFileManager(), opts), nil
+}
+
+// StepCollection rebuilds the V1 spec.json (models.StepCollectionModel) from
+// the inventory: every version of every step, with the group info rebuilt from
+// step-info.json. It bridges V1 clients that only read spec.json to a V2
+// inventory. Asset URLs point to the inventory's assets on its primary mirror.
+//
+// V1 clients read any version's step model straight from spec.json, so every
+// version's step.json is fetched: a first setup costs one request per step
+// version, specWorkers at a time. Per-version files are immutable and cached
+// for good (see CachedAPI), so a rebuild after an inventory update only
+// revalidates the index files and fetches the versions published since.
+func (c *Client) StepCollection(ctx context.Context) (models.StepCollectionModel, error) {
+	meta, err := c.inventoryMeta(ctx)
+	if err != nil {
+		return models.StepCollectionModel{}, err
+	}
+	ids, err := c.api.GetAllStepIDs(ctx)
+	if err != nil {
+		return models.StepCollectionModel{}, fmt.Errorf("fetch step IDs: %w", err)
+	}
+
+	baseURL := strings.TrimRight(c.inventoryURL, "/")
+	groups := make([]models.StepGroupModel, len(ids))
+	errs := make([]error, len(ids))
+	queue := make(chan int)
+	wg := sync.WaitGroup{}
+	for range min(specWorkers, len(ids)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				groups[i], errs[i] = c.stepGroup(ctx, ids[i], baseURL)
+			}
+		}()
+	}
+	for i := range ids {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	collection := models.StepCollectionModel{
+		FormatVersion:         specFormatVersion,
+		GeneratedAtTimeStamp:  meta.UpdatedAt.Unix(),
+		SteplibSource:         meta.SteplibSource,
+		DownloadLocations:     meta.DownloadLocations,
+		AssetsDownloadBaseURI: baseURL + "/" + path.Join(steplibindex.VersionDir(), steplibindex.StepsRootFS),
+		Steps:                 make(models.StepHash, len(ids)),
+	}
+	for i, id := range ids {
+		if errs[i] != nil {
+			return models.StepCollectionModel{}, fmt.Errorf("step %s: %w", id, errs[i])
+		}
+		collection.Steps[id] = groups[i]
+	}
+	return collection, nil
+}
+
+// stepGroup fetches every version of step id into a V1 step group. Asset URLs
+// are made absolute by prefixing baseURL.
+func (c *Client) stepGroup(ctx context.Context, id, baseURL string) (models.StepGroupModel, error) {
+	info, err := c.api.GetStepGroupInfo(ctx, id)
+	if err != nil {
+		return models.StepGroupModel{}, fmt.Errorf("fetch step info: %w", err)
+	}
+	latest, err := c.api.GetLatestStepVersions(ctx, id)
+	if err != nil {
+		return models.StepGroupModel{}, fmt.Errorf("fetch latest version: %w", err)
+	}
+	versions, err := c.api.GetAllStepVersions(ctx, id)
+	if err != nil {
+		return models.StepGroupModel{}, fmt.Errorf("fetch versions: %w", err)
+	}
+
+	groupInfo := toStepGroupInfoModel(info)
+	for file := range groupInfo.AssetURLs {
+		assetPath, err := steplibindex.StepAssetPath(id, file)
+		if err != nil {
+			return models.StepGroupModel{}, err
+		}
+		groupInfo.AssetURLs[file] = baseURL + assetPath.URL()
+	}
+
+	group := models.StepGroupModel{
+		Info:                groupInfo,
+		LatestVersionNumber: latest.Latest,
+		Versions:            make(map[string]models.StepModel, len(versions)),
+	}
+	for _, version := range versions {
+		step, err := c.api.GetStepModel(ctx, ResolvedStepVersion{ID: id, Version: version})
+		if err != nil {
+			return models.StepGroupModel{}, fmt.Errorf("fetch version %s: %w", version, err)
+		}
+		// V1 spec.json repeats the group's asset URLs in every version.
+		step.AssetURLs = groupInfo.AssetURLs
+		group.Versions[version] = step
+	}
+	return group, nil
+}
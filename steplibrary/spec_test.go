@@ -0,0 +1,121 @@
+package steplibrary
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/stepman/models"
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_StepCollection(t *testing.T) {
+	api := newFakeAPI()
+	api.ids = []string{"script"}
+	client := &Client{log: nil, inventoryURL: "https://steplib.example/", api: api, fileManager: nil}
+
+	got, err := client.StepCollection(t.Context())
+	require.NoError(t, err)
+
+	assert.Equal(t, "1.0.0", got.FormatVersion)
+	assert.Equal(t, time.Date(2026, 5, 15, 12, 0, 0, 0, time.UTC).Unix(), got.GeneratedAtTimeStamp)
+	assert.Equal(t, "https://steplib.example/v2/steps", got.AssetsDownloadBaseURI)
+	require.Contains(t, got.Steps, "script")
+
+	script := got.Steps["script"]
+	assert.Equal(t, "3.0.0", script.LatestVersionNumber)
+	wantAssets := map[string]string{"icon.svg": "https://steplib.example/v2/steps/script/assets/icon.svg"}
+	assert.Equal(t, models.StepGroupInfoModel{Maintainer: "bitrise", AssetURLs: wantAssets}, script.Info)
+	assert.Len(t, script.Versions, len(api.allVersions["script"]))
+	for version, step := range script.Versions {
+		assert.Equal(t, "Script", *step.Title, version)
+		assert.Equal(t, wantAssets, step.AssetURLs, version)
+	}
+
+	// The converted collection resolves versions like a V1 spec.json.
+	resolved, stepFound, versionFound := got.GetStepVersion("script", "2")
+	require.True(t, stepFound && versionFound)
+	assert.Equal(t, "2.4.1", resolved.Version)
+}
+
+func TestClient_StepCollection_step_error(t *testing.T) {
+	// newFakeAPI lists xcode-test but has no files for it.
+	client := &Client{log: nil, inventoryURL: "https://steplib.example", api: newFakeAPI(), fileManager: nil}
+
+	_, err := client.StepCollection(t.Context())
+	require.ErrorContains(t, err, "step xcode-test: fetch step info")
+}
+
+func TestClient_StepCollection_largeIndex(t *testing.T) {
+	const stepCount, versionCount = 100, 30
+	inv := newCountingInventory()
+	inv.files = map[string]string{
+		steplibindex.MetaPath().URL(): `{"format_version":2,"updated_at":"2026-05-15T12:00:00Z"}`,
+	}
+	var ids []string
+	for s := range stepCount {
+		id := fmt.Sprintf("step-%03d", s)
+		ids = append(ids, id)
+		var versions []string
+		for v := versionCount - 1; v >= 0; v-- {
+			version := fmt.Sprintf("1.%d.0", v)
+			versions = append(versions, version)
+			stepJSON, err := steplibindex.StepJSONPath(id, version)
+			require.NoError(t, err)
+			inv.files[stepJSON.URL()] = fmt.Sprintf(`{"title":%q}`, id+"@"+version)
+		}
+		latest, err := steplibindex.LatestPointerPath(id)
+		require.NoError(t, err)
+		inv.files[latest.URL()] = fmt.Sprintf(`{"step_id":%q,"latest":%q,"latest_by_major":{"1":%q}}`, id, versions[0], versions[0])
+		versionsPath, err := steplibindex.VersionsPath(id)
+		require.NoError(t, err)
+		inv.files[versionsPath.URL()] = fmt.Sprintf(`{"step_id":%q,"versions":["%s"]}`, id, strings.Join(versions, `","`))
+		info, err := steplibindex.StepInfoPath(id)
+		require.NoError(t, err)
+		inv.files[info.URL()] = `{"maintainer":"community","deprecation":null,"asset_urls":[]}`
+	}
+	idsJSON, err := json.Marshal(steplibindex.StepIDs{StepIDs: ids})
+	require.NoError(t, err)
+	inv.files[steplibindex.StepIDsPath().URL()] = string(idsJSON)
+	srv := httptest.NewServer(inv)
+	t.Cleanup(srv.Close)
+
+	stepJSONRequests := func() int {
+		inv.mu.Lock()
+		defer inv.mu.Unlock()
+		count := 0
+		for pth, n := range inv.requests {
+			if strings.HasSuffix(pth, "/step.json") {
+				count += n
+			}
+		}
+		return count
+	}
+
+	cacheDir := t.TempDir()
+	now := time.Date(2026, 5, 15, 12, 0, 0, 0, time.UTC)
+	for round := range 2 {
+		// A fresh client per round, as each stepman run builds its own.
+		client := &Client{log: testLogger{t}, inventoryURL: srv.URL, api: newTestCachedAPI(t, srv, cacheDir, &now), fileManager: nil}
+		got, err := client.StepCollection(t.Context())
+		require.NoError(t, err, "round %d", round)
+		require.Len(t, got.Steps, stepCount, "round %d", round)
+		for _, id := range []string{ids[0], ids[stepCount-1]} {
+			group := got.Steps[id]
+			assert.Len(t, group.Versions, versionCount, "round %d: %s", round, id)
+			assert.Equal(t, "1.29.0", group.LatestVersionNumber, "round %d: %s", round, id)
+			assert.Equal(t, id+"@1.3.0", *group.Versions["1.3.0"].Title, "round %d: %s", round, id)
+		}
+		// Past the index TTL: the rebuild revalidates the index files only.
+		now = now.Add(24 * time.Hour)
+	}
+
+	assert.Equal(t, stepCount*versionCount, stepJSONRequests(), "each version's step.json is fetched once across rebuilds")
+	_, notModified := inv.counts(steplibindex.StepIDsPath().URL())
+	assert.Equal(t, 1, notModified, "the rebuild revalidates step_ids.json")
+}
@@ -6,6 +6,7 @@ import (
 	"net/url"
 	"path"
 	"strings"
+	"time"
 )
 
 // Paths to every file in the V2 inventory tree. There must be exactly one
@@ -52,6 +53,27 @@ func (p Path) FS() string { return p.fs }
 // URL returns the absolute, percent-escaped URL path.
 func (p Path) URL() string { return p.url }
 
+// Immutable reports whether the file never changes once published. See
+// IsImmutableFS.
+func (p Path) Immutable() bool { return IsImmutableFS(p.fs) }
+
+// IsImmutableFS reports whether the inventory file at the slash-separated
+// fsPath is immutable: only the per-version files under
+// v2/steps/<id>/<version>/ are. Everything else — meta.json, index/, and the
+// per-step step-info.json and assets/ — can be rewritten by a later generation
+// (a new release, a deprecation), so caches must revalidate it.
+func IsImmutableFS(fsPath string) bool {
+	parts := strings.Split(fsPath, "/")
+	return len(parts) == 5 &&
+		parts[0] == VersionDir() &&
+		parts[1] == StepsRootFS &&
+		parts[3] != "assets"
+}
+
+// DefaultIndexTTL is how long a mutable inventory file (see IsImmutableFS) may
+// be cached before it is revalidated.
+const DefaultIndexTTL = 5 * time.Minute
+
 // seg is one path segment. Dynamic segments (step id, version, asset file) are
 // validated and percent-escaped in the URL form; static ones are taken verbatim.
 type seg struct {
@@ -106,11 +128,29 @@ func staticPath(segs ...string) Path {
 }
 
 // MetaPath is v2/meta.json.
-func MetaPath() Path { return staticPath("meta.json") }
+func MetaPath() Path { return MetaPathFor(FormatVersion) }
+
+// MetaPathFor is v<N>/meta.json of format version N. meta.json is the one file
+// every format version's tree has, so it is how a reader discovers which
+// format versions an inventory hosts.
+func MetaPathFor(formatVersion int) Path {
+	joined := path.Join(VersionDirFor(formatVersion), "meta.json")
+	return Path{fs: joined, url: "/" + joined}
+}
+
+// ManifestPath is v2/manifest.json, the digest manifest of a signed inventory.
+func ManifestPath() Path { return staticPath("manifest.json") }
+
+// ManifestSignaturePath is v2/manifest.json.sig, the ed25519 signature of
+// manifest.json's exact bytes.
+func ManifestSignaturePath() Path { return staticPath("manifest.json.sig") }
 
 // StepIDsPath is v2/index/step_ids.json.
 func StepIDsPath() Path { return staticPath(IndexRootFS, "step_ids.json") }
 
+// SearchIndexPath is v2/index/search.json.
+func SearchIndexPath() Path { return staticPath(IndexRootFS, "search.json") }
+
 // LatestPointerPath is v2/index/steps/<id>/latest.json.
 func LatestPointerPath(stepID string) (Path, error) {
 	return build(lit(IndexRootFS), lit("steps"), dyn(stepID), lit("latest.json"))
@@ -45,6 +45,11 @@ func TestStaticPaths(t *testing.T) {
 	assert.Equal(t, "/v2/meta.json", MetaPath().URL(), "MetaPath URL")
 	assert.Equal(t, "v2/index/step_ids.json", StepIDsPath().FS(), "StepIDsPath FS")
 	assert.Equal(t, "/v2/index/step_ids.json", StepIDsPath().URL(), "StepIDsPath URL")
+	assert.Equal(t, "/v2/index/search.json", SearchIndexPath().URL(), "SearchIndexPath URL")
+	assert.Equal(t, "v2/manifest.json", ManifestPath().FS(), "ManifestPath FS")
+	assert.Equal(t, "/v2/manifest.json.sig", ManifestSignaturePath().URL(), "ManifestSignaturePath URL")
+	assert.Equal(t, "v3/meta.json", MetaPathFor(3).FS(), "MetaPathFor(3) FS")
+	assert.Equal(t, "/v3/meta.json", MetaPathFor(3).URL(), "MetaPathFor(3) URL")
 }
 
 // TestPaths_rejectsUnsafeSegments is the security-grade check: a dynamic segment
@@ -82,3 +87,27 @@ func TestDirPaths(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "v2/steps/git-clone/assets", assetDir, "StepAssetDirFS")
 }
+
+// TestImmutable locks in which files caches may keep without revalidation:
+// only the per-version step files.
+func TestImmutable(t *testing.T) {
+	stepJSON, err := StepJSONPath("git-clone", "1.0.0")
+	require.NoError(t, err)
+	assert.True(t, stepJSON.Immutable(), "step.json")
+
+	info, err := StepInfoPath("git-clone")
+	require.NoError(t, err)
+	assert.False(t, info.Immutable(), "step-info.json")
+
+	asset, err := StepAssetPath("git-clone", "icon.svg")
+	require.NoError(t, err)
+	assert.False(t, asset.Immutable(), "asset")
+
+	latest, err := LatestPointerPath("git-clone")
+	require.NoError(t, err)
+	assert.False(t, latest.Immutable(), "latest.json")
+
+	assert.False(t, MetaPath().Immutable(), "meta.json")
+	assert.False(t, StepIDsPath().Immutable(), "step_ids.json")
+	assert.True(t, IsImmutableFS("v2/steps/git-clone/1.0.0/src.zip"), "any per-version file")
+}
@@ -0,0 +1,68 @@
+package steplibindex
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Signed inventories carry manifest.json (see Manifest) and manifest.json.sig.
+// Keys and signatures travel as standard base64: a public key is the 32-byte
+// ed25519 key, a private key either the 32-byte seed or the 64-byte key, and
+// manifest.json.sig the 64-byte signature.
+
+// Digest returns the manifest digest of a file's content: "sha256-<hex>".
+func Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256-" + hex.EncodeToString(sum[:])
+}
+
+// SignManifest returns the manifest.json.sig content for manifestJSON.
+func SignManifest(key ed25519.PrivateKey, manifestJSON []byte) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifestJSON)) + "\n")
+}
+
+// VerifyManifest checks that sig (manifest.json.sig content) is key's signature
+// of manifestJSON.
+func VerifyManifest(key ed25519.PublicKey, manifestJSON, sig []byte) error {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil {
+		return fmt.Errorf("decode manifest signature: %w", err)
+	}
+	if !ed25519.Verify(key, manifestJSON, raw) {
+		return errors.New("manifest signature does not match the public key")
+	}
+	return nil
+}
+
+// ParsePublicKey decodes a base64 ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("decode public key: %w", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key is %d bytes, expected %d", len(raw), ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// ParsePrivateKey decodes a base64 ed25519 private key, given either as its
+// seed or as the full private key.
+func ParsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("decode private key: %w", err)
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	}
+	return nil, fmt.Errorf("private key is %d bytes, expected %d (seed) or %d", len(raw), ed25519.SeedSize, ed25519.PrivateKeySize)
+}
@@ -0,0 +1,55 @@
+package steplibindex
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignManifest_VerifyManifest(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	key := ed25519.NewKeyFromSeed(seed)
+	public := key.Public().(ed25519.PublicKey)
+	manifest := []byte(`{"files":{"v2/meta.json":"sha256-00"}}` + "\n")
+
+	sig := SignManifest(key, manifest)
+	require.NoError(t, VerifyManifest(public, manifest, sig), "genuine manifest")
+
+	tampered := []byte(`{"files":{"v2/meta.json":"sha256-01"}}` + "\n")
+	require.ErrorContains(t, VerifyManifest(public, tampered, sig), "does not match", "tampered manifest")
+
+	otherPublic := ed25519.NewKeyFromSeed(append(make([]byte, ed25519.SeedSize-1), 1)).Public().(ed25519.PublicKey)
+	require.ErrorContains(t, VerifyManifest(otherPublic, manifest, sig), "does not match", "other key")
+
+	require.ErrorContains(t, VerifyManifest(public, manifest, []byte("not base64!")), "decode manifest signature")
+}
+
+func TestParseKeys(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	seed[0] = 7
+	key := ed25519.NewKeyFromSeed(seed)
+
+	fromSeed, err := ParsePrivateKey(base64.StdEncoding.EncodeToString(seed))
+	require.NoError(t, err, "seed")
+	assert.Equal(t, key, fromSeed, "key from seed")
+
+	fromFull, err := ParsePrivateKey(base64.StdEncoding.EncodeToString(key) + "\n")
+	require.NoError(t, err, "full key")
+	assert.Equal(t, key, fromFull, "key from full key")
+
+	public, err := ParsePublicKey(base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)))
+	require.NoError(t, err, "public key")
+	assert.Equal(t, key.Public(), public, "public key")
+
+	_, err = ParsePublicKey(base64.StdEncoding.EncodeToString(seed[:16]))
+	require.ErrorContains(t, err, "16 bytes")
+	_, err = ParsePrivateKey("%%%")
+	require.ErrorContains(t, err, "decode private key")
+}
+
+func TestDigest(t *testing.T) {
+	assert.Equal(t, "sha256-e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", Digest(nil))
+}
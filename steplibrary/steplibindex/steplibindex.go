@@ -14,14 +14,15 @@
 // Wire shape is kept stable: index and per-step collections always render as
 // [] or {} (never null) and nullable values (Deprecation, published_at) as
 // null. Optional inventory metadata (Meta.steplib_commit_sha,
-// Meta.steplib_source, Meta.download_locations) uses omitempty and is dropped
-// when empty.
+// Meta.steplib_source, Meta.download_locations) and StepInfo.yanked_versions
+// use omitempty and are dropped when empty.
 package steplibindex
 
 import (
 	"fmt"
 	"time"
 
+	"github.com/bitrise-io/go-utils/pointers"
 	"github.com/bitrise-io/stepman/models"
 )
 
@@ -32,7 +33,12 @@ const FormatVersion = 2
 // VersionDir is the inventory's top-level directory for this format version
 // (e.g. "v2"). The whole tree is rooted under it so multiple format versions
 // can be hosted side by side; readers prefix their fetch URLs with it.
-func VersionDir() string { return fmt.Sprintf("v%d", FormatVersion) }
+func VersionDir() string { return VersionDirFor(FormatVersion) }
+
+// VersionDirFor is the top-level directory of the given format version's tree
+// (e.g. 3 -> "v3"). Readers use it to probe for side-by-side trees of format
+// versions other than their own.
+func VersionDirFor(formatVersion int) string { return fmt.Sprintf("v%d", formatVersion) }
 
 // Meta is the inventory-level metadata file at the inventory root (meta.json).
 // It is the only file that carries FormatVersion.
@@ -48,10 +54,13 @@ type Meta struct {
 // Holds facts that span versions: maintainer, deprecation, asset list.
 // Asset URLs are relative to the file's own location for self-containment.
 // Deprecation is null for active steps; AssetURLs is [] for steps with no assets.
+// YankedVersions maps the yanked versions to the reason they were yanked: they
+// stay in versions.json for exact pins, but the latest pointers skip them.
 type StepInfo struct {
-	Maintainer  string       `json:"maintainer"`
-	Deprecation *Deprecation `json:"deprecation"`
-	AssetURLs   []string     `json:"asset_urls"`
+	Maintainer     string            `json:"maintainer"`
+	Deprecation    *Deprecation      `json:"deprecation"`
+	AssetURLs      []string          `json:"asset_urls"`
+	YankedVersions map[string]string `json:"yanked_versions,omitempty"`
 }
 
 // Deprecation carries the removal_date and notes for a deprecated step.
@@ -82,3 +91,53 @@ type Versions struct {
 	StepID   string   `json:"step_id"`
 	Versions []string `json:"versions"`
 }
+
+// Manifest is manifest.json, present in signed inventories only: the digest
+// ("sha256-<hex>", see Digest) of every other file in the format-version tree,
+// keyed by its FS path. manifest.json.sig holds the ed25519 signature of
+// manifest.json's exact bytes (see VerifyManifest).
+type Manifest struct {
+	Files map[string]string `json:"files"`
+}
+
+// SearchIndex is index/search.json: one entry per step, describing its latest
+// version, so a client can search the whole steplib in a single fetch. Steps
+// are sorted by StepID.
+type SearchIndex struct {
+	Steps []SearchEntry `json:"steps"`
+}
+
+// SearchEntry is one step in SearchIndex. Tag lists always render as [].
+type SearchEntry struct {
+	StepID          string   `json:"step_id"`
+	LatestVersion   string   `json:"latest_version"`
+	Title           string   `json:"title"`
+	Summary         string   `json:"summary"`
+	TypeTags        []string `json:"type_tags"`
+	ProjectTypeTags []string `json:"project_type_tags"`
+	HostOSTags      []string `json:"host_os_tags"`
+	Maintainer      string   `json:"maintainer"`
+	Deprecated      bool     `json:"deprecated"`
+}
+
+// NewSearchEntry builds the SearchEntry of step id from its latest version's
+// model.
+func NewSearchEntry(id, latestVersion string, latest models.StepModel, maintainer string, deprecated bool) SearchEntry {
+	orEmpty := func(tags []string) []string {
+		if tags == nil {
+			return []string{}
+		}
+		return tags
+	}
+	return SearchEntry{
+		StepID:          id,
+		LatestVersion:   latestVersion,
+		Title:           pointers.String(latest.Title),
+		Summary:         pointers.String(latest.Summary),
+		TypeTags:        orEmpty(latest.TypeTags),
+		ProjectTypeTags: orEmpty(latest.ProjectTypeTags),
+		HostOSTags:      orEmpty(latest.HostOsTags),
+		Maintainer:      maintainer,
+		Deprecated:      deprecated,
+	}
+}
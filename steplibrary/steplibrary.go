@@ -2,58 +2,192 @@ package steplibrary
 
 import (
 	"context"
+	"crypto/ed25519"
 	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/bitrise-io/go-utils/v2/fileutil"
 	"github.com/bitrise-io/stepman/internal/httpfetch"
+	"github.com/bitrise-io/stepman/internal/stepstorage"
+	"github.com/bitrise-io/stepman/models"
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
 	"github.com/bitrise-io/stepman/stepman"
 	"gopkg.in/yaml.v2"
 )
 
+// fileURLPrefix marks an inventory URL that points to a local directory.
+const fileURLPrefix = "file://"
+
 type Client struct {
-	log          stepman.Logger
+	log stepman.Logger
+	// steplibURI is the steplib identity, the library of the client's entries
+	// in stepman.lock.
+	steplibURI string
+	// inventoryURL names the inventory in messages and results: the first of
+	// its mirrors.
 	inventoryURL string
 	api          API
 	fileManager  fileutil.FileManager
+
+	// fetcher downloads precompiled executables from storageURLs; platform
+	// selects which of a step's executables applies (<GOOS>-<GOARCH>).
+	// A positive hedgeDelay races the storage URLs (see
+	// stepstorage.HedgeDelayEnv) instead of trying them in order.
+	fetcher     httpfetch.Client
+	storageURLs []string
+	hedgeDelay  time.Duration
+	platform    string
+
+	metaMu sync.Mutex
+	meta   *steplibindex.Meta
 }
 
 type ActivateOutputPaths struct {
 	YMLPath, CodePath string
 }
 
-// New builds a Client. steplibURI is the steplib identity; inventoryURL is
-// the base URL the V2 inventory JSON is fetched from.
+// Options configures a Client built by NewWithOptions.
+type Options struct {
+	// InventoryURLs are the base URLs of the V2 inventory's mirrors, tried in
+	// order (see MirrorAPI). Blank entries are dropped.
+	InventoryURLs []string
+	// PublicKey, when non-nil, makes the client accept only files covered by
+	// the inventory's signed manifest (see HTTPAPI.VerifyWith and
+	// PublicKeyFromEnv).
+	PublicKey ed25519.PublicKey
+}
+
+// New builds a Client of the V2 inventory at inventoryURL. steplibURI is the
+// steplib identity. Use NewWithOptions for mirrors and signed inventories.
 func New(log stepman.Logger, steplibURI, inventoryURL string, fileManager fileutil.FileManager) *Client {
+	return NewWithOptions(log, steplibURI, fileManager, Options{InventoryURLs: []string{inventoryURL}, PublicKey: nil})
+}
+
+// NewWithOptions builds a Client of the inventory configured by opts. A
+// file:// mirror is read straight from disk (see FSAPI); any other is fetched
+// over HTTP, with responses cached under the stepman dir (see CachedAPI).
+func NewWithOptions(log stepman.Logger, steplibURI string, fileManager fileutil.FileManager, opts Options) *Client {
+	fetcher := httpfetch.NewClient(log)
+	urls := nonBlank(opts.InventoryURLs)
+	hedgeDelay, err := stepstorage.HedgeDelay()
+	if err != nil {
+		log.Warnf("%s, downloading executables from one storage URL at a time", err)
+	}
+	primary := ""
+	if len(urls) > 0 {
+		primary = urls[0]
+	}
 	return &Client{
 		log:          log,
-		inventoryURL: inventoryURL,
-		api:          NewHTTPAPI(inventoryURL, httpfetch.NewClient(log)),
+		steplibURI:   steplibURI,
+		inventoryURL: primary,
+		api:          newMirroredAPI(log, urls, opts.PublicKey, fetcher),
 		fileManager:  fileManager,
+		fetcher:      fetcher,
+		storageURLs:  stepstorage.BaseURLs(),
+		hedgeDelay:   hedgeDelay,
+		platform:     fmt.Sprintf("%s-%s", runtime.GOOS, runtime.GOARCH),
+		metaMu:       sync.Mutex{},
+		meta:         nil,
+	}
+}
+
+// newMirroredAPI builds the API for urls: a single mirror's API as is, or a
+// MirrorAPI failing over between several.
+func newMirroredAPI(log stepman.Logger, urls []string, publicKey ed25519.PublicKey, fetcher httpfetch.Client) API {
+	if len(urls) == 1 {
+		return newAPI(log, urls[0], publicKey, fetcher)
+	}
+	mirrors := make([]Mirror, 0, len(urls))
+	for _, url := range urls {
+		mirrors = append(mirrors, Mirror{URL: url, API: newAPI(log, url, publicKey, fetcher)})
+	}
+	return NewMirrorAPI(mirrors, log)
+}
+
+// newAPI picks the API implementation for inventoryURL's scheme.
+func newAPI(log stepman.Logger, inventoryURL string, publicKey ed25519.PublicKey, fetcher httpfetch.Client) API {
+	if dir, ok := strings.CutPrefix(inventoryURL, fileURLPrefix); ok {
+		fsAPI := NewFSAPI(os.DirFS(dir))
+		if publicKey != nil {
+			fsAPI.VerifyWith(publicKey)
+		}
+		return fsAPI
 	}
+	httpAPI := NewHTTPAPI(inventoryURL, fetcher)
+	if publicKey != nil {
+		httpAPI.VerifyWith(publicKey)
+	}
+	return NewCachedAPI(httpAPI, stepman.GetInventoryCacheDirPath(), steplibindex.DefaultIndexTTL, log)
 }
 
 func (c *Client) FetchStepMetadata(ctx context.Context, stepID, version string, outputPaths ActivateOutputPaths) (ActivateResult, error) {
-	stepInfo, resolved, err := c.getStepVersionInfo(ctx, stepID, version)
+	result, _, _, err := c.fetchStep(ctx, stepID, version, outputPaths)
+	return result, err
+}
+
+// SearchIndex returns the inventory's search index (index/search.json), for
+// searching the steplib without fetching every step.
+func (c *Client) SearchIndex(ctx context.Context) (steplibindex.SearchIndex, error) {
+	if _, err := c.inventoryMeta(ctx); err != nil {
+		return steplibindex.SearchIndex{}, err
+	}
+	index, err := c.api.GetSearchIndex(ctx)
 	if err != nil {
-		return ActivateResult{}, fmt.Errorf("resolve step version: %w", err)
+		return steplibindex.SearchIndex{}, fmt.Errorf("fetch search index: %w", err)
 	}
+	return index, nil
+}
 
+// StepModel resolves version and returns the step definition of the
+// resolved version, without writing it to disk.
+func (c *Client) StepModel(ctx context.Context, stepID, version string) (models.StepInfoModel, models.StepModel, error) {
+	if _, err := c.inventoryMeta(ctx); err != nil {
+		return models.StepInfoModel{}, models.StepModel{}, err
+	}
+	stepInfo, resolved, err := c.getStepVersionInfo(ctx, stepID, version)
+	if err != nil {
+		return models.StepInfoModel{}, models.StepModel{}, fmt.Errorf("resolve step version: %w", err)
+	}
 	stepModel, err := c.api.GetStepModel(ctx, resolved)
 	if err != nil {
-		return ActivateResult{}, fmt.Errorf("fetch step definition: %w", err)
+		return models.StepInfoModel{}, models.StepModel{}, fmt.Errorf("fetch step definition: %w", err)
+	}
+	return stepInfo, stepModel, nil
+}
+
+// fetchStep resolves version, writes the step's step.yml to
+// outputPaths.YMLPath and returns the step model alongside the result, for
+// callers that go on to activate the step.
+func (c *Client) fetchStep(ctx context.Context, stepID, version string, outputPaths ActivateOutputPaths) (ActivateResult, models.StepModel, steplibindex.Meta, error) {
+	meta, err := c.inventoryMeta(ctx)
+	if err != nil {
+		return ActivateResult{}, models.StepModel{}, steplibindex.Meta{}, err
+	}
+
+	stepInfo, stepModel, err := c.StepModel(ctx, stepID, version)
+	if err != nil {
+		return ActivateResult{}, models.StepModel{}, steplibindex.Meta{}, err
 	}
 
 	stepYML, err := yaml.Marshal(stepModel)
 	if err != nil {
-		return ActivateResult{}, fmt.Errorf("marshal step model to YAML: %w", err)
+		return ActivateResult{}, models.StepModel{}, steplibindex.Meta{}, fmt.Errorf("marshal step model to YAML: %w", err)
 	}
 
 	if err := c.fileManager.WriteBytes(outputPaths.YMLPath, stepYML); err != nil {
-		return ActivateResult{}, fmt.Errorf("write step.yml: %w", err)
+		return ActivateResult{}, models.StepModel{}, steplibindex.Meta{}, fmt.Errorf("write step.yml: %w", err)
 	}
 
 	return ActivateResult{
-		StepInfo:    stepInfo,
-		StepYMLPath: outputPaths.YMLPath,
-	}, nil
+		StepInfo:           stepInfo,
+		StepYMLPath:        outputPaths.YMLPath,
+		ExecutablePath:     "",
+		SteplibCommitSHA:   meta.SteplibCommitSHA,
+		InventoryUpdatedAt: meta.UpdatedAt,
+	}, stepModel, meta, nil
 }
@@ -1,7 +1,15 @@
 package steplibrary
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/bitrise-io/go-utils/v2/fileutil"
 
 	"github.com/bitrise-io/stepman/models"
 	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
@@ -43,6 +51,17 @@ func TestToStepGroupInfoModel(t *testing.T) {
 				DeprecateNotes: "Replaced by `new-step`.",
 			},
 		},
+		"yanked versions carry over": {
+			given: steplibindex.StepInfo{
+				Maintainer:     "bitrise",
+				AssetURLs:      nil,
+				YankedVersions: map[string]string{"2.4.1": "broken"},
+			},
+			want: models.StepGroupInfoModel{
+				Maintainer:     "bitrise",
+				YankedVersions: map[string]string{"2.4.1": "broken"},
+			},
+		},
 	}
 
 	for name, tc := range cases {
@@ -54,9 +73,9 @@ func TestToStepGroupInfoModel(t *testing.T) {
 }
 
 func TestSteplib_getStepVersionInfo(t *testing.T) {
-	// newFakeAPI's "script" step exposes versions 1.0.0, 1.1.5, 1.2.0, 2.0.0,
-	// 2.4.0, 2.4.1, 3.0.0 with latest 3.0.0 and latest-by-major 1→1.2.0,
-	// 2→2.4.1, 3→3.0.0.
+	// newFakeAPI's "script" step exposes versions 1.0.0, 1.1.5, 1.1.6-rc.1,
+	// 1.2.0, 2.0.0, 2.4.0, 2.4.1, 3.0.0, 4.0.0-beta.1 with latest 3.0.0 and
+	// latest-by-major 1→1.2.0, 2→2.4.1, 3→3.0.0.
 	cases := map[string]struct {
 		stepID      string
 		version     string
@@ -69,6 +88,13 @@ func TestSteplib_getStepVersionInfo(t *testing.T) {
 		"major-locked picks latest of major": {stepID: "script", version: "2", wantVersion: "2.4.1"},
 		"minor-locked picks highest patch":   {stepID: "script", version: "1.1", wantVersion: "1.1.5"},
 		"major-locked with no such major":    {stepID: "script", version: "9", wantErr: true},
+		"pinned pre-release":                 {stepID: "script", version: "4.0.0-beta.1", wantVersion: "4.0.0-beta.1"},
+		"major-locked skips pre-releases":    {stepID: "script", version: "4", wantErr: true},
+		"range":                              {stepID: "script", version: ">=2.0.0 <3", wantVersion: "2.4.1"},
+		"caret":                              {stepID: "script", version: "^1.1", wantVersion: "1.2.0"},
+		"tilde skips pre-releases":           {stepID: "script", version: "~1.1", wantVersion: "1.1.5"},
+		"exclusion":                          {stepID: "script", version: "!=3.0.0", wantVersion: "2.4.1"},
+		"range with no match":                {stepID: "script", version: ">=5", wantErr: true},
 		"unknown step id":                    {stepID: "nope", version: "1.0.0", wantErr: true},
 		"empty step id":                      {stepID: "", version: "1.0.0", wantErr: true},
 		"invalid version constraint":         {stepID: "script", version: "1.2.3.4", wantErr: true},
@@ -99,6 +125,78 @@ func TestSteplib_getStepVersionInfo(t *testing.T) {
 	}
 }
 
+func TestSteplib_getStepVersionInfo_preReleasesOnly(t *testing.T) {
+	api := newFakeAPI()
+	api.ids = []string{"script", "rc-step"}
+	api.latestVersions["rc-step"] = steplibindex.LatestPointer{StepID: "rc-step", Latest: "", LatestByMajor: map[string]string{}}
+	api.allVersions["rc-step"] = []string{"1.0.0-rc.1", "1.0.0-beta.1"}
+	api.groupInfo["rc-step"] = steplibindex.StepInfo{Maintainer: "community", Deprecation: nil, AssetURLs: []string{}}
+	client := &Client{log: nil, inventoryURL: "https://steplib.example", api: api, fileManager: nil}
+
+	_, _, err := client.getStepVersionInfo(t.Context(), "rc-step", "")
+	require.ErrorContains(t, err, "does not contain a release of rc-step step", "latest")
+	_, _, err = client.getStepVersionInfo(t.Context(), "rc-step", "1")
+	require.Error(t, err, "major-locked")
+
+	stepInfo, resolved, err := client.getStepVersionInfo(t.Context(), "rc-step", "1.0.0-rc.1")
+	require.NoError(t, err, "pinned")
+	assert.Equal(t, "1.0.0-rc.1", resolved.Version, "resolved version")
+	assert.Empty(t, stepInfo.LatestVersion, "step info latest version")
+}
+
+func TestSteplib_getStepVersionInfo_yanked(t *testing.T) {
+	cases := map[string]struct {
+		version     string
+		wantVersion string
+		wantWarning bool
+		wantErr     bool
+	}{
+		"pinned yanked version warns":       {version: "2.4.1", wantVersion: "2.4.1", wantWarning: true},
+		"pinned version that is not yanked": {version: "2.4.0", wantVersion: "2.4.0"},
+		"minor-locked skips yanked":         {version: "2.4", wantVersion: "2.4.0"},
+		"range skips yanked":                {version: ">=2.0.0 <3", wantVersion: "2.4.0"},
+		"minor-locked with only yanked":     {version: "1.1", wantErr: true},
+	}
+
+	api := newFakeAPI()
+	info := api.groupInfo["script"]
+	info.YankedVersions = map[string]string{"2.4.1": "crashes on macOS", "1.1.5": "broken"}
+	api.groupInfo["script"] = info
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			log := &recordingLogger{testLogger: testLogger{t}, warnings: nil}
+			client := &Client{log: log, inventoryURL: "https://steplib.example", api: api}
+
+			stepInfo, resolved, err := client.getStepVersionInfo(t.Context(), "script", tc.version)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantVersion, resolved.Version)
+			assert.Equal(t, info.YankedVersions, stepInfo.GroupInfo.YankedVersions)
+			if tc.wantWarning {
+				require.Len(t, log.warnings, 1)
+				assert.Contains(t, log.warnings[0], "crashes on macOS")
+			} else {
+				assert.Empty(t, log.warnings)
+			}
+		})
+	}
+}
+
+// recordingLogger is a testLogger that also records the warnings.
+type recordingLogger struct {
+	testLogger
+	warnings []string
+}
+
+func (l *recordingLogger) Warnf(f string, a ...any) {
+	l.warnings = append(l.warnings, fmt.Sprintf(f, a...))
+	l.testLogger.Warnf(f, a...)
+}
+
 func TestResolveMinorLocked(t *testing.T) {
 	cases := map[string]struct {
 		versions []string
@@ -111,6 +209,8 @@ func TestResolveMinorLocked(t *testing.T) {
 		"single matching version":              {versions: []string{"2.4.1"}, major: 2, minor: 4, want: "2.4.1"},
 		"no version matches the minor":         {versions: []string{"1.0.0", "2.0.0"}, major: 1, minor: 5, wantErr: true},
 		"unparseable version is an error":      {versions: []string{"not-semver"}, major: 1, minor: 0, wantErr: true},
+		"skips pre-releases":                   {versions: []string{"1.1.0", "1.1.1-rc.1", "1.2.0-beta.1"}, major: 1, minor: 1, want: "1.1.0"},
+		"pre-releases only":                    {versions: []string{"1.2.0-beta.1"}, major: 1, minor: 2, wantErr: true},
 	}
 
 	for name, tc := range cases {
@@ -125,3 +225,96 @@ func TestResolveMinorLocked(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_inventoryMeta_negotiatesFormat(t *testing.T) {
+	current := steplibindex.FormatVersion
+	cases := map[string]struct {
+		meta            map[int]steplibindex.Meta
+		wantErr         string
+		wantUnsupported bool
+	}{
+		"current format": {
+			meta: map[int]steplibindex.Meta{current: {FormatVersion: current}},
+		},
+		"newer format published in our dir": {
+			meta:            map[int]steplibindex.Meta{current: {FormatVersion: current + 1}},
+			wantErr:         "upgrade stepman",
+			wantUnsupported: true,
+		},
+		"only a newer format dir is published": {
+			meta:            map[int]steplibindex.Meta{current + 1: {FormatVersion: current + 1}},
+			wantErr:         "upgrade stepman",
+			wantUnsupported: true,
+		},
+		"older format": {
+			meta:            map[int]steplibindex.Meta{current: {FormatVersion: current - 1}},
+			wantErr:         "this stepman reads format version",
+			wantUnsupported: true,
+		},
+		"no inventory at all": {
+			meta:    map[int]steplibindex.Meta{},
+			wantErr: "fetch inventory metadata",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			api := newFakeAPI()
+			api.meta = tc.meta
+			client := &Client{inventoryURL: "https://steplib.example", api: api}
+
+			got, err := client.inventoryMeta(t.Context())
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				assert.Equal(t, tc.wantUnsupported, errors.Is(err, ErrUnsupportedFormat), "ErrUnsupportedFormat")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, current, got.FormatVersion, "FormatVersion")
+		})
+	}
+}
+
+func TestClient_FetchStepMetadata_recordsInventorySnapshot(t *testing.T) {
+	client := &Client{
+		log:          nil,
+		inventoryURL: "https://steplib.example",
+		api:          newFakeAPI(),
+		fileManager:  fileutil.NewFileManager(),
+	}
+	ymlPath := filepath.Join(t.TempDir(), "step.yml")
+
+	got, err := client.FetchStepMetadata(t.Context(), "script", "2", ActivateOutputPaths{YMLPath: ymlPath})
+	require.NoError(t, err)
+
+	assert.Equal(t, "2.4.1", got.StepInfo.Version, "resolved version")
+	assert.Equal(t, ymlPath, got.StepYMLPath, "StepYMLPath")
+	assert.Equal(t, "deadbeefcafef00d", got.SteplibCommitSHA, "SteplibCommitSHA")
+	assert.Equal(t, time.Date(2026, 5, 15, 12, 0, 0, 0, time.UTC), got.InventoryUpdatedAt, "InventoryUpdatedAt")
+	assert.FileExists(t, ymlPath, "step.yml written")
+}
+
+func TestPublicKeyFromEnv(t *testing.T) {
+	publicKey := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)).Public().(ed25519.PublicKey)
+	tests := map[string]struct {
+		value       string
+		want        ed25519.PublicKey
+		expectedErr string
+	}{
+		"unset":     {value: "", want: nil},
+		"key":       {value: base64.StdEncoding.EncodeToString(publicKey), want: publicKey},
+		"short key": {value: "AAAA", expectedErr: "invalid BITRISE_STEPLIB_INVENTORY_PUBLIC_KEY: public key is 3 bytes, expected 32"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(PublicKeyEnv, tt.value)
+			got, err := PublicKeyFromEnv()
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
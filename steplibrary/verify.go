@@ -0,0 +1,103 @@
+package steplibrary
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/bitrise-io/stepman/steplibrary/steplibindex"
+)
+
+// PublicKeyEnv configures the public key V2 inventories must be signed with:
+// a base64 ed25519 key (see steplibindex.ParsePublicKey).
+const PublicKeyEnv = "BITRISE_STEPLIB_INVENTORY_PUBLIC_KEY"
+
+// PublicKeyFromEnv returns the PublicKeyEnv key, and nil when it's unset,
+// which means inventories aren't verified.
+func PublicKeyFromEnv() (ed25519.PublicKey, error) {
+	value := os.Getenv(PublicKeyEnv)
+	if value == "" {
+		return nil, nil
+	}
+	publicKey, err := steplibindex.ParsePublicKey(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", PublicKeyEnv, err)
+	}
+	return publicKey, nil
+}
+
+// ErrVerification is returned (wrapped) when an inventory file can't be
+// verified against the inventory's signed manifest: the manifest is missing,
+// its signature doesn't match the configured public key, or the file is not
+// listed in it or has a different digest.
+var ErrVerification = errors.New("inventory verification failed")
+
+// rawSource loads the exact bytes of the inventory file at p.
+type rawSource func(ctx context.Context, p steplibindex.Path) ([]byte, error)
+
+// verifier checks inventory files against the inventory's manifest.json,
+// whose signature it checks with publicKey. The manifest is fetched on first
+// use and reused for the rest of the session.
+type verifier struct {
+	publicKey ed25519.PublicKey
+	read      rawSource
+
+	mu       sync.Mutex
+	manifest *steplibindex.Manifest
+}
+
+func newVerifier(publicKey ed25519.PublicKey, read rawSource) *verifier {
+	return &verifier{publicKey: publicKey, read: read, mu: sync.Mutex{}, manifest: nil}
+}
+
+// verify checks body, the content of the file at p. Files outside this
+// format version's tree (the v<N+1>/meta.json probe) aren't covered by its
+// manifest and are let through; they only ever produce an upgrade hint.
+func (v *verifier) verify(ctx context.Context, p steplibindex.Path, body []byte) error {
+	if !strings.HasPrefix(p.FS(), steplibindex.VersionDir()+"/") {
+		return nil
+	}
+	manifest, err := v.loadManifest(ctx)
+	if err != nil {
+		return err
+	}
+	want, ok := manifest.Files[p.FS()]
+	if !ok {
+		return fmt.Errorf("%w: %s is not listed in the signed manifest", ErrVerification, p.FS())
+	}
+	if got := steplibindex.Digest(body); got != want {
+		return fmt.Errorf("%w: %s has digest %s, the signed manifest lists %s", ErrVerification, p.FS(), got, want)
+	}
+	return nil
+}
+
+func (v *verifier) loadManifest(ctx context.Context) (steplibindex.Manifest, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.manifest != nil {
+		return *v.manifest, nil
+	}
+
+	manifestJSON, err := v.read(ctx, steplibindex.ManifestPath())
+	if err != nil {
+		return steplibindex.Manifest{}, fmt.Errorf("%w: fetch manifest.json: %w", ErrVerification, err)
+	}
+	sig, err := v.read(ctx, steplibindex.ManifestSignaturePath())
+	if err != nil {
+		return steplibindex.Manifest{}, fmt.Errorf("%w: fetch manifest.json.sig: %w", ErrVerification, err)
+	}
+	if err := steplibindex.VerifyManifest(v.publicKey, manifestJSON, sig); err != nil {
+		return steplibindex.Manifest{}, fmt.Errorf("%w: %w", ErrVerification, err)
+	}
+	var manifest steplibindex.Manifest
+	if err := json.Unmarshal(manifestJSON, &manifest); err != nil {
+		return steplibindex.Manifest{}, fmt.Errorf("%w: decode manifest.json: %w", ErrVerification, err)
+	}
+	v.manifest = &manifest
+	return manifest, nil
+}
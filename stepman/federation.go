@@ -0,0 +1,122 @@
+package stepman
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// SearchPathEnvKey is the env var of the steplib search path: a
+// comma-separated list of steplib URIs in order of precedence, e.g. a private
+// steplib overlaying the public one. Step IDs without a steplib source resolve
+// against the first library of the path containing the step.
+const SearchPathEnvKey = "STEPMAN_STEPLIB_SEARCH_PATH"
+
+// LibraryResolution explains which library of a search path a step resolved
+// to.
+type LibraryResolution struct {
+	ID         string   `json:"id"`
+	SearchPath []string `json:"search_path"`
+	// Library is the first library of the search path containing the step.
+	Library string `json:"library"`
+	// Shadowed are the later libraries of the search path also containing the
+	// step, which Library takes precedence over.
+	Shadowed []string `json:"shadowed"`
+}
+
+// SearchPath returns the steplib search path configured in SearchPathEnvKey,
+// followed by defaultLibrary (if not empty and not on the path yet) as the
+// last layer. It is empty if no search path is configured.
+func SearchPath(defaultLibrary string) []string {
+	var searchPath []string
+	for _, library := range strings.Split(os.Getenv(SearchPathEnvKey), ",") {
+		if library = strings.TrimSpace(library); library != "" && !slices.Contains(searchPath, library) {
+			searchPath = append(searchPath, library)
+		}
+	}
+	if len(searchPath) > 0 && defaultLibrary != "" && !slices.Contains(searchPath, defaultLibrary) {
+		searchPath = append(searchPath, defaultLibrary)
+	}
+	return searchPath
+}
+
+// LibraryResolver resolves step IDs against a search path. It sets up and
+// reads each library once, then answers from memory, so it is meant to live
+// as long as the process.
+type LibraryResolver struct {
+	reader InventoryReader
+
+	mu sync.Mutex
+	// steps holds the step IDs of each library read so far.
+	steps map[string]map[string]bool
+}
+
+// NewLibraryResolver returns a LibraryResolver setting up inventory libraries
+// with reader.
+func NewLibraryResolver(reader InventoryReader) *LibraryResolver {
+	return &LibraryResolver{reader: reader, mu: sync.Mutex{}, steps: map[string]map[string]bool{}}
+}
+
+// Resolve returns the first library of searchPath containing the step,
+// setting up the libraries it checks if needed.
+func (r *LibraryResolver) Resolve(searchPath []string, id string, log Logger) (string, error) {
+	for _, library := range searchPath {
+		found, err := r.containsStep(library, id, log)
+		if err != nil {
+			return "", err
+		}
+		if found {
+			log.Debugf("Step %s resolved to library %s", id, library)
+			return library, nil
+		}
+	}
+	return "", fmt.Errorf("none of the libraries of the search path (%s) contain step %s", strings.Join(searchPath, ", "), id)
+}
+
+// Explain is Resolve which also checks the rest of the search path for
+// libraries the resolved one shadows.
+func (r *LibraryResolver) Explain(searchPath []string, id string, log Logger) (LibraryResolution, error) {
+	resolution := LibraryResolution{ID: id, SearchPath: searchPath, Library: "", Shadowed: []string{}}
+	for _, library := range searchPath {
+		found, err := r.containsStep(library, id, log)
+		if err != nil {
+			return LibraryResolution{}, err
+		}
+		if !found {
+			continue
+		}
+		if resolution.Library == "" {
+			resolution.Library = library
+		} else {
+			resolution.Shadowed = append(resolution.Shadowed, library)
+		}
+	}
+	if resolution.Library == "" {
+		return LibraryResolution{}, fmt.Errorf("none of the libraries of the search path (%s) contain step %s", strings.Join(searchPath, ", "), id)
+	}
+	return resolution, nil
+}
+
+func (r *LibraryResolver) containsStep(library, id string, log Logger) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	steps, ok := r.steps[library]
+	if !ok {
+		if err := SetupLibraryWithReader(library, r.reader, log); err != nil {
+			return false, fmt.Errorf("setup %s: %w", library, err)
+		}
+		collection, err := ReadStepSpec(library)
+		if err != nil {
+			return false, fmt.Errorf("read spec of %s: %w", library, err)
+		}
+		steps = make(map[string]bool, len(collection.Steps))
+		for stepID := range collection.Steps {
+			steps[stepID] = true
+		}
+		r.steps[library] = steps
+	}
+	return steps[id], nil
+}
@@ -0,0 +1,164 @@
+package stepman
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/go-utils/pointers"
+	"github.com/bitrise-io/stepman/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testPrivateLibrary = InventoryURIPrefix + "https://private.example.com"
+	testTeamLibrary    = InventoryURIPrefix + "https://team.example.com"
+	testPublicLibrary  = InventoryURIPrefix + "https://public.example.com"
+)
+
+// federatedInventoryReader serves the given steps of each inventory.
+type federatedInventoryReader struct {
+	steps map[string][]string
+}
+
+func (r federatedInventoryReader) UpdatedAt(string, Logger) (time.Time, error) {
+	return time.Date(2026, 5, 15, 12, 0, 0, 0, time.UTC), nil
+}
+
+func (r federatedInventoryReader) StepCollection(inventoryURL string, _ Logger) (models.StepCollectionModel, error) {
+	collection := models.StepCollectionModel{
+		FormatVersion: "1.0.0",
+		SteplibSource: inventoryURL,
+		Steps:         models.StepHash{},
+	}
+	for _, id := range r.steps[inventoryURL] {
+		step := models.StepModel{
+			Title:  pointers.NewStringPtr(id),
+			Source: &models.StepSourceModel{Git: inventoryURL + "/" + id + ".git", Commit: "abc"},
+		}
+		collection.Steps[id] = models.StepGroupModel{
+			LatestVersionNumber: "1.0.0",
+			Versions:            map[string]models.StepModel{"1.0.0": step},
+		}
+	}
+	return collection, nil
+}
+
+func newFederatedResolver(t *testing.T) *LibraryResolver {
+	t.Setenv("HOME", t.TempDir())
+	return NewLibraryResolver(federatedInventoryReader{steps: map[string][]string{
+		strings.TrimPrefix(testPrivateLibrary, InventoryURIPrefix): {"deploy"},
+		strings.TrimPrefix(testTeamLibrary, InventoryURIPrefix):    {"script", "deploy"},
+		strings.TrimPrefix(testPublicLibrary, InventoryURIPrefix):  {"script", "deploy", "git-clone"},
+	}})
+}
+
+func TestSearchPath(t *testing.T) {
+	cases := map[string]struct {
+		env            string
+		defaultLibrary string
+		want           []string
+	}{
+		"not configured": {
+			defaultLibrary: testPublicLibrary,
+			want:           nil,
+		},
+		"default appended": {
+			env:            testPrivateLibrary + "," + testTeamLibrary,
+			defaultLibrary: testPublicLibrary,
+			want:           []string{testPrivateLibrary, testTeamLibrary, testPublicLibrary},
+		},
+		"default already on the path": {
+			env:            testPublicLibrary + ", " + testPrivateLibrary,
+			defaultLibrary: testPublicLibrary,
+			want:           []string{testPublicLibrary, testPrivateLibrary},
+		},
+		"duplicates and blanks dropped": {
+			env:  testPrivateLibrary + ",," + testPrivateLibrary,
+			want: []string{testPrivateLibrary},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(SearchPathEnvKey, tc.env)
+			assert.Equal(t, tc.want, SearchPath(tc.defaultLibrary))
+		})
+	}
+}
+
+func TestLibraryResolver_Resolve(t *testing.T) {
+	resolver := newFederatedResolver(t)
+	searchPath := []string{testPrivateLibrary, testTeamLibrary, testPublicLibrary}
+
+	cases := map[string]struct {
+		id      string
+		want    string
+		wantErr string
+	}{
+		"first library wins": {
+			id:   "deploy",
+			want: testPrivateLibrary,
+		},
+		"falls through to a later library": {
+			id:   "script",
+			want: testTeamLibrary,
+		},
+		"last layer": {
+			id:   "git-clone",
+			want: testPublicLibrary,
+		},
+		"not found": {
+			id:      "missing",
+			wantErr: "none of the libraries of the search path (" + strings.Join(searchPath, ", ") + ") contain step missing",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			library, err := resolver.Resolve(searchPath, tc.id, testLogger{t})
+			if tc.wantErr != "" {
+				require.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, library)
+		})
+	}
+
+	// The libraries read so far are answered from memory.
+	require.NoError(t, os.RemoveAll(GetStepmanDirPath()))
+	library, err := resolver.Resolve(searchPath, "script", testLogger{t})
+	require.NoError(t, err)
+	assert.Equal(t, testTeamLibrary, library)
+	assert.NoDirExists(t, GetStepmanDirPath(), "no library set up again")
+}
+
+func TestLibraryResolver_Explain(t *testing.T) {
+	resolver := newFederatedResolver(t)
+	searchPath := []string{testPrivateLibrary, testTeamLibrary, testPublicLibrary}
+
+	resolution, err := resolver.Explain(searchPath, "deploy", testLogger{t})
+	require.NoError(t, err)
+	assert.Equal(t, LibraryResolution{
+		ID:         "deploy",
+		SearchPath: searchPath,
+		Library:    testPrivateLibrary,
+		Shadowed:   []string{testTeamLibrary, testPublicLibrary},
+	}, resolution)
+
+	resolution, err = resolver.Explain(searchPath, "git-clone", testLogger{t})
+	require.NoError(t, err)
+	assert.Equal(t, testPublicLibrary, resolution.Library)
+	assert.Empty(t, resolution.Shadowed)
+
+	// The winning library is recorded in the step info.
+	stepInfo, err := QueryStepInfoFromLibrary(resolution.Library, "git-clone", "", testLogger{t})
+	require.NoError(t, err)
+	assert.Equal(t, testPublicLibrary, stepInfo.Library)
+
+	_, err = resolver.Explain(searchPath, "missing", testLogger{t})
+	require.Error(t, err)
+}
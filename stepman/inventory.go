@@ -0,0 +1,181 @@
+package stepman
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-utils/fileutil"
+	"github.com/bitrise-io/stepman/models"
+	"gopkg.in/yaml.v2"
+)
+
+// InventoryURIPrefix marks a library URI that points to a V2 inventory instead
+// of a steplib git repository, for example
+// inventory+https://steplib.example.com. Such a library is set up by fetching
+// the inventory, without cloning the steplib or parsing its step.yml files.
+const InventoryURIPrefix = "inventory+"
+
+// InventoryReader reads the V2 inventory of a library set up from one. The
+// steplibrary package implements it (see steplibrary.NewInventoryReader);
+// stepman can't import that package, so callers setting up inventory libraries
+// pass it to SetupLibraryWithReader and UpdateLibraryWithReader.
+type InventoryReader interface {
+	// UpdatedAt returns the updated_at of the inventory's meta.json.
+	UpdatedAt(inventoryURL string, log Logger) (time.Time, error)
+	// StepCollection builds the library's spec from the inventory. Its
+	// GeneratedAtTimeStamp is the inventory's updated_at.
+	StepCollection(inventoryURL string, log Logger) (models.StepCollectionModel, error)
+}
+
+// IsInventoryURI reports whether libraryURI points to a V2 inventory.
+func IsInventoryURI(libraryURI string) bool {
+	return strings.HasPrefix(libraryURI, InventoryURIPrefix)
+}
+
+// InventoryURL returns the inventory base URL of an inventory library URI.
+func InventoryURL(libraryURI string) string {
+	return strings.TrimPrefix(libraryURI, InventoryURIPrefix)
+}
+
+func checkInventoryReader(reader InventoryReader) error {
+	if reader == nil {
+		return errors.New("no inventory reader, set up inventory libraries with SetupLibraryWithReader")
+	}
+	return nil
+}
+
+func setupInventoryLibrary(route SteplibRoute, reader InventoryReader, log Logger) error {
+	if err := checkInventoryReader(reader); err != nil {
+		return err
+	}
+
+	collection, err := reader.StepCollection(InventoryURL(route.SteplibURI), log)
+	if err != nil {
+		return fmt.Errorf("failed to read inventory, error: %s", err)
+	}
+
+	return writeInventoryLibrary(route, collection)
+}
+
+// updateInventoryLibrary re-builds the library only if the inventory's
+// updated_at differs from the one the library was set up from.
+func updateInventoryLibrary(route SteplibRoute, reader InventoryReader, log Logger) error {
+	if err := checkInventoryReader(reader); err != nil {
+		return err
+	}
+
+	updatedAt, err := reader.UpdatedAt(InventoryURL(route.SteplibURI), log)
+	if err != nil {
+		return fmt.Errorf("failed to read inventory meta, error: %s", err)
+	}
+
+	if collection, err := ReadStepSpec(route.SteplibURI); err != nil {
+		log.Warnf("Failed to read spec of library (%s), re-building it, error: %s", route.SteplibURI, err)
+	} else if collection.GeneratedAtTimeStamp == updatedAt.Unix() {
+		log.Debugf("Library (%s) is up to date", route.SteplibURI)
+		return nil
+	}
+
+	return setupInventoryLibrary(route, reader, log)
+}
+
+// writeInventoryLibrary writes the spec of an inventory library, along with the
+// steplib.yml, step-info.yml and step.yml files a steplib clone would have, so
+// that everything reading the library dir (step activation, step-info) works
+// the same as with a cloned library. The library is built in a staging dir
+// and moved into place once complete, so a failed or interrupted rebuild
+// leaves the previous one intact.
+func writeInventoryLibrary(route SteplibRoute, collection models.StepCollectionModel) (err error) {
+	routeDir := filepath.Join(GetCollectionsDirPath(), route.FolderAlias)
+	if err := os.MkdirAll(routeDir, 0777); err != nil {
+		return err
+	}
+	stagingDir, err := os.MkdirTemp(routeDir, "staging-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if removeErr := os.RemoveAll(stagingDir); removeErr != nil && err == nil {
+			err = removeErr
+		}
+	}()
+
+	staging := SteplibRoute{SteplibURI: route.SteplibURI, FolderAlias: filepath.Join(route.FolderAlias, filepath.Base(stagingDir))}
+	if err := buildInventoryLibrary(staging, collection); err != nil {
+		return err
+	}
+	return moveInventoryLibrary(staging, route)
+}
+
+// buildInventoryLibrary writes the files of an inventory library to route.
+func buildInventoryLibrary(route SteplibRoute, collection models.StepCollectionModel) error {
+	templateCollection := collection
+	templateCollection.Steps = models.StepHash{}
+	if err := writeYAMLToFile(GetStepCollectionSpecPath(route), templateCollection); err != nil {
+		return err
+	}
+
+	for stepID, stepGroup := range collection.Steps {
+		// The library dir has no assets, the asset URLs point to the inventory.
+		info := stepGroup.Info
+		info.AssetURLs = nil
+		if err := writeYAMLToFile(GetStepGlobalInfoPath(route, stepID), info); err != nil {
+			return err
+		}
+
+		for version, step := range stepGroup.Versions {
+			step.AssetURLs = nil
+			pth := filepath.Join(GetStepCollectionDirPath(route, stepID, version), "step.yml")
+			if err := writeYAMLToFile(pth, step); err != nil {
+				return err
+			}
+		}
+	}
+
+	return writeStepSpec(collection, route)
+}
+
+// moveInventoryLibrary replaces the library of route with the one built at
+// staging: the library dir is swapped with two renames, then each spec file is
+// renamed over the previous one.
+func moveInventoryLibrary(staging, route SteplibRoute) error {
+	libraryPth := GetLibraryBaseDirPath(route)
+	previousPth := filepath.Join(GetCollectionsDirPath(), staging.FolderAlias, "previous")
+	if err := os.Rename(libraryPth, previousPth); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.Rename(GetLibraryBaseDirPath(staging), libraryPth); err != nil {
+		// Best-effort restore of the previous library; the rename error is
+		// what matters.
+		_ = os.Rename(previousPth, libraryPth)
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(GetStepSpecPath(route)), 0777); err != nil {
+		return err
+	}
+	for _, specPath := range []func(SteplibRoute) string{GetStepSpecPath, GetSlimStepSpecPath} {
+		if err := os.Rename(specPath(staging), specPath(route)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeYAMLToFile(pth string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(pth), 0777); err != nil {
+		return err
+	}
+
+	bytes, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return fileutil.WriteBytesToFile(pth, bytes)
+}
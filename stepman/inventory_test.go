@@ -0,0 +1,100 @@
+package stepman
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/go-utils/pointers"
+	"github.com/bitrise-io/stepman/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testLogger struct{ t *testing.T }
+
+func (l testLogger) Debugf(format string, v ...any) { l.t.Logf("DEBUG "+format, v...) }
+func (l testLogger) Infof(format string, v ...any)  { l.t.Logf("INFO "+format, v...) }
+func (l testLogger) Warnf(format string, v ...any)  { l.t.Logf("WARN "+format, v...) }
+func (l testLogger) Errorf(format string, v ...any) { l.t.Logf("ERROR "+format, v...) }
+
+type fakeInventoryReader struct {
+	updatedAt       time.Time
+	collectionCalls int
+}
+
+func (r *fakeInventoryReader) UpdatedAt(string, Logger) (time.Time, error) {
+	return r.updatedAt, nil
+}
+
+func (r *fakeInventoryReader) StepCollection(inventoryURL string, _ Logger) (models.StepCollectionModel, error) {
+	r.collectionCalls++
+	step := models.StepModel{
+		Title:     pointers.NewStringPtr("Script"),
+		Source:    &models.StepSourceModel{Git: "https://github.com/bitrise-steplib/steps-script.git", Commit: "abc"},
+		AssetURLs: map[string]string{"icon.svg": inventoryURL + "/v2/steps/script/assets/icon.svg"},
+	}
+	return models.StepCollectionModel{
+		FormatVersion:        "1.0.0",
+		GeneratedAtTimeStamp: r.updatedAt.Unix(),
+		SteplibSource:        "https://github.com/bitrise-io/bitrise-steplib.git",
+		Steps: models.StepHash{
+			"script": {
+				Info:                models.StepGroupInfoModel{Maintainer: "bitrise", AssetURLs: step.AssetURLs},
+				LatestVersionNumber: "1.0.0",
+				Versions:            map[string]models.StepModel{"1.0.0": step},
+			},
+		},
+	}, nil
+}
+
+func TestSetupLibrary_inventory(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	reader := &fakeInventoryReader{updatedAt: time.Date(2026, 5, 15, 12, 0, 0, 0, time.UTC)}
+
+	const libraryURI = InventoryURIPrefix + "https://steplib.example.com"
+	require.ErrorContains(t, SetupLibrary(libraryURI, testLogger{t}), "no inventory reader")
+	require.NoError(t, SetupLibraryWithReader(libraryURI, reader, testLogger{t}))
+
+	route, found := ReadRoute(libraryURI)
+	require.True(t, found)
+	spec, err := ReadStepSpec(libraryURI)
+	require.NoError(t, err)
+	assert.Equal(t, reader.updatedAt.Unix(), spec.GeneratedAtTimeStamp)
+	assert.Contains(t, spec.Steps, "script")
+
+	// The library dir looks like a steplib clone, without asset URLs.
+	step, err := ParseStepDefinition(filepath.Join(GetStepCollectionDirPath(route, "script", "1.0.0"), "step.yml"), false)
+	require.NoError(t, err)
+	assert.Equal(t, "Script", *step.Title)
+	assert.Empty(t, step.AssetURLs)
+	info, err := os.ReadFile(GetStepGlobalInfoPath(route, "script"))
+	require.NoError(t, err)
+	assert.Equal(t, "maintainer: bitrise\n", string(info))
+	_, err = ParseStepCollection(GetStepCollectionSpecPath(route))
+	require.NoError(t, err)
+
+	stepInfo, err := QueryStepInfoFromLibrary(libraryURI, "script", "1", testLogger{t})
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", stepInfo.Version)
+
+	_, err = UpdateLibraryWithReader(libraryURI, reader, testLogger{t})
+	require.NoError(t, err)
+	assert.Equal(t, 1, reader.collectionCalls, "inventory not changed")
+
+	reader.updatedAt = reader.updatedAt.Add(time.Hour)
+	spec, err = UpdateLibraryWithReader(libraryURI, reader, testLogger{t})
+	require.NoError(t, err)
+	assert.Equal(t, 2, reader.collectionCalls, "inventory changed")
+	assert.Equal(t, reader.updatedAt.Unix(), spec.GeneratedAtTimeStamp)
+
+	// The rebuild is staged and moved into place, without leftovers.
+	entries, err := os.ReadDir(filepath.Join(GetCollectionsDirPath(), route.FolderAlias))
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"collection", "spec"}, names)
+}
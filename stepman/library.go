@@ -10,6 +10,7 @@ import (
 	"github.com/bitrise-io/go-utils/command/git"
 	"github.com/bitrise-io/go-utils/pathutil"
 	"github.com/bitrise-io/go-utils/retry"
+	"github.com/bitrise-io/stepman/internal/httpconfig"
 	"github.com/bitrise-io/stepman/models"
 )
 
@@ -25,6 +26,12 @@ type Logger interface {
 
 // SetupLibrary ...
 func SetupLibrary(libraryURI string, log Logger) error {
+	return SetupLibraryWithReader(libraryURI, nil, log)
+}
+
+// SetupLibraryWithReader is SetupLibrary which also sets up inventory
+// libraries (see InventoryURIPrefix), reading their inventory with reader.
+func SetupLibraryWithReader(libraryURI string, reader InventoryReader, log Logger) error {
 	if libraryURI == "" {
 		return fmt.Errorf("no step library specified")
 	}
@@ -52,6 +59,20 @@ func SetupLibrary(libraryURI string, log Logger) error {
 	}()
 
 	// Setup
+	if IsInventoryURI(libraryURI) {
+		if err := setupInventoryLibrary(route, reader, log); err != nil {
+			return fmt.Errorf("failed to setup library (%s) from its inventory, error: %s", libraryURI, err)
+		}
+
+		if err := AddRoute(route); err != nil {
+			return fmt.Errorf("failed to add routing, error: %s", err)
+		}
+
+		isSuccess = true
+
+		return nil
+	}
+
 	isLocalLibrary := strings.HasPrefix(libraryURI, filePathPrefix)
 
 	pth := GetLibraryBaseDirPath(route)
@@ -61,7 +82,7 @@ func SetupLibrary(libraryURI string, log Logger) error {
 			if err != nil {
 				return err
 			}
-			return repo.Clone(libraryURI).Run()
+			return httpconfig.ConfigureGit(repo.Clone(libraryURI), libraryURI).Run()
 		}); err != nil {
 			return fmt.Errorf("failed to clone library (%s), error: %s", libraryURI, err)
 		}
@@ -96,6 +117,12 @@ func SetupLibrary(libraryURI string, log Logger) error {
 
 // UpdateLibrary ...
 func UpdateLibrary(libraryURI string, log Logger) (models.StepCollectionModel, error) {
+	return UpdateLibraryWithReader(libraryURI, nil, log)
+}
+
+// UpdateLibraryWithReader is UpdateLibrary which also updates inventory
+// libraries (see InventoryURIPrefix), reading their inventory with reader.
+func UpdateLibraryWithReader(libraryURI string, reader InventoryReader, log Logger) (models.StepCollectionModel, error) {
 	route, found := ReadRoute(libraryURI)
 	if !found {
 		if err := CleanupDanglingLibrary(libraryURI); err != nil {
@@ -104,6 +131,14 @@ func UpdateLibrary(libraryURI string, log Logger) (models.StepCollectionModel, e
 		return models.StepCollectionModel{}, fmt.Errorf("no route found for library: %s", libraryURI)
 	}
 
+	if IsInventoryURI(libraryURI) {
+		if err := updateInventoryLibrary(route, reader, log); err != nil {
+			return models.StepCollectionModel{}, fmt.Errorf("failed to update library (%s) from its inventory, error: %s", libraryURI, err)
+		}
+
+		return ReadStepSpec(libraryURI)
+	}
+
 	isLocalLibrary := strings.HasPrefix(libraryURI, filePathPrefix)
 
 	if isLocalLibrary {
@@ -127,7 +162,7 @@ func UpdateLibrary(libraryURI string, log Logger) (models.StepCollectionModel, e
 			if err != nil {
 				return err
 			}
-			return repo.Pull().Run()
+			return httpconfig.ConfigureGit(repo.Pull(), libraryURI).Run()
 		}); err != nil {
 			return models.StepCollectionModel{}, fmt.Errorf("failed to pull library (%s), error: %s", libraryURI, err)
 		}
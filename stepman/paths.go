@@ -20,6 +20,8 @@ const (
 	RoutingFilename = "routing.json"
 	// CollectionsDirname ...
 	CollectionsDirname = "step_collections"
+	// InventoryCacheDirname ...
+	InventoryCacheDirname = "inventory_cache"
 )
 
 // SteplibRoute ...
@@ -127,8 +129,10 @@ func AddRoute(route SteplibRoute) error {
 }
 
 // GenerateFolderAlias ...
+// Nanosecond precision keeps the aliases of libraries set up in quick
+// succession, e.g. the libraries of a search path, unique.
 func GenerateFolderAlias() string {
-	return fmt.Sprintf("%v", time.Now().Unix())
+	return fmt.Sprintf("%v", time.Now().UnixNano())
 }
 
 func readRouteMap() (SteplibRoutes, error) {
@@ -232,6 +236,12 @@ func GetCollectionsDirPath() string {
 	return filepath.Join(GetStepmanDirPath(), CollectionsDirname)
 }
 
+// GetInventoryCacheDirPath ...
+// Root of the on-disk cache of V2 inventory responses.
+func GetInventoryCacheDirPath() string {
+	return filepath.Join(GetStepmanDirPath(), InventoryCacheDirname)
+}
+
 func getRoutingFilePath() string {
 	return filepath.Join(GetStepmanDirPath(), RoutingFilename)
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/bitrise-io/go-utils/command/git"
 	"github.com/bitrise-io/go-utils/pathutil"
 	"github.com/bitrise-io/go-utils/retry"
+	"github.com/bitrise-io/stepman/internal/httpconfig"
 	"github.com/bitrise-io/stepman/models"
 )
 
@@ -27,7 +28,7 @@ func QueryStepInfoFromGit(gitURL, tagOrBranch string) (models.StepInfoModel, err
 		if err != nil {
 			return err
 		}
-		return repo.CloneTagOrBranch(gitURL, tagOrBranch).Run()
+		return httpconfig.ConfigureGit(repo.CloneTagOrBranch(gitURL, tagOrBranch), gitURL).Run()
 	}); err != nil {
 		return models.StepInfoModel{}, fmt.Errorf("query git step info: clone %s: %s", gitURL, err)
 	}
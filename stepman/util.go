@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"path"
 	"path/filepath"
@@ -17,6 +19,7 @@ import (
 	"github.com/bitrise-io/go-utils/pathutil"
 	"github.com/bitrise-io/go-utils/retry"
 	"github.com/bitrise-io/go-utils/urlutil"
+	"github.com/bitrise-io/stepman/internal/httpconfig"
 	"github.com/bitrise-io/stepman/models"
 	version "github.com/hashicorp/go-version"
 	"gopkg.in/yaml.v2"
@@ -124,11 +127,18 @@ func DownloadStep(collectionURI string, collection models.StepCollectionModel, i
 		return nil
 	}
 
+	return DownloadStepSource(downloadLocations, id, version, commithash, stepPth, log)
+}
+
+// DownloadStepSource downloads a step version's source into stepPth, trying
+// downloadLocations (see models.StepDownloadLocations) in order until one
+// succeeds. A git location must check out commithash at the version tag.
+func DownloadStepSource(downloadLocations []models.DownloadLocationModel, id, version, commithash, stepPth string, log Logger) error {
 	for _, downloadLocation := range downloadLocations {
 		switch downloadLocation.Type {
 		case "zip":
 			err := retry.Times(2).Wait(3 * time.Second).Try(func(attempt uint) error {
-				return command.DownloadAndUnZIP(downloadLocation.Src, stepPth)
+				return downloadAndUnZIP(downloadLocation.Src, stepPth)
 			})
 
 			if err != nil {
@@ -143,7 +153,7 @@ func DownloadStep(collectionURI string, collection models.StepCollectionModel, i
 					return err
 				}
 
-				if err := repo.CloneTagOrBranch(downloadLocation.Src, version).Run(); err != nil {
+				if err := httpconfig.ConfigureGit(repo.CloneTagOrBranch(downloadLocation.Src, version), downloadLocation.Src).Run(); err != nil {
 					return err
 				}
 
@@ -171,26 +181,85 @@ func DownloadStep(collectionURI string, collection models.StepCollectionModel, i
 	return errors.New("failed to download step")
 }
 
+// downloadAndUnZIP is command.DownloadAndUnZIP through stepman's shared HTTP
+// transport, authenticated with the default credentials of url's host.
+func downloadAndUnZIP(url, pth string) (err error) {
+	tmpDir, err := pathutil.NormalizedOSTempDirPath("__step_zip__")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if removeErr := os.RemoveAll(tmpDir); removeErr != nil {
+			err = errors.Join(err, removeErr)
+		}
+	}()
+
+	resp, err := httpconfig.NewRetryableClient(nil).StandardClient().Get(url)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			err = errors.Join(err, closeErr)
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %s: status %d", url, resp.StatusCode)
+	}
+
+	zipPth := filepath.Join(tmpDir, "step.zip")
+	zipFile, err := os.Create(zipPth)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(zipFile, resp.Body); err != nil {
+		return errors.Join(err, zipFile.Close())
+	}
+	if err := zipFile.Close(); err != nil {
+		return err
+	}
+
+	return command.UnZIP(zipPth, pth)
+}
+
+// addStepVersionToStepGroup adds a step version to stepGroup, moving its latest
+// version if needed. A pre-release is never the latest, it only resolves when
+// pinned, so a step without releases has no latest version. A yanked version
+// (per stepGroup.Info) is only the latest while every release is yanked.
 func addStepVersionToStepGroup(step models.StepModel, stepVersionStr string, stepGroup models.StepGroupModel) (models.StepGroupModel, error) {
+	stepVersion, err := version.NewVersion(stepVersionStr)
+	if err != nil {
+		return models.StepGroupModel{}, err
+	}
+	stepGroup.Versions[stepVersionStr] = step
+	if stepVersion.Prerelease() != "" {
+		return stepGroup, nil
+	}
+
 	if stepGroup.LatestVersionNumber != "" {
 		latestVersion, err := version.NewVersion(stepGroup.LatestVersionNumber)
 		if err != nil {
 			return models.StepGroupModel{}, err
 		}
-		stepVersion, err := version.NewVersion(stepVersionStr)
-		if err != nil {
-			return models.StepGroupModel{}, err
-		}
-		if latestVersion.LessThan(stepVersion) {
+		rank, latestRank := latestRank(stepGroup, stepVersion), latestRank(stepGroup, latestVersion)
+		if rank == latestRank && latestVersion.LessThan(stepVersion) || rank > latestRank {
 			stepGroup.LatestVersionNumber = stepVersionStr
 		}
 	} else {
 		stepGroup.LatestVersionNumber = stepVersionStr
 	}
-	stepGroup.Versions[stepVersionStr] = step
 	return stepGroup, nil
 }
 
+// latestRank orders releases by their preference as the latest version: not
+// yanked ones over yanked ones.
+func latestRank(stepGroup models.StepGroupModel, v *version.Version) int {
+	if _, yanked := stepGroup.Info.YankedVersions[v.Original()]; yanked {
+		return 0
+	}
+	return 1
+}
+
 func parseStepCollection(route SteplibRoute, templateCollection models.StepCollectionModel) (models.StepCollectionModel, error) {
 	collection := models.StepCollectionModel{
 		FormatVersion:         templateCollection.FormatVersion,
@@ -236,6 +305,7 @@ func parseStepCollection(route SteplibRoute, templateCollection models.StepColle
 					stepGroupInfo.RemovalDate = deprecationInfo.RemovalDate
 					stepGroupInfo.DeprecateNotes = deprecationInfo.DeprecateNotes
 					stepGroupInfo.Maintainer = deprecationInfo.Maintainer
+					stepGroupInfo.YankedVersions = deprecationInfo.YankedVersions
 				}
 
 				// Check for assets - STEP_SPEC_DIR/steps/step-id/assets
@@ -277,13 +347,12 @@ func parseStepCollection(route SteplibRoute, templateCollection models.StepColle
 						LatestVersionNumber: "",
 					}
 				}
+				stepGroup.Info = stepGroupInfo
 				stepGroup, err = addStepVersionToStepGroup(step, stepVersion, stepGroup)
 				if err != nil {
 					return err
 				}
 
-				stepGroup.Info = stepGroupInfo
-
 				collection.Steps[stepID] = stepGroup
 			}
 		}
@@ -308,9 +377,14 @@ func generateSlimStepModel(collection models.StepCollectionModel) models.StepCol
 	}
 
 	for stepID, stepGroupModel := range collection.Steps {
+		versions := map[string]models.StepModel{}
+		// A step with pre-releases only has no latest version.
+		if latest, found := stepGroupModel.LatestVersion(); found {
+			versions[stepGroupModel.LatestVersionNumber] = latest
+		}
 		slimCollection.Steps[stepID] = models.StepGroupModel{
 			Info:                stepGroupModel.Info,
-			Versions:            map[string]models.StepModel{stepGroupModel.LatestVersionNumber: stepGroupModel.Versions[stepGroupModel.LatestVersionNumber]},
+			Versions:            versions,
 			LatestVersionNumber: stepGroupModel.LatestVersionNumber,
 		}
 	}
@@ -320,6 +394,16 @@ func generateSlimStepModel(collection models.StepCollectionModel) models.StepCol
 
 // WriteStepSpecToFile ...
 func WriteStepSpecToFile(templateCollection models.StepCollectionModel, route SteplibRoute) error {
+	collection, err := parseStepCollection(route, templateCollection)
+	if err != nil {
+		return err
+	}
+
+	return writeStepSpec(collection, route)
+}
+
+// writeStepSpec writes collection to the spec.json and slim-spec.json of route.
+func writeStepSpec(collection models.StepCollectionModel, route SteplibRoute) error {
 	pth := GetStepSpecPath(route)
 
 	if exist, err := pathutil.IsPathExists(pth); err != nil {
@@ -337,11 +421,6 @@ func WriteStepSpecToFile(templateCollection models.StepCollectionModel, route St
 		}
 	}
 
-	collection, err := parseStepCollection(route, templateCollection)
-	if err != nil {
-		return err
-	}
-
 	bytes, err := json.MarshalIndent(collection, "", "\t")
 	if err != nil {
 		return err
@@ -353,9 +432,6 @@ func WriteStepSpecToFile(templateCollection models.StepCollectionModel, route St
 
 	pth = GetSlimStepSpecPath(route)
 	slimCollection := generateSlimStepModel(collection)
-	if err != nil {
-		return err
-	}
 
 	bytes, err = json.MarshalIndent(slimCollection, "", "\t")
 	if err != nil {
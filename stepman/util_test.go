@@ -28,6 +28,36 @@ func TestAddStepVersionToStepGroup(t *testing.T) {
 	require.Equal(t, nil, err)
 	require.Equal(t, 3, len(group.Versions))
 	require.Equal(t, "2.1.0", group.LatestVersionNumber)
+
+	group, err = addStepVersionToStepGroup(step, "3.0.0-beta.1", group)
+	require.NoError(t, err)
+	require.Equal(t, 4, len(group.Versions))
+	require.Equal(t, "2.1.0", group.LatestVersionNumber, "a pre-release doesn't move latest")
+
+	preReleasesOnly := models.StepGroupModel{Versions: map[string]models.StepModel{}}
+	preReleasesOnly, err = addStepVersionToStepGroup(step, "1.0.0-beta.1", preReleasesOnly)
+	require.NoError(t, err)
+	preReleasesOnly, err = addStepVersionToStepGroup(step, "1.0.0-rc.1", preReleasesOnly)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(preReleasesOnly.Versions))
+	require.Equal(t, "", preReleasesOnly.LatestVersionNumber, "pre-releases are never the latest")
+	preReleasesOnly, err = addStepVersionToStepGroup(step, "0.9.0", preReleasesOnly)
+	require.NoError(t, err)
+	require.Equal(t, "0.9.0", preReleasesOnly.LatestVersionNumber, "the first release is the latest")
+
+	withYanked := models.StepGroupModel{
+		Versions: map[string]models.StepModel{},
+		Info:     models.StepGroupInfoModel{YankedVersions: map[string]string{"1.1.0": "broken", "1.2.0": "broken"}},
+	}
+	withYanked, err = addStepVersionToStepGroup(step, "1.1.0", withYanked)
+	require.NoError(t, err)
+	require.Equal(t, "1.1.0", withYanked.LatestVersionNumber, "yanked version while every version is yanked")
+	withYanked, err = addStepVersionToStepGroup(step, "1.0.0", withYanked)
+	require.NoError(t, err)
+	require.Equal(t, "1.0.0", withYanked.LatestVersionNumber, "a not yanked version replaces a yanked one")
+	withYanked, err = addStepVersionToStepGroup(step, "1.2.0", withYanked)
+	require.NoError(t, err)
+	require.Equal(t, "1.0.0", withYanked.LatestVersionNumber, "a yanked version doesn't move latest")
 }
 
 func Test_parseStepModel(t *testing.T) {
@@ -13,7 +13,6 @@ import (
 
 	"github.com/bitrise-io/go-utils/command"
 	"github.com/bitrise-io/go-utils/pathutil"
-	"github.com/bitrise-io/go-utils/retry"
 	"github.com/bitrise-io/stepman/models"
 	"github.com/bitrise-io/stepman/stepid"
 	"github.com/bitrise-io/stepman/stepman"
@@ -214,13 +213,8 @@ func (toolkit GoToolkit) Install() (InstallResult, error) {
 	goArchiveDownloadPath := filepath.Join(goTmpDirPath, localFileName)
 
 	toolkit.logger.Infof("=> Downloading ...")
-	downloadErr := retry.Times(2).Wait(5 * time.Second).Try(func(attempt uint) error {
-		if attempt > 0 {
-			toolkit.logger.Warnf("==> Download failed, retrying ...")
-		}
-		return downloadFile(downloadURL, goArchiveDownloadPath)
-	})
-	if downloadErr != nil {
+	// downloadFile retries by the shared HTTP config.
+	if downloadErr := downloadFile(downloadURL, goArchiveDownloadPath); downloadErr != nil {
 		return InstallResult{InstallDuration: time.Since(start)}, fmt.Errorf("download Go toolkit: %s", downloadErr)
 	}
 
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/bitrise-io/stepman/internal/httpconfig"
 	"github.com/bitrise-io/stepman/models"
 	"github.com/bitrise-io/stepman/stepid"
 	"github.com/bitrise-io/stepman/stepman"
@@ -103,6 +104,9 @@ func toolkitDir(toolkitName string) string {
 	return filepath.Join(userHome, ".bitrise", "toolkits", toolkitName)
 }
 
+// downloadFile downloads url to targetPath. The request is retried by the
+// shared HTTP config (see httpconfig.NewRetryableClient), so callers must not
+// retry it again.
 func downloadFile(url string, targetPath string) error {
 	outFile, err := os.Create(targetPath)
 	if err != nil {
@@ -115,7 +119,7 @@ func downloadFile(url string, targetPath string) error {
 		}
 	}()
 
-	resp, err := http.Get(url)
+	resp, err := httpconfig.NewRetryableClient(nil).StandardClient().Get(url)
 	if err != nil {
 		return fmt.Errorf("downloading %s failed: %s", url, err)
 	}